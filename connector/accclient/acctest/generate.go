@@ -0,0 +1,151 @@
+// Copyright (c) 2021 Acronis International GmbH
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package acctest
+
+import (
+	"fmt"
+
+	"github.com/acronis/acronis-cyber-cloud-go-sample-connector/connector/accclient"
+)
+
+// Dataset describes the shape of a synthetic tenant hierarchy created by Generate
+type Dataset struct {
+	// Depth is the number of tenant levels below the root tenant. Tenants of the last level are customers,
+	// tenants of the levels above are partners.
+	Depth int
+
+	// FanOut is the number of child tenants of the root tenant and of each partner
+	FanOut int
+
+	// OfferingItemsPerTenant is the number of enabled offering items of each generated tenant
+	OfferingItemsPerTenant int
+
+	// UsersPerTenant is the number of users of each generated tenant
+	UsersPerTenant int
+
+	// AccessPoliciesPerUser is the number of roles granted to each user on its tenant, at least one
+	AccessPoliciesPerUser int
+}
+
+// Tenants returns the number of tenants generated for the dataset
+func (d Dataset) Tenants() int {
+	total, level := 0, 1
+	for i := 0; i < d.Depth; i++ {
+		level *= d.FanOut
+		total += level
+	}
+	return total
+}
+
+// GeneratedDataset holds the objects created by Generate
+type GeneratedDataset struct {
+	TenantIDs      []string // in creation order, parents before children
+	UserIDs        []string
+	OfferingItems  int
+	AccessPolicies int
+}
+
+// extraRoles are granted to users in addition to the admin role of their tenant kind
+var extraRoles = []accclient.RoleIDEnum{
+	accclient.RoleIDReadOnlyAdmin,
+	accclient.RoleIDBackupUser,
+	accclient.RoleIDSyncShareUser,
+	accclient.RoleIDMonitoringAdmin,
+	accclient.RoleIDBackupAdmin,
+	accclient.RoleIDSyncShareAdmin,
+}
+
+// Generate creates a synthetic tenant hierarchy under RootTenantID, e.g. for load testing.
+// Depth 3 with fan-out 46 gives about 100k tenants, with 5 users per tenant about 500k users.
+func (s *Server) Generate(dataset Dataset) GeneratedDataset {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// offering items of the same name share the application, like offering items of a real application
+	applicationIDs := make([]string, dataset.OfferingItemsPerTenant)
+	for i := range applicationIDs {
+		applicationIDs[i] = newUUID()
+	}
+
+	generated := GeneratedDataset{
+		TenantIDs: make([]string, 0, dataset.Tenants()),
+		UserIDs:   make([]string, 0, dataset.Tenants()*dataset.UsersPerTenant),
+	}
+	parents := []string{s.RootTenantID}
+	for level := 1; level <= dataset.Depth; level++ {
+		kind, adminRole := "partner", accclient.RoleIDPartnerAdmin
+		if level == dataset.Depth {
+			kind, adminRole = "customer", accclient.RoleIDCompanyAdmin
+		}
+
+		var children []string
+		for _, parentID := range parents {
+			for i := 0; i < dataset.FanOut; i++ {
+				tenant := s.addTenant(accclient.Tenant{
+					Name:     fmt.Sprintf("%v %v", kind, len(generated.TenantIDs)+1),
+					ParentID: parentID,
+					Kind:     kind,
+					Enabled:  true,
+				})
+				children = append(children, tenant.ID)
+				generated.TenantIDs = append(generated.TenantIDs, tenant.ID)
+
+				s.generateOfferingItems(tenant, applicationIDs)
+				generated.OfferingItems += len(applicationIDs)
+
+				for u := 0; u < dataset.UsersPerTenant; u++ {
+					user := s.addUser(accclient.User{
+						TenantID: tenant.ID,
+						Login:    fmt.Sprintf("user-%v", len(generated.UserIDs)+1),
+						Enabled:  true,
+					})
+					generated.UserIDs = append(generated.UserIDs, user.ID)
+
+					policies := []accclient.AccessPolicy{{RoleID: adminRole}}
+					for p := 1; p < dataset.AccessPoliciesPerUser && p <= len(extraRoles); p++ {
+						policies = append(policies, accclient.AccessPolicy{RoleID: extraRoles[p-1]})
+					}
+					s.setAccessPolicies(user, policies)
+					generated.AccessPolicies += len(policies)
+				}
+			}
+		}
+		parents = children
+	}
+	return generated
+}
+
+func (s *Server) generateOfferingItems(tenant *accclient.Tenant, applicationIDs []string) {
+	updatedAt := s.now()
+	items := make([]accclient.OfferingItem, len(applicationIDs))
+	for i, applicationID := range applicationIDs {
+		items[i] = accclient.OfferingItem{
+			ApplicationID:   applicationID,
+			Name:            fmt.Sprintf("offering_item_%v", i+1),
+			UsageName:       fmt.Sprintf("offering_item_%v", i+1),
+			TenantID:        tenant.ID,
+			UpdatedAt:       updatedAt,
+			Status:          1,
+			Type:            "count",
+			MeasurementUnit: "quantity",
+		}
+	}
+	s.offeringItems[tenant.ID] = items
+}
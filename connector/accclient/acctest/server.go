@@ -0,0 +1,497 @@
+// Copyright (c) 2021 Acronis International GmbH
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+// Package acctest provides an in-process fake of Acronis Cyber Cloud Platform API for offline testing.
+//
+// The fake server implements the subset of Account Management API used by accclient and the connector:
+// client registration info, client credentials token, tenants, users, access policies, offering items,
+// applications and usages. State is kept in memory and can be inspected and modified by tests at any time,
+// e.g. to simulate changes made in Acronis cloud management portal while the connector is running.
+package acctest
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/clientcredentials"
+
+	"github.com/acronis/acronis-cyber-cloud-go-sample-connector/connector/accclient"
+)
+
+// Default credentials of the API client registered on the fake server
+const (
+	DefaultClientID     = "test-client"
+	DefaultClientSecret = "test-secret"
+)
+
+// apiPrefix is the prefix of all Account Management API paths
+const apiPrefix = "/api/2"
+
+// defaultPageSize is the number of items per page when the limit is not set in list requests
+const defaultPageSize = 100
+
+// maxSnapshots is the number of paged list requests whose results are kept for the next pages,
+// cursors of older requests become invalid
+const maxSnapshots = 16
+
+// Server is a fake Acronis Cyber Cloud Platform API server backed by mutable in-memory state.
+// Use URL as the base URL of the datacenter. Create one by calling NewServer, and Close it when done.
+type Server struct {
+	*httptest.Server
+
+	// ClientID and ClientSecret are the credentials of the API client registered in RootTenantID
+	ClientID     string
+	ClientSecret string
+
+	// RootTenantID is the tenant the API client is registered in, a partner tenant created with the server
+	RootTenantID string
+
+	// clock returns the current time used for timestamps of responses and changes
+	clock func() time.Time
+
+	mu            sync.Mutex
+	tokens        map[string]struct{}
+	tenants       map[string]*accclient.Tenant
+	tenantOrder   []string
+	offeringItems map[string][]accclient.OfferingItem
+	users         map[string]*accclient.User
+	userOrder     []string
+	applications  []accclient.Application
+	usages        []accclient.Usage
+	activations   []string
+	passwords     map[string]string
+	cursors       map[string]cursor
+	snapshots     []*snapshot
+	requestsCount int
+}
+
+// itemKey identifies an item of a list response: ID of tenant or user, or ID of tenant and index of its offering item
+type itemKey struct {
+	id    string
+	index int
+}
+
+// snapshot holds the query of a list request and the keys of the matching items, so that the next pages
+// are requested with "after" param only and served without filtering all items again
+type snapshot struct {
+	query  url.Values
+	limit  int
+	keys   []itemKey
+	afters []string
+}
+
+// cursor points to the next page of a snapshot
+type cursor struct {
+	snapshot *snapshot
+	offset   int
+}
+
+// NewServer starts a fake server with the registered API client and its partner tenant
+func NewServer(options ...func(*Server)) *Server {
+	s := &Server{
+		ClientID:      DefaultClientID,
+		ClientSecret:  DefaultClientSecret,
+		clock:         time.Now,
+		tokens:        make(map[string]struct{}),
+		tenants:       make(map[string]*accclient.Tenant),
+		offeringItems: make(map[string][]accclient.OfferingItem),
+		users:         make(map[string]*accclient.User),
+		passwords:     make(map[string]string),
+		cursors:       make(map[string]cursor),
+	}
+
+	for _, option := range options {
+		option(s)
+	}
+
+	root := s.AddTenant(accclient.Tenant{Name: "Root partner", Kind: "partner", Enabled: true})
+	s.RootTenantID = root.ID
+
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+// WithClock is an optional init function to set the source of current time of the server,
+// e.g. the Now method of a fake clock to control updated_since filtering in tests
+func WithClock(now func() time.Time) func(*Server) {
+	return func(s *Server) {
+		s.clock = now
+	}
+}
+
+// HTTPClient returns a HTTP client authenticated with the credentials of the registered API client
+func (s *Server) HTTPClient() *http.Client {
+	oauth2Config := &clientcredentials.Config{
+		ClientID:     s.ClientID,
+		ClientSecret: s.ClientSecret,
+		TokenURL:     s.URL + apiPrefix + "/idp/token",
+		AuthStyle:    oauth2.AuthStyleInHeader,
+	}
+	return oauth2Config.Client(context.Background())
+}
+
+// NewClient returns an accclient.Client authenticated with the credentials of the registered API client
+func (s *Server) NewClient(options ...accclient.ClientOption) *accclient.Client {
+	return accclient.NewClient(s.HTTPClient(), s.URL, options...)
+}
+
+// RequestsCount returns the number of API requests served, excluding token requests
+func (s *Server) RequestsCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requestsCount
+}
+
+// AddApplication registers the application, returned by GET /applications
+func (s *Server) AddApplication(app accclient.Application) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.applications = append(s.applications, app)
+}
+
+// Usages returns all usages reported by PUT /tenants/usages, in order
+func (s *Server) Usages() []accclient.Usage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]accclient.Usage(nil), s.usages...)
+}
+
+// ActivationEmails returns the IDs of users activation emails were sent to, in order
+func (s *Server) ActivationEmails() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.activations...)
+}
+
+// ===================
+// routing
+// ===================
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.URL.Path, apiPrefix+"/") {
+		writeError(w, http.StatusNotFound, "NotFound", "unknown path "+r.URL.Path)
+		return
+	}
+	segments := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, apiPrefix), "/"), "/")
+
+	if len(segments) == 2 && segments[0] == "idp" && segments[1] == "token" && r.Method == http.MethodPost {
+		s.handleToken(w, r)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.authorized(r) {
+		writeError(w, http.StatusUnauthorized, "Unauthorized", "missing or invalid access token")
+		return
+	}
+	s.requestsCount++
+
+	handler := s.route(r.Method, segments)
+	if handler == nil {
+		writeError(w, http.StatusNotFound, "NotFound", fmt.Sprintf("unknown endpoint %v %v", r.Method, r.URL.Path))
+		return
+	}
+	handler(w, r)
+}
+
+// route returns the handler of the endpoint, nil if there is no such endpoint
+func (s *Server) route(method string, segments []string) http.HandlerFunc {
+	switch {
+	case len(segments) == 2 && segments[0] == "clients" && method == http.MethodGet:
+		return s.withID(segments[1], s.handleGetClient)
+	case len(segments) == 1 && segments[0] == "applications" && method == http.MethodGet:
+		return s.handleGetApplications
+	case len(segments) >= 1 && segments[0] == "tenants":
+		return s.routeTenants(method, segments[1:])
+	case len(segments) >= 1 && segments[0] == "users":
+		return s.routeUsers(method, segments[1:])
+	}
+	return nil
+}
+
+func (s *Server) routeTenants(method string, segments []string) http.HandlerFunc {
+	switch {
+	case len(segments) == 0 && method == http.MethodGet:
+		return s.handleGetTenants
+	case len(segments) == 0 && method == http.MethodPost:
+		return s.handlePostTenant
+	case len(segments) == 1 && segments[0] == "offering_items" && method == http.MethodGet:
+		return s.handleGetOfferingItems
+	case len(segments) == 1 && segments[0] == "usages" && method == http.MethodPut:
+		return s.handlePutUsages
+	case len(segments) == 1 && method == http.MethodGet:
+		return s.withID(segments[0], s.handleGetTenant)
+	case len(segments) == 1 && method == http.MethodPut:
+		return s.withID(segments[0], s.handlePutTenant)
+	case len(segments) == 1 && method == http.MethodDelete:
+		return s.withID(segments[0], s.handleDeleteTenant)
+	case len(segments) == 2 && segments[1] == "offering_items" && method == http.MethodGet:
+		return s.withID(segments[0], s.handleGetTenantOfferingItems)
+	case len(segments) == 2 && segments[1] == "offering_items" && method == http.MethodPut:
+		return s.withID(segments[0], s.handlePutTenantOfferingItems)
+	}
+	return nil
+}
+
+func (s *Server) routeUsers(method string, segments []string) http.HandlerFunc {
+	switch {
+	case len(segments) == 0 && method == http.MethodGet:
+		return s.handleGetUsers
+	case len(segments) == 0 && method == http.MethodPost:
+		return s.handlePostUser
+	case len(segments) == 1 && segments[0] == "check_login" && method == http.MethodGet:
+		return s.handleCheckLogin
+	case len(segments) == 1 && method == http.MethodGet:
+		return s.withID(segments[0], s.handleGetUser)
+	case len(segments) == 1 && method == http.MethodPut:
+		return s.withID(segments[0], s.handlePutUser)
+	case len(segments) == 1 && method == http.MethodDelete:
+		return s.withID(segments[0], s.handleDeleteUser)
+	case len(segments) == 2 && segments[1] == "access_policies" && method == http.MethodGet:
+		return s.withID(segments[0], s.handleGetAccessPolicies)
+	case len(segments) == 2 && segments[1] == "access_policies" && method == http.MethodPut:
+		return s.withID(segments[0], s.handlePutAccessPolicies)
+	case len(segments) == 2 && segments[1] == "send-activation-email" && method == http.MethodPost:
+		return s.withID(segments[0], s.handleSendActivationEmail)
+	case len(segments) == 2 && segments[1] == "password" && method == http.MethodPost:
+		return s.withID(segments[0], s.handleSetPassword)
+	}
+	return nil
+}
+
+// withID adapts handler of a single object endpoint
+func (s *Server) withID(id string, handler func(w http.ResponseWriter, r *http.Request, id string)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		handler(w, r, id)
+	}
+}
+
+// ===================
+// auth and clients
+// ===================
+
+func (s *Server) handleToken(w http.ResponseWriter, r *http.Request) {
+	clientID, clientSecret, ok := r.BasicAuth()
+	if !ok {
+		clientID, clientSecret = r.FormValue("client_id"), r.FormValue("client_secret")
+	}
+	if clientID != s.ClientID || clientSecret != s.ClientSecret {
+		writeError(w, http.StatusUnauthorized, "invalid_client", "invalid client credentials")
+		return
+	}
+	if grantType := r.FormValue("grant_type"); grantType != "client_credentials" {
+		writeError(w, http.StatusBadRequest, "unsupported_grant_type", "unsupported grant type "+grantType)
+		return
+	}
+
+	token := newUUID()
+	s.mu.Lock()
+	s.tokens[token] = struct{}{}
+	s.mu.Unlock()
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token": token,
+		"token_type":   "bearer",
+		"expires_in":   3600,
+	})
+}
+
+// RevokeTokens invalidates all issued access tokens, e.g. to test re-authentication
+func (s *Server) RevokeTokens() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tokens = make(map[string]struct{})
+}
+
+func (s *Server) authorized(r *http.Request) bool {
+	const prefix = "Bearer "
+	header := r.Header.Get("Authorization")
+	if len(header) <= len(prefix) || !strings.EqualFold(header[:len(prefix)], prefix) {
+		return false
+	}
+	_, ok := s.tokens[header[len(prefix):]]
+	return ok
+}
+
+func (s *Server) handleGetClient(w http.ResponseWriter, r *http.Request, id string) {
+	if id != s.ClientID {
+		writeError(w, http.StatusNotFound, "ClientNotFound", "client "+id+" not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"client_id": s.ClientID,
+		"tenant_id": s.RootTenantID,
+		"type":      "api_client",
+	})
+}
+
+func (s *Server) handleGetApplications(w http.ResponseWriter, r *http.Request) {
+	items := make([]accclient.Application, len(s.applications))
+	copy(items, s.applications)
+	writeJSON(w, http.StatusOK, map[string]interface{}{"items": items})
+}
+
+// ===================
+// helper functions
+// ===================
+
+// page returns the query and the keys of items of the requested page, and the cursor to the next page, if any.
+// match returns the keys of items matching the query of the first page, next pages are served from its snapshot.
+func (s *Server) page(r *http.Request, match func(query url.Values) ([]itemKey, error)) (
+	query url.Values, keys []itemKey, after string, err error) {
+	var snap *snapshot
+	from := 0
+	if a := r.URL.Query().Get("after"); a != "" {
+		c, ok := s.cursors[a]
+		if !ok {
+			return nil, nil, "", fmt.Errorf("invalid cursor %v", a)
+		}
+		snap, from = c.snapshot, c.offset
+	} else {
+		query = r.URL.Query()
+		limit := defaultPageSize
+		if l := query.Get("limit"); l != "" {
+			if limit, err = strconv.Atoi(l); err != nil || limit <= 0 {
+				return nil, nil, "", fmt.Errorf("invalid limit %v", l)
+			}
+		}
+		matched, err := match(query)
+		if err != nil {
+			return nil, nil, "", err
+		}
+		snap = &snapshot{query: query, limit: limit, keys: matched}
+	}
+
+	to := from + snap.limit
+	if to >= len(snap.keys) {
+		return snap.query, snap.keys[from:], "", nil
+	}
+
+	if len(snap.afters) == 0 {
+		s.addSnapshot(snap)
+	}
+	after = newUUID()
+	s.cursors[after] = cursor{snapshot: snap, offset: to}
+	snap.afters = append(snap.afters, after)
+	return snap.query, snap.keys[from:to], after, nil
+}
+
+// addSnapshot keeps the snapshot for the next pages, evicting the oldest one with its cursors
+func (s *Server) addSnapshot(snap *snapshot) {
+	s.snapshots = append(s.snapshots, snap)
+	if len(s.snapshots) <= maxSnapshots {
+		return
+	}
+	for _, after := range s.snapshots[0].afters {
+		delete(s.cursors, after)
+	}
+	s.snapshots[0] = nil
+	s.snapshots = s.snapshots[1:]
+}
+
+// parseUpdatedSince parses updated_since param, zero time if it's not set
+func parseUpdatedSince(query url.Values) (time.Time, error) {
+	since := query.Get("updated_since")
+	if since == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339, since)
+}
+
+// parseList parses comma separated list param into set, nil if it's not set
+func parseList(query url.Values, key string) map[string]struct{} {
+	value := query.Get(key)
+	if value == "" {
+		return nil
+	}
+	set := make(map[string]struct{})
+	for _, item := range strings.Split(value, ",") {
+		set[item] = struct{}{}
+	}
+	return set
+}
+
+func contains(set map[string]struct{}, key string) bool {
+	_, ok := set[key]
+	return ok
+}
+
+// checkVersion compares the version param of DELETE requests with the current version
+func checkVersion(w http.ResponseWriter, r *http.Request, current int64) bool {
+	version, err := strconv.ParseInt(r.URL.Query().Get("version"), 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "InvalidVersion", "version param is required")
+		return false
+	}
+	if version != current {
+		writeError(w, http.StatusConflict, "VersionConflict",
+			fmt.Sprintf("version %v doesn't match current version %v", version, current))
+		return false
+	}
+	return true
+}
+
+func decodeBody(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		writeError(w, http.StatusBadRequest, "InvalidBody", err.Error())
+		return false
+	}
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	domain := "PlatformAccountServer"
+	writeJSON(w, status, map[string]interface{}{
+		"error": accclient.Error{Code: code, Domain: &domain, Message: message},
+	})
+}
+
+// now returns the current time, truncated to microseconds as stored by Acronis cloud
+func (s *Server) now() time.Time {
+	return s.clock().UTC().Truncate(time.Microsecond)
+}
+
+// newUUID generates random UUID version 4
+func newUUID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
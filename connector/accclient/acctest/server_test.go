@@ -0,0 +1,365 @@
+// Copyright (c) 2021 Acronis International GmbH
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package acctest
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/acronis/acronis-cyber-cloud-go-sample-connector/connector/accclient"
+)
+
+func TestServer_Auth(t *testing.T) {
+	server := NewServer()
+	defer server.Close()
+
+	ctx := context.Background()
+	if _, err := accclient.NewClient(http.DefaultClient, server.URL).GetTenant(ctx, server.RootTenantID); !accclient.IsUnauthorized(err) {
+		t.Errorf("expected unauthorized error without access token, got %v", err)
+	}
+
+	client := server.NewClient()
+	tenantID, err := client.GetRegistrationTenantID(ctx, server.URL, server.ClientID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if tenantID != server.RootTenantID {
+		t.Errorf("expected registration tenant %v, got %v", server.RootTenantID, tenantID)
+	}
+}
+
+// testClock is a source of current time which only moves when advanced
+type testClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *testClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *testClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func TestServer_Tenants(t *testing.T) {
+	clock := &testClock{now: time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)}
+	server := NewServer(WithClock(clock.Now))
+	defer server.Close()
+
+	ctx := context.Background()
+	client := server.NewClient()
+
+	enabled := true
+	created, err := client.CreateTenant(ctx, &accclient.TenantPostRequest{
+		Name: "customer", ParentID: server.RootTenantID, Kind: "customer", Enabled: &enabled,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	unit := server.AddTenant(accclient.Tenant{Name: "unit", ParentID: created.ID, Kind: "unit", Enabled: true})
+	other := server.AddTenant(accclient.Tenant{Name: "other", Kind: "customer", Enabled: true})
+	if len(unit.Path) != 2 || unit.Path[0] != created.ID || unit.Path[1] != server.RootTenantID {
+		t.Errorf("unexpected path of unit %v", unit.Path)
+	}
+
+	// subtree with pagination, root tenant included
+	limit := uint(2)
+	var names []string
+	tenants := client.NewTenantIterator(&accclient.TenantGetRequest{SubTreeRootID: created.ID, Limit: &limit})
+	for tenants.Next(ctx) {
+		names = append(names, tenants.Item().Name)
+	}
+	if err := tenants.Err(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(names) != 2 || names[0] != "customer" || names[1] != "unit" {
+		t.Errorf("unexpected tenants in subtree %v", names)
+	}
+
+	// updated_since and allow_deleted
+	clock.Advance(time.Minute)
+	since := clock.Now()
+	if err := server.DeleteTenant(other.ID); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp, err := client.GetTenants(ctx, &accclient.TenantGetRequest{UpdatedSince: &since, AllowDeleted: true})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(resp.Items) != 1 || resp.Items[0].ID != other.ID || resp.Items[0].DeletedAt.IsZero() {
+		t.Errorf("expected deleted tenant %v, got %+v", other.ID, resp.Items)
+	}
+	resp, err = client.GetTenants(ctx, &accclient.TenantGetRequest{UpdatedSince: &since})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(resp.Items) != 0 {
+		t.Errorf("expected no tenants without allow_deleted, got %+v", resp.Items)
+	}
+
+	// versioned update
+	customerID := "C-1"
+	if err := client.ModifyTenant(ctx, created.ID, func(putReq *accclient.TenantPutRequest) {
+		putReq.CustomerID = &customerID
+	}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := client.UpdateTenant(ctx, created.ID, &accclient.TenantPutRequest{Version: created.Version}); !accclient.IsConflict(err) {
+		t.Errorf("expected conflict on stale version, got %v", err)
+	}
+	tenant, _ := server.GetTenant(created.ID)
+	if tenant.CustomerID == nil || *tenant.CustomerID != customerID || tenant.Version != created.Version+1 {
+		t.Errorf("unexpected tenant after update %+v", tenant)
+	}
+}
+
+func TestServer_OfferingItems(t *testing.T) {
+	server := NewServer()
+	defer server.Close()
+
+	ctx := context.Background()
+	client := server.NewClient()
+
+	tenant := server.AddTenant(accclient.Tenant{Name: "customer", Kind: "customer", Enabled: true})
+	if err := server.SetOfferingItems(tenant.ID,
+		accclient.OfferingItem{ApplicationID: "app", Name: "storage", UsageName: "storage", Status: 1},
+		accclient.OfferingItem{ApplicationID: "app", Name: "workstations", UsageName: "workstations"},
+	); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	quota := float64(100)
+	if err := client.ModifyTenantOfferingItems(ctx, tenant.ID, func(current []accclient.OfferingItem) *accclient.OfferingItemsTenantPutRequest {
+		return &accclient.OfferingItemsTenantPutRequest{OfferingItems: []*accclient.OfferingItemTenantPut{
+			{ApplicationID: "app", Name: "storage", Quota: &accclient.Quota{Value: &quota, Version: current[0].Quota.Version}},
+		}}
+	}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	withOfferingItems := true
+	resp, err := client.GetTenants(ctx, &accclient.TenantGetRequest{UUIDs: []string{tenant.ID}, WithOfferingItems: &withOfferingItems})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	items := resp.Items[0].OfferingItems
+	if len(items) != 2 || items[0].Quota.Value == nil || *items[0].Quota.Value != quota || items[0].Quota.Version != 1 {
+		t.Errorf("unexpected offering items %+v", items)
+	}
+
+	oiResp, err := client.GetOfferingItems(ctx, &accclient.OfferingItemsGetRequest{
+		SubTreeRootTenantID: server.RootTenantID, UsageNames: []string{"workstations"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(oiResp.Items) != 1 || oiResp.Items[0].Name != "workstations" || oiResp.Items[0].TenantID != tenant.ID {
+		t.Errorf("unexpected offering items %+v", oiResp.Items)
+	}
+
+	usage, offeringItem, unknown := int64(5), "storage", "unknown"
+	usagesResp, err := client.UpdateUsages(ctx, &accclient.UsagesPutRequest{Items: []accclient.Usage{
+		{TenantID: &tenant.ID, OfferingItem: &offeringItem, UsageValue: usage},
+		{TenantID: &unknown, OfferingItem: &offeringItem, UsageValue: usage},
+	}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if usagesResp.Items[0].Error != nil || usagesResp.Items[1].Error == nil {
+		t.Errorf("expected error for unknown tenant only, got %+v", usagesResp.Items)
+	}
+	if usages := server.Usages(); len(usages) != 1 || usages[0].UsageValue != usage {
+		t.Errorf("unexpected reported usages %+v", usages)
+	}
+}
+
+func TestServer_Users(t *testing.T) {
+	server := NewServer()
+	defer server.Close()
+
+	ctx := context.Background()
+	client := server.NewClient()
+
+	tenant := server.AddTenant(accclient.Tenant{Name: "customer", Kind: "customer", Enabled: true})
+	login, email := "admin", "admin@example.com"
+	created, err := client.CreateUser(ctx, &accclient.UserPost{
+		TenantID: tenant.ID, Login: &login, Contact: &accclient.Contact{Email: &email},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if available, err := client.CheckLoginAvailability(ctx, login); err != nil || available {
+		t.Errorf("expected login to be taken, got %v, %v", available, err)
+	}
+	if _, err := client.CreateUser(ctx, &accclient.UserPost{TenantID: tenant.ID, Login: &login}); !accclient.IsConflict(err) {
+		t.Errorf("expected conflict on taken login, got %v", err)
+	}
+
+	if _, err := client.UpdateAccessPolicy(ctx, created.ID, &accclient.AccessPolicyList{Items: []*accclient.AccessPolicy{
+		{ID: zeroUUID, TenantID: tenant.ID, RoleID: accclient.RoleIDCompanyAdmin},
+	}}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := client.SendActivationEmail(ctx, created.ID); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if activations := server.ActivationEmails(); len(activations) != 1 || activations[0] != created.ID {
+		t.Errorf("unexpected activation emails %v", activations)
+	}
+
+	withAccessPolicies := true
+	resp, err := client.GetUsers(ctx, &accclient.UserGetRequest{SubTreeRootTenantID: server.RootTenantID, WithAccessPolicies: &withAccessPolicies})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(resp.Items) != 1 || len(resp.Items[0].AccessPolicies) != 1 ||
+		resp.Items[0].AccessPolicies[0].TrusteeID != created.ID || resp.Items[0].AccessPolicies[0].ID == zeroUUID {
+		t.Errorf("unexpected users %+v", resp.Items)
+	}
+
+	if err := client.DeleteUser(ctx, created.ID); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := client.GetUser(ctx, created.ID); !accclient.IsNotFound(err) {
+		t.Errorf("expected deleted user not to be found, got %v", err)
+	}
+	user, _ := server.GetUser(created.ID)
+	if user.DeletedAt.IsZero() || user.AccessPolicies[0].DeletedAt == nil {
+		t.Errorf("expected user and access policies to be deleted, got %+v", user)
+	}
+}
+
+func TestServer_Generate(t *testing.T) {
+	server := NewServer()
+	defer server.Close()
+
+	dataset := Dataset{Depth: 2, FanOut: 3, OfferingItemsPerTenant: 2, UsersPerTenant: 2, AccessPoliciesPerUser: 2}
+	generated := server.Generate(dataset)
+	if len(generated.TenantIDs) != 12 || dataset.Tenants() != 12 {
+		t.Fatalf("expected 12 tenants, got %v", len(generated.TenantIDs))
+	}
+	if len(generated.UserIDs) != 24 || generated.OfferingItems != 24 || generated.AccessPolicies != 48 {
+		t.Errorf("unexpected generated dataset %+v", generated)
+	}
+
+	customer, _ := server.GetTenant(generated.TenantIDs[len(generated.TenantIDs)-1])
+	if customer.Kind != "customer" || len(customer.Path) != 2 || customer.Path[1] != server.RootTenantID {
+		t.Errorf("unexpected customer %+v", customer)
+	}
+
+	// paging through all the generated tenants returns each of them once
+	ctx := context.Background()
+	limit := uint(5)
+	tenants := server.NewClient().NewTenantIterator(&accclient.TenantGetRequest{SubTreeRootID: server.RootTenantID, Limit: &limit})
+	seen := make(map[string]bool)
+	for tenants.Next(ctx) {
+		if seen[tenants.Item().ID] {
+			t.Errorf("tenant %v returned twice", tenants.Item().ID)
+		}
+		seen[tenants.Item().ID] = true
+	}
+	if err := tenants.Err(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(seen) != 13 {
+		t.Errorf("expected 12 generated tenants and the root, got %v", len(seen))
+	}
+}
+
+func TestServer_GenerateHierarchy(t *testing.T) {
+	server := NewServer()
+	defer server.Close()
+
+	dataset := Dataset{Depth: 3, FanOut: 4, OfferingItemsPerTenant: 3, UsersPerTenant: 2, AccessPoliciesPerUser: 3}
+	generated := server.Generate(dataset)
+	if dataset.Tenants() != 4+16+64 || len(generated.TenantIDs) != dataset.Tenants() {
+		t.Fatalf("expected %v tenants, got %v", 4+16+64, len(generated.TenantIDs))
+	}
+
+	children := make(map[string]int)
+	levels := make(map[int]int)
+	for _, tenantID := range generated.TenantIDs {
+		tenant, ok := server.GetTenant(tenantID)
+		if !ok {
+			t.Fatalf("tenant %v not found", tenantID)
+		}
+		children[tenant.ParentID]++
+
+		// path lists the ancestors from the parent up to the root tenant
+		level := len(tenant.Path)
+		levels[level]++
+		if level < 1 || level > dataset.Depth || tenant.Path[0] != tenant.ParentID || tenant.Path[level-1] != server.RootTenantID {
+			t.Errorf("unexpected path of tenant %+v", tenant)
+		}
+		kind := "partner"
+		if level == dataset.Depth {
+			kind = "customer"
+		}
+		if tenant.Kind != kind {
+			t.Errorf("expected %v at level %v, got %+v", kind, level, tenant)
+		}
+		if items := server.GetOfferingItems(tenantID); len(items) != dataset.OfferingItemsPerTenant {
+			t.Errorf("expected %v offering items of tenant %v, got %v", dataset.OfferingItemsPerTenant, tenantID, len(items))
+		}
+	}
+	if levels[1] != 4 || levels[2] != 16 || levels[3] != 64 {
+		t.Errorf("unexpected number of tenants per level %v", levels)
+	}
+	for parentID, count := range children {
+		if count != dataset.FanOut {
+			t.Errorf("expected %v children of tenant %v, got %v", dataset.FanOut, parentID, count)
+		}
+	}
+	// the root tenant and each partner have children, customers don't
+	if len(children) != 1+4+16 {
+		t.Errorf("expected %v parent tenants, got %v", 1+4+16, len(children))
+	}
+
+	if len(generated.UserIDs) != dataset.Tenants()*dataset.UsersPerTenant ||
+		generated.OfferingItems != dataset.Tenants()*dataset.OfferingItemsPerTenant ||
+		generated.AccessPolicies != len(generated.UserIDs)*dataset.AccessPoliciesPerUser {
+		t.Errorf("unexpected generated dataset counts: %v users, %v offering items, %v access policies",
+			len(generated.UserIDs), generated.OfferingItems, generated.AccessPolicies)
+	}
+	usersPerTenant := make(map[string]int)
+	for _, userID := range generated.UserIDs {
+		user, ok := server.GetUser(userID)
+		if !ok {
+			t.Fatalf("user %v not found", userID)
+		}
+		usersPerTenant[user.TenantID]++
+		if len(user.AccessPolicies) != dataset.AccessPoliciesPerUser {
+			t.Errorf("expected %v access policies of user %v, got %v", dataset.AccessPoliciesPerUser, userID, len(user.AccessPolicies))
+		}
+	}
+	for _, tenantID := range generated.TenantIDs {
+		if usersPerTenant[tenantID] != dataset.UsersPerTenant {
+			t.Errorf("expected %v users of tenant %v, got %v", dataset.UsersPerTenant, tenantID, usersPerTenant[tenantID])
+		}
+	}
+}
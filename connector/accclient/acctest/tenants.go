@@ -0,0 +1,513 @@
+// Copyright (c) 2021 Acronis International GmbH
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package acctest
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/acronis/acronis-cyber-cloud-go-sample-connector/connector/accclient"
+)
+
+// AddTenant creates the tenant and returns it with the generated fields, such as ID if empty, version and timestamps.
+// ParentID defaults to RootTenantID.
+func (s *Server) AddTenant(tenant accclient.Tenant) accclient.Tenant {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return cloneTenant(s.addTenant(tenant))
+}
+
+// ModifyTenant applies the mutation to the tenant, bumping its version and update timestamp,
+// as if the tenant was modified in Acronis cloud management portal
+func (s *Server) ModifyTenant(tenantID string, mutate func(*accclient.Tenant)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tenant, ok := s.tenants[tenantID]
+	if !ok {
+		return fmt.Errorf("tenant %v not found", tenantID)
+	}
+	mutate(tenant)
+	s.touchTenant(tenant)
+	return nil
+}
+
+// DeleteTenant soft deletes the tenant
+func (s *Server) DeleteTenant(tenantID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tenant, ok := s.tenants[tenantID]
+	if !ok {
+		return fmt.Errorf("tenant %v not found", tenantID)
+	}
+	s.deleteTenant(tenant)
+	return nil
+}
+
+// GetTenant returns the tenant, including soft deleted one
+func (s *Server) GetTenant(tenantID string) (accclient.Tenant, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tenant, ok := s.tenants[tenantID]
+	if !ok {
+		return accclient.Tenant{}, false
+	}
+	return cloneTenant(tenant), true
+}
+
+// SetOfferingItems replaces the offering items available to the tenant
+func (s *Server) SetOfferingItems(tenantID string, items ...accclient.OfferingItem) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.tenants[tenantID]; !ok {
+		return fmt.Errorf("tenant %v not found", tenantID)
+	}
+
+	updatedAt := s.now()
+	stored := make([]accclient.OfferingItem, len(items))
+	for i := range items {
+		stored[i] = items[i]
+		stored[i].TenantID = tenantID
+		stored[i].UpdatedAt = updatedAt
+	}
+	s.offeringItems[tenantID] = stored
+	return nil
+}
+
+// GetOfferingItems returns the offering items available to the tenant
+func (s *Server) GetOfferingItems(tenantID string) []accclient.OfferingItem {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]accclient.OfferingItem(nil), s.offeringItems[tenantID]...)
+}
+
+// ===================
+// handlers
+// ===================
+
+func (s *Server) handleGetTenants(w http.ResponseWriter, r *http.Request) {
+	query, keys, after, err := s.page(r, s.filterTenants)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "InvalidParam", err.Error())
+		return
+	}
+
+	withOfferingItems := query.Get("with_offering_items") == "true"
+	items := make([]accclient.Tenant, 0, len(keys))
+	for _, key := range keys {
+		item := cloneTenant(s.tenants[key.id])
+		if withOfferingItems {
+			item.OfferingItems = append([]accclient.OfferingItem{}, s.offeringItems[key.id]...)
+		}
+		items = append(items, item)
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"items":     items,
+		"paging":    accclient.Paging{Cursors: accclient.Cursors{After: after}},
+		"timestamp": s.now(),
+	})
+}
+
+func (s *Server) handlePostTenant(w http.ResponseWriter, r *http.Request) {
+	var postReq accclient.TenantPostRequest
+	if !decodeBody(w, r, &postReq) {
+		return
+	}
+	if postReq.Name == "" || postReq.Kind == "" {
+		writeError(w, http.StatusBadRequest, "InvalidBody", "name and kind are required")
+		return
+	}
+	if parent, ok := s.tenants[postReq.ParentID]; !ok || !parent.DeletedAt.IsZero() {
+		writeError(w, http.StatusNotFound, "TenantNotFound", "parent tenant "+postReq.ParentID+" not found")
+		return
+	}
+
+	tenant := accclient.Tenant{
+		Name:        postReq.Name,
+		ParentID:    postReq.ParentID,
+		Kind:        postReq.Kind,
+		Enabled:     true,
+		CustomerID:  postReq.CustomerID,
+		InternalTag: postReq.InternalTag,
+		Language:    "en",
+	}
+	if postReq.Enabled != nil {
+		tenant.Enabled = *postReq.Enabled
+	}
+	if postReq.Language != nil {
+		tenant.Language = *postReq.Language
+	}
+	if postReq.Contact != nil {
+		tenant.Contact = *postReq.Contact
+	}
+	if postReq.UpdateLock != nil {
+		tenant.UpdateLock = *postReq.UpdateLock
+	}
+	if postReq.AncestralAccess != nil {
+		tenant.AncestralAccess = *postReq.AncestralAccess
+	}
+
+	writeJSON(w, http.StatusCreated, cloneTenant(s.addTenant(tenant)))
+}
+
+func (s *Server) handleGetTenant(w http.ResponseWriter, r *http.Request, tenantID string) {
+	tenant, ok := s.activeTenant(w, tenantID)
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, cloneTenant(tenant))
+}
+
+func (s *Server) handlePutTenant(w http.ResponseWriter, r *http.Request, tenantID string) {
+	tenant, ok := s.activeTenant(w, tenantID)
+	if !ok {
+		return
+	}
+
+	var putReq accclient.TenantPutRequest
+	if !decodeBody(w, r, &putReq) {
+		return
+	}
+	if putReq.Version != tenant.Version {
+		writeError(w, http.StatusConflict, "VersionConflict",
+			fmt.Sprintf("version %v doesn't match current version %v", putReq.Version, tenant.Version))
+		return
+	}
+
+	if putReq.Name != nil {
+		tenant.Name = *putReq.Name
+	}
+	if putReq.CustomerType != nil {
+		tenant.CustomerType = *putReq.CustomerType
+	}
+	if putReq.Kind != nil {
+		tenant.Kind = *putReq.Kind
+	}
+	if putReq.Contact != nil {
+		tenant.Contact = *putReq.Contact
+	}
+	if putReq.Enabled != nil {
+		tenant.Enabled = *putReq.Enabled
+	}
+	if putReq.CustomerID != nil {
+		tenant.CustomerID = putReq.CustomerID
+	}
+	if putReq.InternalTag != nil {
+		tenant.InternalTag = putReq.InternalTag
+	}
+	if putReq.Language != nil {
+		tenant.Language = *putReq.Language
+	}
+	if putReq.UpdateLock != nil {
+		tenant.UpdateLock = *putReq.UpdateLock
+	}
+	if putReq.AncestralAccess != nil {
+		tenant.AncestralAccess = *putReq.AncestralAccess
+	}
+	s.touchTenant(tenant)
+
+	writeJSON(w, http.StatusOK, cloneTenant(tenant))
+}
+
+func (s *Server) handleDeleteTenant(w http.ResponseWriter, r *http.Request, tenantID string) {
+	tenant, ok := s.activeTenant(w, tenantID)
+	if !ok || !checkVersion(w, r, tenant.Version) {
+		return
+	}
+	if tenant.Enabled {
+		writeError(w, http.StatusBadRequest, "TenantEnabled", "tenant must be disabled before deletion")
+		return
+	}
+
+	s.deleteTenant(tenant)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleGetTenantOfferingItems(w http.ResponseWriter, r *http.Request, tenantID string) {
+	if _, ok := s.activeTenant(w, tenantID); !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"items":     append([]accclient.OfferingItem{}, s.offeringItems[tenantID]...),
+		"timestamp": s.now(),
+	})
+}
+
+func (s *Server) handlePutTenantOfferingItems(w http.ResponseWriter, r *http.Request, tenantID string) {
+	if _, ok := s.activeTenant(w, tenantID); !ok {
+		return
+	}
+
+	var putReq accclient.OfferingItemsTenantPutRequest
+	if !decodeBody(w, r, &putReq) {
+		return
+	}
+
+	// validate all items first, so that the update is atomic
+	items := append([]accclient.OfferingItem{}, s.offeringItems[tenantID]...)
+	for _, put := range putReq.OfferingItems {
+		i := findOfferingItem(items, put.ApplicationID, put.Name)
+		if i < 0 {
+			items = append(items, accclient.OfferingItem{
+				ApplicationID: put.ApplicationID,
+				Name:          put.Name,
+				TenantID:      tenantID,
+			})
+			i = len(items) - 1
+		}
+		item := &items[i]
+
+		if put.Status != nil && int(*put.Status) != item.Status {
+			if item.Locked {
+				writeError(w, http.StatusBadRequest, "OfferingItemLocked", "status of offering item "+item.Name+" is locked")
+				return
+			}
+			item.Status = int(*put.Status)
+		}
+		if put.InfraID != nil {
+			item.InfraID = *put.InfraID
+		}
+		if put.Quota != nil {
+			if put.Quota.Version != item.Quota.Version {
+				writeError(w, http.StatusConflict, "VersionConflict",
+					fmt.Sprintf("quota version %v of offering item %v doesn't match current version %v",
+						put.Quota.Version, item.Name, item.Quota.Version))
+				return
+			}
+			item.Quota = accclient.Quota{
+				Value:   put.Quota.Value,
+				Overage: put.Quota.Overage,
+				Version: item.Quota.Version + 1,
+			}
+		}
+		item.UpdatedAt = s.now()
+	}
+	s.offeringItems[tenantID] = items
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{"items": items})
+}
+
+func (s *Server) handleGetOfferingItems(w http.ResponseWriter, r *http.Request) {
+	_, keys, after, err := s.page(r, s.filterOfferingItems)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "InvalidParam", err.Error())
+		return
+	}
+
+	items := make([]accclient.OfferingItem, 0, len(keys))
+	for _, key := range keys {
+		// offering items of the tenant may have been replaced since the first page
+		if tenantItems := s.offeringItems[key.id]; key.index < len(tenantItems) {
+			items = append(items, tenantItems[key.index])
+		}
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"items":     items,
+		"paging":    accclient.Paging{Cursors: accclient.Cursors{After: after}},
+		"timestamp": s.now(),
+	})
+}
+
+func (s *Server) handlePutUsages(w http.ResponseWriter, r *http.Request) {
+	var putReq accclient.UsagesPutRequest
+	if !decodeBody(w, r, &putReq) {
+		return
+	}
+
+	items := make([]accclient.UsagesResponse, len(putReq.Items))
+	for i, usage := range putReq.Items {
+		items[i] = accclient.UsagesResponse{
+			ResourceID:   usage.ResourceID,
+			UsageType:    usage.UsageType,
+			TenantID:     usage.TenantID,
+			OfferingItem: usage.OfferingItem,
+			InfraID:      usage.InfraID,
+		}
+		if usage.TenantID != nil {
+			if _, ok := s.tenants[*usage.TenantID]; !ok {
+				items[i].Error = &accclient.Error{Code: "TenantNotFound", Message: "tenant " + *usage.TenantID + " not found"}
+				continue
+			}
+		}
+		s.usages = append(s.usages, usage)
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{"items": items})
+}
+
+// ===================
+// helper functions
+// ===================
+
+// addTenant stores the tenant, the caller must hold the lock
+func (s *Server) addTenant(tenant accclient.Tenant) *accclient.Tenant {
+	if tenant.ID == "" {
+		tenant.ID = newUUID()
+	}
+	switch {
+	case s.RootTenantID == "":
+		// the root tenant is its own parent, as the top of the hierarchy
+		tenant.ParentID = tenant.ID
+	case tenant.ParentID == "":
+		tenant.ParentID = s.RootTenantID
+	}
+
+	tenant.Path = nil
+	for id := tenant.ParentID; id != tenant.ID; {
+		parent, ok := s.tenants[id]
+		if !ok {
+			break
+		}
+		tenant.Path = append(tenant.Path, id)
+		parent.HasChildren = true
+		if parent.ParentID == id {
+			break
+		}
+		id = parent.ParentID
+	}
+
+	createdAt := s.now()
+	tenant.Version = 1
+	tenant.CreatedAt = accclient.CustomTime{Time: createdAt}
+	tenant.UpdatedAt = accclient.CustomTime{Time: createdAt}
+	tenant.DeletedAt = accclient.CustomTime{}
+	tenant.OfferingItems = nil
+
+	stored := cloneTenant(&tenant)
+	s.tenants[tenant.ID] = &stored
+	s.tenantOrder = append(s.tenantOrder, tenant.ID)
+	return &stored
+}
+
+// activeTenant returns the tenant which is not deleted, otherwise responds with not found
+func (s *Server) activeTenant(w http.ResponseWriter, tenantID string) (*accclient.Tenant, bool) {
+	tenant, ok := s.tenants[tenantID]
+	if !ok || !tenant.DeletedAt.IsZero() {
+		writeError(w, http.StatusNotFound, "TenantNotFound", "tenant "+tenantID+" not found")
+		return nil, false
+	}
+	return tenant, true
+}
+
+// inSubtree reports whether the tenant is the root tenant of the subtree or its descendant
+func (s *Server) inSubtree(tenantID, rootID string) bool {
+	for id := tenantID; ; {
+		if id == rootID {
+			return true
+		}
+		tenant, ok := s.tenants[id]
+		if !ok || tenant.ParentID == id {
+			return false
+		}
+		id = tenant.ParentID
+	}
+}
+
+// filterTenants returns the keys of tenants matching the query of GET /tenants, in creation order
+func (s *Server) filterTenants(query url.Values) ([]itemKey, error) {
+	updatedSince, err := parseUpdatedSince(query)
+	if err != nil {
+		return nil, err
+	}
+	uuids := parseList(query, "uuids")
+	parentID := query.Get("parent_id")
+	subtreeRootID := query.Get("subtree_root_id")
+	allowDeleted := query.Get("allow_deleted") == "true"
+
+	var keys []itemKey
+	for _, id := range s.tenantOrder {
+		tenant := s.tenants[id]
+		switch {
+		case uuids != nil && !contains(uuids, id),
+			parentID != "" && (tenant.ParentID != parentID || id == parentID),
+			subtreeRootID != "" && !s.inSubtree(id, subtreeRootID),
+			!allowDeleted && !tenant.DeletedAt.IsZero(),
+			tenant.UpdatedAt.Before(updatedSince):
+			continue
+		}
+		keys = append(keys, itemKey{id: id})
+	}
+	return keys, nil
+}
+
+// filterOfferingItems returns the keys of offering items matching the query of GET /tenants/offering_items
+func (s *Server) filterOfferingItems(query url.Values) ([]itemKey, error) {
+	updatedSince, err := parseUpdatedSince(query)
+	if err != nil {
+		return nil, err
+	}
+	subtreeRootID := query.Get("subtree_root_tenant_id")
+	usageNames := parseList(query, "usage_names")
+	editions := parseList(query, "editions")
+
+	var keys []itemKey
+	for _, id := range s.tenantOrder {
+		if subtreeRootID != "" && !s.inSubtree(id, subtreeRootID) {
+			continue
+		}
+		for i, item := range s.offeringItems[id] {
+			switch {
+			case usageNames != nil && !contains(usageNames, item.UsageName),
+				editions != nil && (item.Edition == nil || !contains(editions, *item.Edition)),
+				item.UpdatedAt.Before(updatedSince):
+				continue
+			}
+			keys = append(keys, itemKey{id: id, index: i})
+		}
+	}
+	return keys, nil
+}
+
+// findOfferingItem returns the index of offering item by name, and by application ID if it's not empty
+func findOfferingItem(items []accclient.OfferingItem, applicationID, name string) int {
+	for i := range items {
+		if items[i].Name == name && (applicationID == "" || items[i].ApplicationID == applicationID) {
+			return i
+		}
+	}
+	return -1
+}
+
+// touchTenant bumps the version and update timestamp of the modified tenant
+func (s *Server) touchTenant(tenant *accclient.Tenant) {
+	tenant.Version++
+	tenant.UpdatedAt = accclient.CustomTime{Time: s.now()}
+}
+
+func (s *Server) deleteTenant(tenant *accclient.Tenant) {
+	s.touchTenant(tenant)
+	tenant.Enabled = false
+	tenant.DeletedAt = tenant.UpdatedAt
+}
+
+// cloneTenant copies the tenant, so that the stored tenant is not modified through the returned one
+func cloneTenant(tenant *accclient.Tenant) accclient.Tenant {
+	clone := *tenant
+	clone.Path = append([]string(nil), tenant.Path...)
+	clone.Contacts = append([]accclient.Contact(nil), tenant.Contacts...)
+	clone.OfferingItems = append([]accclient.OfferingItem(nil), tenant.OfferingItems...)
+	return clone
+}
@@ -0,0 +1,503 @@
+// Copyright (c) 2021 Acronis International GmbH
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package acctest
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/acronis/acronis-cyber-cloud-go-sample-connector/connector/accclient"
+)
+
+// zeroUUID is the ID of access policies to be created, as accepted by PUT /users/{id}/access_policies
+const zeroUUID = "00000000-0000-0000-0000-000000000000"
+
+// AddUser creates the user and returns it with the generated fields, such as ID if empty, version and timestamps.
+// TenantID defaults to RootTenantID, access policies of the user are created as well.
+func (s *Server) AddUser(user accclient.User) accclient.User {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	policies := user.AccessPolicies
+	stored := s.addUser(user)
+	s.setAccessPolicies(stored, policies)
+	return cloneUser(stored)
+}
+
+// ModifyUser applies the mutation to the user, bumping its version and update timestamp,
+// as if the user was modified in Acronis cloud management portal
+func (s *Server) ModifyUser(userID string, mutate func(*accclient.User)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[userID]
+	if !ok {
+		return fmt.Errorf("user %v not found", userID)
+	}
+	mutate(user)
+	s.touchUser(user)
+	return nil
+}
+
+// DeleteUser soft deletes the user with its access policies
+func (s *Server) DeleteUser(userID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[userID]
+	if !ok {
+		return fmt.Errorf("user %v not found", userID)
+	}
+	s.deleteUser(user)
+	return nil
+}
+
+// GetUser returns the user with its access policies, including soft deleted ones
+func (s *Server) GetUser(userID string) (accclient.User, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[userID]
+	if !ok {
+		return accclient.User{}, false
+	}
+	return cloneUser(user), true
+}
+
+// SetAccessPolicies replaces the access policies of the user, like PUT /users/{id}/access_policies.
+// Policies with empty or zero ID are created, revoked policies are soft deleted.
+func (s *Server) SetAccessPolicies(userID string, policies ...accclient.AccessPolicy) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[userID]
+	if !ok {
+		return fmt.Errorf("user %v not found", userID)
+	}
+	s.setAccessPolicies(user, policies)
+	return nil
+}
+
+// ===================
+// handlers
+// ===================
+
+func (s *Server) handleGetUsers(w http.ResponseWriter, r *http.Request) {
+	query, keys, after, err := s.page(r, s.filterUsers)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "InvalidParam", err.Error())
+		return
+	}
+
+	allowDeleted := query.Get("allow_deleted") == "true"
+	withAccessPolicies := query.Get("with_access_policies") == "true"
+	items := make([]accclient.User, 0, len(keys))
+	for _, key := range keys {
+		item := cloneUser(s.users[key.id])
+		switch {
+		case !withAccessPolicies:
+			item.AccessPolicies = nil
+		case !allowDeleted:
+			item.AccessPolicies = activeAccessPolicies(item.AccessPolicies)
+		}
+		items = append(items, item)
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"items":     items,
+		"paging":    accclient.Paging{Cursors: accclient.Cursors{After: after}},
+		"timestamp": s.now(),
+	})
+}
+
+func (s *Server) handlePostUser(w http.ResponseWriter, r *http.Request) {
+	var userPost accclient.UserPost
+	if !decodeBody(w, r, &userPost) {
+		return
+	}
+	if _, ok := s.activeTenant(w, userPost.TenantID); !ok {
+		return
+	}
+	if userPost.Login != nil && s.loginTaken(*userPost.Login) {
+		writeError(w, http.StatusConflict, "LoginAlreadyTaken", "login "+*userPost.Login+" is already taken")
+		return
+	}
+
+	user := accclient.User{
+		TenantID: userPost.TenantID,
+		Enabled:  true,
+		Language: "en",
+	}
+	if userPost.Login != nil {
+		user.Login = *userPost.Login
+	}
+	if userPost.ExternalID != nil {
+		user.ExternalID = *userPost.ExternalID
+	}
+	if userPost.IdpID != nil {
+		user.IdpID = *userPost.IdpID
+	}
+	if userPost.Contact != nil {
+		user.Contact = *userPost.Contact
+	}
+	if userPost.Enabled != nil {
+		user.Enabled = *userPost.Enabled
+	}
+	if userPost.Language != nil {
+		user.Language = *userPost.Language
+	}
+	if userPost.BusinessTypes != nil {
+		user.BusinessType = *userPost.BusinessTypes
+	}
+	if userPost.Notifications != nil {
+		user.Notifications = *userPost.Notifications
+	}
+
+	// Account Management API responds with 200 OK to user creation
+	writeJSON(w, http.StatusOK, cloneUser(s.addUser(user)))
+}
+
+func (s *Server) handleCheckLogin(w http.ResponseWriter, r *http.Request) {
+	login := r.URL.Query().Get("username")
+	if login == "" {
+		writeError(w, http.StatusBadRequest, "InvalidParam", "username is required")
+		return
+	}
+	if s.loginTaken(login) {
+		writeError(w, http.StatusConflict, "LoginAlreadyTaken", "login "+login+" is already taken")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleGetUser(w http.ResponseWriter, r *http.Request, userID string) {
+	user, ok := s.activeUser(w, userID)
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, cloneUser(user))
+}
+
+func (s *Server) handlePutUser(w http.ResponseWriter, r *http.Request, userID string) {
+	user, ok := s.activeUser(w, userID)
+	if !ok {
+		return
+	}
+
+	var putReq accclient.UserPutRequest
+	if !decodeBody(w, r, &putReq) {
+		return
+	}
+	if putReq.Version != user.Version {
+		writeError(w, http.StatusConflict, "VersionConflict",
+			fmt.Sprintf("version %v doesn't match current version %v", putReq.Version, user.Version))
+		return
+	}
+	if putReq.Login != nil && *putReq.Login != user.Login && s.loginTaken(*putReq.Login) {
+		writeError(w, http.StatusConflict, "LoginAlreadyTaken", "login "+*putReq.Login+" is already taken")
+		return
+	}
+
+	if putReq.Login != nil {
+		user.Login = *putReq.Login
+	}
+	if putReq.Contact != nil {
+		user.Contact = *putReq.Contact
+	}
+	if putReq.Enabled != nil {
+		user.Enabled = *putReq.Enabled
+	}
+	if putReq.Language != nil {
+		user.Language = *putReq.Language
+	}
+	if putReq.IdpID != nil {
+		user.IdpID = *putReq.IdpID
+	}
+	if putReq.ExternalID != nil {
+		user.ExternalID = *putReq.ExternalID
+	}
+	if putReq.BusinessTypes != nil {
+		user.BusinessType = *putReq.BusinessTypes
+	}
+	if putReq.Notifications != nil {
+		user.Notifications = *putReq.Notifications
+	}
+	s.touchUser(user)
+
+	writeJSON(w, http.StatusOK, cloneUser(user))
+}
+
+func (s *Server) handleDeleteUser(w http.ResponseWriter, r *http.Request, userID string) {
+	user, ok := s.activeUser(w, userID)
+	if !ok || !checkVersion(w, r, int64(user.Version)) {
+		return
+	}
+
+	s.deleteUser(user)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleGetAccessPolicies(w http.ResponseWriter, r *http.Request, userID string) {
+	user, ok := s.activeUser(w, userID)
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, accessPolicyList(activeAccessPolicies(user.AccessPolicies)))
+}
+
+func (s *Server) handlePutAccessPolicies(w http.ResponseWriter, r *http.Request, userID string) {
+	user, ok := s.activeUser(w, userID)
+	if !ok {
+		return
+	}
+
+	var putReq accclient.AccessPolicyList
+	if !decodeBody(w, r, &putReq) {
+		return
+	}
+
+	policies := make([]accclient.AccessPolicy, 0, len(putReq.Items))
+	for _, policy := range putReq.Items {
+		if policy == nil {
+			continue
+		}
+		if _, ok := s.tenants[policy.TenantID]; policy.TenantID != "" && !ok {
+			writeError(w, http.StatusNotFound, "TenantNotFound", "tenant "+policy.TenantID+" not found")
+			return
+		}
+		policies = append(policies, *policy)
+	}
+	s.setAccessPolicies(user, policies)
+
+	writeJSON(w, http.StatusOK, accessPolicyList(activeAccessPolicies(user.AccessPolicies)))
+}
+
+func (s *Server) handleSendActivationEmail(w http.ResponseWriter, r *http.Request, userID string) {
+	user, ok := s.activeUser(w, userID)
+	if !ok {
+		return
+	}
+	if user.Contact.Email == nil || *user.Contact.Email == "" {
+		writeError(w, http.StatusBadRequest, "EmailNotSet", "user "+userID+" has no email")
+		return
+	}
+
+	s.activations = append(s.activations, userID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleSetPassword(w http.ResponseWriter, r *http.Request, userID string) {
+	user, ok := s.activeUser(w, userID)
+	if !ok {
+		return
+	}
+
+	var postReq accclient.UserPasswordPostRequest
+	if !decodeBody(w, r, &postReq) {
+		return
+	}
+	if postReq.Password == "" {
+		writeError(w, http.StatusBadRequest, "InvalidBody", "password is required")
+		return
+	}
+
+	s.passwords[userID] = postReq.Password
+	user.Activated = true
+	s.touchUser(user)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ===================
+// helper functions
+// ===================
+
+// addUser stores the user without access policies, the caller must hold the lock
+func (s *Server) addUser(user accclient.User) *accclient.User {
+	if user.ID == "" {
+		user.ID = newUUID()
+	}
+	if user.TenantID == "" {
+		user.TenantID = s.RootTenantID
+	}
+
+	createdAt := s.now()
+	user.Version = 1
+	user.CreatedAt = createdAt
+	user.UpdatedAt = createdAt
+	user.DeletedAt = time.Time{}
+	user.AccessPolicies = nil
+
+	stored := cloneUser(&user)
+	s.users[user.ID] = &stored
+	s.userOrder = append(s.userOrder, user.ID)
+	return &stored
+}
+
+// setAccessPolicies replaces the active access policies of the user. Policies granting the same role
+// on the same tenant as an active policy keep the active one, the other active policies are soft deleted.
+func (s *Server) setAccessPolicies(user *accclient.User, policies []accclient.AccessPolicy) {
+	updatedAt := s.now()
+	kept := make(map[int]bool)
+
+	var created []accclient.AccessPolicy
+	for _, policy := range policies {
+		if policy.TenantID == "" {
+			policy.TenantID = user.TenantID
+		}
+
+		existing := -1
+		for i := range user.AccessPolicies {
+			current := &user.AccessPolicies[i]
+			if current.DeletedAt == nil && current.TenantID == policy.TenantID && current.RoleID == policy.RoleID {
+				existing = i
+				break
+			}
+		}
+		if existing >= 0 {
+			kept[existing] = true
+			continue
+		}
+
+		if policy.ID == "" || policy.ID == zeroUUID {
+			policy.ID = newUUID()
+		}
+		if policy.IssuerID == "" {
+			policy.IssuerID = policy.TenantID
+		}
+		policy.Version = 1
+		policy.TrusteeID = user.ID
+		policy.TrusteeType = accclient.TrusteeTypeUser
+		policy.CreatedAt = updatedAt
+		policy.UpdatedAt = updatedAt
+		policy.DeletedAt = nil
+		created = append(created, policy)
+	}
+
+	for i := range user.AccessPolicies {
+		current := &user.AccessPolicies[i]
+		if current.DeletedAt == nil && !kept[i] {
+			deletedAt := updatedAt
+			current.Version++
+			current.UpdatedAt = updatedAt
+			current.DeletedAt = &deletedAt
+		}
+	}
+	user.AccessPolicies = append(user.AccessPolicies, created...)
+
+	// changes of access policies are reported as changes of the user
+	user.UpdatedAt = updatedAt
+}
+
+// activeUser returns the user which is not deleted, otherwise responds with not found
+func (s *Server) activeUser(w http.ResponseWriter, userID string) (*accclient.User, bool) {
+	user, ok := s.users[userID]
+	if !ok || !user.DeletedAt.IsZero() {
+		writeError(w, http.StatusNotFound, "UserNotFound", "user "+userID+" not found")
+		return nil, false
+	}
+	return user, true
+}
+
+func (s *Server) loginTaken(login string) bool {
+	for _, user := range s.users {
+		if user.Login == login && user.DeletedAt.IsZero() {
+			return true
+		}
+	}
+	return false
+}
+
+// filterUsers returns the keys of users matching the query of GET /users, in creation order
+func (s *Server) filterUsers(query url.Values) ([]itemKey, error) {
+	updatedSince, err := parseUpdatedSince(query)
+	if err != nil {
+		return nil, err
+	}
+	uuids := parseList(query, "uuids")
+	externalIDs := parseList(query, "external_ids")
+	tenantID := query.Get("tenant_id")
+	subtreeRootID := query.Get("subtree_root_tenant_id")
+	allowDeleted := query.Get("allow_deleted") == "true"
+
+	var keys []itemKey
+	for _, id := range s.userOrder {
+		user := s.users[id]
+		switch {
+		case uuids != nil && !contains(uuids, id),
+			externalIDs != nil && !contains(externalIDs, user.ExternalID),
+			tenantID != "" && user.TenantID != tenantID,
+			subtreeRootID != "" && !s.inSubtree(user.TenantID, subtreeRootID),
+			!allowDeleted && !user.DeletedAt.IsZero(),
+			user.UpdatedAt.Before(updatedSince):
+			continue
+		}
+		keys = append(keys, itemKey{id: id})
+	}
+	return keys, nil
+}
+
+// touchUser bumps the version and update timestamp of the modified user
+func (s *Server) touchUser(user *accclient.User) {
+	user.Version++
+	user.UpdatedAt = s.now()
+}
+
+func (s *Server) deleteUser(user *accclient.User) {
+	s.touchUser(user)
+	user.Enabled = false
+	user.DeletedAt = user.UpdatedAt
+	for i := range user.AccessPolicies {
+		if user.AccessPolicies[i].DeletedAt == nil {
+			deletedAt := user.UpdatedAt
+			user.AccessPolicies[i].Version++
+			user.AccessPolicies[i].UpdatedAt = deletedAt
+			user.AccessPolicies[i].DeletedAt = &deletedAt
+		}
+	}
+}
+
+func activeAccessPolicies(policies []accclient.AccessPolicy) []accclient.AccessPolicy {
+	active := make([]accclient.AccessPolicy, 0, len(policies))
+	for i := range policies {
+		if policies[i].DeletedAt == nil {
+			active = append(active, policies[i])
+		}
+	}
+	return active
+}
+
+func accessPolicyList(policies []accclient.AccessPolicy) *accclient.AccessPolicyList {
+	list := &accclient.AccessPolicyList{Items: make([]*accclient.AccessPolicy, len(policies))}
+	for i := range policies {
+		list.Items[i] = &policies[i]
+	}
+	return list
+}
+
+// cloneUser copies the user, so that the stored user is not modified through the returned one
+func cloneUser(user *accclient.User) accclient.User {
+	clone := *user
+	clone.BusinessType = append([]accclient.BusinessType(nil), user.BusinessType...)
+	clone.Notifications = append([]accclient.UserNotification(nil), user.Notifications...)
+	clone.AccessPolicies = append([]accclient.AccessPolicy(nil), user.AccessPolicies...)
+	return clone
+}
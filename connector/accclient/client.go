@@ -28,21 +28,54 @@ import (
 	"io"
 	"io/ioutil"
 	"net/http"
+	"net/url"
 )
 
 const clientRegistrationInfoEndpoint = "/api/2/clients/%s"
 
+// defaultMaxConflictRetries is the number of times version-aware updates are retried on version conflict
+const defaultMaxConflictRetries = 3
+
 // Client is a Acronis Cyber Cloud Platform API client. Create one by calling NewClient
 type Client struct {
 	APIURL     string
 	HTTPClient *http.Client
+
+	middlewares        []Middleware
+	maxConflictRetries int
 }
 
+// ClientOption is an optional init function of Client
+type ClientOption func(*Client)
+
 // NewClient creates a new Acronis Cyber Cloud Platform API client
-func NewClient(httpClient *http.Client, url string) *Client {
-	return &Client{
-		APIURL:     url + "/api/2",
-		HTTPClient: httpClient,
+func NewClient(httpClient *http.Client, url string, options ...ClientOption) *Client {
+	c := &Client{
+		APIURL:             url + "/api/2",
+		HTTPClient:         httpClient,
+		maxConflictRetries: defaultMaxConflictRetries,
+	}
+
+	for _, option := range options {
+		option(c)
+	}
+
+	return c
+}
+
+// WithMiddleware is an optional init function to add middlewares intercepting every request sent by Client.
+// Middlewares are called in the order they are added, the first one being the outermost.
+func WithMiddleware(middlewares ...Middleware) ClientOption {
+	return func(c *Client) {
+		c.middlewares = append(c.middlewares, middlewares...)
+	}
+}
+
+// WithMaxConflictRetries is an optional init function to set the number of times version-aware updates,
+// such as ModifyTenant, are retried on version conflict
+func WithMaxConflictRetries(retries int) ClientOption {
+	return func(c *Client) {
+		c.maxConflictRetries = retries
 	}
 }
 
@@ -81,7 +114,7 @@ func (c *Client) Do(ctx context.Context, method, url string, body interface{}, h
 		reader = nil
 	}
 
-	req, err := http.NewRequest(method, url, reader)
+	req, err := http.NewRequestWithContext(ctx, method, url, reader)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create http request. %w", err)
 	}
@@ -90,7 +123,12 @@ func (c *Client) Do(ctx context.Context, method, url string, body interface{}, h
 		req.Header.Set(key, val)
 	}
 
-	resp, err := c.HTTPClient.Do(req)
+	roundTrip := RoundTripFunc(c.HTTPClient.Do)
+	for i := len(c.middlewares) - 1; i >= 0; i-- {
+		roundTrip = c.middlewares[i](roundTrip)
+	}
+
+	resp, err := roundTrip(req)
 	if err != nil {
 		return nil, fmt.Errorf("error connecting to api server. %w", err)
 	}
@@ -308,29 +346,30 @@ func (c *Client) CreateUser(ctx context.Context, user *UserPost) (*UserPostRespo
 }
 
 // DeleteUser deletes a user in Acronis cloud with the given userID
-// First it will retrieve the latest version for the specified user before performing the deletion.
+// First it will retrieve the latest version for the specified user before performing the deletion,
+// retrying on version conflict.
 func (c *Client) DeleteUser(ctx context.Context, userID string) error {
-	userRequest := UserGetRequest{UUIDs: []string{userID}}
-	userResp, err := c.GetUsers(ctx, &userRequest)
-	if err != nil {
-		return fmt.Errorf("error in GetUsers. %w", err)
-	}
+	return c.retryOnConflict(func() error {
+		user, err := c.GetUser(ctx, userID)
+		if err != nil {
+			return fmt.Errorf("error in GetUser. %w", err)
+		}
 
-	version := userResp.Items[0].Version
-	apiPath := fmt.Sprintf("%v/users/%v?version=%v", c.APIURL, userID, version)
+		apiPath := fmt.Sprintf("%v/users/%v?version=%v", c.APIURL, userID, user.Version)
 
-	resp, err := c.DoDelete(ctx, apiPath)
-	if err != nil {
-		return fmt.Errorf("error in http request DeleteUser. %w", err)
-	}
-	defer resp.Body.Close()
-	_, _ = io.Copy(ioutil.Discard, resp.Body)
+		resp, err := c.DoDelete(ctx, apiPath)
+		if err != nil {
+			return fmt.Errorf("error in http request DeleteUser. %w", err)
+		}
+		defer resp.Body.Close()
+		_, _ = io.Copy(ioutil.Discard, resp.Body)
 
-	if resp.StatusCode != http.StatusNoContent {
-		return fmt.Errorf("invalid status code %d from DeleteUser", resp.StatusCode)
-	}
+		if resp.StatusCode != http.StatusNoContent {
+			return fmt.Errorf("invalid status code %d from DeleteUser", resp.StatusCode)
+		}
 
-	return nil
+		return nil
+	})
 }
 
 // UpdateUsages updates the list of usages listed by the params
@@ -387,20 +426,22 @@ func (c *Client) CreateTenant(ctx context.Context, postReq *TenantPostRequest) (
 
 // DeleteTenant using the UUID tenantID. The tenant must first be disabled using UpdateTenant for this to succeed.
 // As the version number of the tenant is necessary to perform deletion,
-// 	the function will first get the current version of the tenant.
+// 	the function will first get the current version of the tenant, retrying on version conflict.
 func (c *Client) DeleteTenant(ctx context.Context, tenantID string) error {
-	tenantObj, err := c.GetTenant(ctx, tenantID)
-	if err != nil {
-		return fmt.Errorf("error getting tenant version in DeleteTenant. %w", err)
-	}
-	deletePath := fmt.Sprintf("%v/tenants/%v/?version=%v", c.APIURL, tenantID, tenantObj.Version)
-	resp, err := c.DoDelete(ctx, deletePath)
-	if err != nil {
-		return fmt.Errorf("error in http request DeleteTenant. %w", err)
-	}
-	defer resp.Body.Close()
-	_, _ = io.Copy(ioutil.Discard, resp.Body)
-	return nil
+	return c.retryOnConflict(func() error {
+		tenantObj, err := c.GetTenant(ctx, tenantID)
+		if err != nil {
+			return fmt.Errorf("error getting tenant version in DeleteTenant. %w", err)
+		}
+		deletePath := fmt.Sprintf("%v/tenants/%v/?version=%v", c.APIURL, tenantID, tenantObj.Version)
+		resp, err := c.DoDelete(ctx, deletePath)
+		if err != nil {
+			return fmt.Errorf("error in http request DeleteTenant. %w", err)
+		}
+		defer resp.Body.Close()
+		_, _ = io.Copy(ioutil.Discard, resp.Body)
+		return nil
+	})
 }
 
 // UpdateTenant using the UUID tenantID and newDetails.
@@ -414,6 +455,175 @@ func (c *Client) UpdateTenant(ctx context.Context, tenantID string, newDetails *
 	return nil
 }
 
+// ModifyTenant applies the mutation to the tenant with the UUID tenantID.
+// It fetches the current version of the tenant, calls mutate with a TenantPutRequest holding this version,
+// and sends the update. On version conflict, i.e. the tenant was modified concurrently, the whole sequence is retried.
+func (c *Client) ModifyTenant(ctx context.Context, tenantID string, mutate func(*TenantPutRequest)) error {
+	return c.retryOnConflict(func() error {
+		tenant, err := c.GetTenant(ctx, tenantID)
+		if err != nil {
+			return fmt.Errorf("error getting tenant version in ModifyTenant. %w", err)
+		}
+
+		putReq := &TenantPutRequest{Version: tenant.Version}
+		mutate(putReq)
+
+		return c.UpdateTenant(ctx, tenantID, putReq)
+	})
+}
+
+// GetUser using the UUID userID, returning a User object if successful.
+func (c *Client) GetUser(ctx context.Context, userID string) (*SingleUserResponse, error) {
+	resp, err := c.DoGet(ctx, c.APIURL+"/users/"+userID)
+	if err != nil {
+		return nil, fmt.Errorf("error in http request GetUser. %w", err)
+	}
+	defer CloseBody(resp)
+
+	user, err := parseUserResponse(resp)
+	if err != nil {
+		return nil, fmt.Errorf("error unmarshaling response GetUser. %w", err)
+	}
+
+	return user, nil
+}
+
+// UpdateUser using the UUID userID and newDetails. Version of newDetails must match the current version of the user.
+func (c *Client) UpdateUser(ctx context.Context, userID string, newDetails *UserPutRequest) (*SingleUserResponse, error) {
+	resp, err := c.DoPut(ctx, c.APIURL+"/users/"+userID, newDetails, map[string]string{"Content-Type": "application/json"})
+	if err != nil {
+		return nil, fmt.Errorf("error in http request UpdateUser. %w", err)
+	}
+	defer CloseBody(resp)
+
+	user, err := parseUserResponse(resp)
+	if err != nil {
+		return nil, fmt.Errorf("error unmarshaling response UpdateUser. %w", err)
+	}
+
+	return user, nil
+}
+
+// ModifyUser applies the mutation to the user with the UUID userID.
+// It fetches the current version of the user, calls mutate with a UserPutRequest holding this version,
+// and sends the update. On version conflict the whole sequence is retried.
+func (c *Client) ModifyUser(ctx context.Context, userID string, mutate func(*UserPutRequest)) error {
+	return c.retryOnConflict(func() error {
+		user, err := c.GetUser(ctx, userID)
+		if err != nil {
+			return fmt.Errorf("error getting user version in ModifyUser. %w", err)
+		}
+
+		putReq := &UserPutRequest{Version: user.Version}
+		mutate(putReq)
+
+		_, err = c.UpdateUser(ctx, userID, putReq)
+		return err
+	})
+}
+
+// SendActivationEmail sends an email to the user with the link to activate the account and set the password
+func (c *Client) SendActivationEmail(ctx context.Context, userID string) error {
+	apiPath := fmt.Sprintf("%v/users/%v/send-activation-email", c.APIURL, userID)
+	resp, err := c.DoPost(ctx, apiPath, struct{}{}, map[string]string{"Content-Type": "application/json"})
+	if err != nil {
+		return fmt.Errorf("error in http request SendActivationEmail. %w", err)
+	}
+	CloseBody(resp)
+	return nil
+}
+
+// SetUserPassword sets the password of the user, activating the account
+func (c *Client) SetUserPassword(ctx context.Context, userID, password string) error {
+	apiPath := fmt.Sprintf("%v/users/%v/password", c.APIURL, userID)
+	resp, err := c.DoPost(ctx, apiPath, &UserPasswordPostRequest{Password: password},
+		map[string]string{"Content-Type": "application/json"})
+	if err != nil {
+		return fmt.Errorf("error in http request SetUserPassword. %w", err)
+	}
+	CloseBody(resp)
+	return nil
+}
+
+// CheckLoginAvailability checks whether the login can be used for a new user.
+// It returns false without error if the login is already taken.
+func (c *Client) CheckLoginAvailability(ctx context.Context, login string) (bool, error) {
+	apiPath := c.APIURL + "/users/check_login?" + url.Values{"username": []string{login}}.Encode()
+	resp, err := c.DoGet(ctx, apiPath)
+	if IsConflict(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("error in http request CheckLoginAvailability. %w", err)
+	}
+	CloseBody(resp)
+	return true, nil
+}
+
+// GetUserAccessPolicies gets the access policies granted to the user
+func (c *Client) GetUserAccessPolicies(ctx context.Context, userID string) (*UserAccessPoliciesResponse, error) {
+	apiPath := fmt.Sprintf("%v/users/%v/access_policies", c.APIURL, userID)
+	resp, err := c.DoGet(ctx, apiPath)
+	if err != nil {
+		return nil, fmt.Errorf("error in http request GetUserAccessPolicies. %w", err)
+	}
+	defer CloseBody(resp)
+
+	accessPolicies, err := parseUserAccessPoliciesResponse(resp)
+	if err != nil {
+		return nil, fmt.Errorf("error unmarshaling response GetUserAccessPolicies. %w", err)
+	}
+	return accessPolicies, nil
+}
+
+// GetTenantOfferingItems gets the offering items of the tenant with the UUID tenantID
+func (c *Client) GetTenantOfferingItems(ctx context.Context, tenantID string) (*OfferingItemsGetResponse, error) {
+	apiPath := fmt.Sprintf("%v/tenants/%v/offering_items", c.APIURL, tenantID)
+	resp, err := c.DoGet(ctx, apiPath)
+	if err != nil {
+		return nil, fmt.Errorf("error in http request GetTenantOfferingItems. %w", err)
+	}
+	defer CloseBody(resp)
+
+	offeringItemsResp, err := parseOfferingItemsGetResponse(resp)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing response GetTenantOfferingItems. %w", err)
+	}
+
+	return offeringItemsResp, nil
+}
+
+// ModifyTenantOfferingItems updates the offering items of the tenant with the UUID tenantID.
+// It fetches the current offering items and calls mutate to build the update request from them,
+// nil request means there is nothing to update. Quota versions should be taken from the current offering items,
+// on version conflict the whole sequence is retried.
+func (c *Client) ModifyTenantOfferingItems(
+	ctx context.Context, tenantID string, mutate func(current []OfferingItem) *OfferingItemsTenantPutRequest) error {
+	return c.retryOnConflict(func() error {
+		current, err := c.GetTenantOfferingItems(ctx, tenantID)
+		if err != nil {
+			return fmt.Errorf("error getting offering items in ModifyTenantOfferingItems. %w", err)
+		}
+
+		putReq := mutate(current.Items)
+		if putReq == nil {
+			return nil
+		}
+
+		return c.UpdateTenantOfferingItems(ctx, tenantID, putReq)
+	})
+}
+
+// retryOnConflict calls fn until it succeeds, fails with an error other than version conflict,
+// or the maximum number of conflict retries is reached
+func (c *Client) retryOnConflict(fn func() error) error {
+	err := fn()
+	for retry := 0; retry < c.maxConflictRetries && IsConflict(err); retry++ {
+		err = fn()
+	}
+	return err
+}
+
 // UpdateAccessPolicy updates access policy for a particular user
 func (c *Client) UpdateAccessPolicy(
 	ctx context.Context, userID string, accessPolicies *AccessPolicyList) (*UpdateAccessPolicyResponse, error) {
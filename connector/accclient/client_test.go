@@ -537,3 +537,466 @@ func TestClient_UpdateUsages(t *testing.T) {
 		})
 	}
 }
+
+func getTestPagingServer(pages map[string]TenantGetResponse) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		page, ok := pages[r.URL.Query().Get("after")]
+		if !ok {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		respBody, err := json.Marshal(page)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if _, err := w.Write(respBody); err != nil {
+			return
+		}
+	}))
+
+	return srv
+}
+
+func testTenantPage(after string, ids ...string) TenantGetResponse {
+	page := TenantGetResponse{}
+	page.Paging.Cursors.After = after
+	for _, id := range ids {
+		page.Items = append(page.Items, Tenant{ID: id})
+	}
+	return page
+}
+
+func TestClient_TenantIterator(t *testing.T) {
+	server := getTestPagingServer(map[string]TenantGetResponse{
+		"":   testTenantPage("c1", "t1"),
+		"c1": testTenantPage("c2"), // empty page in the middle is skipped
+		"c2": testTenantPage("", "t2", "t3"),
+	})
+	defer server.Close()
+	client := NewClient(server.Client(), server.URL)
+
+	var ids, cursors []string
+	pages := 0
+	it := client.NewTenantIterator(&TenantGetRequest{}).OnPage(func(page PageInfo) error {
+		pages++
+		return nil
+	})
+	for it.Next(context.Background()) {
+		ids = append(ids, it.Item().ID)
+		cursors = append(cursors, it.Cursor())
+	}
+
+	if it.Err() != nil {
+		t.Fatalf("unexpected error: %v", it.Err())
+	}
+	if want := []string{"t1", "t2", "t3"}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("got items %v, want %v", ids, want)
+	}
+	if want := []string{"", "c2", "c2"}; !reflect.DeepEqual(cursors, want) {
+		t.Errorf("got cursors %v, want %v", cursors, want)
+	}
+	if pages != 3 {
+		t.Errorf("got %d pages, want 3", pages)
+	}
+	if it.Next(context.Background()) {
+		t.Error("exhausted iterator must not advance")
+	}
+}
+
+func TestClient_TenantIterator_ErrorAndResume(t *testing.T) {
+	server := getTestPagingServer(map[string]TenantGetResponse{
+		"":   testTenantPage("c1", "t1"),
+		"c2": testTenantPage("", "t2"),
+	})
+	defer server.Close()
+	client := NewClient(server.Client(), server.URL)
+
+	it := client.NewTenantIterator(&TenantGetRequest{})
+	count := 0
+	for it.Next(context.Background()) {
+		count++
+	}
+	var clientErr Error
+	if count != 1 || !errors.As(it.Err(), &clientErr) {
+		t.Fatalf("expected 1 item and client error, got %d items and %v", count, it.Err())
+	}
+
+	it = client.NewTenantIterator(&TenantGetRequest{After: "c2"})
+	if !it.Next(context.Background()) || it.Item().ID != "t2" || it.Cursor() != "c2" {
+		t.Fatalf("expected resumed iteration to return t2, err %v", it.Err())
+	}
+	if it.Next(context.Background()) || it.Err() != nil {
+		t.Errorf("expected resumed iteration to complete, err %v", it.Err())
+	}
+}
+
+func TestClient_TenantIterator_HookError(t *testing.T) {
+	server := getTestPagingServer(map[string]TenantGetResponse{
+		"": testTenantPage("c1", "t1"),
+	})
+	defer server.Close()
+	client := NewClient(server.Client(), server.URL)
+
+	hookErr := errors.New("stop")
+	it := client.NewTenantIterator(&TenantGetRequest{}).OnPage(func(page PageInfo) error {
+		return hookErr
+	})
+	if it.Next(context.Background()) || !errors.Is(it.Err(), hookErr) {
+		t.Errorf("expected hook error, got %v", it.Err())
+	}
+}
+
+func TestMakeError(t *testing.T) {
+	domain := "PlatformAccountServer"
+	tests := []struct {
+		name   string
+		status int
+		body   string
+		want   Error
+	}{
+		{
+			name:   "Envelope",
+			status: http.StatusConflict,
+			body:   `{"error":{"domain":"PlatformAccountServer","code":"VersionConflict","message":"version mismatch"}}`,
+			want: Error{Code: "VersionConflict", Domain: &domain, Message: "version mismatch",
+				StatusCode: http.StatusConflict, RequestID: "req-1"},
+		},
+		{
+			name:   "Flat",
+			status: http.StatusNotFound,
+			body:   `{"domain":"PlatformAccountServer","code":"NotFound","message":"tenant not found"}`,
+			want: Error{Code: "NotFound", Domain: &domain, Message: "tenant not found",
+				StatusCode: http.StatusNotFound, RequestID: "req-1"},
+		},
+		{
+			name:   "Not JSON",
+			status: http.StatusBadGateway,
+			body:   `<html>bad gateway</html>`,
+			want:   Error{Code: "502", StatusCode: http.StatusBadGateway, RequestID: "req-1"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("X-Request-ID", "req-1")
+				w.WriteHeader(tt.status)
+				_, _ = w.Write([]byte(tt.body))
+			}))
+			defer server.Close()
+
+			c := NewClient(server.Client(), server.URL)
+			_, err := c.GetTenant(context.Background(), "id")
+
+			var clientErr Error
+			if !errors.As(err, &clientErr) {
+				t.Fatalf("expected accclient error, got %v", err)
+			}
+			if !reflect.DeepEqual(clientErr, tt.want) {
+				t.Errorf("makeError() = %+v, want %+v", clientErr, tt.want)
+			}
+		})
+	}
+}
+
+func TestErrorHelpers(t *testing.T) {
+	wrapped := fmt.Errorf("error in http request. %w", Error{StatusCode: http.StatusNotFound})
+	if !IsNotFound(wrapped) || IsConflict(wrapped) {
+		t.Error("expected wrapped error to be reported as not found only")
+	}
+	if !IsConflict(Error{StatusCode: http.StatusConflict}) {
+		t.Error("expected conflict")
+	}
+	if !IsRateLimited(&Error{StatusCode: http.StatusTooManyRequests}) {
+		t.Error("expected rate limited")
+	}
+	if !IsUnauthorized(Error{StatusCode: http.StatusForbidden}) {
+		t.Error("expected unauthorized")
+	}
+	if !IsServerError(Error{StatusCode: http.StatusBadGateway}) || IsServerError(Error{StatusCode: http.StatusBadRequest}) {
+		t.Error("expected only 5xx to be server errors")
+	}
+	if IsNotFound(errors.New("plain error")) {
+		t.Error("plain error must not be reported as not found")
+	}
+}
+
+// getTestVersionedServer returns a server holding a single object with version,
+// PUT and DELETE requests respond with 409 Conflict for the first conflicts calls
+func getTestVersionedServer(t *testing.T, conflicts int) (*httptest.Server, *[]string) {
+	var requests []string
+	version := 1
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method)
+		switch r.Method {
+		case http.MethodGet:
+			_, _ = w.Write([]byte(fmt.Sprintf(`{"id":"id","version":%d,"name":"test"}`, version)))
+		case http.MethodPut:
+			var body map[string]interface{}
+			if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+				t.Errorf("failed to decode request body: %v", err)
+			}
+			if conflicts > 0 {
+				conflicts--
+				version++ // modified concurrently
+				w.WriteHeader(http.StatusConflict)
+				_, _ = w.Write([]byte(`{"error":{"code":"VersionConflict"}}`))
+				return
+			}
+			if int(body["version"].(float64)) != version {
+				t.Errorf("expected version %d, got %v", version, body["version"])
+			}
+			version++
+			_, _ = w.Write([]byte(fmt.Sprintf(`{"id":"id","version":%d}`, version)))
+		case http.MethodDelete:
+			if conflicts > 0 {
+				conflicts--
+				w.WriteHeader(http.StatusConflict)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	return srv, &requests
+}
+
+func TestClient_GetTenant(t *testing.T) {
+	server, _ := getTestVersionedServer(t, 0)
+	defer server.Close()
+
+	tenant, err := NewClient(server.Client(), server.URL).GetTenant(context.Background(), "id")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if tenant.ID != "id" || tenant.Version != 1 || tenant.Name != "test" || tenant.StatusCode != http.StatusOK {
+		t.Errorf("unexpected tenant %+v", tenant)
+	}
+}
+
+func TestClient_ModifyTenant(t *testing.T) {
+	tests := []struct {
+		name      string
+		conflicts int
+		wantErr   bool
+		wantCalls []string
+	}{
+		{"No conflict", 0, false, []string{"GET", "PUT"}},
+		{"Retried conflict", 2, false, []string{"GET", "PUT", "GET", "PUT", "GET", "PUT"}},
+		{"Too many conflicts", 4, true, []string{"GET", "PUT", "GET", "PUT", "GET", "PUT", "GET", "PUT"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, requests := getTestVersionedServer(t, tt.conflicts)
+			defer server.Close()
+
+			c := NewClient(server.Client(), server.URL)
+			name := "renamed"
+			err := c.ModifyTenant(context.Background(), "id", func(putReq *TenantPutRequest) {
+				putReq.Name = &name
+			})
+
+			if (err != nil) != tt.wantErr || tt.wantErr && !IsConflict(err) {
+				t.Errorf("ModifyTenant() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(*requests, tt.wantCalls) {
+				t.Errorf("ModifyTenant() requests = %v, want %v", *requests, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestClient_ModifyUser(t *testing.T) {
+	server, requests := getTestVersionedServer(t, 1)
+	defer server.Close()
+
+	c := NewClient(server.Client(), server.URL, WithMaxConflictRetries(1))
+	enabled := false
+	err := c.ModifyUser(context.Background(), "id", func(putReq *UserPutRequest) {
+		putReq.Enabled = &enabled
+	})
+	if err != nil {
+		t.Errorf("ModifyUser() unexpected error: %v", err)
+	}
+	if want := []string{"GET", "PUT", "GET", "PUT"}; !reflect.DeepEqual(*requests, want) {
+		t.Errorf("ModifyUser() requests = %v, want %v", *requests, want)
+	}
+}
+
+func TestClient_DeleteTenant(t *testing.T) {
+	server, requests := getTestVersionedServer(t, 1)
+	defer server.Close()
+
+	if err := NewClient(server.Client(), server.URL).DeleteTenant(context.Background(), "id"); err != nil {
+		t.Errorf("DeleteTenant() unexpected error: %v", err)
+	}
+	if want := []string{"GET", "DELETE", "GET", "DELETE"}; !reflect.DeepEqual(*requests, want) {
+		t.Errorf("DeleteTenant() requests = %v, want %v", *requests, want)
+	}
+}
+
+func TestClient_ModifyTenantOfferingItems(t *testing.T) {
+	var putReq OfferingItemsTenantPutRequest
+	puts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPut {
+			puts++
+			_ = json.NewDecoder(r.Body).Decode(&putReq)
+			return
+		}
+		_, _ = w.Write([]byte(`{"items":[{"name":"storage","application_id":"app","status":1,"quota":{"value":10,"version":3}}]}`))
+	}))
+	defer server.Close()
+	c := NewClient(server.Client(), server.URL)
+
+	// nothing to update
+	if err := c.ModifyTenantOfferingItems(context.Background(), "id", func(current []OfferingItem) *OfferingItemsTenantPutRequest {
+		return nil
+	}); err != nil || puts != 0 {
+		t.Fatalf("expected no update, got %d updates and error %v", puts, err)
+	}
+
+	err := c.ModifyTenantOfferingItems(context.Background(), "id", func(current []OfferingItem) *OfferingItemsTenantPutRequest {
+		value := *current[0].Quota.Value * 2
+		return &OfferingItemsTenantPutRequest{OfferingItems: []*OfferingItemTenantPut{{
+			ApplicationID: current[0].ApplicationID,
+			Name:          current[0].Name,
+			Quota:         &Quota{Value: &value, Version: current[0].Quota.Version},
+		}}}
+	})
+	if err != nil || puts != 1 {
+		t.Fatalf("expected 1 update, got %d updates and error %v", puts, err)
+	}
+	if quota := putReq.OfferingItems[0].Quota; *quota.Value != 20 || quota.Version != 3 {
+		t.Errorf("unexpected quota %+v", quota)
+	}
+}
+
+// getTestRecordingServer returns a server responding with the status code and body,
+// recording method, path with query and body of the last request
+func getTestRecordingServer(statusCode int, body string) (*httptest.Server, *http.Request, *string) {
+	var lastReq http.Request
+	var lastBody string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lastReq = *r
+		reqBody, _ := ioutil.ReadAll(r.Body)
+		lastBody = string(reqBody)
+		w.WriteHeader(statusCode)
+		_, _ = w.Write([]byte(body))
+	}))
+	return srv, &lastReq, &lastBody
+}
+
+func TestClient_GetUser(t *testing.T) {
+	server, req, _ := getTestRecordingServer(http.StatusOK,
+		`{"id":"user-id","version":3,"login":"john","tenant_id":"tenant-id","enabled":true}`)
+	defer server.Close()
+
+	user, err := NewClient(server.Client(), server.URL).GetUser(context.Background(), "user-id")
+	if err != nil {
+		t.Fatalf("GetUser() unexpected error: %v", err)
+	}
+	if req.Method != http.MethodGet || req.URL.Path != "/api/2/users/user-id" {
+		t.Errorf("GetUser() sent %v %v", req.Method, req.URL.Path)
+	}
+	if user.ID != "user-id" || user.Version != 3 || user.Login != "john" || !user.Enabled {
+		t.Errorf("GetUser() unexpected user %+v", user)
+	}
+}
+
+func TestClient_UpdateUser(t *testing.T) {
+	server, req, body := getTestRecordingServer(http.StatusOK, `{"id":"user-id","version":4,"language":"de"}`)
+	defer server.Close()
+
+	language := "de"
+	user, err := NewClient(server.Client(), server.URL).UpdateUser(context.Background(), "user-id",
+		&UserPutRequest{Version: 3, Language: &language})
+	if err != nil {
+		t.Fatalf("UpdateUser() unexpected error: %v", err)
+	}
+	if req.Method != http.MethodPut || req.URL.Path != "/api/2/users/user-id" {
+		t.Errorf("UpdateUser() sent %v %v", req.Method, req.URL.Path)
+	}
+	if *body != `{"version":3,"language":"de"}` {
+		t.Errorf("UpdateUser() sent body %v", *body)
+	}
+	if user.Version != 4 || user.Language != "de" {
+		t.Errorf("UpdateUser() unexpected user %+v", user)
+	}
+
+	conflictServer, _, _ := getTestRecordingServer(http.StatusConflict, `{"error":{"code":"VersionConflict"}}`)
+	defer conflictServer.Close()
+	_, err = NewClient(conflictServer.Client(), conflictServer.URL).UpdateUser(context.Background(), "user-id",
+		&UserPutRequest{Version: 2})
+	if !IsConflict(err) {
+		t.Errorf("UpdateUser() expected conflict error, got %v", err)
+	}
+}
+
+func TestClient_SendActivationEmail(t *testing.T) {
+	server, req, _ := getTestRecordingServer(http.StatusNoContent, "")
+	defer server.Close()
+
+	if err := NewClient(server.Client(), server.URL).SendActivationEmail(context.Background(), "user-id"); err != nil {
+		t.Fatalf("SendActivationEmail() unexpected error: %v", err)
+	}
+	if req.Method != http.MethodPost || req.URL.Path != "/api/2/users/user-id/send-activation-email" {
+		t.Errorf("SendActivationEmail() sent %v %v", req.Method, req.URL.Path)
+	}
+}
+
+func TestClient_SetUserPassword(t *testing.T) {
+	server, req, body := getTestRecordingServer(http.StatusNoContent, "")
+	defer server.Close()
+
+	if err := NewClient(server.Client(), server.URL).SetUserPassword(context.Background(), "user-id", "secret"); err != nil {
+		t.Fatalf("SetUserPassword() unexpected error: %v", err)
+	}
+	if req.Method != http.MethodPost || req.URL.Path != "/api/2/users/user-id/password" || *body != `{"password":"secret"}` {
+		t.Errorf("SetUserPassword() sent %v %v with body %v", req.Method, req.URL.Path, *body)
+	}
+}
+
+func TestClient_CheckLoginAvailability(t *testing.T) {
+	tests := []struct {
+		name       string
+		statusCode int
+		want       bool
+		wantErr    bool
+	}{
+		{"Available", http.StatusNoContent, true, false},
+		{"Taken", http.StatusConflict, false, false},
+		{"Server error", http.StatusInternalServerError, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, req, _ := getTestRecordingServer(tt.statusCode, "")
+			defer server.Close()
+
+			got, err := NewClient(server.Client(), server.URL).CheckLoginAvailability(context.Background(), "john doe")
+			if (err != nil) != tt.wantErr || got != tt.want {
+				t.Errorf("CheckLoginAvailability() = %v, %v, want %v, wantErr %v", got, err, tt.want, tt.wantErr)
+			}
+			if req.URL.Path != "/api/2/users/check_login" || req.URL.Query().Get("username") != "john doe" {
+				t.Errorf("CheckLoginAvailability() sent %v", req.URL)
+			}
+		})
+	}
+}
+
+func TestClient_GetUserAccessPolicies(t *testing.T) {
+	server, req, _ := getTestRecordingServer(http.StatusOK,
+		`{"items":[{"id":"ap-id","trustee_id":"user-id","trustee_type":"user","tenant_id":"tenant-id","role_id":"company_admin"}]}`)
+	defer server.Close()
+
+	policies, err := NewClient(server.Client(), server.URL).GetUserAccessPolicies(context.Background(), "user-id")
+	if err != nil {
+		t.Fatalf("GetUserAccessPolicies() unexpected error: %v", err)
+	}
+	if req.Method != http.MethodGet || req.URL.Path != "/api/2/users/user-id/access_policies" {
+		t.Errorf("GetUserAccessPolicies() sent %v %v", req.Method, req.URL.Path)
+	}
+	if len(policies.Items) != 1 || policies.Items[0].RoleID != RoleIDCompanyAdmin || policies.Items[0].TrusteeID != "user-id" {
+		t.Errorf("GetUserAccessPolicies() unexpected policies %+v", policies.Items)
+	}
+}
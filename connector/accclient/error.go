@@ -21,10 +21,17 @@ package accclient
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"net/http"
+	"time"
 )
 
+// maxErrorBodySize limits the size of error body read from the server
+const maxErrorBodySize = 1 << 20
+
 // Error contains the information about the error return from the server
 type Error struct {
 	Code    string                 `json:"code"`
@@ -33,6 +40,20 @@ type Error struct {
 	Message string                 `json:"message"`
 	Details Details                `json:"details"`
 	Data    *[]string              `json:"data,omitempty"`
+
+	// StatusCode is the HTTP status code of the response
+	StatusCode int `json:"-"`
+
+	// RequestID is the value of X-Request-ID response header, useful when reporting issues to Acronis
+	RequestID string `json:"-"`
+
+	// RetryAfter is the delay requested by Retry-After response header, 0 if the header is not set
+	RetryAfter time.Duration `json:"-"`
+}
+
+// errorEnvelope is the body format of errors returned by Account Management API
+type errorEnvelope struct {
+	Error *Error `json:"error"`
 }
 
 // Details holds additional information on the error.
@@ -42,7 +63,17 @@ type Details struct {
 
 // Error implements the error interface
 func (e Error) Error() string {
-	return fmt.Sprintf("accclient error: domain: %v, reason: %v", getStrPtrValue(e.Domain), e.Code)
+	msg := fmt.Sprintf("accclient error: domain: %v, reason: %v", getStrPtrValue(e.Domain), e.Code)
+	if e.StatusCode != 0 && e.Code != fmt.Sprintf("%d", e.StatusCode) {
+		msg += fmt.Sprintf(", status: %d", e.StatusCode)
+	}
+	if e.Message != "" {
+		msg += fmt.Sprintf(", message: %v", e.Message)
+	}
+	if e.RequestID != "" {
+		msg += fmt.Sprintf(", request_id: %v", e.RequestID)
+	}
+	return msg
 }
 
 func getStrPtrValue(v *string) string {
@@ -52,17 +83,68 @@ func getStrPtrValue(v *string) string {
 	return nullString
 }
 
+// makeError decodes the error body of the response, supporting both the {"error": {...}} envelope
+// and the plain error object. If the body can't be decoded, only status code is reported.
 func makeError(r *http.Response) error {
-	if r.StatusCode >= 400 {
-		return Error{
-			Code: fmt.Sprintf("%d", r.StatusCode),
+	e := Error{}
+
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, maxErrorBodySize))
+	if err == nil && len(body) > 0 {
+		var envelope errorEnvelope
+		if json.Unmarshal(body, &envelope) == nil && envelope.Error != nil {
+			e = *envelope.Error
+		} else if json.Unmarshal(body, &e) != nil {
+			e = Error{}
 		}
 	}
 
-	// Other errors we decode the json error body
+	e.StatusCode = r.StatusCode
+	e.RequestID = r.Header.Get("X-Request-ID")
+	if retryAfter, ok := parseRetryAfter(r.Header.Get("Retry-After"), time.Now()); ok {
+		e.RetryAfter = retryAfter
+	}
+	if e.Code == "" {
+		e.Code = fmt.Sprintf("%d", r.StatusCode)
+	}
+
+	return e
+}
+
+// statusCodeOf returns the HTTP status code carried by the accclient error, 0 if err is not an accclient error
+func statusCodeOf(err error) int {
 	var e Error
-	if err := json.NewDecoder(r.Body).Decode(&e); err != nil {
-		return err
+	if errors.As(err, &e) {
+		return e.StatusCode
 	}
-	return &e
+	var ePtr *Error
+	if errors.As(err, &ePtr) && ePtr != nil {
+		return ePtr.StatusCode
+	}
+	return 0
+}
+
+// IsNotFound reports whether err is caused by a 404 Not Found response
+func IsNotFound(err error) bool {
+	return statusCodeOf(err) == http.StatusNotFound
+}
+
+// IsConflict reports whether err is caused by a 409 Conflict response, e.g. version mismatch on update
+func IsConflict(err error) bool {
+	return statusCodeOf(err) == http.StatusConflict
+}
+
+// IsRateLimited reports whether err is caused by a 429 Too Many Requests response
+func IsRateLimited(err error) bool {
+	return statusCodeOf(err) == http.StatusTooManyRequests
+}
+
+// IsServerError reports whether err is caused by a 5xx response
+func IsServerError(err error) bool {
+	return statusCodeOf(err) >= http.StatusInternalServerError
+}
+
+// IsUnauthorized reports whether err is caused by a 401 Unauthorized or 403 Forbidden response
+func IsUnauthorized(err error) bool {
+	code := statusCodeOf(err)
+	return code == http.StatusUnauthorized || code == http.StatusForbidden
 }
@@ -81,25 +81,17 @@ func main() {
 		Limit:         &limit,
 	}
 
-	tenantResp, err := client.GetTenants(ctx, getTenantReq)
-	if err != nil {
+	tenants := client.NewTenantIterator(getTenantReq).OnPage(func(page accclient.PageInfo) error {
+		log.Printf("Total number of tenant %d of page %d", page.Count, page.Number)
+		return nil
+	})
+	for tenants.Next(ctx) {
+		log.Printf("%v", tenants.Item())
+	}
+	// If there is error on request
+	if err := tenants.Err(); err != nil {
 		log.Printf("Error %v", err)
 		return
 	}
-	for {
-		log.Printf("%v", tenantResp)
-		log.Printf("Total number of tenant %d of this page", len(tenantResp.Items))
-
-		tenantResp, err = client.GetTenantsNextPage(ctx, tenantResp)
-		// If there is error on request
-		if err != nil {
-			log.Printf("Error %v", err)
-			break
-		}
-		// If there is no more pages
-		if tenantResp == nil && err == nil {
-			log.Print("No more page")
-			break
-		}
-	}
+	log.Print("No more page")
 }
@@ -0,0 +1,257 @@
+// Copyright (c) 2021 Acronis International GmbH
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package accclient
+
+import (
+	"context"
+	"time"
+)
+
+// PageInfo describes a page fetched by an iterator, passed to the hooks registered with OnPage
+type PageInfo struct {
+	// Number is the sequence number of the page within the iteration, starting from 1
+	Number int
+
+	// Cursor is the cursor used to fetch this page, empty for the first page of a fresh iteration.
+	// Resuming an iteration from this cursor fetches this page again.
+	Cursor string
+
+	// After is the cursor to fetch the next page, empty if this is the last page
+	After string
+
+	// Count is the number of items in this page
+	Count int
+
+	// Timestamp is the response timestamp reported by the API for this page
+	Timestamp time.Time
+}
+
+// pageFetcher fetches the page for the given cursor, storing the items in the typed iterator.
+// An empty cursor on the first call means the initial request is sent unchanged.
+type pageFetcher func(ctx context.Context, cursor string, first bool) (PageInfo, error)
+
+// pageIterator holds cursor continuation logic shared by the typed iterators
+type pageIterator struct {
+	fetch pageFetcher
+	hooks []func(PageInfo) error
+
+	page      PageInfo
+	index     int
+	started   bool
+	done      bool
+	timestamp time.Time
+	err       error
+}
+
+// next advances to the next item, fetching the next page when the current one is exhausted.
+// Empty pages with a non-empty cursor are skipped.
+func (it *pageIterator) next(ctx context.Context) bool {
+	if it.err != nil || it.done {
+		return false
+	}
+
+	if it.started && it.index+1 < it.page.Count {
+		it.index++
+		return true
+	}
+
+	for {
+		if it.started && it.page.After == "" {
+			it.done = true
+			return false
+		}
+
+		cursor := it.page.After
+		page, err := it.fetch(ctx, cursor, !it.started)
+		if err != nil {
+			it.err = err
+			return false
+		}
+
+		if !it.started {
+			it.timestamp = page.Timestamp
+			it.started = true
+		}
+		page.Number = it.page.Number + 1
+		it.page = page
+		it.index = -1
+
+		for _, hook := range it.hooks {
+			if err := hook(page); err != nil {
+				it.err = err
+				return false
+			}
+		}
+
+		if page.Count > 0 {
+			it.index = 0
+			return true
+		}
+	}
+}
+
+// TenantIterator lazily iterates over tenants matching a TenantGetRequest, fetching the next page on demand.
+// Create one by calling Client.NewTenantIterator.
+type TenantIterator struct {
+	pageIterator
+	items []Tenant
+}
+
+// NewTenantIterator creates an iterator over tenants matching the request.
+// To resume an iteration, set After of the request to a cursor saved from a previous iteration.
+func (c *Client) NewTenantIterator(getReq *TenantGetRequest) *TenantIterator {
+	it := &TenantIterator{}
+	it.fetch = func(ctx context.Context, cursor string, first bool) (PageInfo, error) {
+		req := getReq
+		if !first {
+			req = &TenantGetRequest{After: cursor}
+		}
+		resp, err := c.GetTenants(ctx, req)
+		if err != nil {
+			return PageInfo{}, err
+		}
+		it.items = resp.Items
+		return PageInfo{Cursor: req.After, After: resp.After(), Count: len(resp.Items), Timestamp: resp.Timestamp.Time}, nil
+	}
+	return it
+}
+
+// Next advances the iterator to the next tenant. It returns false when there are no more tenants
+// or an error occurred, which can be checked with Err.
+func (it *TenantIterator) Next(ctx context.Context) bool {
+	return it.next(ctx)
+}
+
+// Item returns the current tenant. The pointer stays valid after the iterator advances.
+func (it *TenantIterator) Item() *Tenant {
+	return &it.items[it.index]
+}
+
+// OnPage registers a hook called after each page is fetched and before its items are returned.
+// An error returned by the hook stops the iteration and is reported by Err.
+func (it *TenantIterator) OnPage(hook func(PageInfo) error) *TenantIterator {
+	it.hooks = append(it.hooks, hook)
+	return it
+}
+
+// UserIterator lazily iterates over users matching a UserGetRequest, fetching the next page on demand.
+// Create one by calling Client.NewUserIterator.
+type UserIterator struct {
+	pageIterator
+	items []User
+}
+
+// NewUserIterator creates an iterator over users matching the request.
+// To resume an iteration, set After of the request to a cursor saved from a previous iteration.
+func (c *Client) NewUserIterator(getReq *UserGetRequest) *UserIterator {
+	it := &UserIterator{}
+	it.fetch = func(ctx context.Context, cursor string, first bool) (PageInfo, error) {
+		req := getReq
+		if !first {
+			req = &UserGetRequest{After: cursor}
+		}
+		resp, err := c.GetUsers(ctx, req)
+		if err != nil {
+			return PageInfo{}, err
+		}
+		it.items = resp.Items
+		return PageInfo{Cursor: req.After, After: resp.After(), Count: len(resp.Items), Timestamp: resp.Timestamp}, nil
+	}
+	return it
+}
+
+// Next advances the iterator to the next user. It returns false when there are no more users
+// or an error occurred, which can be checked with Err.
+func (it *UserIterator) Next(ctx context.Context) bool {
+	return it.next(ctx)
+}
+
+// Item returns the current user. The pointer stays valid after the iterator advances.
+func (it *UserIterator) Item() *User {
+	return &it.items[it.index]
+}
+
+// OnPage registers a hook called after each page is fetched and before its items are returned.
+// An error returned by the hook stops the iteration and is reported by Err.
+func (it *UserIterator) OnPage(hook func(PageInfo) error) *UserIterator {
+	it.hooks = append(it.hooks, hook)
+	return it
+}
+
+// OfferingItemIterator lazily iterates over offering items matching an OfferingItemsGetRequest,
+// fetching the next page on demand. Create one by calling Client.NewOfferingItemIterator.
+type OfferingItemIterator struct {
+	pageIterator
+	items []OfferingItem
+}
+
+// NewOfferingItemIterator creates an iterator over offering items matching the request.
+// To resume an iteration, set After of the request to a cursor saved from a previous iteration.
+func (c *Client) NewOfferingItemIterator(getReq *OfferingItemsGetRequest) *OfferingItemIterator {
+	it := &OfferingItemIterator{}
+	it.fetch = func(ctx context.Context, cursor string, first bool) (PageInfo, error) {
+		req := getReq
+		if !first {
+			req = &OfferingItemsGetRequest{After: cursor}
+		}
+		resp, err := c.GetOfferingItems(ctx, req)
+		if err != nil {
+			return PageInfo{}, err
+		}
+		it.items = resp.Items
+		return PageInfo{Cursor: req.After, After: resp.After(), Count: len(resp.Items), Timestamp: resp.Timestamp}, nil
+	}
+	return it
+}
+
+// Next advances the iterator to the next offering item. It returns false when there are no more offering items
+// or an error occurred, which can be checked with Err.
+func (it *OfferingItemIterator) Next(ctx context.Context) bool {
+	return it.next(ctx)
+}
+
+// Item returns the current offering item. The pointer stays valid after the iterator advances.
+func (it *OfferingItemIterator) Item() *OfferingItem {
+	return &it.items[it.index]
+}
+
+// OnPage registers a hook called after each page is fetched and before its items are returned.
+// An error returned by the hook stops the iteration and is reported by Err.
+func (it *OfferingItemIterator) OnPage(hook func(PageInfo) error) *OfferingItemIterator {
+	it.hooks = append(it.hooks, hook)
+	return it
+}
+
+// Err returns the error which stopped the iteration, nil if the iteration completed successfully
+func (it *pageIterator) Err() error {
+	return it.err
+}
+
+// Timestamp returns the response timestamp of the first page, which can be used as
+// updated_since filter of the next incremental iteration once this one completed successfully
+func (it *pageIterator) Timestamp() time.Time {
+	return it.timestamp
+}
+
+// Cursor returns the cursor used to fetch the page of the current item.
+// Resuming from this cursor fetches the current page again, so every item is returned at least once.
+func (it *pageIterator) Cursor() string {
+	return it.page.Cursor
+}
@@ -0,0 +1,230 @@
+// Copyright (c) 2021 Acronis International GmbH
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package accclient
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/acronis/acronis-cyber-cloud-go-sample-connector/connector/logs"
+)
+
+// RoundTripFunc sends a request and returns its response. It's the signature of each step of the middleware chain.
+type RoundTripFunc func(req *http.Request) (*http.Response, error)
+
+// Middleware intercepts requests sent by Client. It should call next to continue the chain,
+// and can modify the request before, or inspect the response after.
+type Middleware func(next RoundTripFunc) RoundTripFunc
+
+// redacted replaces sensitive values in logs
+const redacted = "REDACTED"
+
+// sensitiveHeaders are redacted by LoggingMiddleware, in canonical form
+var sensitiveHeaders = map[string]struct{}{
+	"Authorization":       {},
+	"Proxy-Authorization": {},
+	"Cookie":              {},
+	"Set-Cookie":          {},
+}
+
+// sensitiveQueryParams are redacted by LoggingMiddleware, matched case-insensitively as a part of the parameter name
+var sensitiveQueryParams = []string{"password", "secret", "token", "key"}
+
+// UserAgentMiddleware sets User-Agent header of every request
+func UserAgentMiddleware(userAgent string) Middleware {
+	return func(next RoundTripFunc) RoundTripFunc {
+		return func(req *http.Request) (*http.Response, error) {
+			req.Header.Set("User-Agent", userAgent)
+			return next(req)
+		}
+	}
+}
+
+// HeadersMiddleware adds the headers to every request, unless the request already has them set
+func HeadersMiddleware(headers http.Header) Middleware {
+	return func(next RoundTripFunc) RoundTripFunc {
+		return func(req *http.Request) (*http.Response, error) {
+			for key, values := range headers {
+				if req.Header.Get(key) == "" {
+					for _, value := range values {
+						req.Header.Add(key, value)
+					}
+				}
+			}
+			return next(req)
+		}
+	}
+}
+
+// LoggingMiddleware logs every request and response with the default logger of the request context.
+// Credentials in headers and query params are redacted.
+func LoggingMiddleware() Middleware {
+	return func(next RoundTripFunc) RoundTripFunc {
+		return func(req *http.Request) (*http.Response, error) {
+			logger := logs.GetDefaultLogger(req.Context())
+			start := time.Now()
+
+			resp, err := next(req)
+			duration := time.Since(start)
+			if err != nil {
+				logger.Debugf("%v %v headers %v failed after %v: %v",
+					req.Method, RedactURL(req.URL), RedactHeaders(req.Header), duration, err)
+				return resp, err
+			}
+
+			logger.Debugf("%v %v headers %v responded %v in %v, request id %v",
+				req.Method, RedactURL(req.URL), RedactHeaders(req.Header), resp.StatusCode, duration,
+				resp.Header.Get("X-Request-ID"))
+			return resp, err
+		}
+	}
+}
+
+// MetricsMiddleware reports method, path, status code and duration of every request to observe.
+// Status code is 0 if the request failed without response.
+func MetricsMiddleware(observe func(method, path string, statusCode int, duration time.Duration)) Middleware {
+	return func(next RoundTripFunc) RoundTripFunc {
+		return func(req *http.Request) (*http.Response, error) {
+			start := time.Now()
+			resp, err := next(req)
+
+			statusCode := 0
+			if resp != nil {
+				statusCode = resp.StatusCode
+			}
+			observe(req.Method, req.URL.Path, statusCode, time.Since(start))
+			return resp, err
+		}
+	}
+}
+
+// RateLimitHint records the delay requested by rate limit headers of the responses, so that periodic loops
+// postpone their next requests accordingly. The delay is requested by Retry-After header of any response,
+// or by RateLimit-Reset or X-RateLimit-Reset header, in seconds or as Unix time, once the remaining number
+// of requests in RateLimit-Remaining or X-RateLimit-Remaining header drops to 0.
+type RateLimitHint struct {
+	now   func() time.Time
+	mutex sync.Mutex
+	until time.Time
+}
+
+// NewRateLimitHint returns a RateLimitHint to be fed by its Middleware, now provides the current time,
+// e.g. time.Now or the clock of the loops waiting for the delay
+func NewRateLimitHint(now func() time.Time) *RateLimitHint {
+	return &RateLimitHint{now: now}
+}
+
+// Middleware returns the middleware recording the delays requested by responses
+func (h *RateLimitHint) Middleware() Middleware {
+	return func(next RoundTripFunc) RoundTripFunc {
+		return func(req *http.Request) (*http.Response, error) {
+			resp, err := next(req)
+			if resp != nil {
+				now := h.now()
+				if delay, ok := rateLimitDelay(resp.Header, now); ok {
+					h.postpone(now.Add(delay))
+				}
+			}
+			return resp, err
+		}
+	}
+}
+
+// Delay returns the remaining delay requested by the responses received so far, 0 if there is none
+func (h *RateLimitHint) Delay() time.Duration {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if delay := h.until.Sub(h.now()); delay > 0 {
+		return delay
+	}
+	return 0
+}
+
+func (h *RateLimitHint) postpone(until time.Time) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if until.After(h.until) {
+		h.until = until
+	}
+}
+
+// unixTimeThreshold separates Unix time from delay in seconds in values of rate limit reset headers
+const unixTimeThreshold = 1000000000
+
+// rateLimitDelay returns the delay requested by rate limit headers, false if there is none
+func rateLimitDelay(header http.Header, now time.Time) (time.Duration, bool) {
+	if delay, ok := parseRetryAfter(header.Get("Retry-After"), now); ok {
+		return delay, true
+	}
+
+	for _, prefix := range []string{"RateLimit-", "X-RateLimit-"} {
+		if header.Get(prefix+"Remaining") != "0" {
+			continue
+		}
+		reset, err := strconv.ParseInt(strings.TrimSpace(header.Get(prefix+"Reset")), 10, 64)
+		if err != nil || reset < 0 {
+			continue
+		}
+		if reset >= unixTimeThreshold {
+			return time.Unix(reset, 0).Sub(now), true
+		}
+		return time.Duration(reset) * time.Second, true
+	}
+	return 0, false
+}
+
+// RedactHeaders returns a copy of headers with credentials replaced
+func RedactHeaders(headers http.Header) http.Header {
+	result := make(http.Header, len(headers))
+	for key, values := range headers {
+		if _, ok := sensitiveHeaders[http.CanonicalHeaderKey(key)]; ok {
+			result[key] = []string{redacted}
+		} else {
+			result[key] = values
+		}
+	}
+	return result
+}
+
+// RedactURL returns the URL as string with credentials in query params and user info replaced
+func RedactURL(u *url.URL) string {
+	redactedURL := *u
+	if redactedURL.User != nil {
+		redactedURL.User = url.User(redacted)
+	}
+
+	query := redactedURL.Query()
+	for key := range query {
+		name := strings.ToLower(key)
+		for _, sensitive := range sensitiveQueryParams {
+			if strings.Contains(name, sensitive) {
+				query.Set(key, redacted)
+				break
+			}
+		}
+	}
+	redactedURL.RawQuery = query.Encode()
+
+	return redactedURL.String()
+}
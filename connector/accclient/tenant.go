@@ -296,12 +296,10 @@ func parseTenantGetResponse(r *http.Response) (*TenantGetResponse, error) {
 	return &t, nil
 }
 
-// SingleTenantResponse represents the returned tenant object for GET and POST requests of single tenant
-// Currently it's only used for end-to-end test purpose, which only require ID and Version fields.
+// SingleTenantResponse represents the returned tenant object for GET, POST and PUT requests of single tenant
 type SingleTenantResponse struct {
 	Response
-	ID      string `json:"id"`
-	Version int64  `json:"version"`
+	Tenant
 }
 
 func parseTenantResponse(r *http.Response) (*SingleTenantResponse, error) {
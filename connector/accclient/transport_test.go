@@ -0,0 +1,182 @@
+// Copyright (c) 2021 Acronis International GmbH
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package accclient
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var testRetryPolicy = RetryPolicy{
+	MaxRetries:     3,
+	InitialBackoff: time.Millisecond,
+	MaxBackoff:     10 * time.Millisecond,
+	Jitter:         0.2,
+}
+
+// getTestFlakyServer returns a server responding with the given status codes in sequence, then 200 OK
+func getTestFlakyServer(header http.Header, statusCodes ...int) (*httptest.Server, *int32) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		call := int(atomic.AddInt32(&calls, 1))
+		body, _ := ioutil.ReadAll(r.Body)
+		for key := range header {
+			w.Header().Set(key, header.Get(key))
+		}
+		if call <= len(statusCodes) {
+			w.WriteHeader(statusCodes[call-1])
+			return
+		}
+		_, _ = w.Write(body)
+	}))
+	return srv, &calls
+}
+
+func TestRetryTransport_RetriesTransientErrors(t *testing.T) {
+	server, calls := getTestFlakyServer(nil, http.StatusServiceUnavailable, http.StatusTooManyRequests)
+	defer server.Close()
+
+	client := &http.Client{Transport: NewRetryTransport(nil, testRetryPolicy, nil)}
+	req, _ := http.NewRequest(http.MethodPut, server.URL, strings.NewReader(`{"name":"test"}`))
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(resp.Body)
+
+	if resp.StatusCode != http.StatusOK || atomic.LoadInt32(calls) != 3 {
+		t.Errorf("expected 200 after 3 calls, got %d after %d calls", resp.StatusCode, atomic.LoadInt32(calls))
+	}
+	if string(body) != `{"name":"test"}` {
+		t.Errorf("expected request body to be resent on retry, got %q", body)
+	}
+}
+
+func TestRetryTransport_DoesNotRetry(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		status int
+	}{
+		{"Non idempotent method", http.MethodPost, http.StatusServiceUnavailable},
+		{"Client error", http.MethodGet, http.StatusConflict},
+		{"Not implemented", http.MethodGet, http.StatusNotImplemented},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, calls := getTestFlakyServer(nil, tt.status)
+			defer server.Close()
+
+			client := &http.Client{Transport: NewRetryTransport(nil, testRetryPolicy, nil)}
+			req, _ := http.NewRequest(tt.method, server.URL, nil)
+			resp, err := client.Do(req)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			resp.Body.Close()
+
+			if resp.StatusCode != tt.status || atomic.LoadInt32(calls) != 1 {
+				t.Errorf("expected %d after 1 call, got %d after %d calls", tt.status, resp.StatusCode, atomic.LoadInt32(calls))
+			}
+		})
+	}
+}
+
+func TestRetryTransport_GivesUp(t *testing.T) {
+	server, calls := getTestFlakyServer(nil, 500, 500, 500, 500, 500)
+	defer server.Close()
+
+	client := &http.Client{Transport: NewRetryTransport(nil, testRetryPolicy, nil)}
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusInternalServerError || atomic.LoadInt32(calls) != 4 {
+		t.Errorf("expected 500 after 4 calls, got %d after %d calls", resp.StatusCode, atomic.LoadInt32(calls))
+	}
+}
+
+func TestRetryTransport_RetryAfterTooLong(t *testing.T) {
+	server, calls := getTestFlakyServer(http.Header{"Retry-After": []string{"3600"}}, http.StatusTooManyRequests)
+	defer server.Close()
+
+	c := NewClient(&http.Client{Transport: NewRetryTransport(nil, testRetryPolicy, nil)}, server.URL)
+	_, err := c.GetTenant(context.Background(), "id")
+
+	var clientErr Error
+	if !IsRateLimited(err) || atomic.LoadInt32(calls) != 1 {
+		t.Fatalf("expected rate limited error after 1 call, got %v after %d calls", err, atomic.LoadInt32(calls))
+	}
+	if errors.As(err, &clientErr); clientErr.RetryAfter != time.Hour {
+		t.Errorf("expected RetryAfter of 1h, got %v", clientErr.RetryAfter)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2021, time.March, 15, 10, 0, 0, 0, time.UTC)
+	tests := []struct {
+		value string
+		want  time.Duration
+		ok    bool
+	}{
+		{"", 0, false},
+		{"120", 2 * time.Minute, true},
+		{"-1", 0, false},
+		{"Mon, 15 Mar 2021 10:00:30 GMT", 30 * time.Second, true},
+		{"Mon, 15 Mar 2021 09:00:00 GMT", 0, true},
+		{"soon", 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := parseRetryAfter(tt.value, now)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("parseRetryAfter(%q) = %v, %v, want %v, %v", tt.value, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestRateLimiter(t *testing.T) {
+	limiter := NewRateLimiter(100, 2)
+	start := time.Now()
+	for i := 0; i < 4; i++ {
+		if err := limiter.Wait(context.Background()); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	// 2 requests are allowed by burst, the rest is throttled to 100 requests per second
+	if elapsed := time.Since(start); elapsed < 15*time.Millisecond {
+		t.Errorf("expected requests to be throttled, took %v", elapsed)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := NewRateLimiter(0.001, 1).Wait(ctx); err != nil {
+		t.Errorf("expected first request within burst to pass, got %v", err)
+	}
+}
@@ -239,3 +239,78 @@ func parseUserPostRespose(r *http.Response) (*UserPostResponse, error) {
 
 	return &u, nil
 }
+
+// =================================
+// Get/Put single User
+// =================================
+
+// SingleUserResponse represents the returned user object for GET and PUT requests of single user
+type SingleUserResponse struct {
+	Response
+	User
+}
+
+func parseUserResponse(r *http.Response) (*SingleUserResponse, error) {
+	var u SingleUserResponse
+	if err := json.NewDecoder(r.Body).Decode(&u); err != nil {
+		return nil, err
+	}
+
+	u.StatusCode = r.StatusCode
+	u.HTTPHeader = r.Header
+
+	return &u, nil
+}
+
+// UserPutRequest represents the input params for the PUT User request
+type UserPutRequest struct {
+	// User`s version, must match the current version of the user
+	Version int `json:"version"`
+
+	// User's login
+	Login *string `json:"login,omitempty"`
+
+	Contact *Contact `json:"contact,omitempty"`
+
+	// Flag, indicates whether the user is enabled or disabled
+	Enabled *bool `json:"enabled,omitempty"`
+
+	// Preferred locale, represented with 2 characters, e.g. "en"
+	Language *string `json:"language,omitempty"`
+
+	// Identity provider UUID
+	IdpID *string `json:"idp_id,omitempty"`
+
+	// User's ID in external identity provider
+	ExternalID *string `json:"external_id,omitempty"`
+
+	BusinessTypes *[]BusinessType     `json:"business_types,omitempty"`
+	Notifications *[]UserNotification `json:"notifications,omitempty"`
+}
+
+// =================================
+// User activation and login
+// =================================
+
+// UserPasswordPostRequest represents the request body to set the password of a user
+type UserPasswordPostRequest struct {
+	Password string `json:"password"`
+}
+
+// UserAccessPoliciesResponse represents the response from the Get User Access Policies API
+type UserAccessPoliciesResponse struct {
+	Response
+	AccessPolicyList
+}
+
+func parseUserAccessPoliciesResponse(r *http.Response) (*UserAccessPoliciesResponse, error) {
+	var apl UserAccessPoliciesResponse
+	if err := json.NewDecoder(r.Body).Decode(&apl); err != nil {
+		return nil, err
+	}
+
+	apl.StatusCode = r.StatusCode
+	apl.HTTPHeader = r.Header
+
+	return &apl, nil
+}
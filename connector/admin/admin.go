@@ -0,0 +1,279 @@
+// Copyright (c) 2021 Acronis International GmbH
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+// Package admin provides the HTTP API to administer a running connector:
+//
+//	GET  /reports?limit=N        last N reconciliation reports without their lists of entities, newest first
+//	GET  /reports/{id}           reconciliation report with its lists of entities
+//	POST /tenants/{id}/resync    start a job pushing the tenant subtree into external system
+//	POST /users/{id}/resync      start a job pushing the user into external system
+//	POST /usages/push            start a job pushing all usages into Acronis cloud
+//	GET  /jobs                   running and last finished jobs, newest first
+//	GET  /jobs/{id}              status of the job
+//	GET  /loops                  whether each loop is paused
+//	POST /loops/{name}/pause     pause the loop after its current cycle
+//	POST /loops/{name}/resume    resume the loop
+//
+// Requests are authenticated with the bearer token set in the configuration, e.g.
+// "Authorization: Bearer <token>". Without the token, all requests are denied.
+package admin
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/acronis/acronis-cyber-cloud-go-sample-connector/connector/core/updater"
+)
+
+// defaultReportsLimit is the number of reports listed if limit is not set
+const defaultReportsLimit = 20
+
+// bearerPrefix is the prefix of the token in the Authorization header
+const bearerPrefix = "Bearer "
+
+// Config defines the configuration of the admin HTTP API
+type Config struct {
+	ListenAddress string `yaml:"listenAddress"` // address of the admin HTTP API, e.g. 127.0.0.1:8081, disabled if empty
+	Token         string `yaml:"token"`         // bearer token of requests, required if the API is enabled
+}
+
+// Validate checks that the token is set if the admin HTTP API is enabled
+func (c Config) Validate() error {
+	if c.ListenAddress != "" && c.Token == "" {
+		return errors.New("admin token is required if admin listen address is set")
+	}
+	return nil
+}
+
+// Updater is the part of updater.Updater administered through the API
+type Updater interface {
+	Reports(limit int) ([]*updater.ReconciliationReport, error)
+	Report(id string) (*updater.ReconciliationReport, bool, error)
+
+	ResyncTenant(tenantID string) updater.Job
+	ResyncUser(userID string) updater.Job
+	PushUsages() updater.Job
+	Jobs() []updater.Job
+	Job(id string) (updater.Job, bool)
+
+	Loops() []updater.LoopStatus
+	PauseLoop(name string) error
+	ResumeLoop(name string) error
+}
+
+type handler struct {
+	updater Updater
+	token   string
+}
+
+// NewHandler returns the handler of the admin HTTP API of the updater, authenticating requests with the token
+func NewHandler(u Updater, token string) http.Handler {
+	h := &handler{updater: u, token: token}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/reports", h.handleReports)
+	mux.HandleFunc("/reports/", h.handleReport)
+	mux.HandleFunc("/tenants/", h.handleResyncTenant)
+	mux.HandleFunc("/users/", h.handleResyncUser)
+	mux.HandleFunc("/usages/push", h.handlePushUsages)
+	mux.HandleFunc("/jobs", h.handleJobs)
+	mux.HandleFunc("/jobs/", h.handleJob)
+	mux.HandleFunc("/loops", h.handleLoops)
+	mux.HandleFunc("/loops/", h.handleLoop)
+	return h.authenticate(mux)
+}
+
+// authenticate checks the bearer token of requests, all requests are denied if the token is not set
+func (h *handler) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if h.token == "" {
+			writeError(w, http.StatusForbidden, "admin token is not configured")
+			return
+		}
+
+		header := r.Header.Get("Authorization")
+		if !strings.HasPrefix(header, bearerPrefix) ||
+			subtle.ConstantTimeCompare([]byte(strings.TrimPrefix(header, bearerPrefix)), []byte(h.token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeError(w, http.StatusUnauthorized, "unauthorized")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (h *handler) handleReports(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	limit := defaultReportsLimit
+	if value := r.URL.Query().Get("limit"); value != "" {
+		var err error
+		if limit, err = strconv.Atoi(value); err != nil || limit <= 0 {
+			writeError(w, http.StatusBadRequest, "invalid limit "+value)
+			return
+		}
+	}
+
+	reports, err := h.updater.Reports(limit)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if reports == nil {
+		reports = []*updater.ReconciliationReport{}
+	}
+	writeJSON(w, http.StatusOK, reports)
+}
+
+func (h *handler) handleReport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	id := strings.TrimPrefix(r.URL.Path, "/reports/")
+	report, ok, err := h.updater.Report(id)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if !ok {
+		writeError(w, http.StatusNotFound, "report "+id+" not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, report)
+}
+
+func (h *handler) handleResyncTenant(w http.ResponseWriter, r *http.Request) {
+	tenantID, _, ok := parseAction(w, r, "/tenants/", "resync")
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusAccepted, h.updater.ResyncTenant(tenantID))
+}
+
+func (h *handler) handleResyncUser(w http.ResponseWriter, r *http.Request) {
+	userID, _, ok := parseAction(w, r, "/users/", "resync")
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusAccepted, h.updater.ResyncUser(userID))
+}
+
+func (h *handler) handlePushUsages(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	writeJSON(w, http.StatusAccepted, h.updater.PushUsages())
+}
+
+func (h *handler) handleJobs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	writeJSON(w, http.StatusOK, h.updater.Jobs())
+}
+
+func (h *handler) handleJob(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	id := strings.TrimPrefix(r.URL.Path, "/jobs/")
+	job, ok := h.updater.Job(id)
+	if !ok {
+		writeError(w, http.StatusNotFound, "job "+id+" not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, job)
+}
+
+func (h *handler) handleLoops(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	writeJSON(w, http.StatusOK, h.updater.Loops())
+}
+
+func (h *handler) handleLoop(w http.ResponseWriter, r *http.Request) {
+	name, action, ok := parseAction(w, r, "/loops/", "pause", "resume")
+	if !ok {
+		return
+	}
+	var err error
+	if action == "pause" {
+		err = h.updater.PauseLoop(name)
+	} else {
+		err = h.updater.ResumeLoop(name)
+	}
+	if err != nil {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, h.updater.Loops())
+}
+
+// parseAction splits the path {prefix}{id}/{action} of POST requests into the ID and one of the actions,
+// an error is written if the request doesn't match
+func parseAction(w http.ResponseWriter, r *http.Request, prefix string, actions ...string) (id, action string, ok bool) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, prefix), "/")
+	if len(parts) != 2 || parts[0] == "" || !contains(actions, parts[1]) {
+		writeError(w, http.StatusNotFound, "not found")
+		return "", "", false
+	}
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return "", "", false
+	}
+	return parts[0], parts[1], true
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// errorResponse is the body of error responses
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, errorResponse{Error: message})
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,257 @@
+// Copyright (c) 2021 Acronis International GmbH
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package admin
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/acronis/acronis-cyber-cloud-go-sample-connector/connector/core/updater"
+)
+
+// testToken is the admin token of test handlers
+const testToken = "secret"
+
+// fakeUpdater serves the reports of a report store, records started jobs and paused loops
+type fakeUpdater struct {
+	store  *updater.MemoryReportStore
+	jobs   []updater.Job
+	paused map[string]bool
+}
+
+func (f *fakeUpdater) Reports(limit int) ([]*updater.ReconciliationReport, error) {
+	return f.store.List(limit)
+}
+
+func (f *fakeUpdater) Report(id string) (*updater.ReconciliationReport, bool, error) {
+	return f.store.Get(id)
+}
+
+func (f *fakeUpdater) ResyncTenant(tenantID string) updater.Job {
+	return f.start(updater.JobResyncTenant, tenantID)
+}
+
+func (f *fakeUpdater) ResyncUser(userID string) updater.Job {
+	return f.start(updater.JobResyncUser, userID)
+}
+
+func (f *fakeUpdater) PushUsages() updater.Job {
+	return f.start(updater.JobPushUsages, "")
+}
+
+func (f *fakeUpdater) start(kind, target string) updater.Job {
+	job := updater.Job{ID: fmt.Sprintf("job-%v", len(f.jobs)+1), Kind: kind, Target: target, Status: updater.JobRunning}
+	f.jobs = append(f.jobs, job)
+	return job
+}
+
+func (f *fakeUpdater) Jobs() []updater.Job {
+	return f.jobs
+}
+
+func (f *fakeUpdater) Job(id string) (updater.Job, bool) {
+	for _, job := range f.jobs {
+		if job.ID == id {
+			return job, true
+		}
+	}
+	return updater.Job{}, false
+}
+
+func (f *fakeUpdater) Loops() []updater.LoopStatus {
+	return []updater.LoopStatus{{Name: updater.LoopSync, Paused: f.paused[updater.LoopSync]}}
+}
+
+func (f *fakeUpdater) PauseLoop(name string) error {
+	return f.setPaused(name, true)
+}
+
+func (f *fakeUpdater) ResumeLoop(name string) error {
+	return f.setPaused(name, false)
+}
+
+func (f *fakeUpdater) setPaused(name string, paused bool) error {
+	if name != updater.LoopSync {
+		return fmt.Errorf("unknown loop %v", name)
+	}
+	f.paused[name] = paused
+	return nil
+}
+
+func get(t *testing.T, server *httptest.Server, path string, body interface{}) int {
+	t.Helper()
+	return request(t, server, http.MethodGet, path, testToken, body)
+}
+
+// request sends the request with the bearer token, if set, decoding the response into body
+func request(t *testing.T, server *httptest.Server, method, path, token string, body interface{}) int {
+	t.Helper()
+	req, err := http.NewRequest(method, server.URL+path, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("%v %v error = %v", method, path, err)
+	}
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(body); err != nil {
+		t.Fatalf("%v %v returned invalid body: %v", method, path, err)
+	}
+	return resp.StatusCode
+}
+
+func TestHandler_Reports(t *testing.T) {
+	store := updater.NewMemoryReportStore(10)
+	for _, id := range []string{"r1", "r2", "r3"} {
+		_ = store.Save(&updater.ReconciliationReport{
+			ID:      id,
+			Kind:    updater.ReportTenantsAndOfferingItems,
+			Created: []updater.ReportEntry{{Kind: updater.EntityTenant, ID: "t1", Reason: "missing in external system"}},
+		})
+	}
+	server := httptest.NewServer(NewHandler(&fakeUpdater{store: store}, testToken))
+	defer server.Close()
+
+	var reports []updater.ReconciliationReport
+	if status := get(t, server, "/reports?limit=2", &reports); status != http.StatusOK {
+		t.Fatalf("unexpected status %v", status)
+	}
+	if len(reports) != 2 || reports[0].ID != "r3" || reports[1].ID != "r2" {
+		t.Errorf("expected 2 last reports, got %+v", reports)
+	}
+
+	var report updater.ReconciliationReport
+	if status := get(t, server, "/reports/r1", &report); status != http.StatusOK {
+		t.Fatalf("unexpected status %v", status)
+	}
+	if report.ID != "r1" || len(report.Created) != 1 || report.Created[0].ID != "t1" {
+		t.Errorf("unexpected report %+v", report)
+	}
+
+	var errResp errorResponse
+	if status := get(t, server, "/reports/unknown", &errResp); status != http.StatusNotFound || errResp.Error == "" {
+		t.Errorf("expected not found, got %v %+v", status, errResp)
+	}
+	if status := get(t, server, "/reports?limit=x", &errResp); status != http.StatusBadRequest {
+		t.Errorf("expected bad request for invalid limit, got %v", status)
+	}
+}
+
+func post(t *testing.T, server *httptest.Server, path, token string, body interface{}) int {
+	t.Helper()
+	return request(t, server, http.MethodPost, path, token, body)
+}
+
+func TestHandler_Jobs(t *testing.T) {
+	u := &fakeUpdater{store: updater.NewMemoryReportStore(10), paused: make(map[string]bool)}
+	server := httptest.NewServer(NewHandler(u, testToken))
+	defer server.Close()
+
+	var job updater.Job
+	if status := post(t, server, "/tenants/t1/resync", testToken, &job); status != http.StatusAccepted {
+		t.Fatalf("unexpected status %v", status)
+	}
+	if job.Kind != updater.JobResyncTenant || job.Target != "t1" || job.Status != updater.JobRunning {
+		t.Errorf("expected job resyncing tenant t1, got %+v", job)
+	}
+	if status := post(t, server, "/users/u1/resync", testToken, &job); status != http.StatusAccepted || job.Target != "u1" {
+		t.Errorf("expected job resyncing user u1, got %v %+v", status, job)
+	}
+	if status := post(t, server, "/usages/push", testToken, &job); status != http.StatusAccepted || job.Kind != updater.JobPushUsages {
+		t.Errorf("expected job pushing usages, got %v %+v", status, job)
+	}
+
+	if status := request(t, server, http.MethodGet, "/jobs/job-1", testToken, &job); status != http.StatusOK || job.Target != "t1" {
+		t.Errorf("expected job resyncing tenant t1, got %v %+v", status, job)
+	}
+	var jobs []updater.Job
+	if status := request(t, server, http.MethodGet, "/jobs", testToken, &jobs); status != http.StatusOK || len(jobs) != 3 {
+		t.Errorf("expected 3 jobs, got %v %+v", status, jobs)
+	}
+
+	var loops []updater.LoopStatus
+	if status := post(t, server, "/loops/sync_loop/pause", testToken, &loops); status != http.StatusOK || !loops[0].Paused {
+		t.Errorf("expected paused sync loop, got %v %+v", status, loops)
+	}
+	if status := post(t, server, "/loops/sync_loop/resume", testToken, &loops); status != http.StatusOK || loops[0].Paused {
+		t.Errorf("expected resumed sync loop, got %v %+v", status, loops)
+	}
+
+	var errResp errorResponse
+	if status := post(t, server, "/loops/unknown/pause", testToken, &errResp); status != http.StatusNotFound {
+		t.Errorf("expected not found for unknown loop, got %v", status)
+	}
+	if status := post(t, server, "/tenants/t1", testToken, &errResp); status != http.StatusNotFound {
+		t.Errorf("expected not found without action, got %v", status)
+	}
+	if status := post(t, server, "/tenants/t1/resync", "wrong", &errResp); status != http.StatusUnauthorized {
+		t.Errorf("expected unauthorized with wrong token, got %v", status)
+	}
+	if status := request(t, server, http.MethodGet, "/jobs", "", &errResp); status != http.StatusUnauthorized {
+		t.Errorf("expected unauthorized without token, got %v", status)
+	}
+
+	req, err := http.NewRequest(http.MethodGet, server.URL+"/jobs", nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	req.Header.Set("Authorization", testToken)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("GET /jobs error = %v", err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected unauthorized with token without Bearer prefix, got %v", resp.StatusCode)
+	}
+}
+
+func TestHandler_WithoutToken(t *testing.T) {
+	u := &fakeUpdater{store: updater.NewMemoryReportStore(10), paused: make(map[string]bool)}
+	server := httptest.NewServer(NewHandler(u, ""))
+	defer server.Close()
+
+	var errResp errorResponse
+	if status := get(t, server, "/loops", &errResp); status != http.StatusForbidden {
+		t.Errorf("expected GET requests forbidden without token, got %v", status)
+	}
+	if status := post(t, server, "/usages/push", "", &errResp); status != http.StatusForbidden || len(u.jobs) != 0 {
+		t.Errorf("expected POST requests forbidden without token, got %v", status)
+	}
+}
+
+func TestConfig_Validate(t *testing.T) {
+	if err := (Config{ListenAddress: "127.0.0.1:8081"}).Validate(); err == nil {
+		t.Error("expected error without token")
+	}
+	if err := (Config{ListenAddress: "127.0.0.1:8081", Token: testToken}).Validate(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := (Config{}).Validate(); err != nil {
+		t.Errorf("unexpected error for disabled API: %v", err)
+	}
+}
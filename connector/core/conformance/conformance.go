@@ -0,0 +1,606 @@
+// Copyright (c) 2021 Acronis International GmbH
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+// Package conformance provides a reusable test suite which verifies that an implementation of
+// core.ExternalSystemClient follows the contract connector relies on:
+//  1. CreateOrUpdate* returns created=true for new objects and created=false for updates
+//  2. Delete* is idempotent, deleting an object which doesn't exist is not an error
+//  3. deleted objects are neither reported as existing nor returned by GetActive*IDs
+//  4. GetActive*IDs pages are stable, contain at most "limit" items, and the last page has less than "limit" items
+//  5. GetActive*IDs return IDs in ascending byte-wise order, offering items by tenant ID, then by name
+//  6. GetActiveOfferingItemIDs excludes disabled offering items (status 0)
+//  7. GetTenantFingerprints and GetUserFingerprints follow the contract of GetActive*IDs and return fingerprints
+//     of the content pushed last, computed with core.TenantFingerprint and core.UserFingerprint
+//  8. GetUserParents and GetAccessPolicyParents follow the contract of GetActive*IDs and return the tenant ID
+//     of users and the trustee user ID of access policies
+//
+// Implementations run the suite from their own tests:
+//
+//	func TestConformance(t *testing.T) {
+//		conformance.Run(t, func(t *testing.T) core.ExternalSystemClient {
+//			return NewExternalSystem(...)
+//		})
+//	}
+//
+// The suite creates objects with random IDs and deletes them at the end of each test,
+// so it can run against an external-system which already contains data.
+package conformance
+
+import (
+	"crypto/rand"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/acronis/acronis-cyber-cloud-go-sample-connector/connector/accclient"
+	"github.com/acronis/acronis-cyber-cloud-go-sample-connector/connector/core"
+)
+
+// Factory returns the implementation of core.ExternalSystemClient under test, it is called once per test
+type Factory func(t *testing.T) core.ExternalSystemClient
+
+// pageSize is the limit used to page through active objects, small enough to span multiple pages
+const pageSize = 2
+
+// objectsCount is the number of objects created to verify pagination
+const objectsCount = 5
+
+// maxPages stops paging through implementations which never return the last page
+const maxPages = 100000
+
+// Run runs the conformance suite against the implementation returned by factory.
+// Optional extensions core.CustomerIDClient, core.UsageCursorClient, core.FingerprintClient and core.ParentsClient
+// are verified if implemented.
+func Run(t *testing.T, factory Factory) {
+	t.Run("Tenants", func(t *testing.T) { testTenants(t, factory(t)) })
+	t.Run("TenantsPagination", func(t *testing.T) { testTenantsPagination(t, factory(t)) })
+	t.Run("OfferingItems", func(t *testing.T) { testOfferingItems(t, factory(t)) })
+	t.Run("OfferingItemsPagination", func(t *testing.T) { testOfferingItemsPagination(t, factory(t)) })
+	t.Run("Users", func(t *testing.T) { testUsers(t, factory(t)) })
+	t.Run("UsersPagination", func(t *testing.T) { testUsersPagination(t, factory(t)) })
+	t.Run("AccessPolicies", func(t *testing.T) { testAccessPolicies(t, factory(t)) })
+	t.Run("AccessPoliciesPagination", func(t *testing.T) { testAccessPoliciesPagination(t, factory(t)) })
+	t.Run("Usages", func(t *testing.T) { testUsages(t, factory(t)) })
+}
+
+func testTenants(t *testing.T, client core.ExternalSystemClient) {
+	parent := createTenant(t, client, "")
+	tenant := newTenant(parent.ID)
+
+	if exists, err := client.CheckTenantExist(tenant.ID); err != nil || exists {
+		t.Errorf("CheckTenantExist() of new tenant = %v, %v, want false, nil", exists, err)
+	}
+
+	created, err := client.CreateOrUpdateTenant(tenant)
+	if err != nil || !created {
+		t.Fatalf("CreateOrUpdateTenant() of new tenant = %v, %v, want true, nil", created, err)
+	}
+	defer deleteTenant(t, client, tenant.ID)
+
+	tenant.Version++
+	tenant.Name += " updated"
+	if created, err := client.CreateOrUpdateTenant(tenant); err != nil || created {
+		t.Errorf("CreateOrUpdateTenant() of existing tenant = %v, %v, want false, nil", created, err)
+	}
+
+	if exists, err := client.CheckTenantExist(tenant.ID); err != nil || !exists {
+		t.Errorf("CheckTenantExist() of created tenant = %v, %v, want true, nil", exists, err)
+	}
+	if ids := activeIDs(t, "GetActiveTenantIDs", client.GetActiveTenantIDs); !ids[tenant.ID] {
+		t.Errorf("GetActiveTenantIDs() doesn't return created tenant %v", tenant.ID)
+	}
+	if fingerprintClient, ok := client.(core.FingerprintClient); ok {
+		checkFingerprint(t, "GetTenantFingerprints", fingerprintClient.GetTenantFingerprints, core.TenantFingerprint(tenant))
+	}
+
+	if custClient, ok := client.(core.CustomerIDClient); ok {
+		if created, _, err := custClient.CreateOrUpdateTenantWithCustomerID(tenant); err != nil || created {
+			t.Errorf("CreateOrUpdateTenantWithCustomerID() of existing tenant = %v, %v, want false, nil", created, err)
+		}
+	}
+
+	if err := client.DeleteTenant(tenant.ID); err != nil {
+		t.Fatalf("DeleteTenant() error = %v", err)
+	}
+	if exists, err := client.CheckTenantExist(tenant.ID); err != nil || exists {
+		t.Errorf("CheckTenantExist() of deleted tenant = %v, %v, want false, nil", exists, err)
+	}
+	if ids := activeIDs(t, "GetActiveTenantIDs", client.GetActiveTenantIDs); ids[tenant.ID] {
+		t.Errorf("GetActiveTenantIDs() returns deleted tenant %v", tenant.ID)
+	}
+	if err := client.DeleteTenant(tenant.ID); err != nil {
+		t.Errorf("DeleteTenant() of deleted tenant error = %v, want nil", err)
+	}
+}
+
+func testTenantsPagination(t *testing.T, client core.ExternalSystemClient) {
+	parent := createTenant(t, client, "")
+	var ids []string
+	for i := 0; i < objectsCount; i++ {
+		ids = append(ids, createTenant(t, client, parent.ID).ID)
+	}
+
+	active := activeIDs(t, "GetActiveTenantIDs", client.GetActiveTenantIDs)
+	for _, id := range append(ids, parent.ID) {
+		if !active[id] {
+			t.Errorf("GetActiveTenantIDs() doesn't return created tenant %v", id)
+		}
+	}
+}
+
+func testOfferingItems(t *testing.T, client core.ExternalSystemClient) {
+	tenant := createTenant(t, client, "")
+	item := newOfferingItem(tenant.ID, 1)
+	itemID := core.OfferingItemID{OfferingItemName: item.Name, TenantID: item.TenantID}
+
+	created, err := client.CreateOrUpdateOfferingItem(item)
+	if err != nil || !created {
+		t.Fatalf("CreateOrUpdateOfferingItem() of new offering item = %v, %v, want true, nil", created, err)
+	}
+	defer deleteOfferingItem(t, client, itemID)
+
+	quota := 10.0
+	item.Quota.Value = &quota
+	item.Quota.Version++
+	if created, err := client.CreateOrUpdateOfferingItem(item); err != nil || created {
+		t.Errorf("CreateOrUpdateOfferingItem() of existing offering item = %v, %v, want false, nil", created, err)
+	}
+	if ids := activeOfferingItemIDs(t, client); !ids[itemID] {
+		t.Errorf("GetActiveOfferingItemIDs() doesn't return enabled offering item %+v", itemID)
+	}
+
+	// connector may pass disabled items, e.g. during reconciliation of offering items of a tenant
+	disabled := newOfferingItem(tenant.ID, 0)
+	disabledID := core.OfferingItemID{OfferingItemName: disabled.Name, TenantID: disabled.TenantID}
+	if _, err := client.CreateOrUpdateOfferingItem(disabled); err != nil {
+		t.Fatalf("CreateOrUpdateOfferingItem() of disabled offering item error = %v", err)
+	}
+	defer deleteOfferingItem(t, client, disabledID)
+	if ids := activeOfferingItemIDs(t, client); ids[disabledID] {
+		t.Errorf("GetActiveOfferingItemIDs() returns disabled offering item %+v", disabledID)
+	}
+
+	if err := client.DeleteOfferingItem(itemID); err != nil {
+		t.Fatalf("DeleteOfferingItem() error = %v", err)
+	}
+	if ids := activeOfferingItemIDs(t, client); ids[itemID] {
+		t.Errorf("GetActiveOfferingItemIDs() returns deleted offering item %+v", itemID)
+	}
+	if err := client.DeleteOfferingItem(itemID); err != nil {
+		t.Errorf("DeleteOfferingItem() of deleted offering item error = %v, want nil", err)
+	}
+}
+
+func testOfferingItemsPagination(t *testing.T, client core.ExternalSystemClient) {
+	tenant := createTenant(t, client, "")
+	var ids []core.OfferingItemID
+	for i := 0; i < objectsCount; i++ {
+		// disabled items in between must not shorten the pages
+		for _, status := range []int{1, 0} {
+			item := newOfferingItem(tenant.ID, status)
+			if _, err := client.CreateOrUpdateOfferingItem(item); err != nil {
+				t.Fatalf("CreateOrUpdateOfferingItem() error = %v", err)
+			}
+			itemID := core.OfferingItemID{OfferingItemName: item.Name, TenantID: item.TenantID}
+			defer deleteOfferingItem(t, client, itemID)
+			if status > 0 {
+				ids = append(ids, itemID)
+			}
+		}
+	}
+
+	active := activeOfferingItemIDs(t, client)
+	for _, id := range ids {
+		if !active[id] {
+			t.Errorf("GetActiveOfferingItemIDs() doesn't return enabled offering item %+v", id)
+		}
+	}
+}
+
+func testUsers(t *testing.T, client core.ExternalSystemClient) {
+	tenant := createTenant(t, client, "")
+	user := newUser(tenant.ID)
+
+	created, err := client.CreateOrUpdateUser(user)
+	if err != nil || !created {
+		t.Fatalf("CreateOrUpdateUser() of new user = %v, %v, want true, nil", created, err)
+	}
+	defer deleteUser(t, client, user.ID)
+
+	user.Version++
+	user.Activated = true
+	if created, err := client.CreateOrUpdateUser(user); err != nil || created {
+		t.Errorf("CreateOrUpdateUser() of existing user = %v, %v, want false, nil", created, err)
+	}
+	if ids := activeIDs(t, "GetActiveUserIDs", client.GetActiveUserIDs); !ids[user.ID] {
+		t.Errorf("GetActiveUserIDs() doesn't return created user %v", user.ID)
+	}
+	if fingerprintClient, ok := client.(core.FingerprintClient); ok {
+		checkFingerprint(t, "GetUserFingerprints", fingerprintClient.GetUserFingerprints, core.UserFingerprint(user))
+	}
+	if parentsClient, ok := client.(core.ParentsClient); ok {
+		checkParent(t, "GetUserParents", parentsClient.GetUserParents, user.ID, user.TenantID)
+	}
+
+	if err := client.DeleteUser(user.ID); err != nil {
+		t.Fatalf("DeleteUser() error = %v", err)
+	}
+	if ids := activeIDs(t, "GetActiveUserIDs", client.GetActiveUserIDs); ids[user.ID] {
+		t.Errorf("GetActiveUserIDs() returns deleted user %v", user.ID)
+	}
+	if err := client.DeleteUser(user.ID); err != nil {
+		t.Errorf("DeleteUser() of deleted user error = %v, want nil", err)
+	}
+}
+
+func testUsersPagination(t *testing.T, client core.ExternalSystemClient) {
+	tenant := createTenant(t, client, "")
+	var ids []string
+	for i := 0; i < objectsCount; i++ {
+		ids = append(ids, createUser(t, client, tenant.ID).ID)
+	}
+
+	active := activeIDs(t, "GetActiveUserIDs", client.GetActiveUserIDs)
+	for _, id := range ids {
+		if !active[id] {
+			t.Errorf("GetActiveUserIDs() doesn't return created user %v", id)
+		}
+	}
+}
+
+func testAccessPolicies(t *testing.T, client core.ExternalSystemClient) {
+	tenant := createTenant(t, client, "")
+	user := createUser(t, client, tenant.ID)
+	accessPolicy := newAccessPolicy(tenant.ID, user.ID)
+
+	created, err := client.CreateOrUpdateAccessPolicy(accessPolicy)
+	if err != nil || !created {
+		t.Fatalf("CreateOrUpdateAccessPolicy() of new access policy = %v, %v, want true, nil", created, err)
+	}
+	defer deleteAccessPolicy(t, client, accessPolicy.ID)
+
+	accessPolicy.Version++
+	accessPolicy.RoleID = accclient.RoleIDReadOnlyAdmin
+	if created, err := client.CreateOrUpdateAccessPolicy(accessPolicy); err != nil || created {
+		t.Errorf("CreateOrUpdateAccessPolicy() of existing access policy = %v, %v, want false, nil", created, err)
+	}
+	if ids := activeIDs(t, "GetActiveAccessPolicyIDs", client.GetActiveAccessPolicyIDs); !ids[accessPolicy.ID] {
+		t.Errorf("GetActiveAccessPolicyIDs() doesn't return created access policy %v", accessPolicy.ID)
+	}
+	if parentsClient, ok := client.(core.ParentsClient); ok {
+		checkParent(t, "GetAccessPolicyParents", parentsClient.GetAccessPolicyParents, accessPolicy.ID, accessPolicy.TrusteeID)
+	}
+
+	if err := client.DeleteAccessPolicy(accessPolicy.ID); err != nil {
+		t.Fatalf("DeleteAccessPolicy() error = %v", err)
+	}
+	if ids := activeIDs(t, "GetActiveAccessPolicyIDs", client.GetActiveAccessPolicyIDs); ids[accessPolicy.ID] {
+		t.Errorf("GetActiveAccessPolicyIDs() returns deleted access policy %v", accessPolicy.ID)
+	}
+	if err := client.DeleteAccessPolicy(accessPolicy.ID); err != nil {
+		t.Errorf("DeleteAccessPolicy() of deleted access policy error = %v, want nil", err)
+	}
+}
+
+func testAccessPoliciesPagination(t *testing.T, client core.ExternalSystemClient) {
+	tenant := createTenant(t, client, "")
+	user := createUser(t, client, tenant.ID)
+	var ids []string
+	for i := 0; i < objectsCount; i++ {
+		accessPolicy := newAccessPolicy(tenant.ID, user.ID)
+		if _, err := client.CreateOrUpdateAccessPolicy(accessPolicy); err != nil {
+			t.Fatalf("CreateOrUpdateAccessPolicy() error = %v", err)
+		}
+		defer deleteAccessPolicy(t, client, accessPolicy.ID)
+		ids = append(ids, accessPolicy.ID)
+	}
+
+	active := activeIDs(t, "GetActiveAccessPolicyIDs", client.GetActiveAccessPolicyIDs)
+	for _, id := range ids {
+		if !active[id] {
+			t.Errorf("GetActiveAccessPolicyIDs() doesn't return created access policy %v", id)
+		}
+	}
+}
+
+// testUsages only verifies paging, usages can't be created through core.ExternalSystemClient
+func testUsages(t *testing.T, client core.ExternalSystemClient) {
+	pages := 0
+	for offset := 0; pages < maxPages; offset += pageSize {
+		usages, err := client.GetUsages(offset, pageSize)
+		if err != nil {
+			t.Fatalf("GetUsages(%v, %v) error = %v", offset, pageSize, err)
+		}
+		if len(usages) > pageSize {
+			t.Fatalf("GetUsages(%v, %v) returned %v usages, more than limit", offset, pageSize, len(usages))
+		}
+		pages++
+		if len(usages) < pageSize {
+			break
+		}
+	}
+	if pages >= maxPages {
+		t.Errorf("GetUsages() didn't return the last page after %v pages", maxPages)
+	}
+
+	cursorClient, ok := client.(core.UsageCursorClient)
+	if !ok {
+		return
+	}
+	after := ""
+	for pages = 0; pages < maxPages; pages++ {
+		usages, nextAfter, err := cursorClient.GetUsagesAfter(after, pageSize)
+		if err != nil {
+			t.Fatalf("GetUsagesAfter(%q, %v) error = %v", after, pageSize, err)
+		}
+		if len(usages) > pageSize {
+			t.Fatalf("GetUsagesAfter(%q, %v) returned %v usages, more than limit", after, pageSize, len(usages))
+		}
+		if nextAfter == "" {
+			return
+		}
+		if nextAfter == after {
+			t.Fatalf("GetUsagesAfter(%q, %v) returned the same cursor", after, pageSize)
+		}
+		after = nextAfter
+	}
+	t.Errorf("GetUsagesAfter() didn't return the last page after %v pages", maxPages)
+}
+
+// ===================
+// helper functions
+// ===================
+
+// activeIDs pages through the IDs returned by getIDs and verifies the pagination contract
+func activeIDs(t *testing.T, name string, getIDs func(offset, limit int) ([]string, error)) map[string]bool {
+	t.Helper()
+	ids := make(map[string]bool)
+	previous := ""
+	for offset, pages := 0, 0; pages < maxPages; offset, pages = offset+pageSize, pages+1 {
+		page, err := getIDs(offset, pageSize)
+		if err != nil {
+			t.Fatalf("%v(%v, %v) error = %v", name, offset, pageSize, err)
+		}
+		if len(page) > pageSize {
+			t.Fatalf("%v(%v, %v) returned %v items, more than limit", name, offset, pageSize, len(page))
+		}
+		for _, id := range page {
+			if id == "" {
+				t.Errorf("%v(%v, %v) returned empty ID", name, offset, pageSize)
+			} else if ids[id] {
+				t.Errorf("%v(%v, %v) returned %v again, pages are not stable", name, offset, pageSize, id)
+			} else if id < previous {
+				t.Errorf("%v(%v, %v) returned %v after %v, IDs are not in ascending order", name, offset, pageSize, id, previous)
+			}
+			ids[id] = true
+			previous = id
+		}
+		if len(page) < pageSize {
+			return ids
+		}
+	}
+	t.Fatalf("%v() didn't return the last page after %v pages", name, maxPages)
+	return nil
+}
+
+// checkFingerprint pages through the fingerprints, verifying the pagination contract,
+// and compares the fingerprint of the object with the expected one
+func checkFingerprint(t *testing.T, name string,
+	getFingerprints func(offset, limit int) ([]core.Fingerprint, error), expected core.Fingerprint) {
+	t.Helper()
+	var found *core.Fingerprint
+	activeIDs(t, name, func(offset, limit int) ([]string, error) {
+		fingerprints, err := getFingerprints(offset, limit)
+		ids := make([]string, len(fingerprints))
+		for i := range fingerprints {
+			ids[i] = fingerprints[i].ID
+			if fingerprints[i].ID == expected.ID {
+				found = &fingerprints[i]
+			}
+		}
+		return ids, err
+	})
+
+	if found == nil {
+		t.Errorf("%v() doesn't return fingerprint of %v", name, expected.ID)
+		return
+	}
+	if found.Hash != expected.Hash {
+		t.Errorf("%v() returned fingerprint of %v with different fields %v", name, expected.ID, expected.DiffFields(found))
+	}
+	if found.Version != 0 && found.Version != expected.Version {
+		t.Errorf("%v() returned version %v of %v, want %v or 0", name, found.Version, expected.ID, expected.Version)
+	}
+}
+
+// checkParent pages through the entities with parents, verifying the pagination contract,
+// and compares the parent ID of the entity with the expected one
+func checkParent(t *testing.T, name string,
+	getParents func(offset, limit int) ([]core.EntityParent, error), id, expectedParentID string) {
+	t.Helper()
+	var found *core.EntityParent
+	activeIDs(t, name, func(offset, limit int) ([]string, error) {
+		parents, err := getParents(offset, limit)
+		ids := make([]string, len(parents))
+		for i := range parents {
+			ids[i] = parents[i].ID
+			if parents[i].ID == id {
+				found = &parents[i]
+			}
+		}
+		return ids, err
+	})
+
+	if found == nil {
+		t.Errorf("%v() doesn't return %v", name, id)
+		return
+	}
+	if found.ParentID != expectedParentID {
+		t.Errorf("%v() returned parent %v of %v, want %v", name, found.ParentID, id, expectedParentID)
+	}
+}
+
+// activeOfferingItemIDs pages through the IDs of active offering items and verifies the pagination contract
+func activeOfferingItemIDs(t *testing.T, client core.ExternalSystemClient) map[core.OfferingItemID]bool {
+	t.Helper()
+	ids := make(map[core.OfferingItemID]bool)
+	var previous core.OfferingItemID
+	for offset, pages := 0, 0; pages < maxPages; offset, pages = offset+pageSize, pages+1 {
+		page, err := client.GetActiveOfferingItemIDs(offset, pageSize)
+		if err != nil {
+			t.Fatalf("GetActiveOfferingItemIDs(%v, %v) error = %v", offset, pageSize, err)
+		}
+		if len(page) > pageSize {
+			t.Fatalf("GetActiveOfferingItemIDs(%v, %v) returned %v items, more than limit", offset, pageSize, len(page))
+		}
+		for _, id := range page {
+			if id.OfferingItemName == "" || id.TenantID == "" {
+				t.Errorf("GetActiveOfferingItemIDs(%v, %v) returned incomplete ID %+v", offset, pageSize, id)
+			} else if ids[id] {
+				t.Errorf("GetActiveOfferingItemIDs(%v, %v) returned %+v again, pages are not stable", offset, pageSize, id)
+			} else if id.TenantID < previous.TenantID ||
+				id.TenantID == previous.TenantID && id.OfferingItemName < previous.OfferingItemName {
+				t.Errorf("GetActiveOfferingItemIDs(%v, %v) returned %+v after %+v, IDs are not in ascending order",
+					offset, pageSize, id, previous)
+			}
+			ids[id] = true
+			previous = id
+		}
+		if len(page) < pageSize {
+			return ids
+		}
+	}
+	t.Fatalf("GetActiveOfferingItemIDs() didn't return the last page after %v pages", maxPages)
+	return nil
+}
+
+func newTenant(parentID string) *accclient.Tenant {
+	now := time.Now().UTC().Truncate(time.Second)
+	id := newUUID()
+	return &accclient.Tenant{
+		ID:        id,
+		Version:   1,
+		CreatedAt: accclient.CustomTime{Time: now},
+		UpdatedAt: accclient.CustomTime{Time: now},
+		Name:      "conformance " + id,
+		ParentID:  parentID,
+		Kind:      "customer",
+		Enabled:   true,
+	}
+}
+
+// createTenant creates a tenant which is deleted at the end of the test
+func createTenant(t *testing.T, client core.ExternalSystemClient, parentID string) *accclient.Tenant {
+	t.Helper()
+	tenant := newTenant(parentID)
+	if _, err := client.CreateOrUpdateTenant(tenant); err != nil {
+		t.Fatalf("CreateOrUpdateTenant() error = %v", err)
+	}
+	t.Cleanup(func() { deleteTenant(t, client, tenant.ID) })
+	return tenant
+}
+
+func deleteTenant(t *testing.T, client core.ExternalSystemClient, tenantID string) {
+	if err := client.DeleteTenant(tenantID); err != nil {
+		t.Logf("Failed to clean up tenant %v: %v", tenantID, err)
+	}
+}
+
+func newOfferingItem(tenantID string, status int) *accclient.OfferingItem {
+	return &accclient.OfferingItem{
+		ApplicationID:   newUUID(),
+		Name:            "conformance_" + newUUID(),
+		UsageName:       "conformance",
+		TenantID:        tenantID,
+		UpdatedAt:       time.Now().UTC().Truncate(time.Second),
+		Status:          status,
+		Type:            "count",
+		MeasurementUnit: "quantity",
+		Quota:           accclient.Quota{Version: 1},
+	}
+}
+
+func deleteOfferingItem(t *testing.T, client core.ExternalSystemClient, itemID core.OfferingItemID) {
+	if err := client.DeleteOfferingItem(itemID); err != nil {
+		t.Logf("Failed to clean up offering item %+v: %v", itemID, err)
+	}
+}
+
+func newUser(tenantID string) *accclient.User {
+	now := time.Now().UTC().Truncate(time.Second)
+	id := newUUID()
+	return &accclient.User{
+		ID:        id,
+		Version:   1,
+		TenantID:  tenantID,
+		Login:     "conformance-" + id,
+		Enabled:   true,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+}
+
+// createUser creates a user which is deleted at the end of the test
+func createUser(t *testing.T, client core.ExternalSystemClient, tenantID string) *accclient.User {
+	t.Helper()
+	user := newUser(tenantID)
+	if _, err := client.CreateOrUpdateUser(user); err != nil {
+		t.Fatalf("CreateOrUpdateUser() error = %v", err)
+	}
+	t.Cleanup(func() { deleteUser(t, client, user.ID) })
+	return user
+}
+
+func deleteUser(t *testing.T, client core.ExternalSystemClient, userID string) {
+	if err := client.DeleteUser(userID); err != nil {
+		t.Logf("Failed to clean up user %v: %v", userID, err)
+	}
+}
+
+func newAccessPolicy(tenantID, userID string) *accclient.AccessPolicy {
+	now := time.Now().UTC().Truncate(time.Second)
+	return &accclient.AccessPolicy{
+		ID:          newUUID(),
+		Version:     1,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+		TrusteeID:   userID,
+		TrusteeType: accclient.TrusteeTypeUser,
+		IssuerID:    tenantID,
+		TenantID:    tenantID,
+		RoleID:      accclient.RoleIDCompanyAdmin,
+	}
+}
+
+func deleteAccessPolicy(t *testing.T, client core.ExternalSystemClient, accessPolicyID string) {
+	if err := client.DeleteAccessPolicy(accessPolicyID); err != nil {
+		t.Logf("Failed to clean up access policy %v: %v", accessPolicyID, err)
+	}
+}
+
+// newUUID generates random UUID version 4, IDs of Acronis cloud objects are UUIDs
+func newUUID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(fmt.Sprintf("failed to generate UUID: %v", err))
+	}
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
@@ -20,11 +20,17 @@
 package core
 
 import (
+	"time"
+
 	"github.com/acronis/acronis-cyber-cloud-go-sample-connector/connector/accclient"
 )
 
 // ExternalSystemClient is an interface to communicate with external system.
 // Communication could be in the form of pushing change events from connector or pulling data from external system.
+//
+// IDs for reconciliation (GetActiveTenantIDs, GetActiveOfferingItemIDs, GetActiveUserIDs and GetActiveAccessPolicyIDs)
+// must be returned in ascending order of strings compared byte-wise, e.g. ORDER BY id COLLATE "C" in PostgreSQL,
+// so that connector can walk them together with objects from Acronis cloud without loading all of them into memory.
 type ExternalSystemClient interface {
 	// 1. Tenants-related changes (sync to external-system)
 	// 1a. When a tenant is created or updated on Acronis cloud, connector will call CreateOrUpdateTenant
@@ -34,7 +40,7 @@ type ExternalSystemClient interface {
 	DeleteTenant(tenantID string) error
 
 	// 1c. For reconciliation purpose, connector needs to get list of tenantIDs
-	// which are still active in external-system.
+	// which are still active in external-system, in ascending order.
 	GetActiveTenantIDs(offset, limit int) (tenantIDs []string, err error)
 
 	// 1d. During tenant creation, we need to maintain hierarchy of tenants. In order to ensure this hierarchy,
@@ -50,7 +56,7 @@ type ExternalSystemClient interface {
 	DeleteOfferingItem(itemID OfferingItemID) error
 
 	// 2c. For reconciliation purpose, connector needs to get list of offering item IDs
-	// which are still active in external-system.
+	// which are still active in external-system, in ascending order of tenantID, then of offering item name.
 	GetActiveOfferingItemIDs(offset, limit int) ([]OfferingItemID, error)
 
 	// 3. User-related changes (sync to external-system)
@@ -61,7 +67,7 @@ type ExternalSystemClient interface {
 	DeleteUser(userID string) error
 
 	// 3c. For reconciliation purpose, connector needs to get list of user IDs
-	// which are still active in external-system.
+	// which are still active in external-system, in ascending order.
 	GetActiveUserIDs(offset, limit int) (userIDs []string, err error)
 
 	// 4. AccessPolicy-related changes (sync to external-system)
@@ -72,7 +78,7 @@ type ExternalSystemClient interface {
 	DeleteAccessPolicy(accessPolicyID string) error
 
 	// 4c. For reconciliation purpose, connector needs to get list of access policy IDs
-	// which are still active in external-system.
+	// which are still active in external-system, in ascending order.
 	GetActiveAccessPolicyIDs(offset, limit int) (accessPolicyIDs []string, err error)
 
 	// 5. external-system usage-related changes (sync from external-system)
@@ -80,6 +86,121 @@ type ExternalSystemClient interface {
 	GetUsages(offset, limit int) ([]accclient.Usage, error)
 }
 
+// UsageCursorClient is an optional extension of ExternalSystemClient to pull usages with cursor (keyset) pagination.
+// Offset pagination could skip or duplicate usages when they are inserted in external-system during a report cycle,
+// connector will use GetUsagesAfter instead of GetUsages if the implementation of ExternalSystemClient supports it.
+type UsageCursorClient interface {
+	// GetUsagesAfter returns up to limit usages which come after the position identified by cursor "after",
+	// in a stable order. Empty "after" requests the first page.
+	// nextAfter is the cursor to request the next page, empty nextAfter indicates no more pages to be requested.
+	GetUsagesAfter(after string, limit int) (usages []accclient.Usage, nextAfter string, err error)
+}
+
+// CustomerIDClient is an optional extension of ExternalSystemClient to write back the identifier of the tenant
+// in external-system, e.g. billing account number, into customer_id of the tenant on Acronis cloud,
+// so that it is carried by usage reports of Acronis cloud.
+// Connector will call CreateOrUpdateTenantWithCustomerID instead of CreateOrUpdateTenant if the implementation
+// of ExternalSystemClient supports it.
+type CustomerIDClient interface {
+	// CreateOrUpdateTenantWithCustomerID creates or updates the tenant like CreateOrUpdateTenant and returns
+	// the identifier of the tenant in external-system. Empty customerID leaves customer_id on Acronis cloud unchanged.
+	CreateOrUpdateTenantWithCustomerID(tenant *accclient.Tenant) (created bool, customerID string, err error)
+}
+
+// ProvisioningClient is an optional extension of ExternalSystemClient to provision tenants and users
+// requested by external-system on Acronis cloud, e.g. when a customer signs up in the ISV portal.
+// Connector will run the provisioning loop only if the implementation of ExternalSystemClient supports it.
+type ProvisioningClient interface {
+	// GetPendingProvisioningRequests returns up to limit requests which are not completed yet.
+	// A request is returned again until CompleteProvisioningRequest succeeds for it.
+	GetPendingProvisioningRequests(limit int) ([]ProvisioningRequest, error)
+
+	// CompleteProvisioningRequest reports the outcome of a request, including the IDs on Acronis cloud
+	CompleteProvisioningRequest(result *ProvisioningResult) error
+}
+
+// DesiredOfferingItemsClient is an optional extension of ExternalSystemClient to manage offering items
+// of tenants from external-system, e.g. to enable editions and set quotas according to the ISV sales system.
+// Connector will run the offering items loop only if the implementation of ExternalSystemClient supports it.
+type DesiredOfferingItemsClient interface {
+	// GetDesiredOfferingItems returns the desired offering items of tenants in pages.
+	// offset indicates starting index of tenants list, limit indicates how many tenants to be requested.
+	// When number of tenants returned is less than "limit", it indicates no more pages to be requested.
+	GetDesiredOfferingItems(offset, limit int) ([]TenantOfferingItems, error)
+}
+
+// FingerprintClient is an optional extension of ExternalSystemClient to detect drift of the content of tenants
+// and users in external-system from Acronis cloud, e.g. when a tenant name is edited directly in external-system.
+// Connector will call GetTenantFingerprints and GetUserFingerprints instead of GetActiveTenantIDs and GetActiveUserIDs
+// during reconciliation if the implementation of ExternalSystemClient supports it.
+type FingerprintClient interface {
+	// GetTenantFingerprints returns the fingerprints of tenants which are active in external-system,
+	// computed with TenantFingerprint. Pages and order are the same as of GetActiveTenantIDs.
+	GetTenantFingerprints(offset, limit int) ([]Fingerprint, error)
+
+	// GetUserFingerprints returns the fingerprints of users which are active in external-system,
+	// computed with UserFingerprint. Pages and order are the same as of GetActiveUserIDs.
+	GetUserFingerprints(offset, limit int) ([]Fingerprint, error)
+}
+
+// PendingDeletionClient is an optional extension of ExternalSystemClient to mark entities deleted on Acronis cloud
+// while their deletion from external-system is delayed by the configured grace period, e.g. to suspend the service
+// of a deleted tenant instead of wiping its data at once.
+// Connector doesn't call the methods for entity kinds without grace period, they are deleted immediately.
+type PendingDeletionClient interface {
+	// MarkPendingDeletion is called once the entity is deleted on Acronis cloud, it's deleted from external-system
+	// with Delete* after deletion.DeleteAt unless it reappears or is restored on Acronis cloud before
+	MarkPendingDeletion(deletion *PendingDeletion) error
+
+	// CancelPendingDeletion is called when the entity marked pending deletion reappears or is restored on Acronis cloud
+	CancelPendingDeletion(deletion *PendingDeletion) error
+}
+
+// ParentsClient is an optional extension of ExternalSystemClient to report the parents of users and access policies
+// in external-system, so that reconciliation can repair users whose tenant, and access policies whose trustee user,
+// don't exist in external-system. Offering items without tenant are repaired using GetActiveOfferingItemIDs.
+type ParentsClient interface {
+	// GetUserParents returns users which are active in external-system with the IDs of their tenants,
+	// paged and ordered as GetActiveUserIDs
+	GetUserParents(offset, limit int) ([]EntityParent, error)
+
+	// GetAccessPolicyParents returns access policies which are active in external-system with the IDs
+	// of their trustee users, paged and ordered as GetActiveAccessPolicyIDs
+	GetAccessPolicyParents(offset, limit int) ([]EntityParent, error)
+}
+
+// EntityParent relates an entity in external-system to its parent
+type EntityParent struct {
+	// ID of the user or access policy
+	ID string
+
+	// ParentID is the ID of the tenant of the user, or of the trustee user of the access policy
+	ParentID string
+}
+
+// Kinds of entities synced to external-system
+const (
+	EntityTenant       = "tenant"
+	EntityOfferingItem = "offering_item"
+	EntityUser         = "user"
+	EntityAccessPolicy = "access_policy"
+)
+
+// PendingDeletion identifies an entity whose deletion from external-system is delayed by a grace period
+type PendingDeletion struct {
+	// Kind is one of EntityTenant, EntityOfferingItem, EntityUser or EntityAccessPolicy
+	Kind string
+
+	// ID of the tenant, user or access policy, empty for offering items
+	ID string
+
+	// OfferingItemID is set for offering items only
+	OfferingItemID OfferingItemID
+
+	// DeleteAt is the time when the grace period expires
+	DeleteAt time.Time
+}
+
 // OfferingItemID is the minimal structure that identifies an offering item uniquely on Acronis cloud
 type OfferingItemID struct {
 	OfferingItemName string
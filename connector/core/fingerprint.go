@@ -0,0 +1,122 @@
+// Copyright (c) 2021 Acronis International GmbH
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package core
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"hash/fnv"
+	"sort"
+
+	"github.com/acronis/acronis-cyber-cloud-go-sample-connector/connector/accclient"
+)
+
+// Fingerprint identifies the content of an entity in external-system, so that connector can detect drift
+// of the entity from Acronis cloud without pulling the whole entity.
+// It's computed with TenantFingerprint or UserFingerprint from the fields stored by external-system.
+type Fingerprint struct {
+	// ID of the entity on Acronis cloud
+	ID string
+
+	// Version of the entity on Acronis cloud the content was pushed from, 0 if external-system doesn't keep it
+	Version int64
+
+	// Hash of the content, combined from the hashes of Fields
+	Hash uint64
+
+	// Hashes of the fields compared for drift detection, keyed by field name
+	Fields map[string]uint64
+}
+
+// DiffFields returns the names of the fields which differ between the fingerprints, in alphabetical order
+func (f *Fingerprint) DiffFields(other *Fingerprint) []string {
+	var fields []string
+	for name, hash := range f.Fields {
+		if otherHash, ok := other.Fields[name]; !ok || otherHash != hash {
+			fields = append(fields, name)
+		}
+	}
+	for name := range other.Fields {
+		if _, ok := f.Fields[name]; !ok {
+			fields = append(fields, name)
+		}
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+// TenantFingerprint returns the fingerprint of the tenant fields which are kept by external-system:
+// parent_id, name, kind, enabled, customer_type, language and pricing_mode.
+// Other fields of the tenant don't contribute to the fingerprint.
+func TenantFingerprint(tenant *accclient.Tenant) Fingerprint {
+	return newFingerprint(tenant.ID, tenant.Version, map[string]interface{}{
+		"parent_id":     tenant.ParentID,
+		"name":          tenant.Name,
+		"kind":          tenant.Kind,
+		"enabled":       tenant.Enabled,
+		"customer_type": tenant.CustomerType,
+		"language":      tenant.Language,
+		"pricing_mode":  tenant.PricingMode,
+	})
+}
+
+// UserFingerprint returns the fingerprint of the user fields which are kept by external-system:
+// tenant_id, login, email, activated and enabled. Other fields of the user don't contribute to the fingerprint.
+func UserFingerprint(user *accclient.User) Fingerprint {
+	email := ""
+	if user.Contact.Email != nil {
+		email = *user.Contact.Email
+	}
+	return newFingerprint(user.ID, int64(user.Version), map[string]interface{}{
+		"tenant_id": user.TenantID,
+		"login":     user.Login,
+		"email":     email,
+		"activated": user.Activated,
+		"enabled":   user.Enabled,
+	})
+}
+
+// newFingerprint hashes each field encoded in JSON, then the names and hashes of all fields in order of names
+func newFingerprint(id string, version int64, fields map[string]interface{}) Fingerprint {
+	fingerprint := Fingerprint{ID: id, Version: version, Fields: make(map[string]uint64, len(fields))}
+	names := make([]string, 0, len(fields))
+	for name, value := range fields {
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			// fields are plain values, which are always encoded
+			panic(err)
+		}
+		hash := fnv.New64a()
+		_, _ = hash.Write(encoded)
+		fingerprint.Fields[name] = hash.Sum64()
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	hash := fnv.New64a()
+	var buf [8]byte
+	for _, name := range names {
+		_, _ = hash.Write([]byte(name))
+		binary.BigEndian.PutUint64(buf[:], fingerprint.Fields[name])
+		_, _ = hash.Write(buf[:])
+	}
+	fingerprint.Hash = hash.Sum64()
+	return fingerprint
+}
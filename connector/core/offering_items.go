@@ -0,0 +1,43 @@
+// Copyright (c) 2021 Acronis International GmbH
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package core
+
+import (
+	"github.com/acronis/acronis-cyber-cloud-go-sample-connector/connector/accclient"
+)
+
+// OfferingItemsLoop is an interface to apply offering items state decided by external-system,
+// e.g. editions and quotas bought by customers in the ISV sales system, to Acronis Cyber Cloud Platform
+type OfferingItemsLoop interface {
+	// ApplyOfferingItems will periodically pull the desired offering items of tenants from external system,
+	// compare them with the current offering items on Acronis Cyber Cloud Platform and apply the differences
+	ApplyOfferingItems()
+}
+
+// TenantOfferingItems describes the desired state of offering items of a tenant
+type TenantOfferingItems struct {
+	// TenantID is the ID of the tenant on Acronis cloud
+	TenantID string
+
+	// OfferingItems are identified by Name and, if not empty, ApplicationID.
+	// Nil Status, InfraID or Quota leaves the respective value on Acronis cloud unchanged,
+	// Quota.Version is ignored. Offering items not listed are left unchanged.
+	OfferingItems []accclient.OfferingItemTenantPut
+}
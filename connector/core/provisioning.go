@@ -0,0 +1,82 @@
+// Copyright (c) 2021 Acronis International GmbH
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package core
+
+import (
+	"github.com/acronis/acronis-cyber-cloud-go-sample-connector/connector/accclient"
+)
+
+// ProvisioningLoop is an interface to provision tenants and users requested by external-system
+// on Acronis Cyber Cloud Platform (reverse provisioning)
+type ProvisioningLoop interface {
+	// ProvisionTenants will periodically pull pending provisioning requests from external system,
+	// execute them against Acronis Cyber Cloud Platform and report the results back to external system
+	ProvisionTenants()
+}
+
+// ProvisioningRequest describes a customer tenant with its admin user to be provisioned on Acronis cloud
+type ProvisioningRequest struct {
+	// ID identifies the request in external-system. It must stay the same when the request is retried,
+	// as it is stored in the internal tag of the created tenant to make provisioning idempotent.
+	ID string
+
+	// ParentTenantID is the ACC tenant under which the tenant is created,
+	// empty means the tenant the connector is registered in
+	ParentTenantID string
+
+	// TenantName is the name of the tenant, it should be unique among the children of the parent tenant
+	TenantName string
+
+	// TenantKind is the kind of the tenant, "customer" if empty
+	TenantKind string
+
+	// CustomerID is the ID of the customer in external-system, reported on the tenant for reporting purposes
+	CustomerID string
+
+	// Language is the preferred locale of the tenant and the admin user, e.g. "en"
+	Language string
+
+	// Admin user of the tenant, skipped if AdminLogin is empty
+	AdminLogin     string
+	AdminEmail     string
+	AdminFirstname string
+	AdminLastname  string
+
+	// AdminRoles are granted to the admin user on the tenant, e.g. company_admin
+	AdminRoles []accclient.RoleIDEnum
+
+	// OfferingItems are enabled on the tenant
+	OfferingItems []accclient.OfferingItemTenantPut
+}
+
+// ProvisioningResult reports the outcome of a provisioning request back to external-system
+type ProvisioningResult struct {
+	// RequestID is the ID of the executed ProvisioningRequest
+	RequestID string
+
+	// TenantID is the ID of the tenant on Acronis cloud, set once the tenant is created or found
+	TenantID string
+
+	// UserID is the ID of the admin user on Acronis cloud, set once the user is created or found
+	UserID string
+
+	// Error describes why provisioning failed, empty on success
+	Error string
+}
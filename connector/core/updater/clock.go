@@ -0,0 +1,134 @@
+// Copyright (c) 2021 Acronis International GmbH
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package updater
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Clock provides the current time and waiting to the updater loops, so that tests can drive them
+// with FakeClock instead of waiting in real time
+type Clock interface {
+	// Now returns the current time
+	Now() time.Time
+	// Sleep blocks for at least the duration d
+	Sleep(d time.Duration)
+}
+
+// RealClock returns the Clock backed by the time package, used by default by all loops
+func RealClock() Clock {
+	return realClock{}
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) Sleep(d time.Duration) {
+	time.Sleep(d)
+}
+
+// FakeClock is a Clock whose time only moves when Advance is called. Sleeps
+// are released once the fake time reaches their deadline. It is safe for concurrent use.
+type FakeClock struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	now     time.Time
+	waiters []*fakeWaiter
+}
+
+// fakeWaiter is a pending sleep of FakeClock
+type fakeWaiter struct {
+	deadline time.Time
+	ch       chan time.Time
+}
+
+// NewFakeClock returns a FakeClock set to the given time
+func NewFakeClock(now time.Time) *FakeClock {
+	c := &FakeClock{now: now}
+	c.cond = sync.NewCond(&c.mu)
+	return c
+}
+
+// Now returns the current fake time
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// Sleep blocks until the fake time is advanced by at least d
+func (c *FakeClock) Sleep(d time.Duration) {
+	if d <= 0 {
+		return
+	}
+	c.mu.Lock()
+	w := c.addWaiter(d)
+	c.mu.Unlock()
+	<-w.ch
+}
+
+// Advance moves the fake time forward by d, releasing the sleeps due in the meantime
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	end := c.now.Add(d)
+	for len(c.waiters) > 0 && !c.waiters[0].deadline.After(end) {
+		w := c.waiters[0]
+		c.now = w.deadline
+		w.ch <- c.now
+		c.waiters = c.waiters[1:]
+	}
+	c.now = end
+	c.cond.Broadcast()
+}
+
+// BlockUntil blocks until at least n sleeps are waiting on the clock.
+// Tests call it to make sure the loop reached its wait before advancing the time.
+func (c *FakeClock) BlockUntil(n int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for len(c.waiters) < n {
+		c.cond.Wait()
+	}
+}
+
+// addWaiter registers a waiter due after d, the caller must hold the lock
+func (c *FakeClock) addWaiter(d time.Duration) *fakeWaiter {
+	w := &fakeWaiter{
+		deadline: c.now.Add(d),
+		ch:       make(chan time.Time, 1),
+	}
+	c.waiters = append(c.waiters, w)
+	c.sortWaiters()
+	c.cond.Broadcast()
+	return w
+}
+
+func (c *FakeClock) sortWaiters() {
+	sort.SliceStable(c.waiters, func(i, j int) bool {
+		return c.waiters[i].deadline.Before(c.waiters[j].deadline)
+	})
+}
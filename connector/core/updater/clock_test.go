@@ -0,0 +1,72 @@
+// Copyright (c) 2021 Acronis International GmbH
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package updater
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestFakeClock_Sleep(t *testing.T) {
+	start := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+	clock := NewFakeClock(start)
+
+	done := make(chan time.Time)
+	go func() {
+		clock.Sleep(time.Minute)
+		done <- clock.Now()
+	}()
+
+	clock.BlockUntil(1)
+	clock.Advance(30 * time.Second)
+	select {
+	case <-done:
+		t.Fatalf("sleep returned before its deadline")
+	default:
+	}
+
+	clock.Advance(time.Hour)
+	if woken := <-done; !woken.Equal(start.Add(time.Hour + 30*time.Second)) {
+		t.Errorf("unexpected time after sleep %v", woken)
+	}
+}
+
+func TestScheduler_FakeClock(t *testing.T) {
+	start := time.Date(2021, 6, 1, 12, 0, 30, 0, time.UTC)
+	clock := NewFakeClock(start)
+	s := newScheduler("test", &alignedSchedule{interval: time.Minute}, 0, clock)
+
+	done := make(chan struct{})
+	go func() {
+		s.wait(context.Background())
+		close(done)
+	}()
+
+	clock.BlockUntil(1)
+	if next := s.NextRun(); !next.Equal(start.Add(30 * time.Second)) {
+		t.Errorf("unexpected next run %v", next)
+	}
+	clock.Advance(30 * time.Second)
+	<-done
+	if next := s.NextRun(); !next.IsZero() {
+		t.Errorf("expected no next run while running, got %v", next)
+	}
+}
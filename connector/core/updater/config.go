@@ -23,18 +23,40 @@ import (
 	"fmt"
 	"net/url"
 	"strings"
+	"time"
 
+	"github.com/acronis/acronis-cyber-cloud-go-sample-connector/connector/accclient"
 	"github.com/acronis/acronis-cyber-cloud-go-sample-connector/connector/logs"
 )
 
 // Config defines the configuration structure of the sample-connector
 type Config struct {
-	LogSettings            logs.LogConfig  `yaml:"logSettings,flow"`       // logging config
-	AuthSettings           AuthConfig      `yaml:"authSettings,flow"`      // configs to enabling auth support
-	APIServerSettings      APIServerConfig `yaml:"apiServerSettings,flow"` // configs to connect to api server
-	UpdateInterval         uint            `yaml:"updateInterval"`         // update interval, in seconds
-	ReconciliationInterval uint            `yaml:"reconciliationInterval"` // reconciliation interval, in seconds
-	UsageReportInterval    uint            `yaml:"usageReportInterval"`    // usage report interval, in seconds
+	LogSettings            logs.LogConfig   `yaml:"logSettings,flow"`        // logging config
+	AuthSettings           AuthConfig       `yaml:"authSettings,flow"`       // configs to enabling auth support
+	APIServerSettings      APIServerConfig  `yaml:"apiServerSettings,flow"`  // configs to connect to api server
+	HTTPClientSettings     HTTPClientConfig `yaml:"httpClientSettings,flow"` // retries and rate limiting of api server requests
+	UpdateInterval         uint             `yaml:"updateInterval"`          // update interval, in seconds
+	TenantsPolling         PollingConfig    `yaml:"tenantsPolling"`          // adaptive update interval of tenants and offering items
+	UsersPolling           PollingConfig    `yaml:"usersPolling"`            // adaptive update interval of users and access policies
+	ReconciliationInterval uint             `yaml:"reconciliationInterval"`  // reconciliation interval, in seconds
+	UsageReportInterval    uint             `yaml:"usageReportInterval"`     // usage report interval, in seconds
+	UsageReportSchedule    string           `yaml:"usageReportSchedule"`     // cron expression for usage reports, overrides usageReportInterval
+	UsageReportOnStartup   bool             `yaml:"usageReportOnStartup"`    // push usages immediately on startup
+	ReconciliationSchedule string           `yaml:"reconciliationSchedule"`  // cron expression for reconciliation, overrides reconciliationInterval
+	ReconciliationMemory   uint             `yaml:"reconciliationMemory"`    // memory of ACC objects buffered by each reconciliation, in MiB
+	ReconciliationTempDir  string           `yaml:"reconciliationTempDir"`   // directory of ACC objects spilled to disk by reconciliation
+	StateFile              string           `yaml:"stateFile"`               // file of states of pushed entities, kept in memory only if empty
+	ForceFullPush          bool             `yaml:"forceFullPush"`           // push all entities, even if not changed since last pushed
+	DriftPolicy            string           `yaml:"driftPolicy"`             // handling of entities drifted in external system: repush, report or ignore
+	DeletionGracePeriod    GracePeriods     `yaml:"deletionGracePeriod"`     // delay of deletions from external system per entity kind
+	RepairOrphans          bool             `yaml:"repairOrphans"`           // repair entities whose parent doesn't exist in external system
+	ReportDir              string           `yaml:"reportDir"`               // directory of reconciliation reports, kept in memory only if empty
+	ReportRetention        uint             `yaml:"reportRetention"`         // number of last reconciliation reports kept
+	ScheduleTimezone       string           `yaml:"scheduleTimezone"`        // time zone of cron expressions
+	ScheduleJitter         uint             `yaml:"scheduleJitter"`          // maximum random delay added to each scheduled run, in seconds
+	ProvisioningInterval   uint             `yaml:"provisioningInterval"`    // provisioning requests polling interval, in seconds
+	OfferingItemsInterval  uint             `yaml:"offeringItemsInterval"`   // interval of applying offering items decided by external system, in seconds
+	OfferingItemsDryRun    bool             `yaml:"offeringItemsDryRun"`     // only log offering items changes without applying them
 }
 
 // AuthConfig defines the authentication configurations
@@ -48,6 +70,61 @@ type APIServerConfig struct {
 	BaseURL string `yaml:"baseURL"`
 }
 
+// HTTPClientConfig contains the retry and rate limiting settings of requests to Acronis Cyber Cloud Platform
+type HTTPClientConfig struct {
+	MaxRetries        uint    `yaml:"maxRetries"`        // maximum number of retries of idempotent requests, 0 disables retries
+	InitialBackoff    uint    `yaml:"initialBackoff"`    // delay before the first retry, doubled after each retry, in milliseconds
+	MaxBackoff        uint    `yaml:"maxBackoff"`        // maximum delay between retries, including Retry-After, in seconds
+	BackoffJitter     float64 `yaml:"backoffJitter"`     // randomized fraction of the delay, between 0 and 1
+	RequestsPerSecond float64 `yaml:"requestsPerSecond"` // client-side rate limit, 0 disables the limit
+	Burst             uint    `yaml:"burst"`             // maximum number of requests sent at once under the rate limit
+}
+
+// PollingConfig contains the bounds of the adaptive interval of an update loop, in seconds. The interval backs off
+// from minInterval toward maxInterval while no changes are reported, and the loop polls again immediately
+// while pages of changes are full. Zero minInterval defaults to updateInterval, maxInterval less than the
+// min interval keeps the interval fixed.
+type PollingConfig struct {
+	MinInterval uint `yaml:"minInterval"`
+	MaxInterval uint `yaml:"maxInterval"`
+}
+
+// bounds returns the minimum and maximum intervals of the update loop
+func (c PollingConfig) bounds(updateInterval uint) (uint, uint) {
+	minInterval, maxInterval := c.MinInterval, c.MaxInterval
+	if minInterval == 0 {
+		minInterval = updateInterval
+	}
+	if maxInterval < minInterval {
+		maxInterval = minInterval
+	}
+	return minInterval, maxInterval
+}
+
+// GracePeriods contains the grace periods of deletions from external system per entity kind, in seconds.
+// Zero grace period deletes the entities immediately.
+type GracePeriods struct {
+	Tenant       uint `yaml:"tenant"`
+	OfferingItem uint `yaml:"offeringItem"`
+	User         uint `yaml:"user"`
+	AccessPolicy uint `yaml:"accessPolicy"`
+}
+
+// Enabled returns whether deletions of any entity kind are delayed
+func (c GracePeriods) Enabled() bool {
+	return c.Tenant > 0 || c.OfferingItem > 0 || c.User > 0 || c.AccessPolicy > 0
+}
+
+// byKind returns the grace periods keyed by entity kind
+func (c GracePeriods) byKind() map[string]time.Duration {
+	return map[string]time.Duration{
+		EntityTenant:       time.Second * time.Duration(c.Tenant),
+		EntityOfferingItem: time.Second * time.Duration(c.OfferingItem),
+		EntityUser:         time.Second * time.Duration(c.User),
+		EntityAccessPolicy: time.Second * time.Duration(c.AccessPolicy),
+	}
+}
+
 // NewDefaultConfig returns the default configuration values
 func NewDefaultConfig() *Config {
 	return &Config{
@@ -63,9 +140,27 @@ func NewDefaultConfig() *Config {
 		APIServerSettings: APIServerConfig{
 			BaseURL: "",
 		},
+		HTTPClientSettings: HTTPClientConfig{
+			MaxRetries:        5,
+			InitialBackoff:    500,
+			MaxBackoff:        60,
+			BackoffJitter:     0.2,
+			RequestsPerSecond: 0,
+			Burst:             10,
+		},
 		UpdateInterval:         5,
+		TenantsPolling:         PollingConfig{MaxInterval: 60},
+		UsersPolling:           PollingConfig{MaxInterval: 60},
 		ReconciliationInterval: 86400,
+		ReconciliationMemory:   64,
+		DriftPolicy:            string(DriftPolicyRepush),
+		RepairOrphans:          true,
+		ReportRetention:        defaultReportRetention,
 		UsageReportInterval:    21600,
+		UsageReportOnStartup:   true,
+		ScheduleTimezone:       "UTC",
+		ProvisioningInterval:   60,
+		OfferingItemsInterval:  3600,
 	}
 }
 
@@ -84,5 +179,80 @@ func (c *Config) Validate() error {
 		return fmt.Errorf("error validating API server base url: %s", c.APIServerSettings.BaseURL)
 	}
 
+	if c.HTTPClientSettings.BackoffJitter < 0 || c.HTTPClientSettings.BackoffJitter > 1 {
+		return fmt.Errorf("invalid backoff jitter %v, should be between 0 and 1", c.HTTPClientSettings.BackoffJitter)
+	}
+
+	if c.HTTPClientSettings.RequestsPerSecond < 0 {
+		return fmt.Errorf("invalid requests per second %v, should not be negative", c.HTTPClientSettings.RequestsPerSecond)
+	}
+
+	for name, polling := range map[string]PollingConfig{"tenants": c.TenantsPolling, "users": c.UsersPolling} {
+		if polling.MinInterval != 0 && polling.MaxInterval < polling.MinInterval {
+			return fmt.Errorf("invalid %v polling max interval %v, should not be less than min interval %v",
+				name, polling.MaxInterval, polling.MinInterval)
+		}
+	}
+
+	if c.ReconciliationMemory == 0 {
+		return fmt.Errorf("invalid reconciliation memory %v, should be positive", c.ReconciliationMemory)
+	}
+
+	if c.ReportRetention == 0 {
+		return fmt.Errorf("invalid report retention %v, should be positive", c.ReportRetention)
+	}
+
+	if _, err := ParseDriftPolicy(c.DriftPolicy); err != nil {
+		return fmt.Errorf("invalid drift policy: %w", err)
+	}
+
+	if _, err := c.usageReportSchedule(); err != nil {
+		return fmt.Errorf("invalid usage report schedule: %w", err)
+	}
+
+	if _, err := c.reconciliationSchedule(); err != nil {
+		return fmt.Errorf("invalid reconciliation schedule: %w", err)
+	}
+
 	return nil
 }
+
+// usageReportSchedule returns the schedule of usage reports, cron expression takes precedence over interval
+func (c *Config) usageReportSchedule() (Schedule, error) {
+	return c.schedule(c.UsageReportSchedule, c.UsageReportInterval)
+}
+
+// reconciliationSchedule returns the schedule of reconciliation, cron expression takes precedence over interval
+func (c *Config) reconciliationSchedule() (Schedule, error) {
+	return c.schedule(c.ReconciliationSchedule, c.ReconciliationInterval)
+}
+
+// retryPolicy returns the retry policy of requests to Acronis Cyber Cloud Platform
+func (c *HTTPClientConfig) retryPolicy() accclient.RetryPolicy {
+	return accclient.RetryPolicy{
+		MaxRetries:     int(c.MaxRetries),
+		InitialBackoff: time.Millisecond * time.Duration(c.InitialBackoff),
+		MaxBackoff:     time.Second * time.Duration(c.MaxBackoff),
+		Jitter:         c.BackoffJitter,
+	}
+}
+
+// rateLimiter returns the client-side rate limiter, nil if rate limiting is disabled
+func (c *HTTPClientConfig) rateLimiter() *accclient.RateLimiter {
+	if c.RequestsPerSecond <= 0 {
+		return nil
+	}
+	return accclient.NewRateLimiter(c.RequestsPerSecond, int(c.Burst))
+}
+
+// schedule returns the schedule of the cron expression in the schedule timezone, or of the interval if it's empty
+func (c *Config) schedule(expr string, interval uint) (Schedule, error) {
+	if expr == "" {
+		return EverySchedule(time.Second * time.Duration(interval)), nil
+	}
+	location, err := time.LoadLocation(c.ScheduleTimezone)
+	if err != nil {
+		return nil, fmt.Errorf("invalid schedule timezone %v: %w", c.ScheduleTimezone, err)
+	}
+	return ParseSchedule(expr, location)
+}
@@ -21,6 +21,7 @@ package updater
 
 import (
 	"context"
+	"fmt"
 	"net/http"
 	"time"
 
@@ -37,20 +38,92 @@ type Updater struct {
 	sync   core.SyncLoop
 	recon  core.Reconciliation
 	usage  core.UsageLoop
+
+	// optional, set only if external system supports reverse provisioning
+	provisioning core.ProvisioningLoop
+
+	// optional, set only if external system manages offering items of tenants
+	offeringItems core.OfferingItemsLoop
+
+	// additional middlewares of requests to Acronis Cyber Cloud Platform
+	accMiddlewares []accclient.Middleware
+
+	// clock used by all loops for waiting and timestamps
+	clock Clock
+
+	// states of entities last pushed to external system, shared by sync and reconciliation loops
+	stateStore StateStore
+
+	// set if stateStore is opened from Config.StateFile, closed by Close
+	stateFile *FileStateStore
+
+	// deletions from external system delayed by grace period, shared by sync and reconciliation loops
+	deletions *PendingDeletions
+
+	// reports of the last reconciliation runs
+	reports ReportStore
+
+	// loops paused and jobs triggered through the admin API
+	loops *loopSwitch
+	jobs  *jobRunner
 }
 
 type Option func(*Updater)
 
+// userAgent identifies the connector in requests to Acronis Cyber Cloud Platform
+const userAgent = "acronis-cyber-cloud-go-sample-connector"
+
+// WithACCMiddleware is an optional init function to intercept requests to Acronis Cyber Cloud Platform,
+// e.g. to collect metrics. Middlewares are called after the built-in user agent and logging middlewares.
+func WithACCMiddleware(middlewares ...accclient.Middleware) Option {
+	return func(u *Updater) {
+		u.accMiddlewares = append(u.accMiddlewares, middlewares...)
+	}
+}
+
+// WithClock is an optional init function to replace the real clock of all loops, e.g. with FakeClock in tests
+func WithClock(clock Clock) Option {
+	return func(u *Updater) {
+		u.clock = clock
+	}
+}
+
+// WithStateStore is an optional init function to replace the state store configured by stateFile,
+// e.g. with a store backed by the database of external system
+func WithStateStore(store StateStore) Option {
+	return func(u *Updater) {
+		u.stateStore = store
+	}
+}
+
+// WithReportStore is an optional init function to replace the report store configured by reportDir,
+// e.g. with a store backed by a database
+func WithReportStore(store ReportStore) Option {
+	return func(u *Updater) {
+		u.reports = store
+	}
+}
+
 // NewUpdater returns an Updater initialized with the given params
 func NewUpdater(config *Config, externalClient core.ExternalSystemClient, options ...Option) (*Updater, error) {
 	u := &Updater{
 		config: config,
+		clock:  RealClock(),
 	}
 
 	for _, option := range options {
 		option(u)
 	}
 
+	reconciliationSchedule, err := config.reconciliationSchedule()
+	if err != nil {
+		return nil, fmt.Errorf("invalid reconciliation schedule: %w", err)
+	}
+	usageReportSchedule, err := config.usageReportSchedule()
+	if err != nil {
+		return nil, fmt.Errorf("invalid usage report schedule: %w", err)
+	}
+
 	// Setup ACC Client
 	httpDefaultClient := &http.Client{Timeout: 120 * time.Second}
 	httpClient := getHTTPClient(
@@ -59,8 +132,21 @@ func NewUpdater(config *Config, externalClient core.ExternalSystemClient, option
 		config.APIServerSettings.BaseURL+"/api/2",
 		httpDefaultClient,
 	)
+	// retry outside of oauth2 transport, so that each attempt is sent with a valid access token
+	httpClient.Transport = accclient.NewRetryTransport(
+		httpClient.Transport,
+		config.HTTPClientSettings.retryPolicy(),
+		config.HTTPClientSettings.rateLimiter(),
+	)
 
-	accClient := accclient.NewClient(httpClient, config.APIServerSettings.BaseURL)
+	rateLimitHint := accclient.NewRateLimitHint(u.clock.Now)
+	accClient := accclient.NewClient(
+		httpClient,
+		config.APIServerSettings.BaseURL,
+		accclient.WithMiddleware(accclient.UserAgentMiddleware(userAgent), accclient.LoggingMiddleware()),
+		accclient.WithMiddleware(rateLimitHint.Middleware()),
+		accclient.WithMiddleware(u.accMiddlewares...),
+	)
 
 	tenantID, err := accClient.GetRegistrationTenantID(
 		context.Background(), config.APIServerSettings.BaseURL, config.AuthSettings.ClientID)
@@ -68,26 +154,101 @@ func NewUpdater(config *Config, externalClient core.ExternalSystemClient, option
 		return nil, err
 	}
 
+	if u.stateStore == nil {
+		if config.StateFile != "" {
+			fileStateStore, err := OpenFileStateStore(config.StateFile)
+			if err != nil {
+				return nil, err
+			}
+			u.stateStore, u.stateFile = fileStateStore, fileStateStore
+		} else {
+			u.stateStore = NewMemoryStateStore()
+		}
+	}
+
+	if u.reports == nil {
+		if config.ReportDir != "" {
+			dirReportStore, err := OpenDirReportStore(config.ReportDir, int(config.ReportRetention))
+			if err != nil {
+				return nil, err
+			}
+			u.reports = dirReportStore
+		} else {
+			u.reports = NewMemoryReportStore(int(config.ReportRetention))
+		}
+	}
+
+	u.deletions = NewPendingDeletions(config.DeletionGracePeriod.byKind(), externalClient, u.clock)
+
+	provisioningClient, provisioningSupported := externalClient.(core.ProvisioningClient)
+	desiredOfferingItemsClient, offeringItemsSupported := externalClient.(core.DesiredOfferingItemsClient)
+	loopNames := []string{LoopSync, LoopReconciliation, LoopUsage}
+	if provisioningSupported {
+		loopNames = append(loopNames, LoopProvisioning)
+	}
+	if offeringItemsSupported {
+		loopNames = append(loopNames, LoopOfferingItems)
+	}
+	u.loops = newLoopSwitch(loopNames...)
+	u.jobs = newJobRunner(u.clock)
+
+	jitter := time.Second * time.Duration(config.ScheduleJitter)
+
 	u.sync = NewSyncLoop(
 		accClient,
 		tenantID,
 		externalClient,
 		WithUpdateInterval(config.UpdateInterval),
+		WithTenantsPolling(config.TenantsPolling.bounds(config.UpdateInterval)),
+		WithUsersPolling(config.UsersPolling.bounds(config.UpdateInterval)),
+		WithSyncRateLimitHint(rateLimitHint),
+		WithSyncClock(u.loops.clock(LoopSync, u.clock)),
+		WithSyncStateStore(u.stateStore, config.ForceFullPush),
+		WithSyncPendingDeletions(u.deletions),
 	)
 
 	u.recon = NewReconciliationLoop(
 		accClient,
 		tenantID,
 		externalClient,
-		WithReconciliationInterval(config.ReconciliationInterval),
+		WithReconciliationSchedule(reconciliationSchedule, jitter),
+		WithReconciliationMemoryLimit(int(config.ReconciliationMemory)<<20, config.ReconciliationTempDir),
+		WithReconciliationClock(u.loops.clock(LoopReconciliation, u.clock)),
+		WithReconciliationStateStore(u.stateStore, config.ForceFullPush),
+		WithReconciliationDriftPolicy(DriftPolicy(config.DriftPolicy)),
+		WithReconciliationPendingDeletions(u.deletions),
+		WithReconciliationOrphanRepair(config.RepairOrphans),
+		WithReconciliationReportStore(u.reports),
 	)
 
 	u.usage = NewUsageLoop(
 		accClient,
 		externalClient,
-		WithUsageUpdateInterval(config.UsageReportInterval),
+		WithUsageSchedule(usageReportSchedule, jitter),
+		WithUsageReportOnStartup(config.UsageReportOnStartup),
+		WithUsageClock(u.loops.clock(LoopUsage, u.clock)),
 	)
 
+	if provisioningSupported {
+		u.provisioning = NewProvisioningLoop(
+			accClient,
+			tenantID,
+			provisioningClient,
+			WithProvisioningInterval(config.ProvisioningInterval),
+			WithProvisioningClock(u.loops.clock(LoopProvisioning, u.clock)),
+		)
+	}
+
+	if offeringItemsSupported {
+		u.offeringItems = NewOfferingItemsLoop(
+			accClient,
+			desiredOfferingItemsClient,
+			WithOfferingItemsInterval(config.OfferingItemsInterval),
+			WithOfferingItemsDryRun(config.OfferingItemsDryRun),
+			WithOfferingItemsClock(u.loops.clock(LoopOfferingItems, u.clock)),
+		)
+	}
+
 	return u, nil
 }
 
@@ -103,19 +264,178 @@ func (u *Updater) Start() error {
 	go u.recon.ReconcileTenantsAndOfferingItems(false)
 	go u.recon.ReconcileUsersAndAccessPolicies(false)
 	go u.usage.UpdateUsages()
+	if u.provisioning != nil {
+		go u.provisioning.ProvisionTenants()
+	}
+	if u.offeringItems != nil {
+		go u.offeringItems.ApplyOfferingItems()
+	}
 
 	return nil
 }
 
+// Close closes the state file opened by NewUpdater, on shutdown of connector.
+// States recorded by the loops still running afterwards are not written to the file.
+func (u *Updater) Close() error {
+	if u.stateFile == nil {
+		return nil
+	}
+	return u.stateFile.Close()
+}
+
+// NextRuns returns the time of the next scheduled run of each periodic loop, keyed by loop name.
+// Zero time indicates that the loop is currently running.
+func (u *Updater) NextRuns() map[string]time.Time {
+	nextRuns := make(map[string]time.Time)
+	if usage, ok := u.usage.(*UsageLoop); ok {
+		nextRuns["usage_loop"] = usage.NextRun()
+	}
+	if recon, ok := u.recon.(*ReconciliationLoop); ok {
+		nextRuns["tenants_reconciliation"] = recon.NextTenantsRun()
+		nextRuns["users_reconciliation"] = recon.NextUsersRun()
+	}
+	return nextRuns
+}
+
+// PendingDeletions returns the deletions from external system waiting for their grace period to expire
+func (u *Updater) PendingDeletions() []core.PendingDeletion {
+	return u.deletions.Pending()
+}
+
+// Reports returns the last reconciliation reports without their lists of entities, newest first
+func (u *Updater) Reports(limit int) ([]*ReconciliationReport, error) {
+	reports, err := u.reports.List(limit)
+	if err != nil {
+		return nil, err
+	}
+	headers := make([]*ReconciliationReport, len(reports))
+	for i := range reports {
+		headers[i] = reports[i].Header()
+	}
+	return headers, nil
+}
+
+// Report returns the reconciliation report with the ID, false if there is no such report
+func (u *Updater) Report(id string) (*ReconciliationReport, bool, error) {
+	return u.reports.Get(id)
+}
+
+// Reconcile reconciles the entities of the report kinds (ReportTenantsAndOfferingItems, ReportUsersAndAccessPolicies)
+// once, outside of the schedule and without starting the loops, and returns the reports of the runs
+func (u *Updater) Reconcile(kinds ...string) ([]*ReconciliationReport, error) {
+	recon := u.recon.(*ReconciliationLoop)
+	reports := make([]*ReconciliationReport, 0, len(kinds))
+	for _, kind := range kinds {
+		switch kind {
+		case ReportTenantsAndOfferingItems:
+			reports = append(reports, recon.ReconcileTenantsAndOfferingItemsOnce())
+		case ReportUsersAndAccessPolicies:
+			reports = append(reports, recon.ReconcileUsersAndAccessPoliciesOnce())
+		default:
+			return reports, fmt.Errorf("unknown reconciliation kind %v", kind)
+		}
+	}
+	return reports, nil
+}
+
+// RunReconciliation reconciles the entities of the report kinds at once and then following the schedule,
+// without the other loops. It doesn't return unless a kind is unknown.
+func (u *Updater) RunReconciliation(kinds ...string) error {
+	if _, err := u.Reconcile(kinds...); err != nil {
+		return err
+	}
+	for _, kind := range kinds {
+		if kind == ReportTenantsAndOfferingItems {
+			go u.recon.ReconcileTenantsAndOfferingItems(false)
+		} else {
+			go u.recon.ReconcileUsersAndAccessPolicies(false)
+		}
+	}
+	select {}
+}
+
+// RunUsages pushes usages following the schedule, without the other loops. It doesn't return.
+func (u *Updater) RunUsages() {
+	u.usage.UpdateUsages()
+}
+
+// RunJob runs the job of the kind for the target in the calling goroutine, e.g. for one-shot commands
+func (u *Updater) RunJob(ctx context.Context, kind, target string) (PushResult, error) {
+	switch kind {
+	case JobResyncTenant:
+		return u.recon.(*ReconciliationLoop).ResyncTenant(ctx, target)
+	case JobResyncUser:
+		return u.sync.(*SyncLoopImpl).ResyncUser(ctx, target)
+	case JobPushUsages:
+		return u.usage.(*UsageLoop).PushUsages(ctx)
+	}
+	return PushResult{}, fmt.Errorf("unknown job kind %v", kind)
+}
+
+// ResyncTenant starts a job reconciling the tenant and its subtree with external system,
+// see ReconciliationLoop.ResyncTenant
+func (u *Updater) ResyncTenant(tenantID string) Job {
+	return u.startJob(JobResyncTenant, tenantID)
+}
+
+// ResyncUser starts a job pushing the user into external system, see SyncLoopImpl.ResyncUser
+func (u *Updater) ResyncUser(userID string) Job {
+	return u.startJob(JobResyncUser, userID)
+}
+
+// PushUsages starts a job pushing all usages from external system into ACC, see UsageLoop.PushUsages
+func (u *Updater) PushUsages() Job {
+	return u.startJob(JobPushUsages, "")
+}
+
+func (u *Updater) startJob(kind, target string) Job {
+	return u.jobs.start(kind, target, func(ctx context.Context) (PushResult, error) {
+		return u.RunJob(ctx, kind, target)
+	})
+}
+
+// Jobs returns the running jobs and the last finished ones, newest first
+func (u *Updater) Jobs() []Job {
+	return u.jobs.list()
+}
+
+// Job returns the job with the ID, false if there is no such job
+func (u *Updater) Job(id string) (Job, bool) {
+	return u.jobs.get(id)
+}
+
+// Diff compares the tenant subtree in ACC with external system, see ReconciliationLoop.Diff
+func (u *Updater) Diff(ctx context.Context, tenantID string) (*TenantDiff, error) {
+	return u.recon.(*ReconciliationLoop).Diff(ctx, tenantID)
+}
+
+// Loops returns whether each loop is paused
+func (u *Updater) Loops() []LoopStatus {
+	return u.loops.statuses()
+}
+
+// PauseLoop pauses the loop with the name after its current cycle, jobs are still run while it's paused
+func (u *Updater) PauseLoop(name string) error {
+	return u.loops.pause(name)
+}
+
+// ResumeLoop resumes the paused loop with the name
+func (u *Updater) ResumeLoop(name string) error {
+	return u.loops.resume(name)
+}
+
 // getHTTPClient returns a HTTP clent for identification with service's access token
 func getHTTPClient(clientID, clientSecret, idpAddr string, httpClient *http.Client) *http.Client {
-	oauth2Config := &clientcredentials.Config{
+	ctx := context.WithValue(context.Background(), oauth2.HTTPClient, httpClient)
+	return getOAuth2Config(clientID, clientSecret, idpAddr).Client(ctx)
+}
+
+// getOAuth2Config returns the config of client credentials flow of the identity provider of api server
+func getOAuth2Config(clientID, clientSecret, idpAddr string) *clientcredentials.Config {
+	return &clientcredentials.Config{
 		ClientID:     clientID,
 		ClientSecret: clientSecret,
 		TokenURL:     idpAddr + "/idp/token",
 		AuthStyle:    oauth2.AuthStyleInHeader,
 	}
-
-	ctx := context.WithValue(context.Background(), oauth2.HTTPClient, httpClient)
-	return oauth2Config.Client(ctx)
 }
@@ -0,0 +1,935 @@
+// Copyright (c) 2021 Acronis International GmbH
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package updater
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/acronis/acronis-cyber-cloud-go-sample-connector/connector/accclient"
+	"github.com/acronis/acronis-cyber-cloud-go-sample-connector/connector/accclient/acctest"
+	"github.com/acronis/acronis-cyber-cloud-go-sample-connector/connector/core"
+	"github.com/acronis/acronis-cyber-cloud-go-sample-connector/connector/core/conformance"
+)
+
+// fakeExternalSystem is an in-memory implementation of core.ExternalSystemClient
+type fakeExternalSystem struct {
+	mu             sync.Mutex
+	tenants        map[string]accclient.Tenant
+	offeringItems  map[core.OfferingItemID]accclient.OfferingItem
+	users          map[string]accclient.User
+	accessPolicies map[string]accclient.AccessPolicy
+	usages         []accclient.Usage
+	customerIDs    map[string]string
+	upserts        int                             // number of calls of CreateOrUpdate* methods
+	pending        map[string]core.PendingDeletion // entities marked pending deletion, keyed by kind and ID
+}
+
+func newFakeExternalSystem() *fakeExternalSystem {
+	return &fakeExternalSystem{
+		tenants:        make(map[string]accclient.Tenant),
+		offeringItems:  make(map[core.OfferingItemID]accclient.OfferingItem),
+		users:          make(map[string]accclient.User),
+		accessPolicies: make(map[string]accclient.AccessPolicy),
+		customerIDs:    make(map[string]string),
+		pending:        make(map[string]core.PendingDeletion),
+	}
+}
+
+func (f *fakeExternalSystem) CreateOrUpdateTenant(tenant *accclient.Tenant) (bool, error) {
+	created, _, err := f.CreateOrUpdateTenantWithCustomerID(tenant)
+	return created, err
+}
+
+func (f *fakeExternalSystem) CreateOrUpdateTenantWithCustomerID(tenant *accclient.Tenant) (bool, string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.upserts++
+	_, exists := f.tenants[tenant.ID]
+	f.tenants[tenant.ID] = *tenant
+	return !exists, f.customerIDs[tenant.ID], nil
+}
+
+func (f *fakeExternalSystem) DeleteTenant(tenantID string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.tenants, tenantID)
+	return nil
+}
+
+func (f *fakeExternalSystem) GetActiveTenantIDs(offset, limit int) ([]string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var ids []string
+	for id := range f.tenants {
+		ids = append(ids, id)
+	}
+	return pageIDs(ids, offset, limit), nil
+}
+
+func (f *fakeExternalSystem) CheckTenantExist(tenantID string) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	_, ok := f.tenants[tenantID]
+	return ok, nil
+}
+
+func (f *fakeExternalSystem) CreateOrUpdateOfferingItem(item *accclient.OfferingItem) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.upserts++
+	id := core.OfferingItemID{OfferingItemName: item.Name, TenantID: item.TenantID}
+	_, exists := f.offeringItems[id]
+	f.offeringItems[id] = *item
+	return !exists, nil
+}
+
+func (f *fakeExternalSystem) DeleteOfferingItem(itemID core.OfferingItemID) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.offeringItems, itemID)
+	return nil
+}
+
+func (f *fakeExternalSystem) GetActiveOfferingItemIDs(offset, limit int) ([]core.OfferingItemID, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var ids []core.OfferingItemID
+	for id, item := range f.offeringItems {
+		if item.Status > 0 {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		if ids[i].TenantID != ids[j].TenantID {
+			return ids[i].TenantID < ids[j].TenantID
+		}
+		return ids[i].OfferingItemName < ids[j].OfferingItemName
+	})
+	if offset >= len(ids) {
+		return nil, nil
+	}
+	if offset+limit < len(ids) {
+		return ids[offset : offset+limit], nil
+	}
+	return ids[offset:], nil
+}
+
+func (f *fakeExternalSystem) CreateOrUpdateUser(user *accclient.User) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.upserts++
+	_, exists := f.users[user.ID]
+	f.users[user.ID] = *user
+	return !exists, nil
+}
+
+func (f *fakeExternalSystem) DeleteUser(userID string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.users, userID)
+	return nil
+}
+
+func (f *fakeExternalSystem) GetActiveUserIDs(offset, limit int) ([]string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var ids []string
+	for id := range f.users {
+		ids = append(ids, id)
+	}
+	return pageIDs(ids, offset, limit), nil
+}
+
+func (f *fakeExternalSystem) CreateOrUpdateAccessPolicy(accessPolicy *accclient.AccessPolicy) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.upserts++
+	_, exists := f.accessPolicies[accessPolicy.ID]
+	f.accessPolicies[accessPolicy.ID] = *accessPolicy
+	return !exists, nil
+}
+
+func (f *fakeExternalSystem) DeleteAccessPolicy(accessPolicyID string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.accessPolicies, accessPolicyID)
+	return nil
+}
+
+func (f *fakeExternalSystem) GetActiveAccessPolicyIDs(offset, limit int) ([]string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var ids []string
+	for id := range f.accessPolicies {
+		ids = append(ids, id)
+	}
+	return pageIDs(ids, offset, limit), nil
+}
+
+func (f *fakeExternalSystem) GetUsages(offset, limit int) ([]accclient.Usage, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if offset >= len(f.usages) {
+		return nil, nil
+	}
+	if offset+limit < len(f.usages) {
+		return f.usages[offset : offset+limit], nil
+	}
+	return f.usages[offset:], nil
+}
+
+func (f *fakeExternalSystem) MarkPendingDeletion(deletion *core.PendingDeletion) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.pending[deletion.Kind+"/"+deletion.ID] = *deletion
+	return nil
+}
+
+func (f *fakeExternalSystem) CancelPendingDeletion(deletion *core.PendingDeletion) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.pending, deletion.Kind+"/"+deletion.ID)
+	return nil
+}
+
+func (f *fakeExternalSystem) GetUserParents(offset, limit int) ([]core.EntityParent, error) {
+	ids, _ := f.GetActiveUserIDs(offset, limit)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	parents := make([]core.EntityParent, len(ids))
+	for i, id := range ids {
+		parents[i] = core.EntityParent{ID: id, ParentID: f.users[id].TenantID}
+	}
+	return parents, nil
+}
+
+func (f *fakeExternalSystem) GetAccessPolicyParents(offset, limit int) ([]core.EntityParent, error) {
+	ids, _ := f.GetActiveAccessPolicyIDs(offset, limit)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	parents := make([]core.EntityParent, len(ids))
+	for i, id := range ids {
+		parents[i] = core.EntityParent{ID: id, ParentID: f.accessPolicies[id].TrusteeID}
+	}
+	return parents, nil
+}
+
+func (f *fakeExternalSystem) hasTenant(tenantID string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	_, ok := f.tenants[tenantID]
+	return ok
+}
+
+// pageIDs returns a page of IDs in stable order
+func pageIDs(ids []string, offset, limit int) []string {
+	sort.Strings(ids)
+	if offset >= len(ids) {
+		return nil
+	}
+	if offset+limit < len(ids) {
+		return ids[offset : offset+limit]
+	}
+	return ids[offset:]
+}
+
+func (f *fakeExternalSystem) accessPolicyIDs() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var ids []string
+	for id := range f.accessPolicies {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// fingerprintExternalSystem is fakeExternalSystem which implements core.FingerprintClient
+type fingerprintExternalSystem struct {
+	*fakeExternalSystem
+}
+
+func (f fingerprintExternalSystem) GetTenantFingerprints(offset, limit int) ([]core.Fingerprint, error) {
+	ids, _ := f.GetActiveTenantIDs(offset, limit)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	fingerprints := make([]core.Fingerprint, len(ids))
+	for i, id := range ids {
+		tenant := f.tenants[id]
+		fingerprints[i] = core.TenantFingerprint(&tenant)
+	}
+	return fingerprints, nil
+}
+
+func (f fingerprintExternalSystem) GetUserFingerprints(offset, limit int) ([]core.Fingerprint, error) {
+	ids, _ := f.GetActiveUserIDs(offset, limit)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	fingerprints := make([]core.Fingerprint, len(ids))
+	for i, id := range ids {
+		user := f.users[id]
+		fingerprints[i] = core.UserFingerprint(&user)
+	}
+	return fingerprints, nil
+}
+
+func TestFakeExternalSystem_Conformance(t *testing.T) {
+	conformance.Run(t, func(t *testing.T) core.ExternalSystemClient {
+		return newFakeExternalSystem()
+	})
+	conformance.Run(t, func(t *testing.T) core.ExternalSystemClient {
+		return fingerprintExternalSystem{newFakeExternalSystem()}
+	})
+}
+
+// newTestUpdater returns an updater connected to the fake ACC server
+func newTestUpdater(t *testing.T, server *acctest.Server, extClient core.ExternalSystemClient, options ...Option) *Updater {
+	return newTestUpdaterWithConfig(t, server, extClient, NewDefaultConfig(), options...)
+}
+
+func newTestUpdaterWithConfig(
+	t *testing.T, server *acctest.Server, extClient core.ExternalSystemClient, config *Config, options ...Option) *Updater {
+	config.AuthSettings.ClientID = server.ClientID
+	config.AuthSettings.ClientSecret = server.ClientSecret
+	config.APIServerSettings.BaseURL = server.URL
+	config.HTTPClientSettings.MaxRetries = 0
+
+	u, err := NewUpdater(config, extClient, options...)
+	if err != nil {
+		t.Fatalf("failed to create updater: %v", err)
+	}
+	return u
+}
+
+func TestUpdater_Reconciliation(t *testing.T) {
+	server := acctest.NewServer()
+	defer server.Close()
+
+	customer := server.AddTenant(accclient.Tenant{Name: "customer", Kind: "customer", Enabled: true})
+	if err := server.SetOfferingItems(customer.ID,
+		accclient.OfferingItem{ApplicationID: "app", Name: "storage", Status: 1},
+		accclient.OfferingItem{ApplicationID: "app", Name: "workstations", Status: 0},
+	); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	user := server.AddUser(accclient.User{
+		TenantID:       customer.ID,
+		Login:          "admin",
+		Enabled:        true,
+		AccessPolicies: []accclient.AccessPolicy{{RoleID: accclient.RoleIDCompanyAdmin}},
+	})
+
+	ext := newFakeExternalSystem()
+	ext.tenants["stale"] = accclient.Tenant{ID: "stale"}
+	ext.users["stale"] = accclient.User{ID: "stale"}
+	ext.customerIDs[customer.ID] = "C-1"
+
+	u := newTestUpdater(t, server, ext)
+	if timestamp := u.recon.ReconcileTenantsAndOfferingItems(true); timestamp.IsZero() {
+		t.Errorf("expected timestamp for the update loop")
+	}
+	u.recon.ReconcileUsersAndAccessPolicies(true)
+
+	if _, ok := ext.tenants["stale"]; ok || len(ext.tenants) != 2 {
+		t.Errorf("expected root and customer tenants, got %v", ext.tenants)
+	}
+	if _, ok := ext.tenants[customer.ID]; !ok {
+		t.Errorf("expected customer tenant %v to be synced", customer.ID)
+	}
+	if len(ext.offeringItems) != 1 {
+		t.Errorf("expected only enabled offering item to be synced, got %v", ext.offeringItems)
+	}
+	if _, ok := ext.users["stale"]; ok || len(ext.users) != 1 {
+		t.Errorf("expected user %v only, got %v", user.ID, ext.users)
+	}
+	if len(ext.accessPolicies) != 1 {
+		t.Errorf("expected access policy of user %v, got %v", user.ID, ext.accessPolicies)
+	}
+
+	tenant, _ := server.GetTenant(customer.ID)
+	if tenant.CustomerID == nil || *tenant.CustomerID != "C-1" {
+		t.Errorf("expected customer ID to be written back, got %v", tenant.CustomerID)
+	}
+}
+
+func TestUpdater_ReconciliationSkipsUnchanged(t *testing.T) {
+	server := acctest.NewServer()
+	defer server.Close()
+
+	customer := server.AddTenant(accclient.Tenant{Name: "customer", Kind: "customer", Enabled: true})
+	if err := server.SetOfferingItems(customer.ID, accclient.OfferingItem{ApplicationID: "app", Name: "storage", Status: 1}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	server.AddUser(accclient.User{
+		TenantID:       customer.ID,
+		Login:          "admin",
+		Enabled:        true,
+		AccessPolicies: []accclient.AccessPolicy{{RoleID: accclient.RoleIDCompanyAdmin}},
+	})
+
+	ext := newFakeExternalSystem()
+	store := NewMemoryStateStore()
+	reconcile := func(u *Updater) int {
+		ext.upserts = 0
+		u.recon.ReconcileTenantsAndOfferingItems(true)
+		u.recon.ReconcileUsersAndAccessPolicies(true)
+		return ext.upserts
+	}
+
+	u := newTestUpdater(t, server, ext, WithStateStore(store))
+	// root and customer tenants, offering item, user and access policy, root tenant is pushed once
+	// even if customer is reconciled first and pushes it as its parent
+	if upserts := reconcile(u); upserts != 5 {
+		t.Errorf("expected all entities pushed on first reconciliation, got %v upserts", upserts)
+	}
+	if upserts := reconcile(u); upserts != 0 {
+		t.Errorf("expected no entities pushed without changes, got %v upserts", upserts)
+	}
+
+	if err := server.ModifyTenant(customer.ID, func(tenant *accclient.Tenant) { tenant.Name = "renamed" }); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	delete(ext.accessPolicies, ext.accessPolicyIDs()[0])
+	if upserts := reconcile(u); upserts != 2 {
+		t.Errorf("expected changed tenant and access policy missing in external system pushed, got %v upserts", upserts)
+	}
+	if ext.tenants[customer.ID].Name != "renamed" || len(ext.accessPolicies) != 1 {
+		t.Errorf("expected external system to be reconciled, got %v and %v", ext.tenants[customer.ID], ext.accessPolicies)
+	}
+
+	config := NewDefaultConfig()
+	config.ForceFullPush = true
+	u = newTestUpdaterWithConfig(t, server, ext, config, WithStateStore(store))
+	if upserts := reconcile(u); upserts != 5 {
+		t.Errorf("expected all entities pushed with force full push, got %v upserts", upserts)
+	}
+}
+
+// unversionedFingerprintExternalSystem returns fingerprints of users without versions, so that drift is detected
+// by content only
+type unversionedFingerprintExternalSystem struct {
+	fingerprintExternalSystem
+}
+
+func (f unversionedFingerprintExternalSystem) GetUserFingerprints(offset, limit int) ([]core.Fingerprint, error) {
+	fingerprints, err := f.fingerprintExternalSystem.GetUserFingerprints(offset, limit)
+	for i := range fingerprints {
+		fingerprints[i].Version = 0
+	}
+	return fingerprints, err
+}
+
+func TestUpdater_ReconciliationDrift(t *testing.T) {
+	server := acctest.NewServer()
+	defer server.Close()
+
+	customer := server.AddTenant(accclient.Tenant{Name: "customer", Kind: "customer", Enabled: true})
+	user := server.AddUser(accclient.User{TenantID: customer.ID, Login: "admin", Enabled: true})
+
+	ext := fingerprintExternalSystem{newFakeExternalSystem()}
+	store := NewMemoryStateStore()
+	u := newTestUpdater(t, server, ext, WithStateStore(store))
+	u.recon.ReconcileTenantsAndOfferingItems(true)
+	u.recon.ReconcileUsersAndAccessPolicies(true)
+
+	// edited directly in external system, versions are unchanged
+	drifted := ext.tenants[customer.ID]
+	drifted.Name = "edited"
+	ext.tenants[customer.ID] = drifted
+	driftedUser := ext.users[user.ID]
+	driftedUser.Login = "edited"
+	ext.users[user.ID] = driftedUser
+
+	config := NewDefaultConfig()
+	config.DriftPolicy = string(DriftPolicyReport)
+	u = newTestUpdaterWithConfig(t, server, ext, config, WithStateStore(store))
+	ext.upserts = 0
+	u.recon.ReconcileTenantsAndOfferingItems(true)
+	u.recon.ReconcileUsersAndAccessPolicies(true)
+	if ext.upserts != 0 || ext.tenants[customer.ID].Name != "edited" || ext.users[user.ID].Login != "edited" {
+		t.Errorf("expected drift only reported, got %v upserts", ext.upserts)
+	}
+
+	// drifted user changed in ACC is pushed, even if drift is reported only and versions aren't compared
+	u = newTestUpdaterWithConfig(t, server, unversionedFingerprintExternalSystem{ext}, config, WithStateStore(store))
+	report := u.recon.(*ReconciliationLoop).ReconcileUsersAndAccessPoliciesOnce()
+	if ext.upserts != 0 || len(report.Drifted) != 1 || report.Drifted[0].ID != user.ID || report.Summary[OutcomeDrifted] != 1 {
+		t.Errorf("expected drifted user in report, got %v upserts, %+v", ext.upserts, report.Drifted)
+	}
+	if err := server.ModifyUser(user.ID, func(user *accclient.User) { user.Language = "de" }); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	report = u.recon.(*ReconciliationLoop).ReconcileUsersAndAccessPoliciesOnce()
+	if ext.upserts != 1 || ext.users[user.ID].Login != "admin" || len(report.Drifted) != 1 || len(report.Updated) != 1 {
+		t.Errorf("expected drifted user changed in ACC to be reported and pushed, got %v upserts, %+v", ext.upserts, report)
+	}
+
+	u = newTestUpdater(t, server, ext, WithStateStore(store))
+	ext.upserts = 0
+	u.recon.ReconcileTenantsAndOfferingItems(true)
+	u.recon.ReconcileUsersAndAccessPolicies(true)
+	if ext.upserts != 1 || ext.tenants[customer.ID].Name != "customer" || ext.users[user.ID].Login != "admin" {
+		t.Errorf("expected drifted tenant pushed again, got %v upserts, %v and %v", ext.upserts,
+			ext.tenants[customer.ID].Name, ext.users[user.ID].Login)
+	}
+}
+
+func TestUpdater_ReconciliationRepairsOrphans(t *testing.T) {
+	server := acctest.NewServer()
+	defer server.Close()
+
+	customer := server.AddTenant(accclient.Tenant{Name: "customer", Kind: "customer", Enabled: true})
+	user := server.AddUser(accclient.User{
+		TenantID:       customer.ID,
+		Login:          "admin",
+		Enabled:        true,
+		AccessPolicies: []accclient.AccessPolicy{{RoleID: accclient.RoleIDCompanyAdmin}},
+	})
+
+	ext := newFakeExternalSystem()
+	u := newTestUpdater(t, server, ext)
+	u.recon.ReconcileTenantsAndOfferingItems(true)
+	u.recon.ReconcileUsersAndAccessPolicies(true)
+	if len(ext.users) != 1 || len(ext.accessPolicies) != 1 {
+		t.Fatalf("expected user and access policy to be synced, got %v and %v", ext.users, ext.accessPolicies)
+	}
+
+	// deleted directly in external system, restored from ACC as the tenant of the user
+	delete(ext.tenants, customer.ID)
+	u.recon.ReconcileUsersAndAccessPolicies(true)
+	if !ext.hasTenant(customer.ID) {
+		t.Errorf("expected tenant %v of user %v to be restored", customer.ID, user.ID)
+	}
+
+	// deleted in ACC while its user is still active, the user and its access policy are removed with the tenant
+	if err := server.DeleteTenant(customer.ID); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	u.recon.ReconcileTenantsAndOfferingItems(true)
+	u.recon.ReconcileUsersAndAccessPolicies(true)
+	if ext.hasTenant(customer.ID) || len(ext.users) != 0 || len(ext.accessPolicies) != 0 {
+		t.Errorf("expected tenant, user and access policy to be removed, got %v and %v", ext.users, ext.accessPolicies)
+	}
+
+	// disabled repair keeps the orphans
+	ext.users[user.ID] = user
+	config := NewDefaultConfig()
+	config.RepairOrphans = false
+	u = newTestUpdaterWithConfig(t, server, ext, config)
+	u.recon.ReconcileUsersAndAccessPolicies(true)
+	if len(ext.users) != 1 {
+		t.Errorf("expected user %v without tenant to be kept", user.ID)
+	}
+}
+
+func TestUpdater_ReconciliationReports(t *testing.T) {
+	server := acctest.NewServer()
+	defer server.Close()
+
+	customer := server.AddTenant(accclient.Tenant{Name: "customer", Kind: "customer", Enabled: true})
+	server.AddUser(accclient.User{TenantID: customer.ID, Login: "admin", Enabled: true})
+
+	ext := newFakeExternalSystem()
+	ext.tenants["stale"] = accclient.Tenant{ID: "stale"}
+	u := newTestUpdater(t, server, ext)
+	u.recon.ReconcileTenantsAndOfferingItems(true)
+	u.recon.ReconcileUsersAndAccessPolicies(true)
+	u.recon.ReconcileTenantsAndOfferingItems(true)
+
+	reports, err := u.Reports(10)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(reports) != 3 || reports[0].Kind != ReportTenantsAndOfferingItems || reports[1].Kind != ReportUsersAndAccessPolicies {
+		t.Fatalf("expected 3 reports, newest first, got %+v", reports)
+	}
+	if reports[2].Created != nil || reports[2].Summary[OutcomeCreated] != 2 {
+		t.Errorf("expected report header with 2 created entities, got %+v", reports[2])
+	}
+
+	report, ok, err := u.Report(reports[2].ID)
+	if err != nil || !ok {
+		t.Fatalf("Report() = %v, %v, want report", ok, err)
+	}
+	if report.ACCCounts[EntityTenant] != 2 || report.ExternalCounts[EntityTenant] != 1 || report.Error != "" {
+		t.Errorf("expected 2 tenants in ACC and 1 in external system, got %+v", report)
+	}
+	if len(report.Deleted) != 1 || report.Deleted[0] != (ReportEntry{Kind: EntityTenant, ID: "stale", Reason: reasonNotInACC}) {
+		t.Errorf("expected stale tenant deleted, got %+v", report.Deleted)
+	}
+	created := make(map[string]string)
+	for _, entry := range report.Created {
+		created[entry.ID] = entry.Reason
+	}
+	if created[customer.ID] != reasonMissing {
+		t.Errorf("expected customer tenant created, got %+v", report.Created)
+	}
+
+	// nothing changed since the first run
+	if reports[0].Summary[OutcomeSkipped] != 2 || len(reports[0].Summary) != 1 {
+		t.Errorf("expected 2 skipped tenants only, got %v", reports[0].Summary)
+	}
+}
+
+func TestUpdater_DeletionGracePeriod(t *testing.T) {
+	server := acctest.NewServer()
+	defer server.Close()
+
+	customer := server.AddTenant(accclient.Tenant{Name: "customer", Kind: "customer", Enabled: true})
+
+	ext := newFakeExternalSystem()
+	clock := NewFakeClock(time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC))
+	config := NewDefaultConfig()
+	config.DeletionGracePeriod.Tenant = 3600
+	u := newTestUpdaterWithConfig(t, server, ext, config, WithClock(clock))
+	u.recon.ReconcileTenantsAndOfferingItems(true)
+
+	if err := server.DeleteTenant(customer.ID); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	u.recon.ReconcileTenantsAndOfferingItems(true)
+	if !ext.hasTenant(customer.ID) {
+		t.Fatalf("expected tenant %v to be kept during grace period", customer.ID)
+	}
+	deleteAt := clock.Now().Add(time.Hour)
+	if pending := u.PendingDeletions(); len(pending) != 1 || !pending[0].DeleteAt.Equal(deleteAt) {
+		t.Errorf("expected tenant %v pending deletion until %v, got %+v", customer.ID, deleteAt, pending)
+	}
+	if _, ok := ext.pending[EntityTenant+"/"+customer.ID]; !ok {
+		t.Errorf("expected tenant %v to be marked pending deletion in external system", customer.ID)
+	}
+
+	// restored within the grace period
+	if err := server.ModifyTenant(customer.ID, func(tenant *accclient.Tenant) {
+		tenant.DeletedAt = accclient.CustomTime{}
+		tenant.Enabled = true
+	}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	u.recon.ReconcileTenantsAndOfferingItems(true)
+	clock.Advance(time.Hour)
+	u.recon.ReconcileTenantsAndOfferingItems(true)
+	if !ext.hasTenant(customer.ID) || len(ext.pending) != 0 || len(u.PendingDeletions()) != 0 {
+		t.Errorf("expected pending deletion of restored tenant %v to be cancelled", customer.ID)
+	}
+
+	// deleted once the grace period expires
+	if err := server.DeleteTenant(customer.ID); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	u.recon.ReconcileTenantsAndOfferingItems(true)
+	clock.Advance(time.Hour - time.Second)
+	u.recon.ReconcileTenantsAndOfferingItems(true)
+	if !ext.hasTenant(customer.ID) {
+		t.Fatalf("expected tenant %v to be kept during grace period", customer.ID)
+	}
+	clock.Advance(time.Second)
+	u.recon.ReconcileTenantsAndOfferingItems(true)
+	if ext.hasTenant(customer.ID) || len(u.PendingDeletions()) != 0 {
+		t.Errorf("expected tenant %v to be deleted after grace period", customer.ID)
+	}
+}
+
+func TestUpdater_Usages(t *testing.T) {
+	server := acctest.NewServer()
+	defer server.Close()
+
+	customer := server.AddTenant(accclient.Tenant{Name: "customer", Kind: "customer", Enabled: true})
+	offeringItem := "storage"
+
+	ext := newFakeExternalSystem()
+	ext.usages = []accclient.Usage{{TenantID: &customer.ID, OfferingItem: &offeringItem, UsageValue: 42}}
+
+	u := newTestUpdater(t, server, ext)
+	if _, err := u.usage.(*UsageLoop).pushUsagesWithOffset(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if usages := server.Usages(); len(usages) != 1 || usages[0].UsageValue != 42 {
+		t.Errorf("expected usage to be pushed, got %+v", usages)
+	}
+}
+
+// waitJob polls the job until it's finished
+func waitJob(t *testing.T, u *Updater, id string) Job {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		job, ok := u.Job(id)
+		if !ok {
+			t.Fatalf("job %v not found", id)
+		}
+		if job.Status != JobRunning {
+			return job
+		}
+	}
+	t.Fatalf("job %v is still running", id)
+	return Job{}
+}
+
+func TestUpdater_Jobs(t *testing.T) {
+	server := acctest.NewServer()
+	defer server.Close()
+
+	customer := server.AddTenant(accclient.Tenant{Name: "customer", Kind: "customer", Enabled: true})
+	unit := server.AddTenant(accclient.Tenant{Name: "unit", Kind: "unit", ParentID: customer.ID, Enabled: true})
+	other := server.AddTenant(accclient.Tenant{Name: "other", Kind: "customer", Enabled: true})
+	user := server.AddUser(accclient.User{
+		TenantID:       unit.ID,
+		Login:          "admin",
+		Enabled:        true,
+		AccessPolicies: []accclient.AccessPolicy{{RoleID: accclient.RoleIDCompanyAdmin}},
+	})
+
+	ext := newFakeExternalSystem()
+	offeringItem := "storage"
+	ext.usages = []accclient.Usage{{TenantID: &customer.ID, OfferingItem: &offeringItem, UsageValue: 42}}
+	u := newTestUpdater(t, server, ext, WithStateStore(NewMemoryStateStore()))
+	u.recon.ReconcileTenantsAndOfferingItems(true)
+	u.recon.ReconcileUsersAndAccessPolicies(true)
+
+	// entities edited in external system are pushed again, even though they are not changed in ACC
+	for _, id := range []string{customer.ID, unit.ID, other.ID} {
+		tenant := ext.tenants[id]
+		tenant.Name = "edited"
+		ext.tenants[id] = tenant
+	}
+	delete(ext.users, user.ID)
+
+	job := waitJob(t, u, u.ResyncTenant(customer.ID).ID)
+	if job.Status != JobSucceeded || job.Kind != JobResyncTenant || job.Target != customer.ID || job.FinishedAt == nil {
+		t.Fatalf("expected succeeded job, got %+v", job)
+	}
+	if job.Result.Tenants != 2 || job.Result.Users != 1 {
+		t.Errorf("expected 2 tenants and a user pushed, got %+v", job.Result)
+	}
+	if ext.tenants[customer.ID].Name != "customer" || ext.tenants[unit.ID].Name != "unit" {
+		t.Errorf("expected tenants of the subtree to be pushed, got %v", ext.tenants)
+	}
+	if ext.tenants[other.ID].Name != "edited" {
+		t.Errorf("expected tenant %v outside of the subtree not to be pushed", other.ID)
+	}
+	if _, ok := ext.users[user.ID]; !ok {
+		t.Errorf("expected user %v of the subtree to be pushed", user.ID)
+	}
+
+	if err := server.DeleteUser(user.ID); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if job := waitJob(t, u, u.ResyncUser(user.ID).ID); job.Status != JobSucceeded || job.Result.Users != 1 {
+		t.Errorf("expected succeeded job, got %+v", job)
+	}
+	if _, ok := ext.users[user.ID]; ok || len(ext.accessPolicies) != 0 {
+		t.Errorf("expected user %v deleted in ACC to be deleted with its access policies", user.ID)
+	}
+
+	if job := waitJob(t, u, u.ResyncUser("unknown").ID); job.Status != JobFailed || job.Error == "" {
+		t.Errorf("expected failed job for unknown user, got %+v", job)
+	}
+
+	if job := waitJob(t, u, u.PushUsages().ID); job.Status != JobSucceeded || job.Result.Usages != 1 {
+		t.Errorf("expected succeeded job, got %+v", job)
+	}
+	if usages := server.Usages(); len(usages) != 1 || usages[0].UsageValue != 42 {
+		t.Errorf("expected usage to be pushed, got %+v", usages)
+	}
+
+	if jobs := u.Jobs(); len(jobs) != 4 || jobs[0].Kind != JobPushUsages || jobs[3].Kind != JobResyncTenant {
+		t.Errorf("expected 4 jobs, newest first, got %+v", jobs)
+	}
+}
+
+func TestUpdater_ResyncTenantRemovesDeleted(t *testing.T) {
+	server := acctest.NewServer()
+	defer server.Close()
+
+	customer := server.AddTenant(accclient.Tenant{Name: "customer", Kind: "customer", Enabled: true})
+	unit := server.AddTenant(accclient.Tenant{Name: "unit", Kind: "unit", ParentID: customer.ID, Enabled: true})
+	other := server.AddTenant(accclient.Tenant{Name: "other", Kind: "customer", Enabled: true})
+	if err := server.SetOfferingItems(unit.ID, accclient.OfferingItem{ApplicationID: "app", Name: "storage", Status: 1}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	user := server.AddUser(accclient.User{
+		TenantID:       customer.ID,
+		Login:          "admin",
+		Enabled:        true,
+		AccessPolicies: []accclient.AccessPolicy{{RoleID: accclient.RoleIDCompanyAdmin}},
+	})
+
+	ext := newFakeExternalSystem()
+	config := NewDefaultConfig()
+	config.DeletionGracePeriod.User = 3600
+	u := newTestUpdaterWithConfig(t, server, ext, config, WithStateStore(NewMemoryStateStore()))
+	u.recon.ReconcileTenantsAndOfferingItems(true)
+	u.recon.ReconcileUsersAndAccessPolicies(true)
+	ext.tenants["stale"] = accclient.Tenant{ID: "stale"}
+
+	for _, tenantID := range []string{unit.ID, other.ID} {
+		if err := server.DeleteTenant(tenantID); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if err := server.DeleteUser(user.ID); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	job := waitJob(t, u, u.ResyncTenant(customer.ID).ID)
+	if job.Status != JobSucceeded || job.Result.Tenants != 2 || job.Result.Users != 1 || len(job.Result.Reports) != 2 {
+		t.Fatalf("expected succeeded job with 2 tenants, a user and 2 reports, got %+v", job)
+	}
+	if ext.hasTenant(unit.ID) || len(ext.offeringItems) != 0 {
+		t.Errorf("expected tenant %v deleted in ACC to be removed with its offering items", unit.ID)
+	}
+	if !ext.hasTenant(customer.ID) || !ext.hasTenant(other.ID) || !ext.hasTenant("stale") {
+		t.Errorf("expected tenants outside of the subtree to be left to reconciliation, got %v", ext.tenants)
+	}
+	if _, ok := ext.users[user.ID]; !ok {
+		t.Errorf("expected user %v to be kept during grace period", user.ID)
+	}
+	if pending := u.PendingDeletions(); len(pending) != 1 || pending[0].ID != user.ID {
+		t.Errorf("expected user %v pending deletion, got %+v", user.ID, pending)
+	}
+	if len(ext.accessPolicies) != 0 {
+		t.Errorf("expected access policies of deleted user to be removed, got %v", ext.accessPolicies)
+	}
+
+	report, ok, err := u.Report(job.Result.Reports[0])
+	if err != nil || !ok {
+		t.Fatalf("Report() = %v, %v, want report", ok, err)
+	}
+	if report.Subtree != customer.ID || report.Kind != ReportTenantsAndOfferingItems ||
+		report.Summary[OutcomeDeleted] != 2 || report.Summary[OutcomeUpdated] != 1 {
+		t.Errorf("expected report of the subtree with deleted tenant and offering item, got %+v", report)
+	}
+	report, ok, err = u.Report(job.Result.Reports[1])
+	if err != nil || !ok {
+		t.Fatalf("Report() = %v, %v, want report", ok, err)
+	}
+	if len(report.Pending) != 1 || report.Pending[0].ID != user.ID {
+		t.Errorf("expected user %v pending deletion in report, got %+v", user.ID, report.Pending)
+	}
+
+	if job := waitJob(t, u, u.ResyncTenant("unknown").ID); job.Status != JobFailed || job.Error == "" {
+		t.Errorf("expected failed job for unknown tenant, got %+v", job)
+	}
+}
+
+func TestUpdater_JobsWhileSyncRuns(t *testing.T) {
+	server := acctest.NewServer()
+	defer server.Close()
+
+	customer := server.AddTenant(accclient.Tenant{Name: "customer", Kind: "customer", Enabled: true})
+	user := server.AddUser(accclient.User{TenantID: customer.ID, Login: "admin", Enabled: true})
+
+	ext := newFakeExternalSystem()
+	clock := NewFakeClock(time.Now())
+	u := newTestUpdater(t, server, ext, WithClock(clock), WithStateStore(NewMemoryStateStore()))
+	tenantsUpdatedSince := u.recon.ReconcileTenantsAndOfferingItems(true)
+	usersUpdatedSince := u.recon.ReconcileUsersAndAccessPolicies(true)
+	go u.sync.UpdateTenantsAndOfferingItems(tenantsUpdatedSince)
+	go u.sync.UpdateUsersAndAccessPolicies(usersUpdatedSince)
+
+	// sync cycles pushing changes run alongside the jobs, checked by the race detector
+	var jobIDs []string
+	for i := 0; i < 20; i++ {
+		clock.BlockUntil(2)
+		if err := server.ModifyTenant(customer.ID, func(tenant *accclient.Tenant) {
+			tenant.Name = fmt.Sprintf("customer %v", i)
+		}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		clock.Advance(time.Hour)
+		jobIDs = append(jobIDs, u.ResyncTenant(customer.ID).ID, u.ResyncUser(user.ID).ID)
+	}
+
+	for _, id := range jobIDs {
+		if job := waitJob(t, u, id); job.Status != JobSucceeded {
+			t.Errorf("expected succeeded job, got %+v", job)
+		}
+	}
+}
+
+func TestUpdater_Diff(t *testing.T) {
+	server := acctest.NewServer()
+	defer server.Close()
+
+	customer := server.AddTenant(accclient.Tenant{Name: "customer", Kind: "customer", Enabled: true})
+	unit := server.AddTenant(accclient.Tenant{Name: "unit", Kind: "unit", ParentID: customer.ID, Enabled: true})
+	other := server.AddTenant(accclient.Tenant{Name: "other", Kind: "customer", Enabled: true})
+	user := server.AddUser(accclient.User{
+		TenantID:       customer.ID,
+		Login:          "admin",
+		Enabled:        true,
+		AccessPolicies: []accclient.AccessPolicy{{RoleID: accclient.RoleIDCompanyAdmin}},
+	})
+
+	ext := fingerprintExternalSystem{newFakeExternalSystem()}
+	u := newTestUpdater(t, server, ext)
+	u.recon.ReconcileTenantsAndOfferingItems(true)
+	u.recon.ReconcileUsersAndAccessPolicies(true)
+
+	diff, err := u.Diff(context.Background(), customer.ID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(diff.Entries) != 0 || !diff.ContentCompared || diff.Compared[EntityTenant] != 2 || diff.Compared[EntityUser] != 1 {
+		t.Errorf("expected no differences, got %+v", diff)
+	}
+
+	drifted := ext.tenants[customer.ID]
+	drifted.Name = "edited"
+	ext.tenants[customer.ID] = drifted
+	delete(ext.tenants, unit.ID)
+	edited := ext.tenants[other.ID]
+	edited.Name = "edited"
+	ext.tenants[other.ID] = edited
+	if err := server.DeleteUser(user.ID); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	ext.upserts = 0
+	diff, err = u.Diff(context.Background(), customer.ID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	statuses := make(map[string]string)
+	for _, entry := range diff.Entries {
+		statuses[entry.ID] = entry.Status
+		if entry.Status == DiffDrifted && len(entry.Fields) == 0 {
+			t.Errorf("expected drifted fields of %v", entry.ID)
+		}
+	}
+	accessPolicyID := user.AccessPolicies[0].ID
+	if len(statuses) != 4 || statuses[customer.ID] != DiffDrifted || statuses[unit.ID] != DiffMissing ||
+		statuses[user.ID] != DiffDeleted || statuses[accessPolicyID] != DiffDeleted {
+		t.Errorf("expected drifted tenant, missing unit, deleted user and access policy, got %+v", diff.Entries)
+	}
+	if ext.upserts != 0 || ext.hasTenant(unit.ID) || len(ext.users) != 1 {
+		t.Errorf("expected external system to be unchanged by diff")
+	}
+
+	if _, err := u.Diff(context.Background(), "unknown"); err == nil {
+		t.Errorf("expected error for unknown tenant")
+	}
+}
@@ -0,0 +1,229 @@
+// Copyright (c) 2021 Acronis International GmbH
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package updater
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/acronis/acronis-cyber-cloud-go-sample-connector/connector/accclient"
+	"github.com/acronis/acronis-cyber-cloud-go-sample-connector/connector/core"
+)
+
+// Statuses of entities which differ between ACC and external system
+const (
+	DiffMissing  = "missing"  // active in ACC, doesn't exist in external system
+	DiffDeleted  = "deleted"  // deleted or disabled in ACC, still exists in external system
+	DiffOutdated = "outdated" // external system has an older version of the entity
+	DiffDrifted  = "drifted"  // fields in external system differ from the same version in ACC
+)
+
+// TenantDiff is the difference between ACC and external system of the entities of a tenant subtree
+type TenantDiff struct {
+	TenantID string         `json:"tenant_id"`
+	Compared map[string]int `json:"compared"` // entities in ACC compared with external system by entity kind
+	// ContentCompared is false if external system doesn't implement core.FingerprintClient,
+	// so that only the existence of tenants and users is compared
+	ContentCompared bool        `json:"content_compared"`
+	Entries         []DiffEntry `json:"entries,omitempty"`
+}
+
+// DiffEntry is an entity which differs between ACC and external system
+type DiffEntry struct {
+	Kind   string   `json:"kind"` // EntityTenant, EntityOfferingItem, EntityUser or EntityAccessPolicy
+	ID     string   `json:"id"`
+	Status string   `json:"status"`           // DiffMissing, DiffDeleted, DiffOutdated or DiffDrifted
+	Fields []string `json:"fields,omitempty"` // names of the fields which differ, for DiffDrifted
+}
+
+// diffSide collects the entities of one kind from ACC to be looked up in external system
+type diffSide struct {
+	active       map[string]core.Fingerprint // fingerprints of tenants and users, empty ones for other kinds
+	deleted      map[string]bool
+	reportedIDs  map[string]string // IDs of entities in the diff keyed by their IDs in external system, if they differ
+	externalScan func() *externalIDStream
+}
+
+// Diff compares the tenant and the tenants and users of its subtree in ACC, with their offering items and
+// access policies, with external system, without changing anything. All entities of external system are walked,
+// as they can be looked up by ID only in pages.
+func (loop *ReconciliationLoop) Diff(ctx context.Context, tenantID string) (*TenantDiff, error) {
+	fingerprintClient, contentCompared := loop.extClient.(core.FingerprintClient)
+	sides := map[string]*diffSide{
+		EntityTenant: {externalScan: func() *externalIDStream {
+			if contentCompared {
+				return newExternalFingerprintStream(ctx, loop.clock, fingerprintClient.GetTenantFingerprints)
+			}
+			return newExternalIDStream(ctx, loop.clock, loop.extClient.GetActiveTenantIDs)
+		}},
+		EntityOfferingItem: {externalScan: func() *externalIDStream {
+			return newExternalIDStream(ctx, loop.clock, loop.getExternalSystemOfferingItemKeys)
+		}},
+		EntityUser: {externalScan: func() *externalIDStream {
+			if contentCompared {
+				return newExternalFingerprintStream(ctx, loop.clock, fingerprintClient.GetUserFingerprints)
+			}
+			return newExternalIDStream(ctx, loop.clock, loop.extClient.GetActiveUserIDs)
+		}},
+		EntityAccessPolicy: {externalScan: func() *externalIDStream {
+			return newExternalIDStream(ctx, loop.clock, loop.extClient.GetActiveAccessPolicyIDs)
+		}},
+	}
+	for _, side := range sides {
+		side.active = make(map[string]core.Fingerprint)
+		side.deleted = make(map[string]bool)
+		side.reportedIDs = make(map[string]string)
+	}
+
+	if err := loop.collectDiffTenants(ctx, tenantID, sides); err != nil {
+		return nil, err
+	}
+	if len(sides[EntityTenant].active)+len(sides[EntityTenant].deleted) == 0 {
+		return nil, fmt.Errorf("tenant %v not found", tenantID)
+	}
+	if err := loop.collectDiffUsers(ctx, tenantID, sides); err != nil {
+		return nil, err
+	}
+
+	diff := &TenantDiff{TenantID: tenantID, Compared: make(map[string]int), ContentCompared: contentCompared}
+	for _, kind := range []string{EntityTenant, EntityOfferingItem, EntityUser, EntityAccessPolicy} {
+		entries, err := loop.diffEntities(kind, sides[kind])
+		if err != nil {
+			return nil, fmt.Errorf("failed to get %v IDs from external system: %w", entityName(kind), err)
+		}
+		diff.Compared[kind] = len(sides[kind].active)
+		diff.Entries = append(diff.Entries, entries...)
+	}
+	return diff, nil
+}
+
+// collectDiffTenants collects the tenants of the subtree and their offering items from ACC
+func (loop *ReconciliationLoop) collectDiffTenants(ctx context.Context, tenantID string, sides map[string]*diffSide) error {
+	limit := uint(accPageSize)
+	withOfferingItems := true
+	tenants := loop.accClient.NewTenantIterator(&accclient.TenantGetRequest{
+		SubTreeRootID:     tenantID,
+		Limit:             &limit,
+		WithOfferingItems: &withOfferingItems,
+		AllowDeleted:      true,
+	})
+	for tenants.Next(ctx) {
+		tenant := tenants.Item()
+		if !tenant.DeletedAt.IsZero() {
+			sides[EntityTenant].deleted[tenant.ID] = true
+		} else {
+			sides[EntityTenant].active[tenant.ID] = core.TenantFingerprint(tenant)
+		}
+		for i := range tenant.OfferingItems {
+			key := offeringItemKey(core.OfferingItemID{OfferingItemName: tenant.OfferingItems[i].Name, TenantID: tenant.ID})
+			sides[EntityOfferingItem].reportedIDs[key] = reportOfferingItemID(key)
+			if tenant.OfferingItems[i].Status == 0 || !tenant.DeletedAt.IsZero() {
+				sides[EntityOfferingItem].deleted[key] = true
+			} else {
+				sides[EntityOfferingItem].active[key] = core.Fingerprint{}
+			}
+		}
+	}
+	if err := tenants.Err(); err != nil {
+		return fmt.Errorf("failed to get tenants of subtree %v: %w", tenantID, err)
+	}
+	return nil
+}
+
+// collectDiffUsers collects the users of the subtree and their access policies from ACC
+func (loop *ReconciliationLoop) collectDiffUsers(ctx context.Context, tenantID string, sides map[string]*diffSide) error {
+	limit := uint(accPageSize)
+	withAccessPolicies := true
+	users := loop.accClient.NewUserIterator(&accclient.UserGetRequest{
+		SubTreeRootTenantID: tenantID,
+		Limit:               &limit,
+		WithAccessPolicies:  &withAccessPolicies,
+		AllowDeleted:        true,
+	})
+	for users.Next(ctx) {
+		user := users.Item()
+		if user.ID == "" {
+			continue
+		}
+		if !user.DeletedAt.IsZero() {
+			sides[EntityUser].deleted[user.ID] = true
+		} else {
+			sides[EntityUser].active[user.ID] = core.UserFingerprint(user)
+		}
+		for i := range user.AccessPolicies {
+			if user.AccessPolicies[i].DeletedAt != nil || !user.DeletedAt.IsZero() {
+				sides[EntityAccessPolicy].deleted[user.AccessPolicies[i].ID] = true
+			} else {
+				sides[EntityAccessPolicy].active[user.AccessPolicies[i].ID] = core.Fingerprint{}
+			}
+		}
+	}
+	if err := users.Err(); err != nil {
+		return fmt.Errorf("failed to get users of subtree %v: %w", tenantID, err)
+	}
+	return nil
+}
+
+// diffEntities walks the entities of the kind in external system and returns the ones which differ from ACC,
+// ordered by ID
+func (loop *ReconciliationLoop) diffEntities(kind string, side *diffSide) ([]DiffEntry, error) {
+	var entries []DiffEntry
+	found := make(map[string]bool)
+	external := side.externalScan()
+	for external.Next() {
+		id := external.ID()
+		if side.deleted[id] {
+			entries = append(entries, DiffEntry{Kind: kind, ID: id, Status: DiffDeleted})
+		}
+		accFingerprint, ok := side.active[id]
+		if !ok {
+			continue
+		}
+		found[id] = true
+		externalFingerprint := external.Fingerprint()
+		switch {
+		case externalFingerprint == nil:
+		case externalFingerprint.Version != 0 && externalFingerprint.Version != accFingerprint.Version:
+			entries = append(entries, DiffEntry{Kind: kind, ID: id, Status: DiffOutdated})
+		case externalFingerprint.Hash != accFingerprint.Hash:
+			entries = append(entries, DiffEntry{Kind: kind, ID: id, Status: DiffDrifted,
+				Fields: accFingerprint.DiffFields(externalFingerprint)})
+		}
+	}
+	if err := external.Err(); err != nil {
+		return nil, err
+	}
+
+	for id := range side.active {
+		if !found[id] {
+			entries = append(entries, DiffEntry{Kind: kind, ID: id, Status: DiffMissing})
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].ID < entries[j].ID
+	})
+	for i := range entries {
+		if reportedID, ok := side.reportedIDs[entries[i].ID]; ok {
+			entries[i].ID = reportedID
+		}
+	}
+	return entries, nil
+}
@@ -0,0 +1,254 @@
+// Copyright (c) 2021 Acronis International GmbH
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package updater
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"golang.org/x/oauth2"
+
+	"github.com/acronis/acronis-cyber-cloud-go-sample-connector/connector/accclient"
+	"github.com/acronis/acronis-cyber-cloud-go-sample-connector/connector/core"
+)
+
+// Statuses of diagnostic checks
+const (
+	CheckPassed  = "pass"
+	CheckFailed  = "fail"
+	CheckSkipped = "skip" // not run, as a check it depends on failed
+)
+
+const (
+	// diagnosisTimeout limits each request of diagnostic checks
+	diagnosisTimeout = 30 * time.Second
+
+	// maxClockSkew is the difference between local clock and the clock of Acronis cloud above which the check fails
+	maxClockSkew = time.Minute
+
+	// unknownTenantID is looked up in external system if the registration tenant can't be resolved
+	unknownTenantID = "00000000-0000-0000-0000-000000000000"
+)
+
+// Check is the result of a diagnostic check
+type Check struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Detail string `json:"detail,omitempty"` // what was found, or the error if the check failed
+	Hint   string `json:"hint,omitempty"`   // how to fix the failure
+}
+
+// externalProbe calls an endpoint of external system without changing anything
+type externalProbe struct {
+	endpoint string
+	probe    func() error
+}
+
+// diagnosis collects the results of checks run in turn
+type diagnosis struct {
+	clock  Clock
+	checks []Check
+}
+
+// Diagnose checks that connector can obtain an access token from Acronis cloud, resolve its registration tenant and
+// read the tenants, users and offering items of its subtree, that local clock agrees with Acronis cloud, and that
+// every endpoint of external system reading entities responds. Nothing is changed in either system, so the endpoints
+// creating, updating and deleting entities aren't called. Requests aren't retried, so that failures are reported at once.
+// The clock is compared with Acronis cloud, e.g. RealClock().
+func Diagnose(ctx context.Context, config *Config, externalClient core.ExternalSystemClient, clock Clock) []Check {
+	d := &diagnosis{clock: clock}
+	tenantID := d.checkAcronisCloud(ctx, config)
+	d.checkExternalSystem(externalClient, tenantID)
+	return d.checks
+}
+
+func (d *diagnosis) pass(name, detail string) {
+	d.checks = append(d.checks, Check{Name: name, Status: CheckPassed, Detail: detail})
+}
+
+func (d *diagnosis) fail(name string, err error, hint string) {
+	d.checks = append(d.checks, Check{Name: name, Status: CheckFailed, Detail: err.Error(), Hint: hint})
+}
+
+func (d *diagnosis) skip(reason string, names ...string) {
+	for _, name := range names {
+		d.checks = append(d.checks, Check{Name: name, Status: CheckSkipped, Detail: reason})
+	}
+}
+
+// checkAcronisCloud runs the checks of Acronis cloud and returns the registration tenant, empty if it can't be resolved
+func (d *diagnosis) checkAcronisCloud(ctx context.Context, config *Config) string {
+	const (
+		checkToken        = "OAuth token"
+		checkRegistration = "Registration tenant"
+		checkClock        = "Clock skew"
+	)
+	subtreeChecks := []string{"Read tenants of subtree", "Read users of subtree", "Read offering items of subtree"}
+
+	baseURL := config.APIServerSettings.BaseURL
+	oauth2Config := getOAuth2Config(config.AuthSettings.ClientID, config.AuthSettings.ClientSecret, baseURL+"/api/2")
+	tokenCtx := context.WithValue(ctx, oauth2.HTTPClient, &http.Client{Timeout: diagnosisTimeout})
+	tokens := oauth2.ReuseTokenSource(nil, oauth2Config.TokenSource(tokenCtx))
+	if _, err := tokens.Token(); err != nil {
+		d.fail(checkToken, err, tokenHint(err))
+		d.skip("no access token", append([]string{checkRegistration, checkClock}, subtreeChecks...)...)
+		return ""
+	}
+	d.pass(checkToken, "obtained from "+oauth2Config.TokenURL)
+
+	// the first response of api server tells its clock
+	var serverTime, localTime time.Time
+	dateMiddleware := func(next accclient.RoundTripFunc) accclient.RoundTripFunc {
+		return func(req *http.Request) (*http.Response, error) {
+			resp, err := next(req)
+			if resp != nil && serverTime.IsZero() {
+				if date, err := http.ParseTime(resp.Header.Get("Date")); err == nil {
+					serverTime, localTime = date, d.clock.Now()
+				}
+			}
+			return resp, err
+		}
+	}
+	httpClient := oauth2.NewClient(tokenCtx, tokens)
+	httpClient.Timeout = diagnosisTimeout
+	accClient := accclient.NewClient(httpClient, baseURL,
+		accclient.WithMiddleware(accclient.UserAgentMiddleware(userAgent), dateMiddleware))
+
+	tenantID, err := accClient.GetRegistrationTenantID(ctx, baseURL, config.AuthSettings.ClientID)
+	if err != nil {
+		d.fail(checkRegistration, err, "check clientID of authSettings, the API client must be registered "+
+			"in the tenant managed by connector")
+		d.skip("no registration tenant", subtreeChecks...)
+	} else {
+		d.pass(checkRegistration, "tenant "+tenantID)
+		d.checkSubtree(ctx, accClient, tenantID, subtreeChecks)
+	}
+
+	if serverTime.IsZero() {
+		d.skip("no Date header in responses of Acronis cloud", checkClock)
+		return tenantID
+	}
+	skew := localTime.Sub(serverTime)
+	if skew < 0 {
+		skew = -skew
+	}
+	// Date header has a resolution of a second
+	if skew > maxClockSkew+time.Second {
+		d.fail(checkClock, fmt.Errorf("local clock differs from Acronis cloud by %v", skew.Round(time.Second)),
+			"synchronize the clock of the host, e.g. with NTP, as schedules, deletion grace periods and reports rely on it")
+	} else {
+		d.pass(checkClock, fmt.Sprintf("local clock differs from Acronis cloud by %v", skew.Round(time.Second)))
+	}
+	return tenantID
+}
+
+// checkSubtree reads a page of tenants, users and offering items of the subtree of the tenant, named by checks
+func (d *diagnosis) checkSubtree(ctx context.Context, accClient *accclient.Client, tenantID string, checks []string) {
+	limit := uint(1)
+	reads := []func() error{
+		func() error {
+			_, err := accClient.GetTenants(ctx, &accclient.TenantGetRequest{SubTreeRootID: tenantID, Limit: &limit})
+			return err
+		},
+		func() error {
+			_, err := accClient.GetUsers(ctx, &accclient.UserGetRequest{SubTreeRootTenantID: tenantID, Limit: &limit})
+			return err
+		},
+		func() error {
+			_, err := accClient.GetOfferingItems(ctx, &accclient.OfferingItemsGetRequest{SubTreeRootTenantID: tenantID, Limit: &limit})
+			return err
+		},
+	}
+	for i, read := range reads {
+		if err := read(); err != nil {
+			d.fail(checks[i], err, fmt.Sprintf("the API client must be created by an administrator of tenant %v "+
+				"with access to its whole subtree", tenantID))
+		} else {
+			d.pass(checks[i], "")
+		}
+	}
+}
+
+// tokenHint tells whether credentials are rejected, or the identity provider can't be reached
+func tokenHint(err error) string {
+	var retrieveErr *oauth2.RetrieveError
+	if errors.As(err, &retrieveErr) && retrieveErr.Response != nil {
+		switch retrieveErr.Response.StatusCode {
+		case http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden:
+			return "check clientID and clientSecret of authSettings, the API client may have been deleted or disabled"
+		}
+	}
+	return "check baseURL of apiServerSettings, it must be the URL of the Acronis datacenter reachable from connector"
+}
+
+// checkExternalSystem calls every endpoint of external system reading entities, including optional ones
+func (d *diagnosis) checkExternalSystem(client core.ExternalSystemClient, tenantID string) {
+	if tenantID == "" {
+		tenantID = unknownTenantID
+	}
+	probes := []externalProbe{
+		{"GetActiveTenantIDs", func() error { _, err := client.GetActiveTenantIDs(0, 1); return err }},
+		{"CheckTenantExist", func() error { _, err := client.CheckTenantExist(tenantID); return err }},
+		{"GetActiveOfferingItemIDs", func() error { _, err := client.GetActiveOfferingItemIDs(0, 1); return err }},
+		{"GetActiveUserIDs", func() error { _, err := client.GetActiveUserIDs(0, 1); return err }},
+		{"GetActiveAccessPolicyIDs", func() error { _, err := client.GetActiveAccessPolicyIDs(0, 1); return err }},
+		{"GetUsages", func() error { _, err := client.GetUsages(0, 1); return err }},
+	}
+	if cursorClient, ok := client.(core.UsageCursorClient); ok {
+		probes = append(probes, externalProbe{"GetUsagesAfter", func() error {
+			_, _, err := cursorClient.GetUsagesAfter("", 1)
+			return err
+		}})
+	}
+	if provisioningClient, ok := client.(core.ProvisioningClient); ok {
+		probes = append(probes, externalProbe{"GetPendingProvisioningRequests", func() error {
+			_, err := provisioningClient.GetPendingProvisioningRequests(1)
+			return err
+		}})
+	}
+	if offeringItemsClient, ok := client.(core.DesiredOfferingItemsClient); ok {
+		probes = append(probes, externalProbe{"GetDesiredOfferingItems", func() error {
+			_, err := offeringItemsClient.GetDesiredOfferingItems(0, 1)
+			return err
+		}})
+	}
+	if fingerprintClient, ok := client.(core.FingerprintClient); ok {
+		probes = append(probes,
+			externalProbe{"GetTenantFingerprints", func() error { _, err := fingerprintClient.GetTenantFingerprints(0, 1); return err }},
+			externalProbe{"GetUserFingerprints", func() error { _, err := fingerprintClient.GetUserFingerprints(0, 1); return err }})
+	}
+	if parentsClient, ok := client.(core.ParentsClient); ok {
+		probes = append(probes,
+			externalProbe{"GetUserParents", func() error { _, err := parentsClient.GetUserParents(0, 1); return err }},
+			externalProbe{"GetAccessPolicyParents", func() error { _, err := parentsClient.GetAccessPolicyParents(0, 1); return err }})
+	}
+
+	for _, probe := range probes {
+		name := "External-system " + probe.endpoint
+		if err := probe.probe(); err != nil {
+			d.fail(name, err, fmt.Sprintf("check that external-system is reachable from connector and serves %v", probe.endpoint))
+		} else {
+			d.pass(name, "")
+		}
+	}
+}
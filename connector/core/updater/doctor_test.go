@@ -0,0 +1,87 @@
+// Copyright (c) 2021 Acronis International GmbH
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package updater
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/acronis/acronis-cyber-cloud-go-sample-connector/connector/accclient"
+	"github.com/acronis/acronis-cyber-cloud-go-sample-connector/connector/accclient/acctest"
+)
+
+// usagesUnavailable is fakeExternalSystem whose usages endpoint fails
+type usagesUnavailable struct {
+	*fakeExternalSystem
+}
+
+func (f usagesUnavailable) GetUsages(offset, limit int) ([]accclient.Usage, error) {
+	return nil, errors.New("connection refused")
+}
+
+func TestDiagnose(t *testing.T) {
+	server := acctest.NewServer()
+	defer server.Close()
+
+	config := NewDefaultConfig()
+	config.AuthSettings.ClientID = server.ClientID
+	config.AuthSettings.ClientSecret = server.ClientSecret
+	config.APIServerSettings.BaseURL = server.URL
+
+	checks := Diagnose(context.Background(), config, fingerprintExternalSystem{newFakeExternalSystem()}, RealClock())
+	for _, check := range checks {
+		if check.Status != CheckPassed {
+			t.Errorf("expected check to pass, got %+v", check)
+		}
+	}
+	if len(checks) != 16 {
+		t.Errorf("expected Acronis cloud checks and probes of optional endpoints, got %+v", checks)
+	}
+
+	skewed := NewFakeClock(time.Now().Add(time.Hour))
+	for _, check := range Diagnose(context.Background(), config, fingerprintExternalSystem{newFakeExternalSystem()}, skewed) {
+		if check.Name == "Clock skew" && (check.Status != CheckFailed || !strings.Contains(check.Detail, "1h0m")) {
+			t.Errorf("expected clock skew check to fail, got %+v", check)
+		}
+	}
+
+	config.AuthSettings.ClientSecret = "wrong"
+	statuses := make(map[string]Check)
+	for _, check := range Diagnose(context.Background(), config, usagesUnavailable{newFakeExternalSystem()}, RealClock()) {
+		statuses[check.Name] = check
+	}
+	if check := statuses["OAuth token"]; check.Status != CheckFailed || !strings.Contains(check.Hint, "clientSecret") {
+		t.Errorf("expected token check to fail with credentials hint, got %+v", check)
+	}
+	for _, name := range []string{"Registration tenant", "Read users of subtree", "Clock skew"} {
+		if statuses[name].Status != CheckSkipped {
+			t.Errorf("expected %v to be skipped, got %+v", name, statuses[name])
+		}
+	}
+	if check := statuses["External-system GetUsages"]; check.Status != CheckFailed || check.Hint == "" {
+		t.Errorf("expected usages probe to fail, got %+v", check)
+	}
+	if check := statuses["External-system GetActiveTenantIDs"]; check.Status != CheckPassed {
+		t.Errorf("expected external-system to be probed without Acronis cloud, got %+v", check)
+	}
+}
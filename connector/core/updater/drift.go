@@ -0,0 +1,87 @@
+// Copyright (c) 2021 Acronis International GmbH
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package updater
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/acronis/acronis-cyber-cloud-go-sample-connector/connector/core"
+	"github.com/acronis/acronis-cyber-cloud-go-sample-connector/connector/logs"
+)
+
+// DriftPolicy defines how reconciliation handles tenants and users whose content in external system
+// differs from Acronis cloud while their version is the same, e.g. edited directly in external system.
+// Drift is detected only if external system implements core.FingerprintClient.
+type DriftPolicy string
+
+// Supported drift policies
+const (
+	DriftPolicyRepush DriftPolicy = "repush" // report the drift and push the state of Acronis cloud again
+	DriftPolicyReport DriftPolicy = "report" // only report the drift, leaving external system unchanged
+	DriftPolicyIgnore DriftPolicy = "ignore" // don't request fingerprints from external system
+)
+
+// ParseDriftPolicy returns the drift policy of the given name
+func ParseDriftPolicy(name string) (DriftPolicy, error) {
+	switch policy := DriftPolicy(name); policy {
+	case DriftPolicyRepush, DriftPolicyReport, DriftPolicyIgnore:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("unknown drift policy %q, should be one of %v, %v or %v",
+			name, DriftPolicyRepush, DriftPolicyReport, DriftPolicyIgnore)
+	}
+}
+
+// driftResult is the outcome of comparing an entity in Acronis cloud with its fingerprint in external system
+type driftResult int
+
+const (
+	driftUnknown  driftResult = iota // external system doesn't provide the fingerprint
+	driftNone                        // content in external system is the same as in Acronis cloud
+	driftOutdated                    // external system has an older version of the entity, it's to be updated as usual
+	driftDetected                    // content in external system differs from the same version in Acronis cloud
+)
+
+// checkDrift compares the fingerprint of the entity in Acronis cloud with the one in external system
+// and returns the fields which drifted
+func (loop *ReconciliationLoop) checkDrift(
+	logger logs.Logger, kind string, accFingerprint, externalFingerprint *core.Fingerprint) (driftResult, []string) {
+	if externalFingerprint == nil {
+		return driftUnknown, nil
+	}
+	if externalFingerprint.Version != 0 && externalFingerprint.Version != accFingerprint.Version {
+		logger.Debugf("External system has version %v of %v %v, current version is %v",
+			externalFingerprint.Version, kind, accFingerprint.ID, accFingerprint.Version)
+		return driftOutdated, nil
+	}
+	if externalFingerprint.Hash == accFingerprint.Hash {
+		return driftNone, nil
+	}
+
+	action := "pushing the state of Acronis cloud"
+	if loop.driftPolicy == DriftPolicyReport {
+		action = "reported only, unless changed in Acronis cloud"
+	}
+	fields := accFingerprint.DiffFields(externalFingerprint)
+	logger.Warnf("Drift of %v %v in external system, fields differ from Acronis cloud: %v (%v)",
+		kind, accFingerprint.ID, strings.Join(fields, ", "), action)
+	return driftDetected, fields
+}
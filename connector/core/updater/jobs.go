@@ -0,0 +1,164 @@
+// Copyright (c) 2021 Acronis International GmbH
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package updater
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/acronis/acronis-cyber-cloud-go-sample-connector/connector/logs"
+)
+
+// Kinds of jobs triggered outside of the loops
+const (
+	JobResyncTenant = "resync_tenant" // push a tenant subtree, see ReconciliationLoop.ResyncTenant
+	JobResyncUser   = "resync_user"   // push a user, see SyncLoopImpl.ResyncUser
+	JobPushUsages   = "push_usages"   // push all usages, see UsageLoop.PushUsages
+)
+
+// Statuses of jobs
+const (
+	JobRunning   = "running"
+	JobSucceeded = "succeeded"
+	JobFailed    = "failed"
+)
+
+// jobRetention is the number of finished jobs kept for status polling
+const jobRetention = 100
+
+// Job is a push triggered outside of the loops, e.g. through the admin API, which runs in the background
+type Job struct {
+	ID         string     `json:"id"`
+	Kind       string     `json:"kind"`             // JobResyncTenant, JobResyncUser or JobPushUsages
+	Target     string     `json:"target,omitempty"` // ID of the tenant or user
+	Status     string     `json:"status"`           // JobRunning, JobSucceeded or JobFailed
+	StartedAt  time.Time  `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	Result     PushResult `json:"result"`
+	Error      string     `json:"error,omitempty"`
+}
+
+// jobRunner runs jobs in the background and keeps them for status polling
+type jobRunner struct {
+	clock Clock
+
+	mu   sync.Mutex
+	jobs []*Job // oldest first
+	runs uint64 // number of started jobs, making IDs of jobs unique
+}
+
+func newJobRunner(clock Clock) *jobRunner {
+	return &jobRunner{clock: clock}
+}
+
+// start runs the job of the kind for the target in the background and returns its copy.
+// If the same job is still running, it is returned instead of starting another one.
+func (r *jobRunner) start(kind, target string, run func(ctx context.Context) (PushResult, error)) Job {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, job := range r.jobs {
+		if job.Kind == kind && job.Target == target && job.Status == JobRunning {
+			return *job
+		}
+	}
+
+	startedAt := r.clock.Now()
+	r.runs++
+	job := &Job{
+		ID:        fmt.Sprintf("%v-%v-%v", startedAt.UTC().Format("20060102T150405.000Z"), kind, r.runs),
+		Kind:      kind,
+		Target:    target,
+		Status:    JobRunning,
+		StartedAt: startedAt,
+	}
+	r.jobs = append(r.jobs, job)
+	r.prune()
+
+	ctx := context.WithValue(context.Background(), logs.ContextID, job.ID)
+	go func() {
+		logger := logs.GetDefaultLogger(ctx)
+		logger.Infof("Job %v started", job.ID)
+		result, err := run(ctx)
+		r.finish(job, result, err)
+		if err != nil {
+			logger.Warnf("Job %v failed: %v", job.ID, err)
+		} else {
+			logger.Infof("Job %v succeeded", job.ID)
+		}
+	}()
+	return *job
+}
+
+func (r *jobRunner) finish(job *Job, result PushResult, err error) {
+	finishedAt := r.clock.Now()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	job.Result = result
+	job.FinishedAt = &finishedAt
+	job.Status = JobSucceeded
+	if err != nil {
+		job.Status = JobFailed
+		job.Error = err.Error()
+	}
+}
+
+// prune removes the oldest finished jobs beyond retention, running jobs are kept, the caller must hold the lock
+func (r *jobRunner) prune() {
+	finished := 0
+	for _, job := range r.jobs {
+		if job.Status != JobRunning {
+			finished++
+		}
+	}
+	kept := r.jobs[:0]
+	for _, job := range r.jobs {
+		if job.Status != JobRunning && finished > jobRetention {
+			finished--
+			continue
+		}
+		kept = append(kept, job)
+	}
+	r.jobs = kept
+}
+
+// list returns copies of all jobs, newest first
+func (r *jobRunner) list() []Job {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	jobs := make([]Job, len(r.jobs))
+	for i := range r.jobs {
+		jobs[len(r.jobs)-1-i] = *r.jobs[i]
+	}
+	return jobs
+}
+
+// get returns a copy of the job with the ID, false if there is no such job
+func (r *jobRunner) get(id string) (Job, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, job := range r.jobs {
+		if job.ID == id {
+			return *job, true
+		}
+	}
+	return Job{}, false
+}
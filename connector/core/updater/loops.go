@@ -0,0 +1,133 @@
+// Copyright (c) 2021 Acronis International GmbH
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package updater
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Names of the loops which can be paused
+const (
+	LoopSync           = "sync_loop"           // tenants and users update loops
+	LoopReconciliation = "reconciliation_loop" // tenants and users reconciliation
+	LoopUsage          = "usage_loop"
+	LoopProvisioning   = "provisioning_loop"
+	LoopOfferingItems  = "offering_items_loop"
+)
+
+// LoopStatus tells whether a loop is paused
+type LoopStatus struct {
+	Name   string `json:"name"`
+	Paused bool   `json:"paused"`
+}
+
+// loopSwitch pauses and resumes loops. A paused loop completes its current cycle and waits before the next one,
+// as loops wait for their next cycle with sleepBetweenCycles on the clock returned by clock.
+type loopSwitch struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	names  []string
+	paused map[string]bool
+}
+
+func newLoopSwitch(names ...string) *loopSwitch {
+	s := &loopSwitch{names: names, paused: make(map[string]bool)}
+	s.cond = sync.NewCond(&s.mu)
+	return s
+}
+
+// clock returns the clock of the loop, which holds the loop between cycles while it's paused
+func (s *loopSwitch) clock(name string, clock Clock) Clock {
+	return &pausableClock{Clock: clock, loops: s, name: name}
+}
+
+// pause pauses the loop, it's not an error to pause a paused loop
+func (s *loopSwitch) pause(name string) error {
+	return s.set(name, true)
+}
+
+// resume resumes the loop, it's not an error to resume a running loop
+func (s *loopSwitch) resume(name string) error {
+	return s.set(name, false)
+}
+
+func (s *loopSwitch) set(name string, paused bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.known(name) {
+		return fmt.Errorf("unknown loop %v", name)
+	}
+	s.paused[name] = paused
+	s.cond.Broadcast()
+	return nil
+}
+
+// statuses returns the statuses of all loops
+func (s *loopSwitch) statuses() []LoopStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	statuses := make([]LoopStatus, len(s.names))
+	for i, name := range s.names {
+		statuses[i] = LoopStatus{Name: name, Paused: s.paused[name]}
+	}
+	return statuses
+}
+
+// wait blocks while the loop is paused
+func (s *loopSwitch) wait(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for s.paused[name] {
+		s.cond.Wait()
+	}
+}
+
+func (s *loopSwitch) known(name string) bool {
+	for _, known := range s.names {
+		if known == name {
+			return true
+		}
+	}
+	return false
+}
+
+// pausableClock is the clock of a loop which can be paused
+type pausableClock struct {
+	Clock
+	loops *loopSwitch
+	name  string
+}
+
+// waitResumed blocks while the loop is paused
+func (c *pausableClock) waitResumed() {
+	c.loops.wait(c.name)
+}
+
+// sleepBetweenCycles sleeps for d before the next cycle of a loop, then holds the loop while it's paused,
+// if the clock is pausable. Waits within a cycle, such as backoffs of retries, use Sleep of the clock instead,
+// so that the loop is paused only after its current cycle.
+func sleepBetweenCycles(clock Clock, d time.Duration) {
+	clock.Sleep(d)
+	if pausable, ok := clock.(*pausableClock); ok {
+		pausable.waitResumed()
+	}
+}
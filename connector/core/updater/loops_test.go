@@ -0,0 +1,77 @@
+// Copyright (c) 2021 Acronis International GmbH
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package updater
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLoopSwitch(t *testing.T) {
+	clock := NewFakeClock(time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC))
+	loops := newLoopSwitch(LoopSync, LoopUsage)
+	loopClock := loops.clock(LoopUsage, clock)
+
+	if err := loops.pause("unknown"); err == nil {
+		t.Errorf("expected error for unknown loop")
+	}
+	if err := loops.pause(LoopUsage); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if statuses := loops.statuses(); len(statuses) != 2 || statuses[0].Paused || !statuses[1].Paused {
+		t.Errorf("expected paused usage loop only, got %+v", statuses)
+	}
+
+	// waits within a cycle, e.g. backoffs of retries, aren't held
+	slept := make(chan struct{})
+	go func() {
+		loopClock.Sleep(time.Second)
+		close(slept)
+	}()
+	clock.BlockUntil(1)
+	clock.Advance(time.Second)
+	select {
+	case <-slept:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("expected paused loop to complete its cycle")
+	}
+
+	woken := make(chan struct{})
+	go func() {
+		sleepBetweenCycles(loopClock, time.Minute)
+		close(woken)
+	}()
+	clock.BlockUntil(1)
+	clock.Advance(time.Minute)
+	select {
+	case <-woken:
+		t.Fatalf("expected paused loop to keep waiting")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	if err := loops.resume(LoopUsage); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	select {
+	case <-woken:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("expected resumed loop to continue")
+	}
+}
@@ -0,0 +1,266 @@
+// Copyright (c) 2021 Acronis International GmbH
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package updater
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/acronis/acronis-cyber-cloud-go-sample-connector/connector/accclient"
+	"github.com/acronis/acronis-cyber-cloud-go-sample-connector/connector/core"
+	"github.com/acronis/acronis-cyber-cloud-go-sample-connector/connector/logs"
+)
+
+// OfferingItemsLoop is a sample implementation that pulls the desired offering items of tenants from
+// external-system (ISV) and applies status, quota and infra changes to Acronis Cyber Cloud Platform
+type OfferingItemsLoop struct {
+	accClient *accclient.Client
+	extClient core.DesiredOfferingItemsClient
+
+	// optional to be set during initialization
+	applyInterval uint // in seconds
+	dryRun        bool // only log the changes without applying them
+	clock         Clock
+}
+
+// offeringItemChange describes a single change of offering item of a tenant
+type offeringItemChange struct {
+	name  string
+	field string
+	from  string
+	to    string
+}
+
+func (c offeringItemChange) String() string {
+	return fmt.Sprintf("offering item %v %v: %v -> %v", c.name, c.field, c.from, c.to)
+}
+
+// NewOfferingItemsLoop initializes OfferingItemsLoop as an implementation of core.OfferingItemsLoop
+func NewOfferingItemsLoop(
+	accClient *accclient.Client,
+	extClient core.DesiredOfferingItemsClient,
+	options ...func(*OfferingItemsLoop)) core.OfferingItemsLoop {
+	loop := &OfferingItemsLoop{
+		accClient:     accClient,
+		extClient:     extClient,
+		applyInterval: 3600, // default
+		clock:         RealClock(),
+	}
+
+	for _, option := range options {
+		option(loop)
+	}
+
+	return loop
+}
+
+// WithOfferingItemsInterval is an optional init function to set the interval of applying offering items
+func WithOfferingItemsInterval(interval uint) func(*OfferingItemsLoop) {
+	return func(loop *OfferingItemsLoop) {
+		loop.applyInterval = interval
+	}
+}
+
+// WithOfferingItemsDryRun is an optional init function to only log offering items changes without applying them
+func WithOfferingItemsDryRun(dryRun bool) func(*OfferingItemsLoop) {
+	return func(loop *OfferingItemsLoop) {
+		loop.dryRun = dryRun
+	}
+}
+
+// WithOfferingItemsClock is an optional init function to set the clock used for waiting between runs
+func WithOfferingItemsClock(clock Clock) func(*OfferingItemsLoop) {
+	return func(loop *OfferingItemsLoop) {
+		loop.clock = clock
+	}
+}
+
+// ApplyOfferingItems applies the offering items decided by external-system to ACC periodically
+// 1. Get desired offering items of tenants from external system, page by page
+// 2. For each tenant, get current offering items from ACC and diff them with the desired ones
+// 3. Update offering items of the tenant in ACC with the differences, or only log them in dry-run mode
+func (loop *OfferingItemsLoop) ApplyOfferingItems() {
+	ctx := context.Background()
+	ctx = context.WithValue(ctx, logs.ContextID, "offering_items_loop")
+	logger := logs.GetDefaultLogger(ctx)
+
+	for ; ; sleepBetweenCycles(loop.clock, time.Second*time.Duration(loop.applyInterval)) {
+		for offset := 0; ; offset += externalSystemPageSize {
+			// 1. Get desired offering items from external-system
+			tenants, err := loop.extClient.GetDesiredOfferingItems(offset, externalSystemPageSize)
+			if err != nil {
+				logger.Warnf("Failed to get desired offering items from external system: %v", err)
+				break
+			}
+
+			// 2-3. Apply the differences per tenant
+			for i := range tenants {
+				if err := loop.applyTenantOfferingItems(ctx, &tenants[i]); err != nil {
+					logger.Warnf("Failed to apply offering items of tenant %v: %v", tenants[i].TenantID, err)
+				}
+			}
+
+			if len(tenants) < externalSystemPageSize {
+				// last page
+				break
+			}
+		}
+	}
+}
+
+// =====================
+// helper functions
+// =====================
+
+// applyTenantOfferingItems updates offering items of the tenant in ACC to the desired state.
+// On version conflict, the current offering items are fetched and diffed again.
+func (loop *OfferingItemsLoop) applyTenantOfferingItems(ctx context.Context, tenant *core.TenantOfferingItems) error {
+	logger := logs.GetDefaultLogger(ctx)
+
+	var changes []offeringItemChange
+	mutate := func(current []accclient.OfferingItem) *accclient.OfferingItemsTenantPutRequest {
+		var putReq *accclient.OfferingItemsTenantPutRequest
+		var unknown []string
+		changes, putReq, unknown = diffOfferingItems(current, tenant.OfferingItems)
+		for _, name := range unknown {
+			logger.Warnf("Offering item %v is not available for tenant %v, skipped", name, tenant.TenantID)
+		}
+		return putReq
+	}
+
+	if loop.dryRun {
+		current, err := loop.accClient.GetTenantOfferingItems(ctx, tenant.TenantID)
+		if err != nil {
+			return err
+		}
+		mutate(current.Items)
+		for _, change := range changes {
+			logger.Infof("[dry-run] Tenant %v %v", tenant.TenantID, change)
+		}
+		return nil
+	}
+
+	if err := loop.accClient.ModifyTenantOfferingItems(ctx, tenant.TenantID, mutate); err != nil {
+		return err
+	}
+	for _, change := range changes {
+		logger.Infof("Tenant %v %v", tenant.TenantID, change)
+	}
+
+	return nil
+}
+
+// diffOfferingItems compares the current offering items of a tenant with the desired ones.
+// It returns the changes, the request to apply them, nil if there is nothing to change,
+// and the names of desired offering items which are not available for the tenant.
+// Status of locked offering items is never changed.
+func diffOfferingItems(current []accclient.OfferingItem, desired []accclient.OfferingItemTenantPut) (
+	changes []offeringItemChange, putReq *accclient.OfferingItemsTenantPutRequest, unknown []string) {
+	for i := range desired {
+		want := &desired[i]
+		cur := findOfferingItem(current, want.ApplicationID, want.Name)
+		if cur == nil {
+			unknown = append(unknown, want.Name)
+			continue
+		}
+
+		item := &accclient.OfferingItemTenantPut{
+			ApplicationID: cur.ApplicationID,
+			Name:          cur.Name,
+		}
+		var itemChanges []offeringItemChange
+
+		if want.Status != nil && int(*want.Status) != cur.Status && !cur.Locked {
+			status := *want.Status
+			item.Status = &status
+			itemChanges = append(itemChanges, offeringItemChange{
+				name: cur.Name, field: "status", from: fmt.Sprint(cur.Status), to: fmt.Sprint(status),
+			})
+		}
+
+		if want.InfraID != nil && *want.InfraID != cur.InfraID {
+			infraID := *want.InfraID
+			item.InfraID = &infraID
+			itemChanges = append(itemChanges, offeringItemChange{
+				name: cur.Name, field: "infra", from: cur.InfraID, to: infraID,
+			})
+		}
+
+		if want.Quota != nil {
+			valueChanged := !equalQuotaValue(want.Quota.Value, cur.Quota.Value)
+			overageChanged := !equalQuotaValue(want.Quota.Overage, cur.Quota.Overage)
+			if valueChanged {
+				itemChanges = append(itemChanges, offeringItemChange{
+					name: cur.Name, field: "quota", from: formatQuotaValue(cur.Quota.Value), to: formatQuotaValue(want.Quota.Value),
+				})
+			}
+			if overageChanged {
+				itemChanges = append(itemChanges, offeringItemChange{
+					name: cur.Name, field: "overage", from: formatQuotaValue(cur.Quota.Overage), to: formatQuotaValue(want.Quota.Overage),
+				})
+			}
+			if valueChanged || overageChanged {
+				// quota is replaced as a whole, with the version of the current quota
+				item.Quota = &accclient.Quota{
+					Value:   want.Quota.Value,
+					Overage: want.Quota.Overage,
+					Version: cur.Quota.Version,
+				}
+			}
+		}
+
+		if len(itemChanges) == 0 {
+			continue
+		}
+		changes = append(changes, itemChanges...)
+		if putReq == nil {
+			putReq = &accclient.OfferingItemsTenantPutRequest{}
+		}
+		putReq.OfferingItems = append(putReq.OfferingItems, item)
+	}
+
+	return changes, putReq, unknown
+}
+
+// findOfferingItem finds offering item by name, and by application ID if it's not empty
+func findOfferingItem(items []accclient.OfferingItem, applicationID, name string) *accclient.OfferingItem {
+	for i := range items {
+		if items[i].Name == name && (applicationID == "" || items[i].ApplicationID == applicationID) {
+			return &items[i]
+		}
+	}
+	return nil
+}
+
+// equalQuotaValue compares quota values, nil means unlimited
+func equalQuotaValue(a, b *float64) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return *a == *b
+}
+
+func formatQuotaValue(v *float64) string {
+	if v == nil {
+		return "unlimited"
+	}
+	return fmt.Sprint(*v)
+}
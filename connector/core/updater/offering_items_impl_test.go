@@ -0,0 +1,92 @@
+// Copyright (c) 2021 Acronis International GmbH
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package updater
+
+import (
+	"testing"
+
+	"github.com/acronis/acronis-cyber-cloud-go-sample-connector/connector/accclient"
+)
+
+func TestDiffOfferingItems(t *testing.T) {
+	on, off := int8(1), int8(0)
+	ten, twenty := float64(10), float64(20)
+	infra := "infra-2"
+
+	current := []accclient.OfferingItem{
+		{ApplicationID: "app", Name: "storage", Status: 1, InfraID: "infra-1", Quota: accclient.Quota{Value: &ten, Version: 3}},
+		{ApplicationID: "app", Name: "workstations", Status: 0},
+		{ApplicationID: "app", Name: "servers", Status: 1, Locked: true},
+		{ApplicationID: "app", Name: "vms", Status: 1},
+	}
+	desired := []accclient.OfferingItemTenantPut{
+		{Name: "storage", InfraID: &infra, Quota: &accclient.Quota{Value: &twenty}},
+		{ApplicationID: "app", Name: "workstations", Status: &on},
+		{Name: "servers", Status: &off},
+		{Name: "vms", Status: &on, Quota: &accclient.Quota{}},
+		{Name: "mailboxes", Status: &on},
+		{ApplicationID: "other-app", Name: "vms", Status: &off},
+	}
+
+	changes, putReq, unknown := diffOfferingItems(current, desired)
+
+	if len(unknown) != 2 || unknown[0] != "mailboxes" || unknown[1] != "vms" {
+		t.Errorf("expected unknown offering items [mailboxes vms], got %v", unknown)
+	}
+	if len(changes) != 3 {
+		t.Fatalf("expected 3 changes, got %v", changes)
+	}
+	if putReq == nil || len(putReq.OfferingItems) != 2 {
+		t.Fatalf("expected update of 2 offering items, got %+v", putReq)
+	}
+
+	storage := putReq.OfferingItems[0]
+	if storage.Name != "storage" || storage.ApplicationID != "app" || storage.Status != nil {
+		t.Errorf("unexpected storage update %+v", storage)
+	}
+	if storage.InfraID == nil || *storage.InfraID != infra {
+		t.Errorf("expected infra %v, got %v", infra, storage.InfraID)
+	}
+	if storage.Quota == nil || *storage.Quota.Value != twenty || storage.Quota.Version != 3 {
+		t.Errorf("expected quota %v with version 3, got %+v", twenty, storage.Quota)
+	}
+
+	workstations := putReq.OfferingItems[1]
+	if workstations.Name != "workstations" || workstations.Status == nil || *workstations.Status != on || workstations.Quota != nil {
+		t.Errorf("unexpected workstations update %+v", workstations)
+	}
+}
+
+func TestDiffOfferingItems_NoChanges(t *testing.T) {
+	on := int8(1)
+	ten := float64(10)
+
+	current := []accclient.OfferingItem{
+		{ApplicationID: "app", Name: "storage", Status: 1, Quota: accclient.Quota{Value: &ten, Version: 3}},
+	}
+	desired := []accclient.OfferingItemTenantPut{
+		{Name: "storage", Status: &on, Quota: &accclient.Quota{Value: &ten}},
+	}
+
+	changes, putReq, unknown := diffOfferingItems(current, desired)
+	if len(changes) != 0 || putReq != nil || len(unknown) != 0 {
+		t.Errorf("expected no changes, got %v, %+v, %v", changes, putReq, unknown)
+	}
+}
@@ -0,0 +1,297 @@
+// Copyright (c) 2021 Acronis International GmbH
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package updater
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/acronis/acronis-cyber-cloud-go-sample-connector/connector/accclient"
+	"github.com/acronis/acronis-cyber-cloud-go-sample-connector/connector/core"
+	"github.com/acronis/acronis-cyber-cloud-go-sample-connector/connector/logs"
+)
+
+// orphanReport summarizes the orphans of a kind found and repaired by reconciliation
+type orphanReport struct {
+	kind       string // kind of orphans
+	parentKind string // kind of their parents which don't exist in external system
+	found      int    // orphans found
+	restored   int    // parents pushed from ACC into external system
+	deleted    int    // orphans removed from external system
+	skipped    int    // orphans left as they are, as their parents could not be checked in ACC
+}
+
+func (r *orphanReport) log(logger logs.Logger) {
+	if r.found == 0 {
+		logger.Debugf("No %v without %v found in external system", entityName(r.kind), entityName(r.parentKind))
+		return
+	}
+	logger.Infof("Repaired entities without parent in external system, kind: %v, parent kind: %v, "+
+		"found: %v, parents restored from ACC: %v, removed: %v, skipped: %v",
+		entityName(r.kind), entityName(r.parentKind), r.found, r.restored, r.deleted, r.skipped)
+}
+
+// entityName returns the kind of entities for logs
+func entityName(kind string) string {
+	return strings.Replace(kind, "_", " ", -1)
+}
+
+// repairOrphanedOfferingItems restores tenants of offering items which don't exist in external system,
+// or removes the offering items if their tenants don't exist in ACC
+func (loop *ReconciliationLoop) repairOrphanedOfferingItems(report *reportRecorder) {
+	logger := logs.GetDefaultLogger(loop.ctx)
+	orphans := &orphanReport{kind: EntityOfferingItem, parentKind: EntityTenant}
+	err := loop.repairOrphans(orphans, loop.getExternalSystemOfferingItemParents, loop.extClient.GetActiveTenantIDs,
+		func(tenantID string) (bool, error) {
+			return loop.restoreTenant(report, tenantID)
+		},
+		func(tenantID, name string) bool {
+			return loop.removeOfferingItem(report, childKey(tenantID, name), orphanReason(EntityTenant, tenantID))
+		})
+	if err != nil {
+		logger.Warnf("Failed to repair offering items without tenant: %v", err)
+		report.failed(err)
+	}
+	orphans.log(logger)
+}
+
+// repairOrphanedUsersAndAccessPolicies restores tenants of users and trustee users of access policies
+// which don't exist in external system, or removes the users and access policies if their parents don't exist in ACC
+func (loop *ReconciliationLoop) repairOrphanedUsersAndAccessPolicies(
+	report *reportRecorder, parentsClient core.ParentsClient) {
+	logger := logs.GetDefaultLogger(loop.ctx)
+
+	userOrphans := &orphanReport{kind: EntityUser, parentKind: EntityTenant}
+	err := loop.repairOrphans(userOrphans, parentsClient.GetUserParents, loop.extClient.GetActiveTenantIDs,
+		func(tenantID string) (bool, error) {
+			return loop.restoreTenant(report, tenantID)
+		},
+		func(tenantID, userID string) bool {
+			return loop.removeUser(report, userID, orphanReason(EntityTenant, tenantID))
+		})
+	if err != nil {
+		logger.Warnf("Failed to repair users without tenant: %v", err)
+		report.failed(err)
+	}
+	userOrphans.log(logger)
+
+	policyOrphans := &orphanReport{kind: EntityAccessPolicy, parentKind: EntityUser}
+	err = loop.repairOrphans(policyOrphans, parentsClient.GetAccessPolicyParents, loop.extClient.GetActiveUserIDs,
+		func(userID string) (bool, error) {
+			return loop.restoreUser(report, userID)
+		},
+		func(userID, policyID string) bool {
+			return loop.removeAccessPolicy(report, policyID, orphanReason(EntityUser, userID))
+		})
+	if err != nil {
+		logger.Warnf("Failed to repair access policies without user: %v", err)
+		report.failed(err)
+	}
+	policyOrphans.log(logger)
+}
+
+// orphanReason returns the reason of removing an entity whose parent doesn't exist for reports
+func orphanReason(parentKind, parentID string) string {
+	return fmt.Sprintf("%v %v doesn't exist", entityName(parentKind), parentID)
+}
+
+// repairOrphans collects the children in external system ordered by their parent IDs, and walks them together with
+// the IDs of the parents in external system. For each parent which doesn't exist in external system, restore is called
+// to push it from ACC; if it doesn't exist in ACC either, remove is called for each of its children.
+func (loop *ReconciliationLoop) repairOrphans(report *orphanReport,
+	getChildren func(offset, limit int) ([]core.EntityParent, error),
+	getParentIDs func(offset, limit int) ([]string, error),
+	restore func(parentID string) (bool, error),
+	remove func(parentID, id string) bool) error {
+	logger := logs.GetDefaultLogger(loop.ctx)
+
+	children := newSortedSet(loop.tempDir, loop.memoryLimit/2)
+	defer loop.closeSortedSet(children)
+	if err := loop.collectChildren(children, getChildren); err != nil {
+		return err
+	}
+
+	parents := newExternalIDStream(loop.ctx, loop.clock, getParentIDs)
+	return findOrphans(children, parents, func(parentID string, ids []string) {
+		report.found += len(ids)
+		restored, err := restore(parentID)
+		if err != nil {
+			logger.Warnf("Failed to restore %v %v from ACC: %v", entityName(report.parentKind), parentID, err)
+			report.skipped += len(ids)
+			return
+		}
+		if restored {
+			report.restored++
+			return
+		}
+		for _, id := range ids {
+			if remove(parentID, id) {
+				report.deleted++
+			} else {
+				report.skipped++
+			}
+		}
+	})
+}
+
+// collectChildren adds the keys of the children in external system, made of their parent ID and ID, into the set
+func (loop *ReconciliationLoop) collectChildren(
+	children *sortedSet, getChildren func(offset, limit int) ([]core.EntityParent, error)) error {
+	for offset := 0; ; {
+		var page []core.EntityParent
+		err := retryHelper(loop.ctx, loop.clock, func() error {
+			var getPageErr error
+			page, getPageErr = getChildren(offset, externalSystemPageSize)
+			return getPageErr
+		})
+		if err != nil {
+			return fmt.Errorf("failed to get entities with parents from external system: %w", err)
+		}
+
+		for i := range page {
+			if err := children.Add(childKey(page[i].ParentID, page[i].ID), nil); err != nil {
+				return err
+			}
+		}
+		if len(page) < externalSystemPageSize {
+			return nil
+		}
+		offset += len(page)
+	}
+}
+
+// findOrphans walks the children keyed by their parent ID and ID together with the IDs of the parents in external
+// system, both in ascending order, and calls orphans for each parent ID which doesn't exist with the IDs of its children
+func findOrphans(children *sortedSet, parents *externalIDStream, orphans func(parentID string, ids []string)) error {
+	childIterator, err := children.Iterator()
+	if err != nil {
+		return err
+	}
+
+	hasChild, hasParent := childIterator.Next(), parents.Next()
+	for hasChild {
+		parentID, id := splitChildKey(childIterator.Key())
+		for hasParent && parents.ID() < parentID {
+			hasParent = parents.Next()
+		}
+		if !hasParent && parents.Err() != nil {
+			// parents not returned by external system are not orphans
+			break
+		}
+		if hasParent && parents.ID() == parentID {
+			hasChild = childIterator.Next()
+			continue
+		}
+
+		ids := []string{id}
+		for hasChild = childIterator.Next(); hasChild; hasChild = childIterator.Next() {
+			nextParentID, nextID := splitChildKey(childIterator.Key())
+			if nextParentID != parentID {
+				break
+			}
+			ids = append(ids, nextID)
+		}
+		orphans(parentID, ids)
+	}
+
+	if err := childIterator.Err(); err != nil {
+		return err
+	}
+	if err := parents.Err(); err != nil {
+		return fmt.Errorf("failed to get IDs from external system: %w", err)
+	}
+	return nil
+}
+
+// getExternalSystemOfferingItemParents returns a page of offering items in external system with their tenant IDs
+func (loop *ReconciliationLoop) getExternalSystemOfferingItemParents(offset, limit int) ([]core.EntityParent, error) {
+	externalOIs, err := loop.extClient.GetActiveOfferingItemIDs(offset, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	parents := make([]core.EntityParent, len(externalOIs))
+	for i := range externalOIs {
+		parents[i] = core.EntityParent{ID: externalOIs[i].OfferingItemName, ParentID: externalOIs[i].TenantID}
+	}
+	return parents, nil
+}
+
+// restoreTenant pushes the tenant which doesn't exist in external system from ACC, false if it's not active in ACC
+func (loop *ReconciliationLoop) restoreTenant(report *reportRecorder, tenantID string) (bool, error) {
+	tenants, err := loop.accClient.GetTenants(loop.ctx, &accclient.TenantGetRequest{
+		UUIDs:         []string{tenantID},
+		SubTreeRootID: loop.tenantID,
+	})
+	if err != nil {
+		return false, err
+	}
+
+	for i := range tenants.Items {
+		if tenants.Items[i].ID == tenantID && tenants.Items[i].DeletedAt.IsZero() {
+			logs.GetDefaultLogger(loop.ctx).Infof("Restoring tenant %v missing in external system", tenantID)
+			err := createOrUpdateTenant(loop.ctx, loop.extClient, loop.accClient, loop.filter, report.createdParents,
+				loop.tenantID, &tenants.Items[i])
+			report.pushed(EntityTenant, tenantID, false, reasonParentMissing, err)
+			return true, err
+		}
+	}
+	return false, nil
+}
+
+// restoreUser pushes the user which doesn't exist in external system from ACC, false if it's not active in ACC.
+// The tenant of the user is restored first if needed, the user is not restored if its tenant is not active in ACC,
+// otherwise it would be removed again as a user without tenant.
+func (loop *ReconciliationLoop) restoreUser(report *reportRecorder, userID string) (bool, error) {
+	users, err := loop.accClient.GetUsers(loop.ctx, &accclient.UserGetRequest{
+		UUIDs:               []string{userID},
+		SubTreeRootTenantID: loop.tenantID,
+	})
+	if err != nil {
+		return false, err
+	}
+
+	for i := range users.Items {
+		if users.Items[i].ID == userID && users.Items[i].DeletedAt.IsZero() {
+			if restored, err := loop.restoreParentTenant(report, users.Items[i].TenantID); err != nil || !restored {
+				return false, err
+			}
+			logs.GetDefaultLogger(loop.ctx).Infof("Restoring user %v missing in external system", userID)
+			err := createOrUpdateUser(loop.ctx, loop.extClient, loop.accClient, loop.filter, report.createdParents, loop.tenantID, &users.Items[i])
+			report.pushed(EntityUser, userID, false, reasonParentMissing, err)
+			return true, err
+		}
+	}
+	return false, nil
+}
+
+// restoreParentTenant restores the tenant if it doesn't exist in external system, false if it's not active in ACC
+func (loop *ReconciliationLoop) restoreParentTenant(report *reportRecorder, tenantID string) (bool, error) {
+	var exists bool
+	err := retryHelper(loop.ctx, loop.clock, func() error {
+		var checkErr error
+		exists, checkErr = loop.extClient.CheckTenantExist(tenantID)
+		return checkErr
+	})
+	if err != nil || exists {
+		return exists, err
+	}
+	return loop.restoreTenant(report, tenantID)
+}
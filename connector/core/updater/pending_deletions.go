@@ -0,0 +1,195 @@
+// Copyright (c) 2021 Acronis International GmbH
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package updater
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/acronis/acronis-cyber-cloud-go-sample-connector/connector/core"
+	"github.com/acronis/acronis-cyber-cloud-go-sample-connector/connector/logs"
+)
+
+// PendingDeletions delays deletions of entities from external system by a grace period per entity kind,
+// so that entities deleted on Acronis cloud by mistake can be restored before their data in external system is lost.
+// Deletions are cancelled if the entities reappear or are restored on Acronis cloud within the grace period.
+// Pending deletions are kept in memory only: after restart of connector, reconciliation finds the entities
+// deleted on Acronis cloud again and starts a new grace period, so that they are never deleted earlier.
+// nil PendingDeletions deletes all entities immediately. It is safe for concurrent use.
+type PendingDeletions struct {
+	clock        Clock
+	gracePeriods map[string]time.Duration
+	client       core.PendingDeletionClient // nil if external system doesn't mark pending deletions
+
+	mu      sync.Mutex
+	pending map[stateKey]*pendingDeletion
+}
+
+// pendingDeletion is a deletion waiting for its grace period to expire
+type pendingDeletion struct {
+	core.PendingDeletion
+	remove func() error
+}
+
+// NewPendingDeletions returns PendingDeletions delaying deletions by the grace periods keyed by entity kind
+// (EntityTenant, EntityOfferingItem, EntityUser or EntityAccessPolicy), kinds without grace period are deleted
+// immediately. External system is notified of pending deletions if it implements core.PendingDeletionClient.
+func NewPendingDeletions(
+	gracePeriods map[string]time.Duration, extClient core.ExternalSystemClient, clock Clock) *PendingDeletions {
+	client, _ := extClient.(core.PendingDeletionClient)
+	return &PendingDeletions{
+		clock:        clock,
+		gracePeriods: gracePeriods,
+		client:       client,
+		pending:      make(map[stateKey]*pendingDeletion),
+	}
+}
+
+// Pending returns the deletions waiting for their grace period to expire, in order of expiration
+func (d *PendingDeletions) Pending() []core.PendingDeletion {
+	if d == nil {
+		return nil
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	deletions := make([]core.PendingDeletion, 0, len(d.pending))
+	for _, pending := range d.pending {
+		deletions = append(deletions, pending.PendingDeletion)
+	}
+	sort.Slice(deletions, func(i, j int) bool {
+		return deletions[i].DeleteAt.Before(deletions[j].DeleteAt)
+	})
+	return deletions
+}
+
+// delete removes the entity from external system with remove, unless a grace period is set for its kind:
+// then the entity is marked pending deletion on first call, and removed on the first call after the grace period.
+// It returns true if the entity has been removed.
+func (d *PendingDeletions) delete(logger logs.Logger, deletion core.PendingDeletion, remove func() error) bool {
+	if d == nil || d.gracePeriods[deletion.Kind] <= 0 {
+		return remove() == nil
+	}
+
+	key := pendingDeletionKey(&deletion)
+	now := d.clock.Now()
+	d.mu.Lock()
+	pending, ok := d.pending[key]
+	if !ok {
+		deletion.DeleteAt = now.Add(d.gracePeriods[deletion.Kind])
+		pending = &pendingDeletion{PendingDeletion: deletion, remove: remove}
+		d.pending[key] = pending
+	}
+	d.mu.Unlock()
+
+	if !ok {
+		logger.Infof("Deletion of %v is delayed until %v", describeEntity(key), pending.DeleteAt.Format(time.RFC3339))
+		if d.client != nil {
+			if err := d.client.MarkPendingDeletion(&pending.PendingDeletion); err != nil {
+				logger.Warnf("Failed to mark %v pending deletion: %v", describeEntity(key), err)
+			}
+		}
+		return false
+	}
+	if now.Before(pending.DeleteAt) {
+		return false
+	}
+	return d.remove(logger, key, pending, remove)
+}
+
+// cancel cancels the pending deletion of the entity, if any, as it exists on Acronis cloud
+func (d *PendingDeletions) cancel(logger logs.Logger, kind, id string) {
+	if d == nil {
+		return
+	}
+
+	key := stateKey{kind: kind, id: id}
+	d.mu.Lock()
+	pending, ok := d.pending[key]
+	delete(d.pending, key)
+	d.mu.Unlock()
+	if !ok {
+		return
+	}
+
+	logger.Infof("Pending deletion of %v is cancelled, it exists on Acronis cloud", describeEntity(key))
+	if d.client != nil {
+		if err := d.client.CancelPendingDeletion(&pending.PendingDeletion); err != nil {
+			logger.Warnf("Failed to cancel pending deletion of %v: %v", describeEntity(key), err)
+		}
+	}
+}
+
+// sweep removes the entities of the given kinds whose grace period has expired
+func (d *PendingDeletions) sweep(logger logs.Logger, kinds ...string) {
+	if d == nil {
+		return
+	}
+
+	now := d.clock.Now()
+	expired := make(map[stateKey]*pendingDeletion)
+	d.mu.Lock()
+	for key, pending := range d.pending {
+		for _, kind := range kinds {
+			if key.kind == kind && !now.Before(pending.DeleteAt) {
+				expired[key] = pending
+			}
+		}
+	}
+	d.mu.Unlock()
+
+	for key, pending := range expired {
+		d.remove(logger, key, pending, pending.remove)
+	}
+}
+
+// remove removes the entity whose grace period has expired, it's kept pending to be retried on error
+func (d *PendingDeletions) remove(logger logs.Logger, key stateKey, pending *pendingDeletion, remove func() error) bool {
+	logger.Infof("Grace period of deletion of %v has expired", describeEntity(key))
+	if err := remove(); err != nil {
+		return false
+	}
+
+	d.mu.Lock()
+	// not restored meanwhile
+	if d.pending[key] == pending {
+		delete(d.pending, key)
+	}
+	d.mu.Unlock()
+	return true
+}
+
+// pendingDeletionKey returns the key of the entity, same as in StateStore
+func pendingDeletionKey(deletion *core.PendingDeletion) stateKey {
+	if deletion.Kind == EntityOfferingItem {
+		return stateKey{kind: deletion.Kind, id: offeringItemKey(deletion.OfferingItemID)}
+	}
+	return stateKey{kind: deletion.Kind, id: deletion.ID}
+}
+
+// describeEntity returns the kind and ID of the entity for logs
+func describeEntity(key stateKey) string {
+	if key.kind == EntityOfferingItem {
+		id := offeringItemIDFromKey(key.id)
+		return fmt.Sprintf("offering item %v for tenant %v", id.OfferingItemName, id.TenantID)
+	}
+	return entityName(key.kind) + " " + key.id
+}
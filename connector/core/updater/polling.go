@@ -0,0 +1,89 @@
+// Copyright (c) 2021 Acronis International GmbH
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package updater
+
+import (
+	"time"
+
+	"github.com/acronis/acronis-cyber-cloud-go-sample-connector/connector/accclient"
+)
+
+// adaptivePoller decides the delay before the next cycle of a polling loop. The delay backs off from min toward max
+// while cycles report no changes or fail, it's reset to min by cycles which report changes, and it's 0 after cycles
+// whose last page is full, as more changes are likely to be pending. The delay is extended to honor rate limit
+// headers of Acronis Cyber Cloud responses, if hint is set.
+type adaptivePoller struct {
+	min      time.Duration
+	max      time.Duration
+	hint     *accclient.RateLimitHint
+	interval time.Duration // current delay of idle cycles
+}
+
+// minPollingStep is the smallest delay the poller backs off from, so that it backs off even if min is 0
+const minPollingStep = time.Second
+
+func newAdaptivePoller(minInterval, maxInterval time.Duration, hint *accclient.RateLimitHint) *adaptivePoller {
+	if maxInterval < minInterval {
+		maxInterval = minInterval
+	}
+	return &adaptivePoller{min: minInterval, max: maxInterval, hint: hint, interval: minInterval}
+}
+
+// succeeded returns the delay after a cycle which pulled the number of changes, lastPage being the last page
+// fetched with pages of up to limit items
+func (p *adaptivePoller) succeeded(changes int, lastPage accclient.PageInfo, limit int) time.Duration {
+	switch {
+	case lastPage.After != "" || (limit > 0 && lastPage.Count >= limit):
+		p.interval = p.min
+		return p.honorRateLimit(0)
+	case changes > 0:
+		p.interval = p.min
+	default:
+		p.backOff()
+	}
+	return p.honorRateLimit(p.interval)
+}
+
+// failed returns the delay after a failed cycle
+func (p *adaptivePoller) failed() time.Duration {
+	p.backOff()
+	return p.honorRateLimit(p.interval)
+}
+
+func (p *adaptivePoller) backOff() {
+	next := 2 * p.interval
+	if next < minPollingStep {
+		next = minPollingStep
+	}
+	if next > p.max {
+		next = p.max
+	}
+	p.interval = next
+}
+
+func (p *adaptivePoller) honorRateLimit(delay time.Duration) time.Duration {
+	if p.hint == nil {
+		return delay
+	}
+	if rateLimitDelay := p.hint.Delay(); rateLimitDelay > delay {
+		return rateLimitDelay
+	}
+	return delay
+}
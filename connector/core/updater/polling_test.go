@@ -0,0 +1,91 @@
+// Copyright (c) 2021 Acronis International GmbH
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package updater
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/acronis/acronis-cyber-cloud-go-sample-connector/connector/accclient"
+)
+
+func TestAdaptivePoller(t *testing.T) {
+	poller := newAdaptivePoller(5*time.Second, time.Minute, nil)
+	fullPage := accclient.PageInfo{Count: 10}
+	lastPage := accclient.PageInfo{Count: 3}
+
+	steps := []struct {
+		name     string
+		next     func() time.Duration
+		expected time.Duration
+	}{
+		{"idle", func() time.Duration { return poller.succeeded(0, lastPage, 10) }, 10 * time.Second},
+		{"idle", func() time.Duration { return poller.succeeded(0, lastPage, 10) }, 20 * time.Second},
+		{"failed", poller.failed, 40 * time.Second},
+		{"idle", func() time.Duration { return poller.succeeded(0, lastPage, 10) }, time.Minute},
+		{"idle at max", func() time.Duration { return poller.succeeded(0, lastPage, 10) }, time.Minute},
+		{"changes", func() time.Duration { return poller.succeeded(3, lastPage, 10) }, 5 * time.Second},
+		{"full page", func() time.Duration { return poller.succeeded(10, fullPage, 10) }, 0},
+		{"more pages", func() time.Duration {
+			return poller.succeeded(0, accclient.PageInfo{After: "cursor"}, 10)
+		}, 0},
+		{"idle after full page", func() time.Duration { return poller.succeeded(0, lastPage, 10) }, 10 * time.Second},
+	}
+
+	for i, step := range steps {
+		if delay := step.next(); delay != step.expected {
+			t.Fatalf("step %v (%v): expected delay %v, got %v", i, step.name, step.expected, delay)
+		}
+	}
+}
+
+func TestAdaptivePoller_ZeroMinInterval(t *testing.T) {
+	poller := newAdaptivePoller(0, 3*time.Second, nil)
+
+	expected := []time.Duration{time.Second, 2 * time.Second, 3 * time.Second}
+	for i, exp := range expected {
+		if delay := poller.succeeded(0, accclient.PageInfo{}, 10); delay != exp {
+			t.Fatalf("cycle %v: expected delay %v, got %v", i, exp, delay)
+		}
+	}
+}
+
+func TestAdaptivePoller_HonorsRateLimit(t *testing.T) {
+	hint := accclient.NewRateLimitHint(time.Now)
+	roundTrip := hint.Middleware()(func(req *http.Request) (*http.Response, error) {
+		header := http.Header{}
+		header.Set("Retry-After", "120")
+		return &http.Response{StatusCode: http.StatusTooManyRequests, Header: header}, nil
+	})
+	if _, err := roundTrip(&http.Request{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	poller := newAdaptivePoller(5*time.Second, time.Minute, hint)
+	for _, delay := range []time.Duration{
+		poller.failed(),
+		poller.succeeded(10, accclient.PageInfo{Count: 10}, 10),
+	} {
+		if delay <= time.Minute || delay > 2*time.Minute {
+			t.Errorf("expected delay close to 2m requested by Retry-After, got %v", delay)
+		}
+	}
+}
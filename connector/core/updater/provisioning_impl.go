@@ -0,0 +1,347 @@
+// Copyright (c) 2021 Acronis International GmbH
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package updater
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"time"
+
+	"github.com/acronis/acronis-cyber-cloud-go-sample-connector/connector/accclient"
+	"github.com/acronis/acronis-cyber-cloud-go-sample-connector/connector/core"
+	"github.com/acronis/acronis-cyber-cloud-go-sample-connector/connector/logs"
+)
+
+// provisioningTagPrefix marks tenants created by the provisioning loop in their internal tag,
+// followed by the ID of the provisioning request
+const provisioningTagPrefix = "provisioning:"
+
+// defaultTenantKind is the kind of provisioned tenants if not specified by the request
+const defaultTenantKind = "customer"
+
+// errProvisioningRejected marks errors which won't go away if the provisioning request is retried
+var errProvisioningRejected = errors.New("provisioning request rejected")
+
+// ProvisioningLoop is a sample implementation that pulls provisioning requests from external-system (ISV)
+// and creates the requested tenants and users in Acronis Cyber Cloud Platform
+type ProvisioningLoop struct {
+	accClient          *accclient.Client
+	tenantID           string
+	provisioningClient core.ProvisioningClient
+
+	// optional to be set during initialization
+	provisioningInterval uint // in seconds
+	clock                Clock
+}
+
+// NewProvisioningLoop initializes ProvisioningLoop as an implementation of core.ProvisioningLoop
+func NewProvisioningLoop(
+	accClient *accclient.Client,
+	tenantID string,
+	provisioningClient core.ProvisioningClient,
+	options ...func(*ProvisioningLoop)) core.ProvisioningLoop {
+	loop := &ProvisioningLoop{
+		accClient:            accClient,
+		tenantID:             tenantID,
+		provisioningClient:   provisioningClient,
+		provisioningInterval: 60, // default
+		clock:                RealClock(),
+	}
+
+	for _, option := range options {
+		option(loop)
+	}
+
+	return loop
+}
+
+// WithProvisioningInterval is an optional init function to set provisioning interval
+func WithProvisioningInterval(interval uint) func(*ProvisioningLoop) {
+	return func(loop *ProvisioningLoop) {
+		loop.provisioningInterval = interval
+	}
+}
+
+// WithProvisioningClock is an optional init function to set the clock used for waiting between runs
+func WithProvisioningClock(clock Clock) func(*ProvisioningLoop) {
+	return func(loop *ProvisioningLoop) {
+		loop.clock = clock
+	}
+}
+
+// ProvisionTenants provisions tenants and users requested by external-system on Acronis Cyber Cloud Platform
+//  1. Pulls pending provisioning requests from external-system
+//  2. For each request:
+//     a. Finds the tenant created by a previous attempt of this request, or creates the tenant
+//     b. Enables the requested offering items on the tenant
+//     c. Reuses the admin user if the login is already taken within the tenant, or creates the user
+//     d. Grants the requested roles to the admin user
+//     e. Sends activation email to the admin user, only if the user is newly created
+//  3. Reports the IDs of the tenant and the user back to external-system.
+//     Requests failed with transient errors are not reported, so that they are retried on next cycle.
+func (loop *ProvisioningLoop) ProvisionTenants() {
+	ctx := context.Background()
+	ctx = context.WithValue(ctx, logs.ContextID, "provisioning_loop")
+
+	for ; ; sleepBetweenCycles(loop.clock, time.Second*time.Duration(loop.provisioningInterval)) {
+		loop.provisionPending(ctx)
+	}
+}
+
+// ===================
+// helper functions
+// ===================
+
+// provisionPending executes a cycle of provisioning of the pending requests
+func (loop *ProvisioningLoop) provisionPending(ctx context.Context) {
+	logger := logs.GetDefaultLogger(ctx)
+	requests, err := loop.provisioningClient.GetPendingProvisioningRequests(externalSystemPageSize)
+	if err != nil {
+		logger.Warnf("Failed to get provisioning requests from external system: %v", err)
+		return
+	}
+
+	for i := range requests {
+		result, err := loop.provision(ctx, &requests[i])
+		if err != nil {
+			if !errors.Is(err, errProvisioningRejected) && isTransientError(err) {
+				logger.Warnf("Failed to provision request %v, will retry: %v", requests[i].ID, err)
+				continue
+			}
+			logger.Warnf("Failed to provision request %v: %v", requests[i].ID, err)
+			result.Error = err.Error()
+		} else {
+			logger.Infof("Provisioned request %v as tenant %v and user %v", requests[i].ID, result.TenantID, result.UserID)
+		}
+
+		if err := loop.provisioningClient.CompleteProvisioningRequest(result); err != nil {
+			logger.Warnf("Failed to report result of provisioning request %v to external system: %v", requests[i].ID, err)
+		}
+	}
+}
+
+// provision executes a single provisioning request. Result holds the IDs created so far, even on error.
+func (loop *ProvisioningLoop) provision(ctx context.Context, req *core.ProvisioningRequest) (*core.ProvisioningResult, error) {
+	logger := logs.GetDefaultLogger(ctx)
+	result := &core.ProvisioningResult{RequestID: req.ID}
+
+	tenantID, err := loop.findOrCreateTenant(ctx, req)
+	if err != nil {
+		return result, err
+	}
+	result.TenantID = tenantID
+
+	if len(req.OfferingItems) > 0 {
+		putReq := &accclient.OfferingItemsTenantPutRequest{}
+		for i := range req.OfferingItems {
+			putReq.OfferingItems = append(putReq.OfferingItems, &req.OfferingItems[i])
+		}
+		if err := loop.accClient.UpdateTenantOfferingItems(ctx, tenantID, putReq); err != nil {
+			return result, fmt.Errorf("failed to enable offering items: %w", err)
+		}
+	}
+
+	if req.AdminLogin == "" {
+		return result, nil
+	}
+
+	userID, userCreated, err := loop.findOrCreateUser(ctx, req, tenantID)
+	if err != nil {
+		return result, err
+	}
+	result.UserID = userID
+
+	if len(req.AdminRoles) > 0 {
+		// access policies are replaced as a whole, so that retried requests don't duplicate them
+		accessPolicies := &accclient.AccessPolicyList{}
+		for _, role := range req.AdminRoles {
+			accessPolicies.Items = append(accessPolicies.Items, &accclient.AccessPolicy{
+				ID:          "00000000-0000-0000-0000-000000000000",
+				IssuerID:    tenantID,
+				TenantID:    tenantID,
+				TrusteeID:   userID,
+				TrusteeType: accclient.TrusteeTypeUser,
+				RoleID:      role,
+			})
+		}
+		if _, err := loop.accClient.UpdateAccessPolicy(ctx, userID, accessPolicies); err != nil {
+			return result, fmt.Errorf("failed to grant roles to user %v: %w", userID, err)
+		}
+	}
+
+	if userCreated {
+		// non-fatal, the activation email can be sent again from Acronis cloud management portal
+		if err := loop.accClient.SendActivationEmail(ctx, userID); err != nil {
+			logger.Warnf("Failed to send activation email to user %v: %v", userID, err)
+		}
+	}
+
+	return result, nil
+}
+
+// findOrCreateTenant returns the ID of the tenant tagged with the provisioning request ID,
+// creating the tenant if it doesn't exist yet
+func (loop *ProvisioningLoop) findOrCreateTenant(ctx context.Context, req *core.ProvisioningRequest) (string, error) {
+	parentID := req.ParentTenantID
+	if parentID == "" {
+		parentID = loop.tenantID
+	}
+	tag := provisioningTagPrefix + req.ID
+
+	if tenantID, err := loop.findTenant(ctx, req, parentID, tag); err != nil || tenantID != "" {
+		return tenantID, err
+	}
+
+	kind := req.TenantKind
+	if kind == "" {
+		kind = defaultTenantKind
+	}
+	enabled := true
+	postReq := &accclient.TenantPostRequest{
+		Name:        req.TenantName,
+		ParentID:    parentID,
+		Kind:        kind,
+		Enabled:     &enabled,
+		InternalTag: &tag,
+	}
+	if req.CustomerID != "" {
+		postReq.CustomerID = &req.CustomerID
+	}
+	if req.Language != "" {
+		postReq.Language = &req.Language
+	}
+
+	tenant, err := loop.accClient.CreateTenant(ctx, postReq)
+	if accclient.IsConflict(err) {
+		// created concurrently, e.g. by an earlier attempt whose response was lost
+		if tenantID, err := loop.findTenant(ctx, req, parentID, tag); err != nil || tenantID != "" {
+			return tenantID, err
+		}
+		return "", fmt.Errorf("%w: failed to create tenant %v: %v", errProvisioningRejected, req.TenantName, err)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to create tenant %v: %w", req.TenantName, err)
+	}
+	if tenant.ID == "" {
+		return "", fmt.Errorf("failed to create tenant %v: empty tenant ID returned", req.TenantName)
+	}
+
+	return tenant.ID, nil
+}
+
+// findTenant returns the ID of the tenant under parentID tagged with tag, empty if there is none.
+// The request is rejected if another tenant under parentID has the requested name.
+func (loop *ProvisioningLoop) findTenant(
+	ctx context.Context, req *core.ProvisioningRequest, parentID, tag string) (string, error) {
+	limit := uint(accPageSize)
+	tenants := loop.accClient.NewTenantIterator(&accclient.TenantGetRequest{
+		ParentID: parentID,
+		Limit:    &limit,
+	})
+	for tenants.Next(ctx) {
+		tenant := tenants.Item()
+		if !tenant.DeletedAt.IsZero() {
+			continue
+		}
+		if tenant.InternalTag != nil && *tenant.InternalTag == tag {
+			return tenant.ID, nil
+		}
+		if tenant.Name == req.TenantName {
+			return "", fmt.Errorf("%w: tenant with name %v already exists under %v", errProvisioningRejected, req.TenantName, parentID)
+		}
+	}
+	if err := tenants.Err(); err != nil {
+		return "", fmt.Errorf("failed to look up tenants under %v: %w", parentID, err)
+	}
+	return "", nil
+}
+
+// findOrCreateUser returns the ID of the user with the requested login in the tenant,
+// creating the user if the login is not taken yet
+func (loop *ProvisioningLoop) findOrCreateUser(
+	ctx context.Context, req *core.ProvisioningRequest, tenantID string) (userID string, created bool, err error) {
+	available, err := loop.accClient.CheckLoginAvailability(ctx, req.AdminLogin)
+	if err != nil {
+		return "", false, fmt.Errorf("failed to check availability of login %v: %w", req.AdminLogin, err)
+	}
+
+	if !available {
+		userID, err := loop.findUser(ctx, req, tenantID)
+		return userID, false, err
+	}
+
+	userPost := &accclient.UserPost{
+		TenantID: tenantID,
+		Login:    &req.AdminLogin,
+		Contact: &accclient.Contact{
+			Email:     &req.AdminEmail,
+			Firstname: &req.AdminFirstname,
+			Lastname:  &req.AdminLastname,
+		},
+	}
+	if req.Language != "" {
+		userPost.Language = &req.Language
+	}
+
+	user, err := loop.accClient.CreateUser(ctx, userPost)
+	if accclient.IsConflict(err) {
+		// login taken since it was checked, e.g. by an earlier attempt whose response was lost
+		userID, err := loop.findUser(ctx, req, tenantID)
+		return userID, false, err
+	}
+	if err != nil {
+		return "", false, fmt.Errorf("failed to create user %v: %w", req.AdminLogin, err)
+	}
+
+	return user.ID, true, nil
+}
+
+// findUser returns the ID of the user of the tenant with the requested login, which is known to be taken.
+// The request is rejected if the login is taken by a user of another tenant.
+func (loop *ProvisioningLoop) findUser(ctx context.Context, req *core.ProvisioningRequest, tenantID string) (string, error) {
+	users := loop.accClient.NewUserIterator(&accclient.UserGetRequest{TenantID: tenantID})
+	for users.Next(ctx) {
+		if users.Item().Login == req.AdminLogin && users.Item().DeletedAt.IsZero() {
+			return users.Item().ID, nil
+		}
+	}
+	if err := users.Err(); err != nil {
+		return "", fmt.Errorf("failed to look up users of tenant %v: %w", tenantID, err)
+	}
+	return "", fmt.Errorf("%w: login %v is taken by a user of another tenant", errProvisioningRejected, req.AdminLogin)
+}
+
+// isTransientError reports whether the request is likely to succeed if retried later: errors of Acronis cloud
+// with 5xx and 429 responses, and network errors and timeouts. The others, e.g. validation errors, invalid responses
+// or cancellation, would fail the same way on every cycle.
+func isTransientError(err error) bool {
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+	if accclient.IsServerError(err) || accclient.IsRateLimited(err) {
+		return true
+	}
+	var netErr net.Error
+	var urlErr *url.Error
+	return errors.As(err, &netErr) || errors.As(err, &urlErr)
+}
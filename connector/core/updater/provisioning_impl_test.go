@@ -0,0 +1,200 @@
+// Copyright (c) 2021 Acronis International GmbH
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package updater
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/acronis/acronis-cyber-cloud-go-sample-connector/connector/accclient"
+	"github.com/acronis/acronis-cyber-cloud-go-sample-connector/connector/accclient/acctest"
+	"github.com/acronis/acronis-cyber-cloud-go-sample-connector/connector/core"
+)
+
+// fakeProvisioningClient returns the requests until they are completed
+type fakeProvisioningClient struct {
+	requests      []core.ProvisioningRequest
+	results       map[string]core.ProvisioningResult
+	completionErr error // returned by CompleteProvisioningRequest once
+}
+
+func newFakeProvisioningClient(requests ...core.ProvisioningRequest) *fakeProvisioningClient {
+	return &fakeProvisioningClient{requests: requests, results: make(map[string]core.ProvisioningResult)}
+}
+
+func (f *fakeProvisioningClient) GetPendingProvisioningRequests(limit int) ([]core.ProvisioningRequest, error) {
+	var pending []core.ProvisioningRequest
+	for i := range f.requests {
+		if _, ok := f.results[f.requests[i].ID]; !ok && len(pending) < limit {
+			pending = append(pending, f.requests[i])
+		}
+	}
+	return pending, nil
+}
+
+func (f *fakeProvisioningClient) CompleteProvisioningRequest(result *core.ProvisioningResult) error {
+	if err := f.completionErr; err != nil {
+		f.completionErr = nil
+		return err
+	}
+	f.results[result.RequestID] = *result
+	return nil
+}
+
+func newTestProvisioningLoop(server *acctest.Server, client core.ProvisioningClient) *ProvisioningLoop {
+	return NewProvisioningLoop(server.NewClient(), server.RootTenantID, client).(*ProvisioningLoop)
+}
+
+func TestProvisioningLoop(t *testing.T) {
+	server := acctest.NewServer()
+	defer server.Close()
+
+	client := newFakeProvisioningClient(core.ProvisioningRequest{
+		ID:         "1",
+		TenantName: "customer",
+		CustomerID: "c-1",
+		AdminLogin: "admin",
+		AdminEmail: "admin@example.com",
+		AdminRoles: []accclient.RoleIDEnum{accclient.RoleIDCompanyAdmin},
+	})
+	// the result is lost on the first cycle, so that the request is executed again
+	client.completionErr = errors.New("connection refused")
+	loop := newTestProvisioningLoop(server, client)
+
+	loop.provisionPending(context.Background())
+	if len(client.results) != 0 {
+		t.Fatalf("expected request to stay pending, got %+v", client.results)
+	}
+	loop.provisionPending(context.Background())
+
+	result, ok := client.results["1"]
+	if !ok || result.Error != "" || result.TenantID == "" || result.UserID == "" {
+		t.Fatalf("expected provisioned tenant and user, got %+v", result)
+	}
+	tenant, ok := server.GetTenant(result.TenantID)
+	if !ok || tenant.Name != "customer" || tenant.Kind != defaultTenantKind || tenant.ParentID != server.RootTenantID ||
+		tenant.InternalTag == nil || *tenant.InternalTag != provisioningTagPrefix+"1" {
+		t.Errorf("expected tagged customer tenant under the registration tenant, got %+v", tenant)
+	}
+	user, ok := server.GetUser(result.UserID)
+	if !ok || user.Login != "admin" || user.TenantID != result.TenantID {
+		t.Errorf("expected admin user of the tenant, got %+v", user)
+	}
+	if len(user.AccessPolicies) != 1 || user.AccessPolicies[0].RoleID != accclient.RoleIDCompanyAdmin {
+		t.Errorf("expected company admin role, got %+v", user.AccessPolicies)
+	}
+
+	// executed twice, the tenant and the user created by the first attempt are reused
+	tenants, err := server.NewClient().GetTenants(context.Background(), &accclient.TenantGetRequest{ParentID: server.RootTenantID})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(tenants.Items) != 1 {
+		t.Errorf("expected a single provisioned tenant, got %+v", tenants.Items)
+	}
+	if emails := server.ActivationEmails(); len(emails) != 1 || emails[0] != result.UserID {
+		t.Errorf("expected a single activation email to the admin user, got %v", emails)
+	}
+}
+
+func TestProvisioningLoop_Rejected(t *testing.T) {
+	server := acctest.NewServer()
+	defer server.Close()
+
+	existing := server.AddTenant(accclient.Tenant{Name: "existing", Kind: "customer", ParentID: server.RootTenantID, Enabled: true})
+	server.AddUser(accclient.User{TenantID: existing.ID, Login: "taken", Enabled: true})
+
+	client := newFakeProvisioningClient(
+		core.ProvisioningRequest{ID: "1", TenantName: "existing"},
+		core.ProvisioningRequest{ID: "2", TenantName: "customer", AdminLogin: "taken"},
+		core.ProvisioningRequest{ID: "3", TenantName: "other"},
+	)
+	newTestProvisioningLoop(server, client).provisionPending(context.Background())
+
+	if result := client.results["1"]; result.Error == "" || result.TenantID != "" {
+		t.Errorf("expected request for existing tenant name to be rejected, got %+v", result)
+	}
+	// the tenant created so far is reported along with the error
+	if result := client.results["2"]; result.Error == "" || result.TenantID == "" || result.UserID != "" {
+		t.Errorf("expected request for login of another tenant to be rejected, got %+v", result)
+	}
+	if result := client.results["3"]; result.Error != "" || result.TenantID == "" {
+		t.Errorf("expected request following the rejected ones to be provisioned, got %+v", result)
+	}
+}
+
+func TestProvisioningLoop_LoginTakenConcurrently(t *testing.T) {
+	server := acctest.NewServer()
+	defer server.Close()
+
+	// the login is taken between the availability check and the creation of the user,
+	// e.g. by an earlier attempt whose response was lost
+	var taken *accclient.User
+	takeLogin := func(next accclient.RoundTripFunc) accclient.RoundTripFunc {
+		return func(req *http.Request) (*http.Response, error) {
+			if req.Method == http.MethodPost && strings.HasSuffix(req.URL.Path, "/users") && taken == nil {
+				tenants, err := server.NewClient().GetTenants(req.Context(), &accclient.TenantGetRequest{ParentID: server.RootTenantID})
+				if err != nil || len(tenants.Items) != 1 {
+					t.Fatalf("expected provisioned tenant, got %+v, %v", tenants, err)
+				}
+				user := server.AddUser(accclient.User{TenantID: tenants.Items[0].ID, Login: "admin", Enabled: true})
+				taken = &user
+			}
+			return next(req)
+		}
+	}
+
+	client := newFakeProvisioningClient(core.ProvisioningRequest{ID: "1", TenantName: "customer", AdminLogin: "admin"})
+	loop := NewProvisioningLoop(server.NewClient(accclient.WithMiddleware(takeLogin)), server.RootTenantID, client)
+	loop.(*ProvisioningLoop).provisionPending(context.Background())
+
+	if result := client.results["1"]; taken == nil || result.Error != "" || result.UserID != taken.ID {
+		t.Errorf("expected conflict to resolve to the existing user, got %+v", result)
+	}
+	if emails := server.ActivationEmails(); len(emails) != 0 {
+		t.Errorf("expected no activation email to the existing user, got %v", emails)
+	}
+}
+
+func TestIsTransientError(t *testing.T) {
+	for _, tt := range []struct {
+		err       error
+		transient bool
+	}{
+		{fmt.Errorf("failed to create tenant: %w", accclient.Error{StatusCode: http.StatusServiceUnavailable}), true},
+		{accclient.Error{StatusCode: http.StatusTooManyRequests}, true},
+		{&url.Error{Op: "Post", URL: "https://cloud.example.com", Err: errors.New("connection refused")}, true},
+		{accclient.Error{StatusCode: http.StatusConflict}, false},
+		{accclient.Error{StatusCode: http.StatusBadRequest}, false},
+		{&json.SyntaxError{}, false},
+		{errors.New("invalid request"), false},
+		{&url.Error{Op: "Post", URL: "https://cloud.example.com", Err: context.Canceled}, false},
+	} {
+		if transient := isTransientError(tt.err); transient != tt.transient {
+			t.Errorf("isTransientError(%v) = %v, want %v", tt.err, transient, tt.transient)
+		}
+	}
+}
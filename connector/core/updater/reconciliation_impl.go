@@ -21,7 +21,9 @@ package updater
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"sync/atomic"
 	"time"
 
 	"github.com/acronis/acronis-cyber-cloud-go-sample-connector/connector/accclient"
@@ -32,6 +34,9 @@ import (
 const accPageSize = 100            // number of items requested per request to Acronis Cyber Cloud
 const externalSystemPageSize = 100 // number of items requested per request to external system
 
+// defaultReconciliationMemoryLimit is the default memory of ACC objects buffered by each reconciliation, in bytes
+const defaultReconciliationMemoryLimit = 64 << 20
+
 // ReconciliationLoop is a sample implementation of connector to reconcile items between
 // Acronis Cyber Cloud Platform and external-system
 type ReconciliationLoop struct {
@@ -41,7 +46,23 @@ type ReconciliationLoop struct {
 	ctx       context.Context
 
 	// optional to be set during initialization
-	reconciliationInterval uint // in seconds
+	reconciliationInterval uint          // in seconds, used when schedule is not set
+	schedule               Schedule      // wall-clock aligned schedule, takes precedence over reconciliationInterval
+	jitter                 time.Duration // maximum random delay added to each scheduled run
+	clock                  Clock
+	tempDir                string // directory of sorted sets spilled to disk, default directory for temporary files if empty
+	memoryLimit            int    // memory of ACC objects buffered by each reconciliation before spilling to disk, in bytes
+	filter                 *pushFilter
+	driftPolicy            DriftPolicy
+	deletions              *PendingDeletions
+	orphanRepair           bool
+	reports                ReportStore
+
+	runs uint64 // number of started runs, making IDs of reports unique
+
+	// tenants and users are reconciled in separate goroutines, each following its own schedule
+	tenantsScheduler *scheduler
+	usersScheduler   *scheduler
 }
 
 // NewReconciliationLoop initializes ReconciliationLoop as an implementation of core.Reconciliation
@@ -58,12 +79,23 @@ func NewReconciliationLoop(
 		extClient:              extClient,
 		ctx:                    ctx,
 		reconciliationInterval: 3600, // default
+		clock:                  RealClock(),
+		memoryLimit:            defaultReconciliationMemoryLimit,
+		driftPolicy:            DriftPolicyRepush,
+		orphanRepair:           true,
 	}
 
 	for _, option := range options {
 		option(loop)
 	}
 
+	schedule := loop.schedule
+	if schedule == nil {
+		schedule = EverySchedule(time.Second * time.Duration(loop.reconciliationInterval))
+	}
+	loop.tenantsScheduler = newScheduler("tenants and offering items reconciliation", schedule, loop.jitter, loop.clock)
+	loop.usersScheduler = newScheduler("users and access policies reconciliation", schedule, loop.jitter, loop.clock)
+
 	return loop
 }
 
@@ -74,194 +106,285 @@ func WithReconciliationInterval(interval uint) func(*ReconciliationLoop) {
 	}
 }
 
+// WithReconciliationSchedule is an optional init function to set wall-clock aligned schedule of reconciliation
+// with maximum random jitter added to each run
+func WithReconciliationSchedule(schedule Schedule, jitter time.Duration) func(*ReconciliationLoop) {
+	return func(loop *ReconciliationLoop) {
+		loop.schedule = schedule
+		loop.jitter = jitter
+	}
+}
+
+// WithReconciliationClock is an optional init function to set the clock used for scheduling and retries
+func WithReconciliationClock(clock Clock) func(*ReconciliationLoop) {
+	return func(loop *ReconciliationLoop) {
+		loop.clock = clock
+	}
+}
+
+// WithReconciliationMemoryLimit is an optional init function to set the memory of ACC objects buffered by each
+// reconciliation in bytes, and the directory of temporary files the objects are spilled to beyond the limit
+func WithReconciliationMemoryLimit(memoryLimit int, tempDir string) func(*ReconciliationLoop) {
+	return func(loop *ReconciliationLoop) {
+		loop.memoryLimit = memoryLimit
+		loop.tempDir = tempDir
+	}
+}
+
+// WithReconciliationStateStore is an optional init function to skip pushing entities which exist in external system
+// and are not changed since they were last pushed according to the store. forceFullPush pushes all the entities,
+// still recording their states.
+func WithReconciliationStateStore(store StateStore, forceFullPush bool) func(*ReconciliationLoop) {
+	return func(loop *ReconciliationLoop) {
+		loop.filter = &pushFilter{store: store, force: forceFullPush}
+	}
+}
+
+// WithReconciliationDriftPolicy is an optional init function to set how reconciliation handles drift of tenants
+// and users in external system, if external system implements core.FingerprintClient
+func WithReconciliationDriftPolicy(policy DriftPolicy) func(*ReconciliationLoop) {
+	return func(loop *ReconciliationLoop) {
+		loop.driftPolicy = policy
+	}
+}
+
+// WithReconciliationPendingDeletions is an optional init function to delay deletions of entities from external system
+// by their grace period
+func WithReconciliationPendingDeletions(deletions *PendingDeletions) func(*ReconciliationLoop) {
+	return func(loop *ReconciliationLoop) {
+		loop.deletions = deletions
+	}
+}
+
+// WithReconciliationOrphanRepair is an optional init function to enable or disable repair of entities in external system
+// whose parent doesn't exist in external system, enabled by default
+func WithReconciliationOrphanRepair(enabled bool) func(*ReconciliationLoop) {
+	return func(loop *ReconciliationLoop) {
+		loop.orphanRepair = enabled
+	}
+}
+
+// WithReconciliationReportStore is an optional init function to save the report of each reconciliation run
+func WithReconciliationReportStore(store ReportStore) func(*ReconciliationLoop) {
+	return func(loop *ReconciliationLoop) {
+		loop.reports = store
+	}
+}
+
+// NextTenantsRun returns the time of the next scheduled reconciliation of tenants and offering items,
+// zero time if the reconciliation is currently running
+func (loop *ReconciliationLoop) NextTenantsRun() time.Time {
+	return loop.tenantsScheduler.NextRun()
+}
+
+// NextUsersRun returns the time of the next scheduled reconciliation of users and access policies,
+// zero time if the reconciliation is currently running
+func (loop *ReconciliationLoop) NextUsersRun() time.Time {
+	return loop.usersScheduler.NextRun()
+}
+
 // ReconcileTenantsAndOfferingItems will sync all tenants and offering items
 // between Acronis Cyber Cloud and external system periodically
-// 1. Get tenants from ACC and embed offering_items into each tenant
-// 2. Get tenant IDs which currently exist on external system
-// 3. Remove tenant from external system if it doesn't exist in ACC anymore
-// 4. For each tenant from ACC, push into external system to be created/updated (upsert operation)
-// 5. Get Offering items from external system
-// 6. Remove offering item from external system if it is not active in ACC anymore
-// 7. For each active offering items from ACC, push into external system to be created/updated (upsert operation)
+//  1. Get tenants from ACC with embedded offering_items, collecting tenants and active offering items
+//     into sorted sets which are spilled to disk when they exceed the memory limit
+//  2. Walk tenants from ACC together with tenant IDs which currently exist on external system, both in ID order:
+//     a. Remove tenant from external system if it doesn't exist in ACC anymore
+//     b. For each tenant from ACC, push into external system to be created/updated (upsert operation)
+//  3. Walk active offering items from ACC together with offering item IDs from external system in the same way:
+//     a. Remove offering item from external system if it is not active in ACC anymore
+//     b. For each active offering item from ACC, push into external system to be created/updated (upsert operation)
+//  4. Walk offering items from external system ordered by tenant together with tenant IDs from external system,
+//     for each offering item whose tenant doesn't exist in external system:
+//     a. Push the tenant from ACC into external system if it's active in ACC
+//     b. Otherwise remove the offering item from external system
+//
 // If onStartup is set to true, it will only run the logic above once to make sure all tenants
 // and offering items are in sync upon startup. It will also return timestamp that could be used as
 // updated_since filter for the subsequent update loop
-// If onStartup is set to false, the logic will be run periodically every reconciliationInterval in config file
+// If onStartup is set to false, the logic will be run periodically following reconciliationSchedule,
+// or every reconciliationInterval if schedule is not set in config file
 func (loop *ReconciliationLoop) ReconcileTenantsAndOfferingItems(onStartup bool) time.Time {
 	if onStartup {
-		return loop.reconcileTenantsAndOfferingItems()
+		return loop.reconcileTenantsAndOfferingItems(loop.newReport(ReportTenantsAndOfferingItems), nil)
 	}
 
 	for {
 		// wait for next cycle of reconciliation if it's not the first "sync" on startup
-		time.Sleep(time.Second * time.Duration(loop.reconciliationInterval))
-		loop.reconcileTenantsAndOfferingItems()
+		loop.tenantsScheduler.wait(loop.ctx)
+		loop.reconcileTenantsAndOfferingItems(loop.newReport(ReportTenantsAndOfferingItems), nil)
 	}
 }
 
-func (loop *ReconciliationLoop) reconcileTenantsAndOfferingItems() time.Time {
+// ReconcileTenantsAndOfferingItemsOnce reconciles tenants and offering items once, outside of the schedule,
+// and returns the report of the run
+func (loop *ReconciliationLoop) ReconcileTenantsAndOfferingItemsOnce() *ReconciliationReport {
+	report := loop.newReport(ReportTenantsAndOfferingItems)
+	loop.reconcileTenantsAndOfferingItems(report, nil)
+	return report.report
+}
+
+// reconcileTenantsAndOfferingItems reconciles the tenants and offering items of the subtree of the scope,
+// of the whole tree of the registration tenant if the scope is nil
+func (loop *ReconciliationLoop) reconcileTenantsAndOfferingItems(report *reportRecorder, scope *subtreeScope) time.Time {
 	logger := logs.GetDefaultLogger(loop.ctx)
+	defer loop.finishReport(report)
 
-	// 1. Get tenants from ACC
-	var accTenants map[string]*accclient.Tenant
-	var nextUpdateTimestamp time.Time
-	err := retryHelper(loop.ctx,
-		func() error {
-			var getRequestError error
-			accTenants, nextUpdateTimestamp, getRequestError = loop.getACCTenantsAndOfferingItemsForReconciliation()
-			return getRequestError
-		})
+	// half of the memory limit for each of the sorted sets
+	accTenants := newSortedSet(loop.tempDir, loop.memoryLimit/2)
+	defer loop.closeSortedSet(accTenants)
+	accOfferingItems := newSortedSet(loop.tempDir, loop.memoryLimit/2)
+	defer loop.closeSortedSet(accOfferingItems)
+
+	// 1. Get tenants from ACC, each page is retried by accclient.RetryTransport
+	nextUpdateTimestamp, err := loop.getACCTenantsAndOfferingItemsForReconciliation(accTenants, accOfferingItems, scope)
 	if err != nil {
 		logger.Warnf("Failed to get ACC tenants: %v", err)
+		report.failed(err)
 		return nextUpdateTimestamp // retry in next loop
 	}
 
-	// 2. Get tenants from External System
-	var externalTenantIDs map[string]struct{}
-	err = retryHelper(loop.ctx,
-		func() error {
-			var getRequestError error
-			externalTenantIDs, getRequestError = loop.getExternalSystemTenantIDs()
-			return getRequestError
+	// 2. remove non-existing tenants, create or update tenants
+	externalTenantIDs := newExternalIDStream(loop.ctx, loop.clock, loop.extClient.GetActiveTenantIDs)
+	if fingerprintClient, ok := loop.fingerprintClient(); ok {
+		externalTenantIDs = newExternalFingerprintStream(loop.ctx, loop.clock, fingerprintClient.GetTenantFingerprints)
+	}
+	err = mergeSorted(accTenants, externalTenantIDs,
+		func(tenantID string, value []byte, exists bool, fingerprint *core.Fingerprint) {
+			loop.upsertTenant(report, tenantID, value, exists, fingerprint)
+		},
+		func(tenantID string) bool {
+			return scope.removable(EntityTenant, tenantID) && loop.removeTenant(report, tenantID, reasonNotInACC)
 		})
 	if err != nil {
-		logger.Warnf("Failed to get external tenants: %v", err)
+		logger.Warnf("Failed to reconcile tenants: %v", err)
+		report.failed(err)
 		return nextUpdateTimestamp // retry in next loop
 	}
 
-	// 3. remove non-existing tenants
-	for externalTenantID := range externalTenantIDs {
-		if _, ok := accTenants[externalTenantID]; !ok {
-			logger.Infof("Removing tenant %v", externalTenantID)
-			if deleteErr := loop.extClient.DeleteTenant(externalTenantID); deleteErr != nil {
-				logger.Warnf("Failed to delete tenant %v: %v", externalTenantID, deleteErr)
-			}
-		}
-	}
-
-	// 4. create or update tenant
-	for accTenantID, accTenant := range accTenants {
-		logger.Infof("Updating tenant %v", accTenantID)
-		if upsertErr := createOrUpdateTenant(loop.ctx, loop.extClient, loop.accClient, accTenant); upsertErr != nil {
-			logger.Warnf("Failed to update tenant %v: %v", accTenantID, upsertErr)
-		}
-	}
-
-	// 5. get external offering items
-	var externalOIs []core.OfferingItemID
-	err = retryHelper(loop.ctx,
-		func() error {
-			var getRequestError error
-			externalOIs, getRequestError = loop.getExternalSystemOfferingItems()
-			return getRequestError
+	// 3. remove non existing offering items, create or update offering items
+	externalOfferingItemKeys := newExternalIDStream(loop.ctx, loop.clock, loop.getExternalSystemOfferingItemKeys)
+	err = mergeSorted(accOfferingItems, externalOfferingItemKeys,
+		func(key string, value []byte, exists bool, _ *core.Fingerprint) {
+			loop.upsertOfferingItem(report, key, value, exists)
+		},
+		func(key string) bool {
+			return scope.removable(EntityOfferingItem, key) && loop.removeOfferingItem(report, key, reasonNotInACC)
 		})
 	if err != nil {
-		logger.Warnf("Failed to get external offering items: %v", err)
-		return nextUpdateTimestamp // retry in next loop
+		logger.Warnf("Failed to reconcile offering items: %v", err)
+		report.failed(err)
 	}
 
-	// 6. remove non existing offering items
-	loop.deleteInactiveOfferingItems(accTenants, externalOIs)
-
-	// 7. create or update OI
-	loop.updateOfferingItemsOnExternalSystem(accTenants)
+	// 4. repair offering items without tenant, objects from ACC are not needed anymore.
+	// Orphans are looked for in the whole external system, so not by reconciliation of a subtree.
+	if loop.orphanRepair && scope == nil {
+		loop.closeSortedSet(accTenants)
+		loop.closeSortedSet(accOfferingItems)
+		loop.repairOrphanedOfferingItems(report)
+	}
 
 	return nextUpdateTimestamp
 }
 
 // ReconcileUsersAndAccessPolicies will sync all users and access policies
 // between Acronis Cyber Cloud and external system periodically
-// 1. Get users from ACC and embed access policies into each user
-// 2. Get user IDs which currently exist on external system
-// 3. Remove user from external system if it doesn't exist in ACC anymore
-// 4. For each user from ACC, push into external system to be created/updated (upsert operation)
-// 5. Get active access policies from external system
-// 6. Remove access policy from external system if it is not active in ACC anymore
-// 7. For each access policy from ACC, push into external system to be created/updated (upsert operation)
+//  1. Get users from ACC with embedded access policies, collecting users and active access policies
+//     into sorted sets which are spilled to disk when they exceed the memory limit
+//  2. Walk users from ACC together with user IDs which currently exist on external system, both in ID order:
+//     a. Remove user from external system if it doesn't exist in ACC anymore
+//     b. For each user from ACC, push into external system to be created/updated (upsert operation)
+//  3. Walk active access policies from ACC together with access policy IDs from external system in the same way:
+//     a. Remove access policy from external system if it is not active in ACC anymore
+//     b. For each active access policy from ACC, push into external system to be created/updated (upsert operation)
+//  4. If external system implements core.ParentsClient, walk users and access policies from external system ordered
+//     by their tenants and trustee users respectively, together with tenant and user IDs from external system.
+//     For each user or access policy whose parent doesn't exist in external system:
+//     a. Push the parent from ACC into external system if it's active in ACC
+//     b. Otherwise remove the user or access policy from external system
+//
 // If onStartup is set to true, it will only run the logic above once to make sure all tenants
 // and offering items are in sync upon startup. It will also return timestamp that could be used as
 // updated_since filter for the subsequent update loop
-// If onStartup is set to false, the logic will be run periodically every reconciliationInterval in config file
+// If onStartup is set to false, the logic will be run periodically following reconciliationSchedule,
+// or every reconciliationInterval if schedule is not set in config file
 func (loop *ReconciliationLoop) ReconcileUsersAndAccessPolicies(onStartup bool) time.Time {
 	if onStartup {
-		return loop.reconcileUsersAndAccessPolicies()
+		return loop.reconcileUsersAndAccessPolicies(loop.newReport(ReportUsersAndAccessPolicies), nil)
 	}
 
 	for {
 		// wait for next cycle of reconciliation if it's not the first "sync" on startup
-		time.Sleep(time.Second * time.Duration(loop.reconciliationInterval))
-		loop.reconcileUsersAndAccessPolicies()
+		loop.usersScheduler.wait(loop.ctx)
+		loop.reconcileUsersAndAccessPolicies(loop.newReport(ReportUsersAndAccessPolicies), nil)
 	}
 }
 
-func (loop *ReconciliationLoop) reconcileUsersAndAccessPolicies() time.Time {
+// ReconcileUsersAndAccessPoliciesOnce reconciles users and access policies once, outside of the schedule,
+// and returns the report of the run
+func (loop *ReconciliationLoop) ReconcileUsersAndAccessPoliciesOnce() *ReconciliationReport {
+	report := loop.newReport(ReportUsersAndAccessPolicies)
+	loop.reconcileUsersAndAccessPolicies(report, nil)
+	return report.report
+}
+
+// reconcileUsersAndAccessPolicies reconciles the users and access policies of the subtree of the scope,
+// of the whole tree of the registration tenant if the scope is nil
+func (loop *ReconciliationLoop) reconcileUsersAndAccessPolicies(report *reportRecorder, scope *subtreeScope) time.Time {
 	logger := logs.GetDefaultLogger(loop.ctx)
+	defer loop.finishReport(report)
 
-	// 1. Get users from ACC with embedded access policies
-	var accUsers map[string]*accclient.User
-	var nextUpdateTimestamp time.Time
-	err := retryHelper(loop.ctx,
-		func() error {
-			var getRequestError error
-			accUsers, nextUpdateTimestamp, getRequestError = loop.getACCUsersAndAccessPoliciesForReconciliation(loop.ctx)
-			return getRequestError
-		})
+	// half of the memory limit for each of the sorted sets
+	accUsers := newSortedSet(loop.tempDir, loop.memoryLimit/2)
+	defer loop.closeSortedSet(accUsers)
+	accAccessPolicies := newSortedSet(loop.tempDir, loop.memoryLimit/2)
+	defer loop.closeSortedSet(accAccessPolicies)
+
+	// 1. Get users from ACC with embedded access policies, each page is retried by accclient.RetryTransport
+	nextUpdateTimestamp, err := loop.getACCUsersAndAccessPoliciesForReconciliation(loop.ctx, accUsers, accAccessPolicies, scope)
 	if err != nil {
 		logger.Warnf("Failed to get ACC users: %v", err)
+		report.failed(err)
 		return nextUpdateTimestamp // retry in next loop
 	}
 
-	// 2. Get users from External System
-	var externalUserIDs map[string]struct{}
-	err = retryHelper(loop.ctx,
-		func() error {
-			var getRequestError error
-			externalUserIDs, getRequestError = loop.getExternalSystemUserIDs()
-			return getRequestError
+	// 2. remove non-existing users, create or update users
+	externalUserIDs := newExternalIDStream(loop.ctx, loop.clock, loop.extClient.GetActiveUserIDs)
+	if fingerprintClient, ok := loop.fingerprintClient(); ok {
+		externalUserIDs = newExternalFingerprintStream(loop.ctx, loop.clock, fingerprintClient.GetUserFingerprints)
+	}
+	err = mergeSorted(accUsers, externalUserIDs,
+		func(userID string, value []byte, exists bool, fingerprint *core.Fingerprint) {
+			loop.upsertUser(report, userID, value, exists, fingerprint)
+		},
+		func(userID string) bool {
+			return scope.removable(EntityUser, userID) && loop.removeUser(report, userID, reasonNotInACC)
 		})
 	if err != nil {
-		logger.Warnf("Failed to get external users: %v", err)
+		logger.Warnf("Failed to reconcile users: %v", err)
+		report.failed(err)
 		return nextUpdateTimestamp // retry in next loop
 	}
 
-	// 3. remove non-existing users
-	for externalUserID := range externalUserIDs {
-		if _, ok := accUsers[externalUserID]; !ok {
-			logger.Infof("Removing user %v", externalUserID)
-			err = loop.extClient.DeleteUser(externalUserID)
-			if err != nil {
-				logger.Warnf("Failed to delete user %v: %v", externalUserID, err)
-			}
-		}
-	}
-
-	// 4. create or update users
-	for accUserID, accUser := range accUsers {
-		logger.Infof("Updating user %v", accUserID)
-		err = createOrUpdateUser(loop.ctx, loop.extClient, loop.accClient, accUser)
-		if err != nil {
-			logger.Warnf("Failed to update user %v: %v", accUserID, err)
-		}
-	}
-
-	// 5. get external access policies
-	var externalAPs map[string]struct{}
-	err = retryHelper(loop.ctx,
-		func() error {
-			var getRequestError error
-			externalAPs, getRequestError = loop.getExternalSystemAccessPolicies()
-			return getRequestError
+	// 3. remove non existing access policies, create or update access policies
+	externalAccessPolicyIDs := newExternalIDStream(loop.ctx, loop.clock, loop.extClient.GetActiveAccessPolicyIDs)
+	err = mergeSorted(accAccessPolicies, externalAccessPolicyIDs,
+		func(policyID string, value []byte, exists bool, _ *core.Fingerprint) {
+			loop.upsertAccessPolicy(report, policyID, value, exists)
+		},
+		func(policyID string) bool {
+			return scope.removable(EntityAccessPolicy, policyID) && loop.removeAccessPolicy(report, policyID, reasonNotInACC)
 		})
 	if err != nil {
-		logger.Warnf("Failed to get external access policies: %v", err)
-		return nextUpdateTimestamp // retry in next loop
+		logger.Warnf("Failed to reconcile access policies: %v", err)
+		report.failed(err)
 	}
 
-	// 6. remove non existing access policies
-	loop.deleteInactiveAccessPolicies(accUsers, externalAPs)
-
-	// 7. create or update access policies
-	loop.updateAccessPoliciesOnExternalSystem(accUsers)
+	// 4. repair users without tenant and access policies without user, objects from ACC are not needed anymore
+	if parentsClient, ok := loop.extClient.(core.ParentsClient); ok && loop.orphanRepair && scope == nil {
+		loop.closeSortedSet(accUsers)
+		loop.closeSortedSet(accAccessPolicies)
+		loop.repairOrphanedUsersAndAccessPolicies(report, parentsClient)
+	}
 
 	return nextUpdateTimestamp
 }
@@ -270,288 +393,429 @@ func (loop *ReconciliationLoop) reconcileUsersAndAccessPolicies() time.Time {
 // helper functions
 // =====================
 
-// getACCTenantsAndOfferingItemsForReconciliation returns tenants information with embedded offering items that currently exist in ACC
-// it doesn't use updated_since filter because we need current state of tenants and offering items for reconciliation purpose
-func (loop *ReconciliationLoop) getACCTenantsAndOfferingItemsForReconciliation() (map[string]*accclient.Tenant, time.Time, error) {
+// getACCTenantsAndOfferingItemsForReconciliation collects tenants that currently exist in ACC and their active
+// offering items into the sorted sets, keyed by tenant ID and by offering item key respectively.
+// It doesn't use updated_since filter because we need current state of tenants and offering items for reconciliation purpose.
+// Tenants deleted in ACC are collected into the scope, if any.
+func (loop *ReconciliationLoop) getACCTenantsAndOfferingItemsForReconciliation(
+	accTenants, accOfferingItems *sortedSet, scope *subtreeScope) (time.Time, error) {
+	// sets are filled from scratch on retry
+	if err := accTenants.Reset(); err != nil {
+		return time.Time{}, err
+	}
+	if err := accOfferingItems.Reset(); err != nil {
+		return time.Time{}, err
+	}
+
 	limit := uint(accPageSize)
 	withContacts := true
 	withOfferingItems := true
 	tenantsRequest := &accclient.TenantGetRequest{
-		SubTreeRootID:     loop.tenantID,
+		SubTreeRootID:     scope.rootTenantID(loop.tenantID),
 		Limit:             &limit,
 		WithContacts:      &withContacts,
 		WithOfferingItems: &withOfferingItems,
-		// deleted tenants could be hard deleted by retention, still more accurate to pull tenants from ext-system
-		AllowDeleted: false,
+		// deleted tenants could be hard deleted by retention, still more accurate to pull tenants from ext-system,
+		// unless only entities of a subtree are reconciled
+		AllowDeleted: scope != nil,
 	}
 
-	tenantsResp, err := loop.accClient.GetTenants(loop.ctx, tenantsRequest)
-	if err != nil {
-		return nil, time.Time{}, err
-	}
+	tenants := loop.accClient.NewTenantIterator(tenantsRequest)
+	for tenants.Next(loop.ctx) {
+		tenant := tenants.Item()
+		scope.addTenant(tenant)
+		if !tenant.DeletedAt.IsZero() {
+			continue
+		}
 
-	nextUpdateTimestamp := tenantsResp.Timestamp
+		for i := range tenant.OfferingItems {
+			if tenant.OfferingItems[i].Status == 0 {
+				continue
+			}
+			key := offeringItemKey(core.OfferingItemID{OfferingItemName: tenant.OfferingItems[i].Name, TenantID: tenant.ID})
+			if err := addJSON(accOfferingItems, key, &tenant.OfferingItems[i]); err != nil {
+				return time.Time{}, err
+			}
+		}
 
-	// create a map of tenantID to tenant object
-	accTenants := make(map[string]*accclient.Tenant, len(tenantsResp.Items))
-	for i := range tenantsResp.Items {
-		if tenantsResp.Items[i].DeletedAt.IsZero() {
-			accTenants[tenantsResp.Items[i].ID] = &tenantsResp.Items[i]
+		// offering items are reconciled separately
+		tenant.OfferingItems = nil
+		if err := addJSON(accTenants, tenant.ID, tenant); err != nil {
+			return time.Time{}, err
 		}
 	}
-
-	if tenantsResp.After() == "" {
-		// no second page
-		return accTenants, nextUpdateTimestamp.Time, nil
+	if err := tenants.Err(); err != nil {
+		return time.Time{}, err
 	}
 
-	// loop through the rest of the pages
-	for tenantsResp != nil {
-		tenantsResp, err = loop.accClient.GetTenantsNextPage(loop.ctx, tenantsResp)
-		if err != nil {
-			return nil, time.Time{}, err
-		}
-		if tenantsResp == nil {
-			break
-		}
+	return tenants.Timestamp(), nil
+}
 
-		for i := range tenantsResp.Items {
-			if tenantsResp.Items[i].DeletedAt.IsZero() {
-				accTenants[tenantsResp.Items[i].ID] = &tenantsResp.Items[i]
-			}
-		}
+// getExternalSystemOfferingItemKeys returns a page of keys of offering items that currently exist in external system
+func (loop *ReconciliationLoop) getExternalSystemOfferingItemKeys(offset, limit int) ([]string, error) {
+	externalOIs, err := loop.extClient.GetActiveOfferingItemIDs(offset, limit)
+	if err != nil {
+		return nil, err
 	}
 
-	return accTenants, nextUpdateTimestamp.Time, nil
+	keys := make([]string, len(externalOIs))
+	for i := range externalOIs {
+		keys[i] = offeringItemKey(externalOIs[i])
+	}
+	return keys, nil
 }
 
-// getExternalSystemTenantIDs returns a set of tenantIDs that currently exist in external system
-func (loop *ReconciliationLoop) getExternalSystemTenantIDs() (map[string]struct{}, error) {
-	tenantIDs := make(map[string]struct{})
-	offset := 0
-	for ; ; offset += externalSystemPageSize {
-		tenants, err := loop.extClient.GetActiveTenantIDs(offset, externalSystemPageSize)
-		if err != nil {
-			return nil, fmt.Errorf("failed to get tenants from external system: %v", err)
-		}
+// fingerprintClient returns external system as core.FingerprintClient, if it's supported and drift is not ignored
+func (loop *ReconciliationLoop) fingerprintClient() (core.FingerprintClient, bool) {
+	if loop.driftPolicy == DriftPolicyIgnore {
+		return nil, false
+	}
+	fingerprintClient, ok := loop.extClient.(core.FingerprintClient)
+	return fingerprintClient, ok
+}
 
-		for i := range tenants {
-			tenantIDs[tenants[i]] = struct{}{}
-		}
+// upsertTenant pushes the tenant from ACC into external system to be created or updated,
+// unless it exists in external system and is not changed since it was last pushed.
+// Tenants drifted in external system are pushed or only reported according to the drift policy.
+func (loop *ReconciliationLoop) upsertTenant(
+	report *reportRecorder, tenantID string, value []byte, exists bool, fingerprint *core.Fingerprint) {
+	logger := logs.GetDefaultLogger(loop.ctx)
+	report.compared(EntityTenant, true, exists)
+	var tenant accclient.Tenant
+	if err := json.Unmarshal(value, &tenant); err != nil {
+		logger.Warnf("Failed to decode tenant %v: %v", tenantID, err)
+		report.pushed(EntityTenant, tenantID, exists, "", err)
+		return
+	}
+	loop.deletions.cancel(logger, EntityTenant, tenantID)
+
+	state, changed := loop.filter.changed(logger, EntityTenant, tenantID, tenant.Version, tenantContent(&tenant))
+	reason := pushReason(exists)
+	accFingerprint := core.TenantFingerprint(&tenant)
+	drift, driftedFields := loop.checkDrift(logger, EntityTenant, &accFingerprint, fingerprint)
+	if drift == driftDetected {
+		report.drifted(EntityTenant, tenantID, driftedFields)
+	}
+	switch {
+	case drift == driftOutdated:
+		changed = true
+	case drift == driftDetected && loop.driftPolicy != DriftPolicyReport:
+		changed, reason = true, reasonDrifted
+	case drift == driftDetected && !changed:
+		// left unchanged in external system, but pushed as usual if changed in ACC since last pushed
+		return
+	}
+	if !exists && report.createdParents[tenantID] {
+		// created in this cycle as the parent of another tenant, after external system was read
+		logger.Debugf("Tenant %v is already created as parent, skipped", tenantID)
+		report.pushed(EntityTenant, tenantID, false, reasonParentMissing, nil)
+		return
+	}
+	if exists && !changed {
+		logger.Debugf("Tenant %v is not changed, skipped", tenantID)
+		report.skipped()
+		return
+	}
+
+	logger.Infof("Updating tenant %v", tenantID)
+	upsertErr := createOrUpdateTenant(loop.ctx, loop.extClient, loop.accClient, loop.filter, report.createdParents, loop.tenantID, &tenant)
+	report.pushed(EntityTenant, tenantID, exists, reason, upsertErr)
+	if upsertErr != nil {
+		logger.Warnf("Failed to update tenant %v: %v", tenantID, upsertErr)
+		return
+	}
+	loop.filter.pushed(logger, EntityTenant, tenantID, state)
+}
 
-		if len(tenants) < externalSystemPageSize {
-			// last page
-			break
+// removeTenant removes the tenant which doesn't exist in ACC anymore from external system,
+// once its deletion grace period expires
+func (loop *ReconciliationLoop) removeTenant(report *reportRecorder, tenantID, reason string) bool {
+	logger := logs.GetDefaultLogger(loop.ctx)
+	report.compared(EntityTenant, false, true)
+	var removeErr error
+	removed := loop.deletions.delete(logger, core.PendingDeletion{Kind: EntityTenant, ID: tenantID}, func() error {
+		logger.Infof("Removing tenant %v", tenantID)
+		if removeErr = loop.extClient.DeleteTenant(tenantID); removeErr != nil {
+			logger.Warnf("Failed to delete tenant %v: %v", tenantID, removeErr)
+			return removeErr
 		}
-	}
-	return tenantIDs, nil
+		loop.filter.forget(logger, EntityTenant, tenantID)
+		return nil
+	})
+	report.removed(EntityTenant, tenantID, reason, removed, removeErr)
+	return removed
 }
 
-// getExternalSystemOfferingItems returns a set of tenantIDs that currently exist in external system
-func (loop *ReconciliationLoop) getExternalSystemOfferingItems() ([]core.OfferingItemID, error) {
-	offeringItems := make([]core.OfferingItemID, 0)
-	offset := 0
-	for ; ; offset += externalSystemPageSize {
-		externalOIs, err := loop.extClient.GetActiveOfferingItemIDs(offset, externalSystemPageSize)
-		if err != nil {
-			return nil, fmt.Errorf("failed to get tenants from external system: %v", err)
-		}
+// upsertOfferingItem pushes the active offering item from ACC into external system to be created or updated,
+// unless it exists in external system and is not changed since it was last pushed
+func (loop *ReconciliationLoop) upsertOfferingItem(report *reportRecorder, key string, value []byte, exists bool) {
+	logger := logs.GetDefaultLogger(loop.ctx)
+	report.compared(EntityOfferingItem, true, exists)
+	var item accclient.OfferingItem
+	if err := json.Unmarshal(value, &item); err != nil {
+		logger.Warnf("Failed to decode offering item %v: %v", offeringItemIDFromKey(key), err)
+		report.pushed(EntityOfferingItem, reportOfferingItemID(key), exists, "", err)
+		return
+	}
+	loop.deletions.cancel(logger, EntityOfferingItem, key)
 
-		offeringItems = append(offeringItems, externalOIs...)
+	state, changed := loop.filter.changed(logger, EntityOfferingItem, key, 0, &item)
+	if exists && !changed {
+		logger.Debugf("Offering item %v for tenant %v is not changed, skipped", item.Name, item.TenantID)
+		report.skipped()
+		return
+	}
 
-		if len(externalOIs) < externalSystemPageSize {
-			// last page
-			break
-		}
+	oiCreated, err := loop.extClient.CreateOrUpdateOfferingItem(&item)
+	report.pushed(EntityOfferingItem, reportOfferingItemID(key), exists, pushReason(exists), err)
+	if err != nil {
+		logger.Warnf("Failed to upsert offering item %v for tenant %v into external-system: %v",
+			item.Name, item.TenantID, err)
+	} else {
+		logger.Debugf("Offering item %v for tenant %v successfully updated (is new offering item: %v)",
+			item.Name, item.TenantID, oiCreated)
+		loop.filter.pushed(logger, EntityOfferingItem, key, state)
 	}
-	return offeringItems, nil
 }
 
-// deleteInactiveOfferingItems deletes offering item on external system if:
+// removeOfferingItem deletes offering item on external system if:
 // 1. tenant already removed from ACC
 // 2. tenant still exists in ACC but the particular offering item already disabled
 // 3. tenant still exists in ACC but the particular offering item is no longer reported (already hard deleted by ACC)
-func (loop *ReconciliationLoop) deleteInactiveOfferingItems(
-	accTenants map[string]*accclient.Tenant,
-	externalOIs []core.OfferingItemID) {
+//
+// The offering item is deleted once its deletion grace period expires.
+func (loop *ReconciliationLoop) removeOfferingItem(report *reportRecorder, key, reason string) bool {
 	logger := logs.GetDefaultLogger(loop.ctx)
-	for i := range externalOIs {
-		deleteOI := true
-		if accOIs, ok := accTenants[externalOIs[i].TenantID]; ok {
-			for j := range accOIs.OfferingItems {
-				if accOIs.OfferingItems[j].Name == externalOIs[i].OfferingItemName {
-					deleteOI = accOIs.OfferingItems[j].Status == 0
-					break
-				}
-			}
+	report.compared(EntityOfferingItem, false, true)
+	itemID := offeringItemIDFromKey(key)
+	var removeErr error
+	removed := loop.deletions.delete(logger, core.PendingDeletion{Kind: EntityOfferingItem, OfferingItemID: itemID}, func() error {
+		if removeErr = loop.extClient.DeleteOfferingItem(itemID); removeErr != nil {
+			logger.Warnf("Failed to delete offering item on external-system: %v", removeErr)
+			return removeErr
 		}
-
-		if deleteOI {
-			if err := loop.extClient.DeleteOfferingItem(externalOIs[i]); err != nil {
-				logger.Warnf("Failed to delete offering item on external-system: %v", err)
-			}
-		}
-	}
+		loop.filter.forget(logger, EntityOfferingItem, key)
+		return nil
+	})
+	report.removed(EntityOfferingItem, reportOfferingItemID(key), reason, removed, removeErr)
+	return removed
 }
 
-// updateOfferingItemsOnExternalSystem performs upsert for active offering items from ACC to external system
-func (loop *ReconciliationLoop) updateOfferingItemsOnExternalSystem(accTenants map[string]*accclient.Tenant) {
-	logger := logs.GetDefaultLogger(loop.ctx)
-	for _, tenant := range accTenants {
-		for i := range tenant.OfferingItems {
-			if tenant.OfferingItems[i].Status > 0 {
-				if oiCreated, err := loop.extClient.CreateOrUpdateOfferingItem(&tenant.OfferingItems[i]); err != nil {
-					logger.Warnf("Failed to upsert offering item %v for tenant %v into external-system: %v",
-						tenant.OfferingItems[i].Name, tenant.ID, err)
-				} else {
-					logger.Debugf("Offering item %v for tenant %v successfully updated (is new offering item: %v)",
-						tenant.OfferingItems[i].Name, tenant.ID, oiCreated)
-				}
-			}
-		}
+// getACCUsersAndAccessPoliciesForReconciliation collects users that currently exist in ACC and their active
+// access policies into the sorted sets, keyed by user ID and by access policy ID respectively.
+// It doesn't use updated_since filter because we need current state of users and access policies for reconciliation purpose.
+// Users and access policies deleted in ACC are collected into the scope, if any.
+func (loop *ReconciliationLoop) getACCUsersAndAccessPoliciesForReconciliation(
+	ctx context.Context, accUsers, accAccessPolicies *sortedSet, scope *subtreeScope) (time.Time, error) {
+	// sets are filled from scratch on retry
+	if err := accUsers.Reset(); err != nil {
+		return time.Time{}, err
+	}
+	if err := accAccessPolicies.Reset(); err != nil {
+		return time.Time{}, err
 	}
-}
 
-// getACCUsersAndAccessPoliciesForReconciliation returns user information with embedded access policies that currently exist in ACC
-// it doesn't use updated_since filter because we need current state of users and access policies for reconciliation purpose
-func (loop *ReconciliationLoop) getACCUsersAndAccessPoliciesForReconciliation(
-	ctx context.Context) (map[string]*accclient.User, time.Time, error) {
 	limit := uint(accPageSize)
 	withAccessPolicies := true
 	usersRequest := &accclient.UserGetRequest{
-		SubTreeRootTenantID: loop.tenantID,
+		SubTreeRootTenantID: scope.rootTenantID(loop.tenantID),
 		WithAccessPolicies:  &withAccessPolicies,
 		Limit:               &limit,
+		AllowDeleted:        scope != nil,
 	}
 
-	usersResp, err := loop.accClient.GetUsers(ctx, usersRequest)
-	if err != nil {
-		return nil, time.Time{}, err
-	}
-
-	nextUpdateTimestamp := usersResp.Timestamp
-
-	// create a map of userID to user object
-	accUsers := make(map[string]*accclient.User, len(usersResp.Items))
-	for i := range usersResp.Items {
-		if usersResp.Items[i].DeletedAt.IsZero() && usersResp.Items[i].ID != "" {
-			accUsers[usersResp.Items[i].ID] = &usersResp.Items[i]
-		}
-	}
-
-	if usersResp.After() == "" {
-		// no second page
-		return accUsers, nextUpdateTimestamp, nil
-	}
-
-	// loop through the rest of the pages
-	for usersResp != nil {
-		usersResp, err = loop.accClient.GetUsersNextPage(ctx, usersResp)
-		if err != nil {
-			return nil, time.Time{}, err
+	users := loop.accClient.NewUserIterator(usersRequest)
+	for users.Next(ctx) {
+		user := users.Item()
+		if user.ID == "" {
+			continue
 		}
-		if usersResp == nil {
-			break
+		scope.addUser(user)
+		if !user.DeletedAt.IsZero() {
+			continue
 		}
 
-		for i := range usersResp.Items {
-			if usersResp.Items[i].DeletedAt.IsZero() && usersResp.Items[i].ID != "" {
-				accUsers[usersResp.Items[i].ID] = &usersResp.Items[i]
+		for i := range user.AccessPolicies {
+			// skip deleted ACC policies
+			if user.AccessPolicies[i].DeletedAt != nil {
+				continue
+			}
+			if err := addJSON(accAccessPolicies, user.AccessPolicies[i].ID, &user.AccessPolicies[i]); err != nil {
+				return time.Time{}, err
 			}
 		}
-	}
 
-	return accUsers, nextUpdateTimestamp, nil
-}
-
-// getExternalSystemUserIDs returns a set of userIDs that currently exist in external system
-func (loop *ReconciliationLoop) getExternalSystemUserIDs() (map[string]struct{}, error) {
-	userIDs := make(map[string]struct{})
-	offset := 0
-	for ; ; offset += externalSystemPageSize {
-		userIDPage, err := loop.extClient.GetActiveUserIDs(offset, externalSystemPageSize)
-		if err != nil {
-			return nil, fmt.Errorf("failed to get users from external system: %v", err)
+		// access policies are reconciled separately
+		user.AccessPolicies = nil
+		if err := addJSON(accUsers, user.ID, user); err != nil {
+			return time.Time{}, err
 		}
+	}
+	if err := users.Err(); err != nil {
+		return time.Time{}, err
+	}
 
-		for _, userID := range userIDPage {
-			userIDs[userID] = struct{}{}
-		}
+	return users.Timestamp(), nil
+}
 
-		if len(userIDPage) < externalSystemPageSize {
-			// last page
-			break
-		}
+// upsertUser pushes the user from ACC into external system to be created or updated,
+// unless it exists in external system and is not changed since it was last pushed.
+// Users drifted in external system are pushed or only reported according to the drift policy.
+func (loop *ReconciliationLoop) upsertUser(
+	report *reportRecorder, userID string, value []byte, exists bool, fingerprint *core.Fingerprint) {
+	logger := logs.GetDefaultLogger(loop.ctx)
+	report.compared(EntityUser, true, exists)
+	var user accclient.User
+	if err := json.Unmarshal(value, &user); err != nil {
+		logger.Warnf("Failed to decode user %v: %v", userID, err)
+		report.pushed(EntityUser, userID, exists, "", err)
+		return
+	}
+	loop.deletions.cancel(logger, EntityUser, userID)
+
+	state, changed := loop.filter.changed(logger, EntityUser, userID, int64(user.Version), userContent(&user))
+	reason := pushReason(exists)
+	accFingerprint := core.UserFingerprint(&user)
+	drift, driftedFields := loop.checkDrift(logger, EntityUser, &accFingerprint, fingerprint)
+	if drift == driftDetected {
+		report.drifted(EntityUser, userID, driftedFields)
+	}
+	switch {
+	case drift == driftOutdated:
+		changed = true
+	case drift == driftDetected && loop.driftPolicy != DriftPolicyReport:
+		changed, reason = true, reasonDrifted
+	case drift == driftDetected && !changed:
+		// left unchanged in external system, but pushed as usual if changed in ACC since last pushed
+		return
+	}
+	if exists && !changed {
+		logger.Debugf("User %v is not changed, skipped", userID)
+		report.skipped()
+		return
+	}
+
+	logger.Infof("Updating user %v", userID)
+	err := createOrUpdateUser(loop.ctx, loop.extClient, loop.accClient, loop.filter, report.createdParents, loop.tenantID, &user)
+	report.pushed(EntityUser, userID, exists, reason, err)
+	if err != nil {
+		logger.Warnf("Failed to update user %v: %v", userID, err)
+		return
 	}
-	return userIDs, nil
+	loop.filter.pushed(logger, EntityUser, userID, state)
 }
 
-// getExternalSystemAccessPolicies returns a set of policyIDs that currently exist in external system
-func (loop *ReconciliationLoop) getExternalSystemAccessPolicies() (map[string]struct{}, error) {
-	policyIDs := make(map[string]struct{})
-	offset := 0
-	for ; ; offset += externalSystemPageSize {
-		policyIDPage, err := loop.extClient.GetActiveAccessPolicyIDs(offset, externalSystemPageSize)
-		if err != nil {
-			return nil, fmt.Errorf("failed to get users from external system: %v", err)
+// removeUser removes the user which doesn't exist in ACC anymore from external system,
+// once its deletion grace period expires
+func (loop *ReconciliationLoop) removeUser(report *reportRecorder, userID, reason string) bool {
+	logger := logs.GetDefaultLogger(loop.ctx)
+	report.compared(EntityUser, false, true)
+	var removeErr error
+	removed := loop.deletions.delete(logger, core.PendingDeletion{Kind: EntityUser, ID: userID}, func() error {
+		logger.Infof("Removing user %v", userID)
+		if removeErr = loop.extClient.DeleteUser(userID); removeErr != nil {
+			logger.Warnf("Failed to delete user %v: %v", userID, removeErr)
+			return removeErr
 		}
+		loop.filter.forget(logger, EntityUser, userID)
+		return nil
+	})
+	report.removed(EntityUser, userID, reason, removed, removeErr)
+	return removed
+}
 
-		for _, policyID := range policyIDPage {
-			policyIDs[policyID] = struct{}{}
-		}
+// upsertAccessPolicy pushes the active access policy from ACC into external system to be created or updated,
+// unless it exists in external system and is not changed since it was last pushed
+func (loop *ReconciliationLoop) upsertAccessPolicy(report *reportRecorder, policyID string, value []byte, exists bool) {
+	logger := logs.GetDefaultLogger(loop.ctx)
+	report.compared(EntityAccessPolicy, true, exists)
+	var policy accclient.AccessPolicy
+	if err := json.Unmarshal(value, &policy); err != nil {
+		logger.Warnf("Failed to decode access policy %v: %v", policyID, err)
+		report.pushed(EntityAccessPolicy, policyID, exists, "", err)
+		return
+	}
+	loop.deletions.cancel(logger, EntityAccessPolicy, policyID)
 
-		if len(policyIDPage) < externalSystemPageSize {
-			// last page
-			break
-		}
+	state, changed := loop.filter.changed(logger, EntityAccessPolicy, policyID, policy.Version, &policy)
+	if exists && !changed {
+		logger.Debugf("Access policy %v is not changed, skipped", policyID)
+		report.skipped()
+		return
+	}
+
+	apCreated, err := loop.extClient.CreateOrUpdateAccessPolicy(&policy)
+	report.pushed(EntityAccessPolicy, policyID, exists, pushReason(exists), err)
+	if err != nil {
+		logger.Warnf("Failed to upsert access policy %v with ID %v for user %v into external-system: %v",
+			policy.RoleID, policy.ID, policy.TrusteeID, err)
+	} else {
+		logger.Debugf("Access policy %v for user %v with ID %v successfully updated (is new access policy: %v)",
+			policy.RoleID, policy.ID, policy.TrusteeID, apCreated)
+		loop.filter.pushed(logger, EntityAccessPolicy, policyID, state)
 	}
-	return policyIDs, nil
 }
 
-// deleteInactiveAccessPolicies deletes access policy on external system if:
+// removeAccessPolicy deletes access policy on external system if:
 // 1. user already removed from ACC
 // 2. user still exists in ACC but the particular access policy is soft deleted
 // 3. user still exists in ACC but the particular access policy is no longer reported (already hard deleted by ACC)
-func (loop *ReconciliationLoop) deleteInactiveAccessPolicies(
-	accUsers map[string]*accclient.User,
-	externalAPs map[string]struct{}) {
+//
+// The access policy is deleted once its deletion grace period expires.
+func (loop *ReconciliationLoop) removeAccessPolicy(report *reportRecorder, policyID, reason string) bool {
 	logger := logs.GetDefaultLogger(loop.ctx)
-	// externalAPs will be used as the set of policyIDs to delete
-	// if externalAP ID matches accAP ID then it is removed from the map
-	// and will not be deleted from externalSystem
-	for i := range accUsers {
-		for j := range accUsers[i].AccessPolicies {
-			// skip deleted ACC policies
-			if accUsers[i].AccessPolicies[j].DeletedAt != nil {
-				continue
-			}
-			policyID := accUsers[i].AccessPolicies[j].ID
-			// does nothing if key (policyID) doesnt exist in map (externalAPs)
-			delete(externalAPs, policyID)
+	report.compared(EntityAccessPolicy, false, true)
+	var removeErr error
+	removed := loop.deletions.delete(logger, core.PendingDeletion{Kind: EntityAccessPolicy, ID: policyID}, func() error {
+		if removeErr = loop.extClient.DeleteAccessPolicy(policyID); removeErr != nil {
+			logger.Warnf("Failed to delete access policy on external-system: %v", removeErr)
+			return removeErr
 		}
+		loop.filter.forget(logger, EntityAccessPolicy, policyID)
+		return nil
+	})
+	report.removed(EntityAccessPolicy, policyID, reason, removed, removeErr)
+	return removed
+}
+
+// newReport starts the report of a reconciliation run of the kind
+func (loop *ReconciliationLoop) newReport(kind string) *reportRecorder {
+	startedAt := loop.clock.Now()
+	id := fmt.Sprintf("%v-%v-%v", startedAt.UTC().Format("20060102T150405.000Z"), kind, atomic.AddUint64(&loop.runs, 1))
+	return newReportRecorder(id, kind, startedAt)
+}
+
+// finishReport completes the report of the reconciliation run and saves it
+func (loop *ReconciliationLoop) finishReport(report *reportRecorder) {
+	report.finish(logs.GetDefaultLogger(loop.ctx), loop.clock.Now(), loop.reports)
+}
+
+// pushReason returns the reason of pushing the entity into external system for reports
+func pushReason(exists bool) string {
+	if exists {
+		return reasonChanged
 	}
+	return reasonMissing
+}
 
-	for extPolicyID := range externalAPs {
-		if err := loop.extClient.DeleteAccessPolicy(extPolicyID); err != nil {
-			logger.Warnf("Failed to delete access policy on external-system: %v", err)
-		}
+// reportOfferingItemID returns the ID of the offering item in reports, made of its tenant ID and name
+func reportOfferingItemID(key string) string {
+	itemID := offeringItemIDFromKey(key)
+	return itemID.TenantID + "/" + itemID.OfferingItemName
+}
+
+// closeSortedSet releases the items and removes the temporary files of the sorted set, it's safe to call it again
+func (loop *ReconciliationLoop) closeSortedSet(set *sortedSet) {
+	if err := set.Reset(); err != nil {
+		logs.GetDefaultLogger(loop.ctx).Warnf("Failed to remove temporary files of reconciliation: %v", err)
 	}
 }
 
-// updateAccessPoliciesOnExternalSystem performs upsert for active access policies from ACC to external system
-func (loop *ReconciliationLoop) updateAccessPoliciesOnExternalSystem(accUsers map[string]*accclient.User) {
-	logger := logs.GetDefaultLogger(loop.ctx)
-	for _, user := range accUsers {
-		for i := range user.AccessPolicies {
-			if user.AccessPolicies[i].DeletedAt == nil {
-				if apCreated, err := loop.extClient.CreateOrUpdateAccessPolicy(&user.AccessPolicies[i]); err != nil {
-					logger.Warnf("Failed to upsert access policy %v with ID %v for user %v into external-system: %v",
-						user.AccessPolicies[i].RoleID, user.AccessPolicies[i].ID, user.ID, err)
-				} else {
-					logger.Debugf("Access policy %v for user %v with ID %v successfully updated (is new access policy: %v)",
-						user.AccessPolicies[i].RoleID, user.AccessPolicies[i].ID, user.ID, apCreated)
-				}
-			}
-		}
+// addJSON adds the object encoded in JSON into the sorted set
+func addJSON(set *sortedSet, key string, object interface{}) error {
+	value, err := json.Marshal(object)
+	if err != nil {
+		return fmt.Errorf("failed to encode %v: %w", key, err)
 	}
+	return set.Add(key, value)
 }
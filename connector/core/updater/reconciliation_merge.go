@@ -0,0 +1,214 @@
+// Copyright (c) 2021 Acronis International GmbH
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package updater
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/acronis/acronis-cyber-cloud-go-sample-connector/connector/core"
+)
+
+// errUnsortedExternalIDs is reported when external system returns IDs for reconciliation out of ascending order
+var errUnsortedExternalIDs = errors.New("IDs returned by external system are not in ascending order")
+
+// childKeySeparator separates parent ID and ID in keys of entities ordered by parent, e.g. tenant ID and name
+// in keys of offering items, so that keys are ordered by parent ID first
+const childKeySeparator = "\x00"
+
+func offeringItemKey(id core.OfferingItemID) string {
+	return childKey(id.TenantID, id.OfferingItemName)
+}
+
+func offeringItemIDFromKey(key string) core.OfferingItemID {
+	tenantID, name := splitChildKey(key)
+	return core.OfferingItemID{TenantID: tenantID, OfferingItemName: name}
+}
+
+// childKey returns the key of an entity which is ordered by the ID of its parent first, then by its own ID
+func childKey(parentID, id string) string {
+	return parentID + childKeySeparator + id
+}
+
+func splitChildKey(key string) (parentID, id string) {
+	parts := strings.SplitN(key, childKeySeparator, 2)
+	if len(parts) > 1 {
+		return parts[0], parts[1]
+	}
+	return parts[0], ""
+}
+
+// externalIDStream iterates IDs of the objects in external system in ascending order, requesting them in pages.
+// The offset of the next page is decreased by the number of objects removed while iterating, so that no objects
+// are skipped, and IDs returned again because objects were created meanwhile are skipped instead.
+type externalIDStream struct {
+	ctx     context.Context
+	clock   Clock
+	getPage func(offset, limit int) ([]string, []core.Fingerprint, error)
+
+	page         []string
+	fingerprints []core.Fingerprint // parallel to page, nil if external system doesn't return fingerprints
+	offset       int
+	last         bool
+	id           string
+	fingerprint  *core.Fingerprint
+	started      bool
+	err          error
+}
+
+func newExternalIDStream(
+	ctx context.Context, clock Clock, getPage func(offset, limit int) ([]string, error)) *externalIDStream {
+	return &externalIDStream{ctx: ctx, clock: clock, getPage: func(offset, limit int) ([]string, []core.Fingerprint, error) {
+		ids, err := getPage(offset, limit)
+		return ids, nil, err
+	}}
+}
+
+// newExternalFingerprintStream returns externalIDStream of the objects in external system with their fingerprints
+func newExternalFingerprintStream(
+	ctx context.Context, clock Clock, getPage func(offset, limit int) ([]core.Fingerprint, error)) *externalIDStream {
+	return &externalIDStream{ctx: ctx, clock: clock, getPage: func(offset, limit int) ([]string, []core.Fingerprint, error) {
+		fingerprints, err := getPage(offset, limit)
+		if err != nil {
+			return nil, nil, err
+		}
+		ids := make([]string, len(fingerprints))
+		for i := range fingerprints {
+			ids[i] = fingerprints[i].ID
+		}
+		return ids, fingerprints, nil
+	}}
+}
+
+// Next advances to the next ID, false at the end or on error
+func (s *externalIDStream) Next() bool {
+	for {
+		for len(s.page) > 0 {
+			id := s.page[0]
+			s.page = s.page[1:]
+			var fingerprint *core.Fingerprint
+			if s.fingerprints != nil {
+				fingerprint = &s.fingerprints[0]
+				s.fingerprints = s.fingerprints[1:]
+			}
+			if s.started && id <= s.id {
+				continue
+			}
+			s.id, s.fingerprint, s.started = id, fingerprint, true
+			return true
+		}
+		if s.last || s.err != nil {
+			return false
+		}
+		s.fetch()
+	}
+}
+
+// ID returns the current ID
+func (s *externalIDStream) ID() string {
+	return s.id
+}
+
+// Fingerprint returns the fingerprint of the current object, nil if external system doesn't return fingerprints
+func (s *externalIDStream) Fingerprint() *core.Fingerprint {
+	return s.fingerprint
+}
+
+// Removed reports that the object of the current ID has been removed from external system
+func (s *externalIDStream) Removed() {
+	s.offset--
+}
+
+// Err returns the error that stopped the iteration, if any
+func (s *externalIDStream) Err() error {
+	return s.err
+}
+
+func (s *externalIDStream) fetch() {
+	var page []string
+	var fingerprints []core.Fingerprint
+	err := retryHelper(s.ctx, s.clock, func() error {
+		var getPageErr error
+		page, fingerprints, getPageErr = s.getPage(s.offset, externalSystemPageSize)
+		return getPageErr
+	})
+	if err != nil {
+		s.err = err
+		return
+	}
+
+	for i := 1; i < len(page); i++ {
+		if page[i] < page[i-1] {
+			s.err = fmt.Errorf("%w: %v returned after %v", errUnsortedExternalIDs, page[i], page[i-1])
+			return
+		}
+	}
+	if len(page) == externalSystemPageSize && s.started && page[len(page)-1] <= s.id {
+		s.err = fmt.Errorf("%w: page at offset %v ends with %v, returned before", errUnsortedExternalIDs, s.offset, page[len(page)-1])
+		return
+	}
+
+	s.page, s.fingerprints = page, fingerprints
+	s.offset += len(page)
+	s.last = len(page) < externalSystemPageSize
+}
+
+// mergeSorted walks the objects from ACC and the IDs of the objects in external system in a single pass in ascending
+// order of keys. It calls upsert for each object from ACC, telling whether its ID exists in external system
+// with the fingerprint of the object in external system, if any, and remove for each ID which doesn't exist in ACC anymore.
+// remove returns false if the object has not been removed.
+// IDs of external system are never removed on error, as they could exist in ACC: the walk continues with upserts only.
+func mergeSorted(accObjects *sortedSet, externalIDs *externalIDStream,
+	upsert func(key string, value []byte, exists bool, fingerprint *core.Fingerprint), remove func(id string) bool) error {
+	accIterator, err := accObjects.Iterator()
+	if err != nil {
+		return err
+	}
+
+	hasACC, hasExternal := accIterator.Next(), externalIDs.Next()
+	for hasACC || hasExternal {
+		if hasExternal && (!hasACC || externalIDs.ID() < accIterator.Key()) {
+			if remove(externalIDs.ID()) {
+				externalIDs.Removed()
+			}
+			hasExternal = externalIDs.Next()
+			continue
+		}
+
+		exists := hasExternal && externalIDs.ID() == accIterator.Key()
+		var fingerprint *core.Fingerprint
+		if exists {
+			fingerprint = externalIDs.Fingerprint()
+			hasExternal = externalIDs.Next()
+		}
+		upsert(accIterator.Key(), accIterator.Value(), exists, fingerprint)
+		hasACC = accIterator.Next()
+	}
+
+	if err := accIterator.Err(); err != nil {
+		return err
+	}
+	if err := externalIDs.Err(); err != nil {
+		return fmt.Errorf("failed to get IDs from external system: %w", err)
+	}
+	return nil
+}
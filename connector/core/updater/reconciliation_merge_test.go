@@ -0,0 +1,166 @@
+// Copyright (c) 2021 Acronis International GmbH
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package updater
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"testing"
+
+	"github.com/acronis/acronis-cyber-cloud-go-sample-connector/connector/core"
+)
+
+// sortedExternalIDs is an external system holding IDs in a sorted slice, paged by offset
+type sortedExternalIDs struct {
+	ids []string
+}
+
+func (e *sortedExternalIDs) getPage(offset, limit int) ([]string, error) {
+	if offset >= len(e.ids) {
+		return nil, nil
+	}
+	end := offset + limit
+	if end > len(e.ids) {
+		end = len(e.ids)
+	}
+	return append([]string(nil), e.ids[offset:end]...), nil
+}
+
+func (e *sortedExternalIDs) upsert(id string) {
+	i := sort.SearchStrings(e.ids, id)
+	if i == len(e.ids) || e.ids[i] != id {
+		e.ids = append(e.ids[:i], append([]string{id}, e.ids[i:]...)...)
+	}
+}
+
+func (e *sortedExternalIDs) contains(id string) bool {
+	i := sort.SearchStrings(e.ids, id)
+	return i < len(e.ids) && e.ids[i] == id
+}
+
+func (e *sortedExternalIDs) remove(id string) {
+	i := sort.SearchStrings(e.ids, id)
+	if i < len(e.ids) && e.ids[i] == id {
+		e.ids = append(e.ids[:i], e.ids[i+1:]...)
+	}
+}
+
+func TestMergeSorted(t *testing.T) {
+	// external system has 3 pages of IDs, ACC has every other of them and new ones in between,
+	// so that objects are both created and removed while paging through external system
+	external := &sortedExternalIDs{}
+	acc := newSortedSet(t.TempDir(), 1024)
+	defer acc.Close()
+	var expected []string
+	for i := 0; i < 3*externalSystemPageSize; i++ {
+		external.ids = append(external.ids, fmt.Sprintf("id-%04d", 2*i))
+		if i%2 == 0 {
+			expected = append(expected, fmt.Sprintf("id-%04d", 2*i), fmt.Sprintf("id-%04d", 2*i+1))
+		}
+	}
+	for i := len(expected) - 1; i >= 0; i-- {
+		if err := acc.Add(expected[i], []byte(expected[i])); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	upserts, removals := 0, 0
+	err := mergeSorted(acc, newExternalIDStream(context.Background(), RealClock(), external.getPage),
+		func(key string, value []byte, exists bool, _ *core.Fingerprint) {
+			if key != string(value) {
+				t.Errorf("unexpected value %q of %v", value, key)
+			}
+			if exists != (external.contains(key)) {
+				t.Errorf("unexpected existence %v of %v", exists, key)
+			}
+			upserts++
+			external.upsert(key)
+		},
+		func(id string) bool {
+			removals++
+			external.remove(id)
+			return true
+		})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if upserts != len(expected) || removals != 3*externalSystemPageSize/2 {
+		t.Errorf("unexpected %v upserts and %v removals", upserts, removals)
+	}
+	if fmt.Sprint(external.ids) != fmt.Sprint(expected) {
+		t.Errorf("external system is not reconciled, got %v IDs, expected %v", len(external.ids), len(expected))
+	}
+}
+
+func TestMergeSorted_Unsorted(t *testing.T) {
+	acc := newSortedSet(t.TempDir(), 1024)
+	defer acc.Close()
+	for _, id := range []string{"a", "b", "c"} {
+		if err := acc.Add(id, nil); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	// "a" exists in ACC, it must not be removed although it is returned after "x"
+	external := &sortedExternalIDs{ids: []string{"x", "a"}}
+	var removed []string
+	err := mergeSorted(acc, newExternalIDStream(context.Background(), RealClock(), external.getPage),
+		func(string, []byte, bool, *core.Fingerprint) {},
+		func(id string) bool {
+			removed = append(removed, id)
+			return true
+		})
+	if !errors.Is(err, errUnsortedExternalIDs) {
+		t.Errorf("expected unsorted IDs error, got %v", err)
+	}
+	if len(removed) != 0 {
+		t.Errorf("expected no removals, got %v", removed)
+	}
+}
+
+func TestFindOrphans(t *testing.T) {
+	children := newSortedSet(t.TempDir(), 1024)
+	defer children.Close()
+	for _, child := range []core.EntityParent{
+		{ID: "u1", ParentID: "t1"}, {ID: "u2", ParentID: "t2"}, {ID: "u3", ParentID: "t2"},
+		{ID: "u4", ParentID: "t3"}, {ID: "u5", ParentID: "t5"},
+	} {
+		if err := children.Add(childKey(child.ParentID, child.ID), nil); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	parents := &sortedExternalIDs{ids: []string{"t0", "t1", "t3", "t4"}}
+	orphans := make(map[string][]string)
+	err := findOrphans(children, newExternalIDStream(context.Background(), RealClock(), parents.getPage),
+		func(parentID string, ids []string) {
+			orphans[parentID] = ids
+		})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if fmt.Sprint(orphans) != "map[t2:[u2 u3] t5:[u5]]" {
+		t.Errorf("unexpected orphans %v", orphans)
+	}
+}
@@ -0,0 +1,215 @@
+// Copyright (c) 2021 Acronis International GmbH
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package updater
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/acronis/acronis-cyber-cloud-go-sample-connector/connector/logs"
+)
+
+// Kinds of reconciliation reports
+const (
+	ReportTenantsAndOfferingItems = "tenants_and_offering_items"
+	ReportUsersAndAccessPolicies  = "users_and_access_policies"
+)
+
+// Outcomes of entities in reconciliation reports
+const (
+	OutcomeCreated = "created" // pushed into external system, where it didn't exist
+	OutcomeUpdated = "updated" // pushed into external system, where it existed
+	OutcomeSkipped = "skipped" // not changed since last pushed, only counted
+	OutcomeDeleted = "deleted" // removed from external system
+	OutcomePending = "pending" // removal from external system delayed by grace period
+	OutcomeFailed  = "failed"  // failed to push or remove
+	OutcomeDrifted = "drifted" // differs in external system from the same version in ACC, also counted as pushed if pushed
+)
+
+// Reasons of entities in reconciliation reports
+const (
+	reasonMissing       = "missing in external system"
+	reasonChanged       = "changed since last pushed"
+	reasonDrifted       = "drifted in external system"
+	reasonNotInACC      = "not active in ACC"
+	reasonGracePeriod   = "deletion grace period"
+	reasonParentMissing = "parent of entities in external system"
+)
+
+// maxReportEntries limits the entities listed per outcome, so that the report of the first reconciliation
+// of a large subtree stays small. Summary counts all the entities.
+const maxReportEntries = 1000
+
+// ReconciliationReport is the result of a reconciliation run
+type ReconciliationReport struct {
+	ID             string         `json:"id"`
+	Kind           string         `json:"kind"`              // ReportTenantsAndOfferingItems or ReportUsersAndAccessPolicies
+	Subtree        string         `json:"subtree,omitempty"` // root tenant of the subtree reconciled by a resync, empty for the whole tree
+	StartedAt      time.Time      `json:"started_at"`
+	FinishedAt     time.Time      `json:"finished_at"`
+	Error          string         `json:"error,omitempty"` // reason the run stopped before completion
+	ACCCounts      map[string]int `json:"acc_counts"`      // entities in ACC by entity kind
+	ExternalCounts map[string]int `json:"external_counts"` // entities in external system before the run by entity kind
+	Summary        map[string]int `json:"summary"`         // entities by outcome
+
+	Created   []ReportEntry `json:"created,omitempty"`
+	Updated   []ReportEntry `json:"updated,omitempty"`
+	Deleted   []ReportEntry `json:"deleted,omitempty"`
+	Pending   []ReportEntry `json:"pending,omitempty"`
+	Failed    []ReportEntry `json:"failed,omitempty"`
+	Drifted   []ReportEntry `json:"drifted,omitempty"`
+	Truncated bool          `json:"truncated,omitempty"` // entities beyond maxReportEntries per outcome are not listed
+}
+
+// ReportEntry is an entity created, updated, deleted, failed or found drifted by reconciliation
+type ReportEntry struct {
+	Kind   string `json:"kind"` // EntityTenant, EntityOfferingItem, EntityUser or EntityAccessPolicy
+	ID     string `json:"id"`
+	Reason string `json:"reason"`
+}
+
+// Header returns a copy of the report without the lists of entities
+func (r *ReconciliationReport) Header() *ReconciliationReport {
+	header := *r
+	header.Created, header.Updated, header.Deleted, header.Pending, header.Failed, header.Drifted = nil, nil, nil, nil, nil, nil
+	return &header
+}
+
+// reportRecorder collects the outcomes of a reconciliation run into its report.
+// A run records its entities sequentially, so the recorder is not safe for concurrent use.
+type reportRecorder struct {
+	report *ReconciliationReport
+
+	// IDs of tenants created in external system during the run as parents of other entities
+	createdParents map[string]bool
+}
+
+func newReportRecorder(id, kind string, startedAt time.Time) *reportRecorder {
+	return &reportRecorder{report: &ReconciliationReport{
+		ID:             id,
+		Kind:           kind,
+		StartedAt:      startedAt,
+		ACCCounts:      make(map[string]int),
+		ExternalCounts: make(map[string]int),
+		Summary:        make(map[string]int),
+	}, createdParents: make(map[string]bool)}
+}
+
+// compared counts the entity walked by reconciliation in ACC, and in external system if it exists there
+func (r *reportRecorder) compared(kind string, inACC, inExternal bool) {
+	if inACC {
+		r.report.ACCCounts[kind]++
+	}
+	if inExternal {
+		r.report.ExternalCounts[kind]++
+	}
+}
+
+// pushed records the outcome of pushing the entity into external system, err is nil if it succeeded
+func (r *reportRecorder) pushed(kind, id string, existed bool, reason string, err error) {
+	switch {
+	case err != nil:
+		r.record(OutcomeFailed, kind, id, err.Error())
+	case existed:
+		r.record(OutcomeUpdated, kind, id, reason)
+	default:
+		r.record(OutcomeCreated, kind, id, reason)
+	}
+}
+
+// removed records the outcome of removing the entity from external system:
+// removed if it has been removed, err if it failed, pending deletion otherwise
+func (r *reportRecorder) removed(kind, id, reason string, removed bool, err error) {
+	switch {
+	case removed:
+		r.record(OutcomeDeleted, kind, id, reason)
+	case err != nil:
+		r.record(OutcomeFailed, kind, id, err.Error())
+	default:
+		r.record(OutcomePending, kind, id, reasonGracePeriod)
+	}
+}
+
+// skipped counts the entity which is not changed since last pushed
+func (r *reportRecorder) skipped() {
+	r.report.Summary[OutcomeSkipped]++
+}
+
+// drifted records the entity left unchanged in external system, though the fields differ from ACC
+func (r *reportRecorder) drifted(kind, id string, fields []string) {
+	r.record(OutcomeDrifted, kind, id, "fields differ: "+strings.Join(fields, ", "))
+}
+
+func (r *reportRecorder) record(outcome, kind, id, reason string) {
+	r.report.Summary[outcome]++
+	var entries *[]ReportEntry
+	switch outcome {
+	case OutcomeCreated:
+		entries = &r.report.Created
+	case OutcomeUpdated:
+		entries = &r.report.Updated
+	case OutcomeDeleted:
+		entries = &r.report.Deleted
+	case OutcomePending:
+		entries = &r.report.Pending
+	case OutcomeDrifted:
+		entries = &r.report.Drifted
+	default:
+		entries = &r.report.Failed
+	}
+	if len(*entries) >= maxReportEntries {
+		r.report.Truncated = true
+		return
+	}
+	*entries = append(*entries, ReportEntry{Kind: kind, ID: id, Reason: reason})
+}
+
+// failed records the error which stopped the run, or the first error of its steps which don't stop it
+func (r *reportRecorder) failed(err error) {
+	if r.report.Error == "" {
+		r.report.Error = err.Error()
+	}
+}
+
+// finish completes the report, logs its summary and saves it into the store, if set
+func (r *reportRecorder) finish(logger logs.Logger, finishedAt time.Time, store ReportStore) {
+	r.report.FinishedAt = finishedAt
+	logger.Infof("Reconciliation %v finished in %v: %v", r.report.ID, finishedAt.Sub(r.report.StartedAt), summaryText(r.report))
+	if store == nil {
+		return
+	}
+	if err := store.Save(r.report); err != nil {
+		logger.Warnf("Failed to save reconciliation report %v: %v", r.report.ID, err)
+	}
+}
+
+// summaryText formats the number of entities by outcome for logs
+func summaryText(report *ReconciliationReport) string {
+	text := ""
+	outcomes := []string{OutcomeCreated, OutcomeUpdated, OutcomeSkipped, OutcomeDeleted, OutcomePending, OutcomeFailed, OutcomeDrifted}
+	for _, outcome := range outcomes {
+		text += fmt.Sprintf("%v %v, ", report.Summary[outcome], outcome)
+	}
+	if report.Error != "" {
+		return text + "stopped on error: " + report.Error
+	}
+	return text[:len(text)-2]
+}
@@ -0,0 +1,228 @@
+// Copyright (c) 2021 Acronis International GmbH
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package updater
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// defaultReportRetention is the default number of reconciliation reports kept by report stores
+const defaultReportRetention = 100
+
+// ReportStore keeps the reports of the last reconciliation runs.
+// Implementations must be safe for concurrent use.
+type ReportStore interface {
+	// Save saves the report, replacing the report with the same ID if any
+	Save(report *ReconciliationReport) error
+
+	// List returns at most limit last reports, newest first
+	List(limit int) ([]*ReconciliationReport, error)
+
+	// Get returns the report with the ID, false if there is no such report
+	Get(id string) (*ReconciliationReport, bool, error)
+}
+
+// MemoryReportStore is a ReportStore which keeps the reports in memory, they are lost on restart of connector
+type MemoryReportStore struct {
+	mu        sync.RWMutex
+	reports   []*ReconciliationReport // oldest first
+	retention int
+}
+
+// NewMemoryReportStore returns an empty MemoryReportStore keeping the last retention reports
+func NewMemoryReportStore(retention int) *MemoryReportStore {
+	return &MemoryReportStore{retention: retention}
+}
+
+// Save saves the report, removing the oldest reports beyond retention
+func (s *MemoryReportStore) Save(report *ReconciliationReport) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.reports {
+		if s.reports[i].ID == report.ID {
+			s.reports[i] = report
+			return nil
+		}
+	}
+	s.reports = append(s.reports, report)
+	if len(s.reports) > s.retention {
+		s.reports = append([]*ReconciliationReport(nil), s.reports[len(s.reports)-s.retention:]...)
+	}
+	return nil
+}
+
+// List returns at most limit last reports, newest first
+func (s *MemoryReportStore) List(limit int) ([]*ReconciliationReport, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var reports []*ReconciliationReport
+	for i := len(s.reports) - 1; i >= 0 && len(reports) < limit; i-- {
+		reports = append(reports, s.reports[i])
+	}
+	return reports, nil
+}
+
+// Get returns the report with the ID
+func (s *MemoryReportStore) Get(id string) (*ReconciliationReport, bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, report := range s.reports {
+		if report.ID == id {
+			return report, true, nil
+		}
+	}
+	return nil, false, nil
+}
+
+// reportFileExt is the extension of report files of DirReportStore
+const reportFileExt = ".json"
+
+// DirReportStore is a ReportStore which saves each report as a JSON file named by its ID in a directory,
+// so that reports survive restarts of connector. Report IDs start with the start time of the run,
+// so that the files are ordered by name.
+type DirReportStore struct {
+	mu        sync.Mutex
+	dir       string
+	retention int
+}
+
+// OpenDirReportStore returns a DirReportStore keeping the last retention reports in dir, creating dir if it doesn't exist
+func OpenDirReportStore(dir string, retention int) (*DirReportStore, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create report directory %v: %w", dir, err)
+	}
+	return &DirReportStore{dir: dir, retention: retention}, nil
+}
+
+// Save writes the report file, removing the oldest report files beyond retention
+func (s *DirReportStore) Save(report *ReconciliationReport) error {
+	path, ok := s.path(report.ID)
+	if !ok {
+		return fmt.Errorf("invalid report ID %q", report.ID)
+	}
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode report %v: %w", report.ID, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	temp, err := ioutil.TempFile(s.dir, report.ID+".*")
+	if err != nil {
+		return fmt.Errorf("failed to write report file %v: %w", path, err)
+	}
+	defer os.Remove(temp.Name()) // no-op after rename
+	if _, err := temp.Write(data); err != nil {
+		_ = temp.Close()
+		return fmt.Errorf("failed to write report file %v: %w", path, err)
+	}
+	if err := temp.Close(); err != nil {
+		return fmt.Errorf("failed to write report file %v: %w", path, err)
+	}
+	if err := os.Rename(temp.Name(), path); err != nil {
+		return fmt.Errorf("failed to write report file %v: %w", path, err)
+	}
+
+	ids, err := s.ids()
+	if err != nil {
+		return err
+	}
+	for len(ids) > s.retention {
+		if err := os.Remove(filepath.Join(s.dir, ids[0]+reportFileExt)); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove report file: %w", err)
+		}
+		ids = ids[1:]
+	}
+	return nil
+}
+
+// List reads at most limit last report files, newest first
+func (s *DirReportStore) List(limit int) ([]*ReconciliationReport, error) {
+	s.mu.Lock()
+	ids, err := s.ids()
+	s.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	var reports []*ReconciliationReport
+	for i := len(ids) - 1; i >= 0 && len(reports) < limit; i-- {
+		report, ok, err := s.Get(ids[i])
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			reports = append(reports, report)
+		}
+	}
+	return reports, nil
+}
+
+// Get reads the report file with the ID
+func (s *DirReportStore) Get(id string) (*ReconciliationReport, bool, error) {
+	path, ok := s.path(id)
+	if !ok {
+		return nil, false, nil
+	}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to read report file %v: %w", path, err)
+	}
+
+	var report ReconciliationReport
+	if err := json.Unmarshal(data, &report); err != nil {
+		return nil, false, fmt.Errorf("failed to decode report file %v: %w", path, err)
+	}
+	return &report, true, nil
+}
+
+// path returns the path of the report file, false if the ID is not a valid file name
+func (s *DirReportStore) path(id string) (string, bool) {
+	if id == "" || id != filepath.Base(id) || strings.HasPrefix(id, ".") {
+		return "", false
+	}
+	return filepath.Join(s.dir, id+reportFileExt), true
+}
+
+// ids returns the IDs of the report files in ascending order
+func (s *DirReportStore) ids() ([]string, error) {
+	files, err := ioutil.ReadDir(s.dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list report directory %v: %w", s.dir, err)
+	}
+	var ids []string
+	for _, file := range files {
+		if !file.IsDir() && strings.HasSuffix(file.Name(), reportFileExt) {
+			ids = append(ids, strings.TrimSuffix(file.Name(), reportFileExt))
+		}
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
@@ -0,0 +1,101 @@
+// Copyright (c) 2021 Acronis International GmbH
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package updater
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+var reportStartedAt = time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+
+func testReportStore(t *testing.T, store ReportStore) {
+	for i := 0; i < 4; i++ {
+		report := newReportRecorder(fmt.Sprintf("2021060%vT120000.000Z-tenants", i), ReportTenantsAndOfferingItems, reportStartedAt)
+		report.record(OutcomeCreated, EntityTenant, fmt.Sprintf("t%v", i), reasonMissing)
+		if err := store.Save(report.report); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	reports, err := store.List(10)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var ids []string
+	for _, report := range reports {
+		ids = append(ids, report.ID)
+	}
+	// the oldest report is removed beyond retention
+	if fmt.Sprint(ids) != "[20210603T120000.000Z-tenants 20210602T120000.000Z-tenants 20210601T120000.000Z-tenants]" {
+		t.Errorf("unexpected reports %v", ids)
+	}
+	if reports, _ := store.List(1); len(reports) != 1 || reports[0].ID != ids[0] {
+		t.Errorf("expected only the last report, got %v", reports)
+	}
+
+	report, ok, err := store.Get(ids[1])
+	if err != nil || !ok {
+		t.Fatalf("Get() = %v, %v, want report", ok, err)
+	}
+	if len(report.Created) != 1 || report.Created[0].ID != "t2" || report.Summary[OutcomeCreated] != 1 {
+		t.Errorf("unexpected report %+v", report)
+	}
+	for _, id := range []string{"20210600T120000.000Z-tenants", "../report", ""} {
+		if _, ok, err := store.Get(id); ok || err != nil {
+			t.Errorf("Get(%q) = %v, %v, want no report", id, ok, err)
+		}
+	}
+}
+
+func TestMemoryReportStore(t *testing.T) {
+	testReportStore(t, NewMemoryReportStore(3))
+}
+
+func TestDirReportStore(t *testing.T) {
+	dir := t.TempDir()
+	store, err := OpenDirReportStore(dir, 3)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	testReportStore(t, store)
+
+	// reports survive restart
+	store, err = OpenDirReportStore(dir, 3)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if reports, err := store.List(10); err != nil || len(reports) != 3 {
+		t.Errorf("expected 3 reports after reopening, got %v, %v", len(reports), err)
+	}
+}
+
+func TestReportRecorder_Truncated(t *testing.T) {
+	report := newReportRecorder("report", ReportUsersAndAccessPolicies, reportStartedAt)
+	for i := 0; i <= maxReportEntries; i++ {
+		report.removed(EntityUser, fmt.Sprintf("u%v", i), reasonNotInACC, true, nil)
+	}
+	if len(report.report.Deleted) != maxReportEntries || !report.report.Truncated ||
+		report.report.Summary[OutcomeDeleted] != maxReportEntries+1 {
+		t.Errorf("expected %v listed of %v deleted users, got %v", maxReportEntries, maxReportEntries+1,
+			len(report.report.Deleted))
+	}
+}
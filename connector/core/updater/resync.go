@@ -0,0 +1,220 @@
+// Copyright (c) 2021 Acronis International GmbH
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package updater
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/acronis/acronis-cyber-cloud-go-sample-connector/connector/accclient"
+)
+
+// PushResult counts the entities pushed by a push triggered outside of the loops, e.g. through the admin API
+type PushResult struct {
+	Tenants int `json:"tenants,omitempty"` // tenants pushed with their offering items
+	Users   int `json:"users,omitempty"`   // users pushed with their access policies
+	Usages  int `json:"usages,omitempty"`  // usages pushed into ACC
+	Failed  int `json:"failed,omitempty"`  // entities or pages of usages which failed to be pushed or removed
+
+	// IDs of the reconciliation reports of a tenant resync, listing the pushed and removed entities
+	Reports []string `json:"reports,omitempty"`
+}
+
+// ResyncTenant reconciles the tenant and the tenants and users of its subtree in ACC with external system,
+// with their offering items and access policies, pushing them even if they are not changed since they were last pushed.
+// Entities of the subtree deleted in ACC are removed from external system, after their deletion grace period if set,
+// see subtreeScope. The reports of the run are saved like the ones of scheduled reconciliation.
+func (loop *ReconciliationLoop) ResyncTenant(ctx context.Context, tenantID string) (PushResult, error) {
+	forced := loop.forcedPush(ctx)
+	scope := newSubtreeScope(tenantID)
+	var result PushResult
+
+	tenantsReport := loop.newReport(ReportTenantsAndOfferingItems)
+	tenantsReport.report.Subtree = tenantID
+	forced.reconcileTenantsAndOfferingItems(tenantsReport, scope)
+	result.addReport(tenantsReport.report)
+	result.Tenants = scope.tenants
+	if tenantsReport.report.Error != "" {
+		return result, fmt.Errorf("failed to reconcile tenants of subtree %v: %v", tenantID, tenantsReport.report.Error)
+	}
+	if scope.tenants == 0 {
+		return result, fmt.Errorf("tenant %v not found", tenantID)
+	}
+
+	usersReport := loop.newReport(ReportUsersAndAccessPolicies)
+	usersReport.report.Subtree = tenantID
+	forced.reconcileUsersAndAccessPolicies(usersReport, scope)
+	result.addReport(usersReport.report)
+	result.Users = scope.users
+	if usersReport.report.Error != "" {
+		return result, fmt.Errorf("failed to reconcile users of subtree %v: %v", tenantID, usersReport.report.Error)
+	}
+
+	if result.Failed > 0 {
+		return result, fmt.Errorf("failed to push or remove %v entities of subtree %v, see reports %v",
+			result.Failed, tenantID, strings.Join(result.Reports, ", "))
+	}
+	return result, nil
+}
+
+// forcedPush returns a loop running in ctx, which pushes all entities still recording their states.
+// It's built from the settings of the loop only, as the loop itself keeps running.
+func (loop *ReconciliationLoop) forcedPush(ctx context.Context) *ReconciliationLoop {
+	forced := &ReconciliationLoop{
+		accClient:   loop.accClient,
+		tenantID:    loop.tenantID,
+		extClient:   loop.extClient,
+		ctx:         ctx,
+		clock:       loop.clock,
+		tempDir:     loop.tempDir,
+		memoryLimit: loop.memoryLimit,
+		driftPolicy: loop.driftPolicy,
+		deletions:   loop.deletions,
+		reports:     loop.reports,
+	}
+	if loop.filter != nil {
+		forced.filter = &pushFilter{store: loop.filter.store, force: true}
+	}
+	return forced
+}
+
+// addReport counts the entities failed in the reconciliation run and adds its report
+func (result *PushResult) addReport(report *ReconciliationReport) {
+	result.Failed += report.Summary[OutcomeFailed]
+	result.Reports = append(result.Reports, report.ID)
+}
+
+// ResyncUser pushes the user from ACC into external system with its access policies, even if they are not changed
+// since they were last pushed. The user is deleted from external system if it's deleted in ACC.
+func (loop *SyncLoopImpl) ResyncUser(ctx context.Context, userID string) (PushResult, error) {
+	withAccessPolicies := true
+	users, err := loop.accClient.GetUsers(ctx, &accclient.UserGetRequest{
+		UUIDs:              []string{userID},
+		WithAccessPolicies: &withAccessPolicies,
+		AllowDeleted:       true,
+	})
+	if err != nil {
+		return PushResult{}, fmt.Errorf("failed to get user %v: %w", userID, err)
+	}
+
+	for i := range users.Items {
+		if users.Items[i].ID != userID {
+			continue
+		}
+		result := PushResult{Users: 1}
+		pushErr := loop.forcedPush().processUserAndAccessPoliciesChanges(ctx, &users.Items[i])
+		if pushErr != nil {
+			result.Failed++
+		}
+		return result, pushFailure(result, pushErr)
+	}
+	return PushResult{}, fmt.Errorf("user %v not found", userID)
+}
+
+// forcedPush returns a loop which pushes all entities still recording their states.
+// It's built from the settings of the loop only, as the loop itself keeps running.
+func (loop *SyncLoopImpl) forcedPush() *SyncLoopImpl {
+	forced := &SyncLoopImpl{
+		accClient: loop.accClient,
+		tenantID:  loop.tenantID,
+		extClient: loop.extClient,
+		clock:     loop.clock,
+		deletions: loop.deletions,
+	}
+	if loop.filter != nil {
+		forced.filter = &pushFilter{store: loop.filter.store, force: true}
+	}
+	return forced
+}
+
+// pushFailure returns the error of a push which failed for some of the entities, nil if all of them were pushed
+func pushFailure(result PushResult, err error) error {
+	if err == nil {
+		return nil
+	}
+	return fmt.Errorf("failed to push %v of %v tenants and users: %w", result.Failed, result.Tenants+result.Users, err)
+}
+
+// subtreeScope limits reconciliation to the subtree of a tenant. External system doesn't tell the subtree
+// of its entities, so only the ones ACC reports within the subtree are removed from external system: tenants,
+// users and access policies deleted in ACC, and the offering items of the tenants of the subtree which are not active.
+// Entities hard deleted in ACC meanwhile are left to the scheduled reconciliation. nil scope is the whole tree.
+type subtreeScope struct {
+	rootID string
+
+	subtreeTenants map[string]bool   // IDs of the tenants of the subtree, including deleted ones
+	deleted        map[stateKey]bool // entities of the subtree deleted in ACC
+
+	tenants int // tenants of the subtree in ACC, including deleted ones
+	users   int // users of the subtree in ACC, including deleted ones
+}
+
+func newSubtreeScope(rootID string) *subtreeScope {
+	return &subtreeScope{rootID: rootID, subtreeTenants: make(map[string]bool), deleted: make(map[stateKey]bool)}
+}
+
+// rootTenantID returns the root tenant of the subtree, defaultID for the whole tree
+func (s *subtreeScope) rootTenantID(defaultID string) string {
+	if s == nil {
+		return defaultID
+	}
+	return s.rootID
+}
+
+// addTenant collects the tenant of the subtree from ACC
+func (s *subtreeScope) addTenant(tenant *accclient.Tenant) {
+	if s == nil {
+		return
+	}
+	s.tenants++
+	s.subtreeTenants[tenant.ID] = true
+	if !tenant.DeletedAt.IsZero() {
+		s.deleted[stateKey{kind: EntityTenant, id: tenant.ID}] = true
+	}
+}
+
+// addUser collects the user of the subtree from ACC with its access policies
+func (s *subtreeScope) addUser(user *accclient.User) {
+	if s == nil {
+		return
+	}
+	s.users++
+	if !user.DeletedAt.IsZero() {
+		s.deleted[stateKey{kind: EntityUser, id: user.ID}] = true
+	}
+	for i := range user.AccessPolicies {
+		if user.AccessPolicies[i].DeletedAt != nil || !user.DeletedAt.IsZero() {
+			s.deleted[stateKey{kind: EntityAccessPolicy, id: user.AccessPolicies[i].ID}] = true
+		}
+	}
+}
+
+// removable tells whether the entity of the kind in external system, which is not active in ACC,
+// belongs to the scope and can be removed. key is the key of offering items, see offeringItemKey.
+func (s *subtreeScope) removable(kind, key string) bool {
+	if s == nil {
+		return true
+	}
+	if kind == EntityOfferingItem {
+		return s.subtreeTenants[offeringItemIDFromKey(key).TenantID]
+	}
+	return s.deleted[stateKey{kind: kind, id: key}]
+}
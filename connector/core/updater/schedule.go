@@ -0,0 +1,356 @@
+// Copyright (c) 2021 Acronis International GmbH
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package updater
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/acronis/acronis-cyber-cloud-go-sample-connector/connector/logs"
+)
+
+// Schedule determines when the next run of a periodic loop should happen
+type Schedule interface {
+	// Next returns the next activation time later than t, or zero time if there is none
+	Next(t time.Time) time.Time
+}
+
+// maxScheduleSearchYears limits the search of next activation time for expressions which never match, e.g. "0 0 30 2 *"
+const maxScheduleSearchYears = 5
+
+// intervalSchedule runs every interval, counted from the time Next is called
+type intervalSchedule struct {
+	interval time.Duration
+}
+
+// EverySchedule returns a Schedule that runs every interval after the previous run finished.
+// This is the behavior of the plain interval settings such as usageReportInterval.
+func EverySchedule(interval time.Duration) Schedule {
+	return &intervalSchedule{interval: interval}
+}
+
+func (s *intervalSchedule) Next(t time.Time) time.Time {
+	return t.Add(s.interval)
+}
+
+// alignedSchedule runs every interval, aligned to multiples of interval since Unix epoch
+type alignedSchedule struct {
+	interval time.Duration
+}
+
+func (s *alignedSchedule) Next(t time.Time) time.Time {
+	return t.Truncate(s.interval).Add(s.interval)
+}
+
+// cronSchedule is a schedule defined by a standard 5-field cron expression
+type cronSchedule struct {
+	minute, hour, dom, month, dow uint64 // bit sets of allowed values
+
+	// domStar and dowStar are set when the corresponding field is "*",
+	// day matches if either restricted day field matches (same as standard cron)
+	domStar, dowStar bool
+
+	location *time.Location
+}
+
+type cronField struct {
+	name     string
+	min, max uint
+	names    map[string]uint
+}
+
+var (
+	minuteField = cronField{name: "minute", min: 0, max: 59}
+	hourField   = cronField{name: "hour", min: 0, max: 23}
+	domField    = cronField{name: "day of month", min: 1, max: 31}
+	monthField  = cronField{name: "month", min: 1, max: 12, names: map[string]uint{
+		"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+		"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+	}}
+	dowField = cronField{name: "day of week", min: 0, max: 7, names: map[string]uint{
+		"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+	}}
+)
+
+var scheduleDescriptors = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// ParseSchedule parses a cron-style schedule expression, evaluated in the given location.
+// Supported formats:
+//  1. Standard 5-field cron expression "minute hour day-of-month month day-of-week",
+//     each field accepts "*", values, ranges "a-b", lists "a,b" and steps "*/n" or "a-b/n".
+//     Months and days of week accept 3-letter names (JAN, MON), Sunday is either 0 or 7.
+//     e.g. "0 * * * *" runs at :00 every hour, "30 23 * * *" runs daily at 23:30.
+//  2. Descriptors: @yearly, @annually, @monthly, @weekly, @daily, @midnight, @hourly.
+//  3. "@every <duration>", e.g. "@every 15m", runs aligned to multiples of the duration since Unix epoch.
+//
+// The expression can be prefixed with "CRON_TZ=<zone> " or "TZ=<zone> " to override the location.
+func ParseSchedule(expr string, location *time.Location) (Schedule, error) {
+	expr = strings.TrimSpace(expr)
+	if location == nil {
+		location = time.UTC
+	}
+
+	if strings.HasPrefix(expr, "CRON_TZ=") || strings.HasPrefix(expr, "TZ=") {
+		i := strings.Index(expr, " ")
+		if i < 0 {
+			return nil, fmt.Errorf("missing schedule after time zone in %q", expr)
+		}
+		zone := expr[strings.Index(expr, "=")+1 : i]
+		loc, err := time.LoadLocation(zone)
+		if err != nil {
+			return nil, fmt.Errorf("invalid time zone %q in schedule: %w", zone, err)
+		}
+		location = loc
+		expr = strings.TrimSpace(expr[i:])
+	}
+
+	if strings.HasPrefix(expr, "@every ") {
+		interval, err := time.ParseDuration(strings.TrimSpace(strings.TrimPrefix(expr, "@every ")))
+		if err != nil {
+			return nil, fmt.Errorf("invalid duration in schedule %q: %w", expr, err)
+		}
+		if interval < time.Second {
+			return nil, fmt.Errorf("interval in schedule %q must be at least 1s", expr)
+		}
+		return &alignedSchedule{interval: interval}, nil
+	}
+
+	if descriptor, ok := scheduleDescriptors[strings.ToLower(expr)]; ok {
+		expr = descriptor
+	} else if strings.HasPrefix(expr, "@") {
+		return nil, fmt.Errorf("unknown schedule descriptor %q", expr)
+	}
+
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("expected 5 fields in cron expression %q, got %d", expr, len(fields))
+	}
+
+	schedule := &cronSchedule{location: location}
+	var err error
+	if schedule.minute, _, err = minuteField.parse(fields[0]); err != nil {
+		return nil, err
+	}
+	if schedule.hour, _, err = hourField.parse(fields[1]); err != nil {
+		return nil, err
+	}
+	if schedule.dom, schedule.domStar, err = domField.parse(fields[2]); err != nil {
+		return nil, err
+	}
+	if schedule.month, _, err = monthField.parse(fields[3]); err != nil {
+		return nil, err
+	}
+	if schedule.dow, schedule.dowStar, err = dowField.parse(fields[4]); err != nil {
+		return nil, err
+	}
+	// 7 is an alias of Sunday
+	if schedule.dow&(1<<7) != 0 {
+		schedule.dow |= 1
+	}
+
+	if schedule.Next(time.Now()).IsZero() {
+		return nil, fmt.Errorf("cron expression %q never matches", expr)
+	}
+
+	return schedule, nil
+}
+
+// parse returns bit set of allowed values of the field, and whether the field is a wildcard
+func (f cronField) parse(expr string) (bits uint64, star bool, err error) {
+	for _, part := range strings.Split(expr, ",") {
+		rangeExpr, step := part, uint(1)
+		if i := strings.Index(part, "/"); i >= 0 {
+			rangeExpr = part[:i]
+			stepValue, convErr := strconv.ParseUint(part[i+1:], 10, 8)
+			if convErr != nil || stepValue == 0 {
+				return 0, false, fmt.Errorf("invalid step in %v field %q", f.name, part)
+			}
+			step = uint(stepValue)
+		}
+
+		var low, high uint
+		switch {
+		case rangeExpr == "*" || rangeExpr == "?":
+			low, high = f.min, f.max
+			if step == 1 && len(expr) == len(part) {
+				star = true
+			}
+		case strings.Contains(rangeExpr, "-"):
+			bounds := strings.SplitN(rangeExpr, "-", 2)
+			if low, err = f.value(bounds[0]); err != nil {
+				return 0, false, err
+			}
+			if high, err = f.value(bounds[1]); err != nil {
+				return 0, false, err
+			}
+			if low > high {
+				return 0, false, fmt.Errorf("invalid range in %v field %q", f.name, part)
+			}
+		default:
+			if low, err = f.value(rangeExpr); err != nil {
+				return 0, false, err
+			}
+			high = low
+			if step > 1 {
+				// "a/n" means starting from a until the end of the range
+				high = f.max
+			}
+		}
+
+		for v := low; v <= high; v += step {
+			bits |= 1 << v
+		}
+	}
+	return bits, star, nil
+}
+
+func (f cronField) value(s string) (uint, error) {
+	if v, ok := f.names[strings.ToLower(s)]; ok {
+		return v, nil
+	}
+	v, err := strconv.ParseUint(s, 10, 8)
+	if err != nil || uint(v) < f.min || uint(v) > f.max {
+		return 0, fmt.Errorf("invalid value %q in %v field, expected %d-%d", s, f.name, f.min, f.max)
+	}
+	return uint(v), nil
+}
+
+// Next returns the first time matching the cron expression which is later than t
+func (s *cronSchedule) Next(t time.Time) time.Time {
+	originalLocation := t.Location()
+	t = t.In(s.location)
+
+	// start from the next whole minute
+	t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), 0, 0, s.location).Add(time.Minute)
+	yearLimit := t.Year() + maxScheduleSearchYears
+
+WRAP:
+	if t.Year() > yearLimit {
+		return time.Time{}
+	}
+
+	for s.month&(1<<uint(t.Month())) == 0 {
+		t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, s.location)
+		if t.Month() == time.January {
+			goto WRAP
+		}
+	}
+
+	for !s.dayMatches(t) {
+		t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, s.location)
+		if t.Day() == 1 {
+			goto WRAP
+		}
+	}
+
+	for s.hour&(1<<uint(t.Hour())) == 0 {
+		t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, s.location)
+		if t.Hour() == 0 {
+			goto WRAP
+		}
+	}
+
+	for s.minute&(1<<uint(t.Minute())) == 0 {
+		t = t.Add(time.Minute)
+		if t.Minute() == 0 {
+			goto WRAP
+		}
+	}
+
+	return t.In(originalLocation)
+}
+
+func (s *cronSchedule) dayMatches(t time.Time) bool {
+	domMatch := s.dom&(1<<uint(t.Day())) != 0
+	dowMatch := s.dow&(1<<uint(t.Weekday())) != 0
+	if s.domStar || s.dowStar {
+		return domMatch && dowMatch
+	}
+	return domMatch || dowMatch
+}
+
+// scheduler waits for the next run of a periodic loop according to its Schedule,
+// adding random jitter, and keeps the next run time for observability
+type scheduler struct {
+	name     string
+	schedule Schedule
+	jitter   time.Duration
+	clock    Clock
+
+	mu      sync.Mutex
+	nextRun time.Time
+}
+
+func newScheduler(name string, schedule Schedule, jitter time.Duration, clock Clock) *scheduler {
+	return &scheduler{
+		name:     name,
+		schedule: schedule,
+		jitter:   jitter,
+		clock:    clock,
+	}
+}
+
+// wait blocks until the next scheduled run
+func (s *scheduler) wait(ctx context.Context) {
+	logger := logs.GetDefaultLogger(ctx)
+
+	now := s.clock.Now()
+	next := s.schedule.Next(now)
+	if next.IsZero() {
+		// should not happen for validated schedules, avoid spinning anyway
+		logger.Warnf("No next run found for %v, retrying in an hour", s.name)
+		next = now.Add(time.Hour)
+	}
+	if s.jitter > 0 {
+		next = next.Add(time.Duration(rand.Int63n(int64(s.jitter))))
+	}
+
+	s.mu.Lock()
+	s.nextRun = next
+	s.mu.Unlock()
+
+	logger.Infof("Next run of %v is scheduled at %v", s.name, next.Format(time.RFC3339))
+	sleepBetweenCycles(s.clock, next.Sub(now))
+
+	s.mu.Lock()
+	s.nextRun = time.Time{}
+	s.mu.Unlock()
+}
+
+// NextRun returns the time of the next scheduled run, zero time if the loop is currently running
+// or hasn't been scheduled yet
+func (s *scheduler) NextRun() time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.nextRun
+}
@@ -0,0 +1,138 @@
+// Copyright (c) 2021 Acronis International GmbH
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package updater
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseSchedule_Next(t *testing.T) {
+	from := time.Date(2021, time.March, 15, 10, 20, 30, 0, time.UTC) // Monday
+
+	testCases := []struct {
+		expr     string
+		expected time.Time
+	}{
+		{"0 * * * *", time.Date(2021, time.March, 15, 11, 0, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2021, time.March, 15, 10, 30, 0, 0, time.UTC)},
+		{"30 23 * * *", time.Date(2021, time.March, 15, 23, 30, 0, 0, time.UTC)},
+		{"0 2 * * SUN", time.Date(2021, time.March, 21, 2, 0, 0, 0, time.UTC)},
+		{"0 2 * * 7", time.Date(2021, time.March, 21, 2, 0, 0, 0, time.UTC)},
+		{"0 0 1 JAN-MAR *", time.Date(2022, time.January, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 1,20 * *", time.Date(2021, time.March, 20, 0, 0, 0, 0, time.UTC)},
+		{"@daily", time.Date(2021, time.March, 16, 0, 0, 0, 0, time.UTC)},
+		{"@monthly", time.Date(2021, time.April, 1, 0, 0, 0, 0, time.UTC)},
+		{"@every 1h", time.Date(2021, time.March, 15, 11, 0, 0, 0, time.UTC)},
+		{"CRON_TZ=Europe/Berlin 0 12 * * *", time.Date(2021, time.March, 15, 11, 0, 0, 0, time.UTC)},
+	}
+
+	for _, testCase := range testCases {
+		schedule, err := ParseSchedule(testCase.expr, time.UTC)
+		if err != nil {
+			t.Fatalf("unexpected error for %q: %v", testCase.expr, err)
+		}
+		next := schedule.Next(from)
+		if !next.Equal(testCase.expected) {
+			t.Errorf("%q: expected next run at %v, got %v", testCase.expr, testCase.expected, next)
+		}
+	}
+}
+
+func TestParseSchedule_DaylightSavingTime(t *testing.T) {
+	location, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skipf("timezone database is not available: %v", err)
+	}
+
+	// 2:30 does not exist on 2021-03-28 in Berlin, the run is skipped to the next day
+	schedule, err := ParseSchedule("30 2 * * *", location)
+	if err != nil {
+		t.Fatal(err)
+	}
+	from := time.Date(2021, time.March, 27, 12, 0, 0, 0, location)
+	expected := time.Date(2021, time.March, 29, 2, 30, 0, 0, location)
+	if next := schedule.Next(from); !next.Equal(expected) {
+		t.Errorf("expected next run at %v, got %v", expected, next)
+	}
+}
+
+func TestParseSchedule_Invalid(t *testing.T) {
+	invalid := []string{
+		"",
+		"* * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"5-1 * * * *",
+		"* * * FOO *",
+		"@every 500ms",
+		"@every abc",
+		"@fortnightly",
+		"0 0 30 2 *",
+		"TZ=Nowhere/Invalid 0 * * * *",
+	}
+
+	for _, expr := range invalid {
+		if _, err := ParseSchedule(expr, time.UTC); err == nil {
+			t.Errorf("expected error for %q", expr)
+		}
+	}
+}
+
+func TestEverySchedule(t *testing.T) {
+	from := time.Date(2021, time.March, 15, 10, 20, 30, 0, time.UTC)
+	next := EverySchedule(time.Minute).Next(from)
+	if expected := from.Add(time.Minute); !next.Equal(expected) {
+		t.Errorf("expected next run at %v, got %v", expected, next)
+	}
+}
+
+func TestConfig_Schedule(t *testing.T) {
+	config := NewDefaultConfig()
+	config.APIServerSettings.BaseURL = "https://cloud.example.com"
+	config.ReconciliationInterval = 60
+	from := time.Date(2021, time.March, 15, 10, 20, 30, 0, time.UTC)
+	schedule, err := config.reconciliationSchedule()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if next := schedule.Next(from); !next.Equal(from.Add(time.Minute)) {
+		t.Errorf("expected schedule of interval without cron expression, got next run at %v", next)
+	}
+
+	config.ReconciliationSchedule = "60 * * * *"
+	if _, err := config.reconciliationSchedule(); err == nil {
+		t.Error("expected error for invalid cron expression")
+	}
+	if err := config.Validate(); err == nil || !strings.Contains(err.Error(), "reconciliation schedule") {
+		t.Errorf("expected validation error for invalid cron expression, got %v", err)
+	}
+
+	config.ReconciliationSchedule = "0 * * * *"
+	config.ScheduleTimezone = "Nowhere/Invalid"
+	if _, err := config.reconciliationSchedule(); err == nil {
+		t.Error("expected error for invalid timezone")
+	}
+}
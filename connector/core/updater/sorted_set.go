@@ -0,0 +1,296 @@
+// Copyright (c) 2021 Acronis International GmbH
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package updater
+
+import (
+	"bufio"
+	"container/heap"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+)
+
+// sortedItemOverhead approximates memory used by a buffered item in addition to its key and value
+const sortedItemOverhead = 64
+
+// sortedSet collects key-value items and iterates them in ascending order of keys with bounded memory usage.
+// Items are buffered in memory up to maxMemory bytes, then sorted and spilled into a temporary file (run).
+// Iteration merges the runs and the buffer. Adding a key again replaces its value.
+type sortedSet struct {
+	dir       string // directory of temporary files, default directory for temporary files if empty
+	maxMemory int
+
+	buffer []sortedItem
+	memory int
+	runs   []*os.File
+}
+
+type sortedItem struct {
+	key   string
+	value []byte
+}
+
+func newSortedSet(dir string, maxMemory int) *sortedSet {
+	return &sortedSet{dir: dir, maxMemory: maxMemory}
+}
+
+// Add adds the item, spilling buffered items to disk if the memory limit is reached
+func (s *sortedSet) Add(key string, value []byte) error {
+	s.buffer = append(s.buffer, sortedItem{key: key, value: value})
+	s.memory += len(key) + len(value) + sortedItemOverhead
+	if s.memory >= s.maxMemory {
+		return s.spill()
+	}
+	return nil
+}
+
+// Reset removes all the items
+func (s *sortedSet) Reset() error {
+	err := s.Close()
+	s.buffer, s.memory, s.runs = nil, 0, nil
+	return err
+}
+
+// Close removes the temporary files
+func (s *sortedSet) Close() error {
+	var firstErr error
+	for _, run := range s.runs {
+		if err := run.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+		if err := os.Remove(run.Name()); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	s.runs = nil
+	return firstErr
+}
+
+// Iterator returns an iterator over the items in ascending order of keys.
+// Items must not be added while iterating, only one iterator can be used at a time.
+func (s *sortedSet) Iterator() (*sortedSetIterator, error) {
+	s.sortBuffer()
+	it := &sortedSetIterator{}
+	for i, run := range s.runs {
+		if _, err := run.Seek(0, io.SeekStart); err != nil {
+			return nil, fmt.Errorf("failed to rewind reconciliation run %v: %w", run.Name(), err)
+		}
+		if err := it.push(&runSource{reader: bufio.NewReader(run), order: i}); err != nil {
+			return nil, err
+		}
+	}
+	if err := it.push(&bufferSource{items: s.buffer, order: len(s.runs)}); err != nil {
+		return nil, err
+	}
+	return it, nil
+}
+
+// sortBuffer sorts the buffered items, keeping only the last added value of duplicate keys
+func (s *sortedSet) sortBuffer() {
+	sort.SliceStable(s.buffer, func(i, j int) bool {
+		return s.buffer[i].key < s.buffer[j].key
+	})
+	unique := s.buffer[:0]
+	for i := range s.buffer {
+		if i+1 < len(s.buffer) && s.buffer[i+1].key == s.buffer[i].key {
+			continue
+		}
+		unique = append(unique, s.buffer[i])
+	}
+	s.buffer = unique
+}
+
+// spill writes the buffered items into a new run
+func (s *sortedSet) spill() error {
+	s.sortBuffer()
+	run, err := ioutil.TempFile(s.dir, "reconciliation-*")
+	if err != nil {
+		return fmt.Errorf("failed to create reconciliation run: %w", err)
+	}
+	s.runs = append(s.runs, run)
+
+	writer := bufio.NewWriter(run)
+	for i := range s.buffer {
+		if err := writeRecord(writer, s.buffer[i]); err != nil {
+			return fmt.Errorf("failed to write reconciliation run %v: %w", run.Name(), err)
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		return fmt.Errorf("failed to write reconciliation run %v: %w", run.Name(), err)
+	}
+
+	s.buffer, s.memory = nil, 0
+	return nil
+}
+
+// writeRecord writes the item as length prefixed key and value
+func writeRecord(writer *bufio.Writer, item sortedItem) error {
+	var size [binary.MaxVarintLen64]byte
+	for _, field := range [][]byte{[]byte(item.key), item.value} {
+		n := binary.PutUvarint(size[:], uint64(len(field)))
+		if _, err := writer.Write(size[:n]); err != nil {
+			return err
+		}
+		if _, err := writer.Write(field); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sortedSource is a sorted sequence of items merged by sortedSetIterator
+type sortedSource interface {
+	// next returns the next item, io.EOF at the end
+	next() (sortedItem, error)
+	// precedence of the source for duplicate keys, items added later take precedence
+	precedence() int
+}
+
+type bufferSource struct {
+	items []sortedItem
+	order int
+}
+
+func (b *bufferSource) next() (sortedItem, error) {
+	if len(b.items) == 0 {
+		return sortedItem{}, io.EOF
+	}
+	item := b.items[0]
+	b.items = b.items[1:]
+	return item, nil
+}
+
+func (b *bufferSource) precedence() int {
+	return b.order
+}
+
+type runSource struct {
+	reader *bufio.Reader
+	order  int
+}
+
+func (r *runSource) next() (sortedItem, error) {
+	key, err := r.readField()
+	if err != nil {
+		return sortedItem{}, err
+	}
+	value, err := r.readField()
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return sortedItem{}, fmt.Errorf("failed to read reconciliation run: %w", err)
+	}
+	return sortedItem{key: string(key), value: value}, nil
+}
+
+func (r *runSource) readField() ([]byte, error) {
+	size, err := binary.ReadUvarint(r.reader)
+	if err != nil {
+		return nil, err
+	}
+	field := make([]byte, size)
+	if _, err := io.ReadFull(r.reader, field); err != nil {
+		return nil, err
+	}
+	return field, nil
+}
+
+func (r *runSource) precedence() int {
+	return r.order
+}
+
+// sortedSetIterator merges sorted sources, returning each key once
+type sortedSetIterator struct {
+	heads sourceHeap
+	item  sortedItem
+	err   error
+}
+
+type sourceHead struct {
+	item   sortedItem
+	source sortedSource
+}
+
+// sourceHeap orders sources by their current key, the source of the highest precedence first for equal keys
+type sourceHeap []sourceHead
+
+func (h sourceHeap) Len() int { return len(h) }
+func (h sourceHeap) Less(i, j int) bool {
+	if h[i].item.key != h[j].item.key {
+		return h[i].item.key < h[j].item.key
+	}
+	return h[i].source.precedence() > h[j].source.precedence()
+}
+func (h sourceHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *sourceHeap) Push(x interface{}) { *h = append(*h, x.(sourceHead)) }
+func (h *sourceHeap) Pop() interface{} {
+	old := *h
+	head := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return head
+}
+
+// push adds the source positioned at its first item, unless it's empty
+func (it *sortedSetIterator) push(source sortedSource) error {
+	item, err := source.next()
+	if err == io.EOF {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	heap.Push(&it.heads, sourceHead{item: item, source: source})
+	return nil
+}
+
+// Next advances to the next key, false at the end or on error
+func (it *sortedSetIterator) Next() bool {
+	if it.err != nil || len(it.heads) == 0 {
+		return false
+	}
+	it.item = it.heads[0].item
+	for len(it.heads) > 0 && it.heads[0].item.key == it.item.key {
+		head := heap.Pop(&it.heads).(sourceHead)
+		if err := it.push(head.source); err != nil {
+			it.err = err
+			return false
+		}
+	}
+	return true
+}
+
+// Key returns the current key
+func (it *sortedSetIterator) Key() string {
+	return it.item.key
+}
+
+// Value returns the value of the current key
+func (it *sortedSetIterator) Value() []byte {
+	return it.item.value
+}
+
+// Err returns the error that stopped the iteration, if any
+func (it *sortedSetIterator) Err() error {
+	return it.err
+}
@@ -0,0 +1,101 @@
+// Copyright (c) 2021 Acronis International GmbH
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package updater
+
+import (
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"testing"
+)
+
+func TestSortedSet_Spill(t *testing.T) {
+	dir := t.TempDir()
+	set := newSortedSet(dir, 1024)
+
+	// keys added in random order, each key twice, the second value wins
+	keys := rand.Perm(200)
+	for round := 1; round <= 2; round++ {
+		for _, key := range keys {
+			if err := set.Add(fmt.Sprintf("key-%03d", key), []byte(fmt.Sprintf("value %v", round))); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		}
+	}
+	if len(set.runs) < 2 {
+		t.Fatalf("expected items spilled to multiple runs, got %v", len(set.runs))
+	}
+
+	it, err := set.Iterator()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	count := 0
+	for it.Next() {
+		if expected := fmt.Sprintf("key-%03d", count); it.Key() != expected {
+			t.Fatalf("expected key %v, got %v", expected, it.Key())
+		}
+		if string(it.Value()) != "value 2" {
+			t.Errorf("expected last added value of %v, got %q", it.Key(), it.Value())
+		}
+		count++
+	}
+	if err := it.Err(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if count != len(keys) {
+		t.Errorf("expected %v keys, got %v", len(keys), count)
+	}
+
+	if err := set.Close(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if files, _ := ioutil.ReadDir(dir); len(files) != 0 {
+		t.Errorf("expected temporary files removed, got %v", len(files))
+	}
+}
+
+func TestSortedSet_Reset(t *testing.T) {
+	set := newSortedSet(t.TempDir(), 100)
+	for i := 0; i < 10; i++ {
+		if err := set.Add(fmt.Sprintf("stale-%v", i), nil); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if err := set.Reset(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := set.Add("fresh", nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer set.Close()
+
+	it, err := set.Iterator()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var keys []string
+	for it.Next() {
+		keys = append(keys, it.Key())
+	}
+	if len(keys) != 1 || keys[0] != "fresh" {
+		t.Errorf("expected only the key added after reset, got %v", keys)
+	}
+}
@@ -0,0 +1,382 @@
+// Copyright (c) 2021 Acronis International GmbH
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package updater
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/acronis/acronis-cyber-cloud-go-sample-connector/connector/accclient"
+	"github.com/acronis/acronis-cyber-cloud-go-sample-connector/connector/core"
+	"github.com/acronis/acronis-cyber-cloud-go-sample-connector/connector/logs"
+)
+
+// Kinds of entities recorded in StateStore
+const (
+	EntityTenant       = core.EntityTenant
+	EntityOfferingItem = core.EntityOfferingItem
+	EntityUser         = core.EntityUser
+	EntityAccessPolicy = core.EntityAccessPolicy
+)
+
+// EntityState is the state of an entity last pushed successfully to external system
+type EntityState struct {
+	Version int64  `json:"version"` // version of the entity on Acronis cloud, 0 for entities without version
+	Hash    uint64 `json:"hash"`    // hash of the content of the entity
+}
+
+// StateStore records the state of entities last pushed successfully to external system,
+// so that reconciliation and sync loop skip pushing entities which are not changed since then.
+// Entities are identified by kind (EntityTenant, EntityOfferingItem, EntityUser or EntityAccessPolicy) and ID.
+// Implementations must be safe for concurrent use.
+type StateStore interface {
+	// Get returns the recorded state of the entity, false if there is no state recorded
+	Get(kind, id string) (EntityState, bool, error)
+
+	// Put records the state of the entity
+	Put(kind, id string, state EntityState) error
+
+	// Delete removes the recorded state of the entity, it's not an error if there is no state recorded
+	Delete(kind, id string) error
+}
+
+// stateKey identifies an entity in memory of state stores
+type stateKey struct {
+	kind string
+	id   string
+}
+
+// MemoryStateStore is a StateStore which keeps the states in memory, they are lost on restart of connector
+type MemoryStateStore struct {
+	mu     sync.RWMutex
+	states map[stateKey]EntityState
+}
+
+// NewMemoryStateStore returns an empty MemoryStateStore
+func NewMemoryStateStore() *MemoryStateStore {
+	return &MemoryStateStore{states: make(map[stateKey]EntityState)}
+}
+
+// Get returns the recorded state of the entity
+func (s *MemoryStateStore) Get(kind, id string) (EntityState, bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	state, ok := s.states[stateKey{kind: kind, id: id}]
+	return state, ok, nil
+}
+
+// Put records the state of the entity
+func (s *MemoryStateStore) Put(kind, id string, state EntityState) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.states[stateKey{kind: kind, id: id}] = state
+	return nil
+}
+
+// Delete removes the recorded state of the entity
+func (s *MemoryStateStore) Delete(kind, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.states, stateKey{kind: kind, id: id})
+	return nil
+}
+
+// stateRecord is a line of the file of FileStateStore, a state without Hash removes the state of the entity
+type stateRecord struct {
+	Kind    string `json:"kind"`
+	ID      string `json:"id"`
+	Version int64  `json:"version,omitempty"`
+	Hash    uint64 `json:"hash,omitempty"`
+}
+
+// defaultCompactRecords is the number of records appended to the file of FileStateStore beyond which
+// it's compacted, once they also outnumber the states
+const defaultCompactRecords = 10000
+
+// FileStateStore is a StateStore which keeps the states in memory and appends the changes to a file,
+// so that they survive restarts of connector. The file is compacted when the store is opened,
+// and when the records appended since then outnumber the states.
+type FileStateStore struct {
+	memory *MemoryStateStore
+
+	mu             sync.Mutex
+	path           string
+	file           *os.File // nil once the store is closed
+	writer         *bufio.Writer
+	appended       int // records appended since the file was last compacted
+	compactRecords int
+}
+
+// OpenFileStateStore loads the states from the file at path, creating the file if it doesn't exist.
+// Only a single process may open the file, use LoadStateFile to read it while connector is running.
+func OpenFileStateStore(path string) (*FileStateStore, error) {
+	s := &FileStateStore{memory: NewMemoryStateStore(), path: path, compactRecords: defaultCompactRecords}
+	if err := loadStateFile(path, s.memory); err != nil {
+		return nil, err
+	}
+	if err := s.compact(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Get returns the recorded state of the entity
+func (s *FileStateStore) Get(kind, id string) (EntityState, bool, error) {
+	return s.memory.Get(kind, id)
+}
+
+// Put records the state of the entity
+func (s *FileStateStore) Put(kind, id string, state EntityState) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.append(stateRecord{Kind: kind, ID: id, Version: state.Version, Hash: state.Hash}); err != nil {
+		return err
+	}
+	_ = s.memory.Put(kind, id, state)
+	return s.compactIfGrown()
+}
+
+// Delete removes the recorded state of the entity
+func (s *FileStateStore) Delete(kind, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok, _ := s.memory.Get(kind, id); !ok {
+		return nil
+	}
+	if err := s.append(stateRecord{Kind: kind, ID: id}); err != nil {
+		return err
+	}
+	_ = s.memory.Delete(kind, id)
+	return s.compactIfGrown()
+}
+
+// Close flushes the changes and closes the file, the states can't be changed afterwards
+func (s *FileStateStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.file == nil {
+		return nil
+	}
+	file := s.file
+	s.file = nil
+	if err := s.writer.Flush(); err != nil {
+		_ = file.Close()
+		return fmt.Errorf("failed to write state file %v: %w", s.path, err)
+	}
+	return file.Close()
+}
+
+// append writes the record to the file, s.mu must be held
+func (s *FileStateStore) append(record stateRecord) error {
+	if s.file == nil {
+		return fmt.Errorf("state file %v is closed", s.path)
+	}
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	if _, err := s.writer.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write state file %v: %w", s.path, err)
+	}
+	// written to the OS on each change, so that states are not lost if connector is killed
+	if err := s.writer.Flush(); err != nil {
+		return fmt.Errorf("failed to write state file %v: %w", s.path, err)
+	}
+	return nil
+}
+
+// LoadStateFile returns MemoryStateStore with the states of the file of FileStateStore at path, leaving the file
+// untouched, e.g. for one-shot commands run alongside connector which owns the file. States recorded by the store
+// are not written to the file.
+func LoadStateFile(path string) (*MemoryStateStore, error) {
+	memory := NewMemoryStateStore()
+	if err := loadStateFile(path, memory); err != nil {
+		return nil, err
+	}
+	return memory, nil
+}
+
+// loadStateFile applies the records of the file to memory, a partially written last line is ignored
+func loadStateFile(path string, memory *MemoryStateStore) error {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to open state file %v: %w", path, err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var record stateRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			continue
+		}
+		if record.Hash == 0 {
+			_ = memory.Delete(record.Kind, record.ID)
+		} else {
+			_ = memory.Put(record.Kind, record.ID, EntityState{Version: record.Version, Hash: record.Hash})
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read state file %v: %w", path, err)
+	}
+	return nil
+}
+
+// compactIfGrown compacts the file once enough records are appended to it, s.mu must be held
+func (s *FileStateStore) compactIfGrown() error {
+	s.appended++
+	s.memory.mu.RLock()
+	states := len(s.memory.states)
+	s.memory.mu.RUnlock()
+	if s.appended < s.compactRecords || s.appended < states {
+		return nil
+	}
+	return s.compact()
+}
+
+// compact rewrites the file with the current states only and opens it for appending, s.mu must be held
+// unless the store is being opened
+func (s *FileStateStore) compact() error {
+	temp, err := ioutil.TempFile(filepath.Dir(s.path), filepath.Base(s.path)+".*")
+	if err != nil {
+		return fmt.Errorf("failed to compact state file %v: %w", s.path, err)
+	}
+	defer os.Remove(temp.Name()) // no-op after rename
+
+	writer := bufio.NewWriter(temp)
+	encoder := json.NewEncoder(writer)
+	s.memory.mu.RLock()
+	for key, state := range s.memory.states {
+		if err := encoder.Encode(stateRecord{Kind: key.kind, ID: key.id, Version: state.Version, Hash: state.Hash}); err != nil {
+			s.memory.mu.RUnlock()
+			_ = temp.Close()
+			return fmt.Errorf("failed to compact state file %v: %w", s.path, err)
+		}
+	}
+	s.memory.mu.RUnlock()
+	if err := writer.Flush(); err != nil {
+		_ = temp.Close()
+		return fmt.Errorf("failed to compact state file %v: %w", s.path, err)
+	}
+	if err := temp.Close(); err != nil {
+		return fmt.Errorf("failed to compact state file %v: %w", s.path, err)
+	}
+	if err := os.Rename(temp.Name(), s.path); err != nil {
+		return fmt.Errorf("failed to compact state file %v: %w", s.path, err)
+	}
+
+	file, err := os.OpenFile(s.path, os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open state file %v: %w", s.path, err)
+	}
+	// records appended to the replaced file are already flushed and included in the compacted one
+	if s.file != nil {
+		_ = s.file.Close()
+	}
+	s.file, s.writer, s.appended = file, bufio.NewWriter(file), 0
+	return nil
+}
+
+// pushFilter suppresses pushes of entities which are not changed since they were last pushed successfully.
+// nil pushFilter pushes all entities.
+type pushFilter struct {
+	store StateStore
+	force bool // push all entities, still recording their states
+}
+
+// changed returns the state of the entity and whether it differs from the state recorded on the last push.
+// Errors of the state store are logged and the entity is treated as changed.
+func (f *pushFilter) changed(logger logs.Logger, kind, id string, version int64, entity interface{}) (EntityState, bool) {
+	if f == nil {
+		return EntityState{}, true
+	}
+
+	content, err := json.Marshal(entity)
+	if err != nil {
+		logger.Warnf("Failed to hash %v %v: %v", kind, id, err)
+		return EntityState{}, true
+	}
+	hash := fnv.New64a()
+	_, _ = hash.Write(content)
+	state := EntityState{Version: version, Hash: hash.Sum64()}
+	if state.Hash == 0 {
+		state.Hash = 1 // zero hash removes states in FileStateStore
+	}
+
+	if f.force {
+		return state, true
+	}
+	recorded, ok, err := f.store.Get(kind, id)
+	if err != nil {
+		logger.Warnf("Failed to get state of %v %v: %v", kind, id, err)
+		return state, true
+	}
+	return state, !ok || recorded != state
+}
+
+// pushed records the state of the entity pushed successfully
+func (f *pushFilter) pushed(logger logs.Logger, kind, id string, state EntityState) {
+	if f == nil {
+		return
+	}
+	if err := f.store.Put(kind, id, state); err != nil {
+		logger.Warnf("Failed to record state of %v %v: %v", kind, id, err)
+	}
+}
+
+// forget removes the recorded state of the entity, e.g. when it's deleted from external system
+func (f *pushFilter) forget(logger logs.Logger, kind, id string) {
+	if f == nil {
+		return
+	}
+	if err := f.store.Delete(kind, id); err != nil {
+		logger.Warnf("Failed to remove state of %v %v: %v", kind, id, err)
+	}
+}
+
+// tenantContent returns the tenant without embedded offering items, which are pushed separately
+func tenantContent(tenant *accclient.Tenant) accclient.Tenant {
+	content := *tenant
+	content.OfferingItems = nil
+	return content
+}
+
+// userContent returns the user without embedded access policies, which are pushed separately
+func userContent(user *accclient.User) accclient.User {
+	content := *user
+	content.AccessPolicies = nil
+	return content
+}
+
+// offeringItemStateID returns the ID of the offering item in StateStore
+func offeringItemStateID(item *accclient.OfferingItem) string {
+	return offeringItemKey(core.OfferingItemID{OfferingItemName: item.Name, TenantID: item.TenantID})
+}
@@ -0,0 +1,181 @@
+// Copyright (c) 2021 Acronis International GmbH
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package updater
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/acronis/acronis-cyber-cloud-go-sample-connector/connector/accclient"
+	"github.com/acronis/acronis-cyber-cloud-go-sample-connector/connector/logs"
+)
+
+func TestFileStateStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state")
+	store, err := OpenFileStateStore(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, id := range []string{"t1", "t2"} {
+		if err := store.Put(EntityTenant, id, EntityState{Version: 1, Hash: 10}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if err := store.Put(EntityTenant, "t1", EntityState{Version: 2, Hash: 20}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := store.Delete(EntityTenant, "t2"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := store.Close(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// partially written record of a killed connector is ignored
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := file.WriteString(`{"kind":"tenant","id":"t3","ver`); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	_ = file.Close()
+
+	store, err = OpenFileStateStore(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer store.Close()
+	if state, ok, _ := store.Get(EntityTenant, "t1"); !ok || state != (EntityState{Version: 2, Hash: 20}) {
+		t.Errorf("expected last recorded state of t1, got %+v", state)
+	}
+	for _, id := range []string{"t2", "t3"} {
+		if _, ok, _ := store.Get(EntityTenant, id); ok {
+			t.Errorf("expected no state of %v", id)
+		}
+	}
+	if _, ok, _ := store.Get(EntityUser, "t1"); ok {
+		t.Errorf("expected states of different kinds to be separate")
+	}
+}
+
+func TestLoadStateFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state")
+	store, err := OpenFileStateStore(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer store.Close()
+	if err := store.Put(EntityTenant, "t1", EntityState{Version: 1, Hash: 10}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// loaded by a one-shot command while connector keeps appending to the file
+	loaded, err := LoadStateFile(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if state, ok, _ := loaded.Get(EntityTenant, "t1"); !ok || state != (EntityState{Version: 1, Hash: 10}) {
+		t.Errorf("expected recorded state of t1, got %+v", state)
+	}
+	if err := loaded.Put(EntityTenant, "t2", EntityState{Version: 1, Hash: 20}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := store.Put(EntityTenant, "t3", EntityState{Version: 1, Hash: 30}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	reloaded, err := LoadStateFile(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok, _ := reloaded.Get(EntityTenant, "t2"); ok {
+		t.Errorf("expected state recorded by loaded store not to be written to the file")
+	}
+	if _, ok, _ := reloaded.Get(EntityTenant, "t3"); !ok {
+		t.Errorf("expected state recorded by connector after loading to be kept in the file")
+	}
+}
+
+func TestPushFilter(t *testing.T) {
+	logger := logs.GetDefaultLogger(context.Background())
+	filter := &pushFilter{store: NewMemoryStateStore()}
+	tenant := &accclient.Tenant{ID: "t1", Version: 1, Name: "customer"}
+
+	state, changed := filter.changed(logger, EntityTenant, tenant.ID, tenant.Version, tenant)
+	if !changed {
+		t.Fatalf("expected tenant never pushed to be changed")
+	}
+	filter.pushed(logger, EntityTenant, tenant.ID, state)
+	if _, changed := filter.changed(logger, EntityTenant, tenant.ID, tenant.Version, tenant); changed {
+		t.Errorf("expected pushed tenant not to be changed")
+	}
+
+	tenant.Name = "renamed"
+	if _, changed := filter.changed(logger, EntityTenant, tenant.ID, tenant.Version, tenant); !changed {
+		t.Errorf("expected tenant with different content to be changed")
+	}
+
+	filter.force = true
+	tenant.Name = "customer"
+	if _, changed := filter.changed(logger, EntityTenant, tenant.ID, tenant.Version, tenant); !changed {
+		t.Errorf("expected all entities to be changed with force full push")
+	}
+}
+
+func TestFileStateStore_Compact(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state")
+	store, err := OpenFileStateStore(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	store.compactRecords = 4
+	for version := int64(1); version <= 5; version++ {
+		if err := store.Put(EntityTenant, "t1", EntityState{Version: version, Hash: 10}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if err := store.Close(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := store.Put(EntityTenant, "t2", EntityState{Version: 1, Hash: 20}); err == nil {
+		t.Error("expected error recording state in closed store")
+	}
+
+	// compacted after the 4th record, the 5th one is appended to the compacted file
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if lines := strings.Count(string(content), "\n"); lines != 2 {
+		t.Errorf("expected 2 records in compacted file, got %v", lines)
+	}
+	loaded, err := LoadStateFile(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if state, ok, _ := loaded.Get(EntityTenant, "t1"); !ok || state.Version != 5 {
+		t.Errorf("expected last recorded state of t1, got %+v", state)
+	}
+}
@@ -36,7 +36,13 @@ type SyncLoopImpl struct {
 	extClient core.ExternalSystemClient
 
 	// optional to be set during initialization
-	updateInterval uint // in seconds
+	updateInterval uint           // in seconds, fixed delay between cycles of loops without polling bounds
+	tenantsPolling *pollingBounds // adaptive delay between cycles of tenants and offering items update loop
+	usersPolling   *pollingBounds // adaptive delay between cycles of users and access policies update loop
+	rateLimitHint  *accclient.RateLimitHint
+	clock          Clock
+	filter         *pushFilter
+	deletions      *PendingDeletions
 
 	// last response time from Acronis cloud for tenants and offering items update loop
 	tenantsLoopUpdatedSince *time.Time
@@ -56,6 +62,7 @@ func NewSyncLoop(
 		tenantID:       tenantID,
 		extClient:      extClient,
 		updateInterval: 5, // default
+		clock:          RealClock(),
 	}
 
 	for _, option := range options {
@@ -71,6 +78,60 @@ func WithUpdateInterval(updateInterval uint) func(*SyncLoopImpl) {
 	}
 }
 
+// pollingBounds are the minimum and maximum delays between cycles of an update loop, in seconds
+type pollingBounds struct {
+	minInterval uint
+	maxInterval uint
+}
+
+// WithTenantsPolling is an optional init function to adapt the delay between cycles of tenants and offering items
+// update loop between minInterval and maxInterval seconds, instead of the fixed update interval
+func WithTenantsPolling(minInterval, maxInterval uint) func(*SyncLoopImpl) {
+	return func(loop *SyncLoopImpl) {
+		loop.tenantsPolling = &pollingBounds{minInterval: minInterval, maxInterval: maxInterval}
+	}
+}
+
+// WithUsersPolling is an optional init function to adapt the delay between cycles of users and access policies
+// update loop between minInterval and maxInterval seconds, instead of the fixed update interval
+func WithUsersPolling(minInterval, maxInterval uint) func(*SyncLoopImpl) {
+	return func(loop *SyncLoopImpl) {
+		loop.usersPolling = &pollingBounds{minInterval: minInterval, maxInterval: maxInterval}
+	}
+}
+
+// WithSyncRateLimitHint is an optional init function to delay cycles of update loops as requested by rate limit
+// headers of Acronis Cyber Cloud responses, the hint must be fed by the middleware of accClient
+func WithSyncRateLimitHint(hint *accclient.RateLimitHint) func(*SyncLoopImpl) {
+	return func(loop *SyncLoopImpl) {
+		loop.rateLimitHint = hint
+	}
+}
+
+// WithSyncClock is an optional init function to set the clock used for waiting between updates
+func WithSyncClock(clock Clock) func(*SyncLoopImpl) {
+	return func(loop *SyncLoopImpl) {
+		loop.clock = clock
+	}
+}
+
+// WithSyncStateStore is an optional init function to skip pushing entities which are not changed since they were
+// last pushed according to the store, e.g. reported again after a failed cycle. forceFullPush pushes all the entities,
+// still recording their states.
+func WithSyncStateStore(store StateStore, forceFullPush bool) func(*SyncLoopImpl) {
+	return func(loop *SyncLoopImpl) {
+		loop.filter = &pushFilter{store: store, force: forceFullPush}
+	}
+}
+
+// WithSyncPendingDeletions is an optional init function to delay deletions of entities from external system
+// by their grace period
+func WithSyncPendingDeletions(deletions *PendingDeletions) func(*SyncLoopImpl) {
+	return func(loop *SyncLoopImpl) {
+		loop.deletions = deletions
+	}
+}
+
 // UpdateTenantsAndOfferingItems syncs Tenants and Offering Items changes from
 // Acronis Cyber Cloud Platform to external-system
 // 1. Pulls tenants and offering items changes with updated_since filter
@@ -91,7 +152,10 @@ func (loop *SyncLoopImpl) UpdateTenantsAndOfferingItems(firstUpdatedSince time.T
 	limit := uint(100)
 	withContacts := true
 	withOfferingItems := true
-	for ; ; time.Sleep(time.Second * time.Duration(loop.updateInterval)) {
+	poller := loop.newPoller(loop.tenantsPolling)
+	for delay := time.Duration(0); ; sleepBetweenCycles(loop.clock, delay) {
+		loop.deletions.sweep(logger, EntityTenant, EntityOfferingItem)
+
 		tenantsRequest := &accclient.TenantGetRequest{
 			SubTreeRootID:     loop.tenantID,
 			Limit:             &limit,
@@ -101,37 +165,36 @@ func (loop *SyncLoopImpl) UpdateTenantsAndOfferingItems(firstUpdatedSince time.T
 			UpdatedSince:      loop.tenantsLoopUpdatedSince,
 		}
 
-		tenantsResp, err := loop.accClient.GetTenants(ctx, tenantsRequest)
-		if err != nil {
+		syncedTenantsCount, syncedOfferingItemsCount := 0, uint(0)
+		var lastPage accclient.PageInfo
+		tenants := loop.accClient.NewTenantIterator(tenantsRequest).OnPage(func(page accclient.PageInfo) error {
+			lastPage = page
+			return nil
+		})
+		for tenants.Next(ctx) {
+			syncedTenantsCount++
+			syncedOfferingItemsCount += uint(len(tenants.Item().OfferingItems))
+			// failures are logged and treated as non-fatal, the tenant is pushed again by reconciliation
+			_ = loop.processTenantAndOfferingItemsChanges(ctx, tenants.Item())
+		}
+
+		if err := tenants.Err(); err != nil {
+			// keep the previous updated_since, so that the changes are pulled again on next cycle
 			logger.Warnf("Failed to get tenants: %v", err)
+			delay = poller.failed()
 			continue
 		}
 
-		loop.tenantsLoopUpdatedSince = &tenantsResp.Timestamp.Time
-
-		syncedTenantsCount := len(tenantsResp.Items)
-		syncedOfferingItemsCount := countOfferingItemsInTenants(tenantsResp.Items)
-		loop.processTenantsAndOfferingItemsChanges(ctx, tenantsResp.Items)
-
-		for tenantsResp != nil && tenantsResp.After() != "" {
-			tenantsResp, err = loop.accClient.GetTenantsNextPage(ctx, tenantsResp)
-			if err != nil {
-				logger.Warnf("Failed to get tenants next page: %v", err)
-				break
-			}
-
-			if tenantsResp != nil {
-				syncedTenantsCount += len(tenantsResp.Items)
-				syncedOfferingItemsCount += countOfferingItemsInTenants(tenantsResp.Items)
-				loop.processTenantsAndOfferingItemsChanges(ctx, tenantsResp.Items)
-			}
-		}
+		// advance updated_since only after all pages have been processed
+		timestamp := tenants.Timestamp()
+		loop.tenantsLoopUpdatedSince = &timestamp
 
 		if syncedTenantsCount > 0 {
 			logger.Infof("Synced %v tenants and %v offering items", syncedTenantsCount, syncedOfferingItemsCount)
 		} else {
 			logger.Debug("Update loop succeed, no tenants changes reported")
 		}
+		delay = poller.succeeded(syncedTenantsCount, lastPage, int(limit))
 	}
 }
 
@@ -154,7 +217,10 @@ func (loop *SyncLoopImpl) UpdateUsersAndAccessPolicies(firstUpdatedSince time.Ti
 
 	limit := uint(100)
 	withAccessPolicies := true
-	for ; ; time.Sleep(time.Second * time.Duration(loop.updateInterval)) {
+	poller := loop.newPoller(loop.usersPolling)
+	for delay := time.Duration(0); ; sleepBetweenCycles(loop.clock, delay) {
+		loop.deletions.sweep(logger, EntityUser, EntityAccessPolicy)
+
 		usersRequest := &accclient.UserGetRequest{
 			SubTreeRootTenantID: loop.tenantID,
 			Limit:               &limit,
@@ -163,37 +229,36 @@ func (loop *SyncLoopImpl) UpdateUsersAndAccessPolicies(firstUpdatedSince time.Ti
 			UpdatedSince:        loop.usersLoopUpdatedSince,
 		}
 
-		usersResp, err := loop.accClient.GetUsers(ctx, usersRequest)
-		if err != nil {
+		syncedUsersCount, syncedAccessPoliciesCount := 0, uint(0)
+		var lastPage accclient.PageInfo
+		users := loop.accClient.NewUserIterator(usersRequest).OnPage(func(page accclient.PageInfo) error {
+			lastPage = page
+			return nil
+		})
+		for users.Next(ctx) {
+			syncedUsersCount++
+			syncedAccessPoliciesCount += uint(len(users.Item().AccessPolicies))
+			// failures are logged and treated as non-fatal, the user is pushed again by reconciliation
+			_ = loop.processUserAndAccessPoliciesChanges(ctx, users.Item())
+		}
+
+		if err := users.Err(); err != nil {
+			// keep the previous updated_since, so that the changes are pulled again on next cycle
 			logger.Warnf("Failed to get users: %v", err)
+			delay = poller.failed()
 			continue
 		}
 
-		loop.usersLoopUpdatedSince = &usersResp.Timestamp
-
-		syncedUsersCount := len(usersResp.Items)
-		syncedAccessPoliciesCount := countAccessPoliciesInUsers(usersResp.Items)
-		loop.processUsersAndAccessPoliciesChanges(ctx, usersResp.Items)
-
-		for usersResp != nil && usersResp.After() != "" {
-			usersResp, err = loop.accClient.GetUsersNextPage(ctx, usersResp)
-			if err != nil {
-				logger.Warnf("Failed to get users next page: %v", err)
-				break
-			}
-
-			if usersResp != nil {
-				syncedUsersCount += len(usersResp.Items)
-				syncedAccessPoliciesCount += countAccessPoliciesInUsers(usersResp.Items)
-				loop.processUsersAndAccessPoliciesChanges(ctx, usersResp.Items)
-			}
-		}
+		// advance updated_since only after all pages have been processed
+		timestamp := users.Timestamp()
+		loop.usersLoopUpdatedSince = &timestamp
 
 		if syncedUsersCount > 0 {
 			logger.Infof("Synced %v users and %v access policies", syncedUsersCount, syncedAccessPoliciesCount)
 		} else {
 			logger.Debug("Update loop succeed, no users changes reported")
 		}
+		delay = poller.succeeded(syncedUsersCount, lastPage, int(limit))
 	}
 }
 
@@ -201,120 +266,171 @@ func (loop *SyncLoopImpl) UpdateUsersAndAccessPolicies(firstUpdatedSince time.Ti
 // helper functions
 // ===================
 
-// processTenantsAndOfferingItemsChanges processes changes reported by composite API of tenants and offering items.
-func (loop *SyncLoopImpl) processTenantsAndOfferingItemsChanges(ctx context.Context, items []accclient.Tenant) {
+// newPoller returns the poller of an update loop with the polling bounds, fixed update interval if bounds are not set
+func (loop *SyncLoopImpl) newPoller(bounds *pollingBounds) *adaptivePoller {
+	if bounds == nil {
+		bounds = &pollingBounds{minInterval: loop.updateInterval, maxInterval: loop.updateInterval}
+	}
+	return newAdaptivePoller(time.Second*time.Duration(bounds.minInterval), time.Second*time.Duration(bounds.maxInterval),
+		loop.rateLimitHint)
+}
+
+// processTenantAndOfferingItemsChanges processes a change reported by composite API of tenants and offering items.
+// It returns the first error of pushing the tenant and its offering items, the others are pushed anyway.
+func (loop *SyncLoopImpl) processTenantAndOfferingItemsChanges(ctx context.Context, item *accclient.Tenant) error {
 	logger := logs.GetDefaultLogger(ctx)
 
-	for i := range items {
-		deleteTenantID := ""
-		if items[i].ID != "" {
-			if items[i].DeletedAt.IsZero() {
-				if err := createOrUpdateTenant(ctx, loop.extClient, loop.accClient, &items[i]); err != nil {
-					// error is treated as non-fatal, skip and continue to next tenant
-					logger.Warnf("Failed to update tenant %v: %s", items[i].ID, err)
-				}
+	var tenantErr, deleteErr error
+	deleteTenantID := ""
+	if item.ID != "" {
+		if item.DeletedAt.IsZero() {
+			loop.deletions.cancel(logger, EntityTenant, item.ID)
+			if state, changed := loop.filter.changed(logger, EntityTenant, item.ID, item.Version, tenantContent(item)); !changed {
+				logger.Debugf("Tenant %v is not changed, skipped", item.ID)
+			} else if tenantErr = createOrUpdateTenant(
+				ctx, loop.extClient, loop.accClient, loop.filter, nil, loop.tenantID, item); tenantErr != nil {
+				// error is treated as non-fatal, skip and continue to next tenant
+				logger.Warnf("Failed to update tenant %v: %s", item.ID, tenantErr)
 			} else {
-				deleteTenantID = items[i].ID
+				loop.filter.pushed(logger, EntityTenant, item.ID, state)
 			}
-		} else if len(items[i].OfferingItems) > 0 {
-			deleteTenantID = items[i].OfferingItems[0].TenantID
+		} else {
+			deleteTenantID = item.ID
 		}
+	} else if len(item.OfferingItems) > 0 {
+		deleteTenantID = item.OfferingItems[0].TenantID
+	}
 
-		loop.processOfferingItemsChanges(ctx, items[i].OfferingItems)
+	itemsErr := loop.processOfferingItemsChanges(ctx, item.OfferingItems)
 
-		// perform tenant deletion after processing offering items
-		if deleteTenantID != "" {
-			if err := loop.extClient.DeleteTenant(deleteTenantID); err != nil {
-				logger.Warnf("Failed to push tenant deletion to external system: %v", err)
+	// perform tenant deletion after processing offering items
+	if deleteTenantID != "" {
+		loop.deletions.delete(logger, core.PendingDeletion{Kind: EntityTenant, ID: deleteTenantID}, func() error {
+			if deleteErr = loop.extClient.DeleteTenant(deleteTenantID); deleteErr != nil {
+				logger.Warnf("Failed to push tenant deletion to external system: %v", deleteErr)
+				return deleteErr
 			}
-		}
+			loop.filter.forget(logger, EntityTenant, deleteTenantID)
+			return nil
+		})
 	}
+	return firstError(tenantErr, itemsErr, deleteErr)
 }
 
-// processOfferingItemsChanges pushes offering items change events to external system
-func (loop *SyncLoopImpl) processOfferingItemsChanges(ctx context.Context, items []accclient.OfferingItem) {
+// processOfferingItemsChanges pushes offering items change events to external system, returning the first error
+func (loop *SyncLoopImpl) processOfferingItemsChanges(ctx context.Context, items []accclient.OfferingItem) error {
 	logger := logs.GetDefaultLogger(ctx)
+	var failure error
 	for i := range items {
+		stateID := offeringItemStateID(&items[i])
 		if items[i].Status == 0 {
-			if err := loop.extClient.DeleteOfferingItem(core.OfferingItemID{
-				OfferingItemName: items[i].Name,
-				TenantID:         items[i].TenantID,
-			}); err != nil {
-				logger.Warnf("Failed to delete offering item %v for tenant %v: %v", items[i].Name, items[i].TenantID, err)
-			}
+			itemID := core.OfferingItemID{OfferingItemName: items[i].Name, TenantID: items[i].TenantID}
+			loop.deletions.delete(logger, core.PendingDeletion{Kind: EntityOfferingItem, OfferingItemID: itemID}, func() error {
+				if err := loop.extClient.DeleteOfferingItem(itemID); err != nil {
+					logger.Warnf("Failed to delete offering item %v for tenant %v: %v",
+						itemID.OfferingItemName, itemID.TenantID, err)
+					failure = firstError(failure, err)
+					return err
+				}
+				loop.filter.forget(logger, EntityOfferingItem, stateID)
+				return nil
+			})
+			continue
+		}
+
+		loop.deletions.cancel(logger, EntityOfferingItem, stateID)
+		if state, changed := loop.filter.changed(logger, EntityOfferingItem, stateID, 0, &items[i]); !changed {
+			logger.Debugf("Offering item %v for tenant %v is not changed, skipped", items[i].Name, items[i].TenantID)
 		} else {
 			if oiCreated, err := loop.extClient.CreateOrUpdateOfferingItem(&items[i]); err != nil {
 				logger.Warnf("Failed to upsert offering item %v for tenant %v into external-system: %v",
 					items[i].Name, items[i].TenantID, err)
+				failure = firstError(failure, err)
 			} else {
 				logger.Debugf("Offering item %v for tenant %v successfully updated (is new offering item: %v)",
 					items[i].Name, items[i].TenantID, oiCreated)
+				loop.filter.pushed(logger, EntityOfferingItem, stateID, state)
 			}
 		}
 	}
+	return failure
 }
 
-// processUsersAndAccessPoliciesChanges processes changes reported by composite API of users and access policies
-func (loop *SyncLoopImpl) processUsersAndAccessPoliciesChanges(ctx context.Context, items []accclient.User) {
+// processUserAndAccessPoliciesChanges processes a change reported by composite API of users and access policies.
+// It returns the first error of pushing the user and its access policies, the others are pushed anyway.
+func (loop *SyncLoopImpl) processUserAndAccessPoliciesChanges(ctx context.Context, item *accclient.User) error {
 	logger := logs.GetDefaultLogger(ctx)
 
-	for i := range items {
-		deleteUserID := ""
-		// ID field exists if user has active access policies
-		if items[i].ID != "" {
-			if items[i].DeletedAt.IsZero() {
-				if err := createOrUpdateUser(ctx, loop.extClient, loop.accClient, &items[i]); err != nil {
-					// error is treated as non-fatal, skip and continue to next user
-					logger.Warnf("Failed to update user %v: %s", items[i].ID, err)
-				}
+	var userErr, deleteErr error
+	deleteUserID := ""
+	// ID field exists if user has active access policies
+	if item.ID != "" {
+		if item.DeletedAt.IsZero() {
+			loop.deletions.cancel(logger, EntityUser, item.ID)
+			if state, changed := loop.filter.changed(logger, EntityUser, item.ID, int64(item.Version), userContent(item)); !changed {
+				logger.Debugf("User %v is not changed, skipped", item.ID)
+			} else if userErr = createOrUpdateUser(ctx, loop.extClient, loop.accClient, loop.filter, nil, loop.tenantID, item); userErr != nil {
+				// error is treated as non-fatal, skip and continue to next user
+				logger.Warnf("Failed to update user %v: %s", item.ID, userErr)
 			} else {
-				deleteUserID = items[i].ID
+				loop.filter.pushed(logger, EntityUser, item.ID, state)
 			}
-		} else if len(items[i].AccessPolicies) > 0 {
-			deleteUserID = items[i].AccessPolicies[0].TrusteeID
+		} else {
+			deleteUserID = item.ID
 		}
+	} else if len(item.AccessPolicies) > 0 {
+		deleteUserID = item.AccessPolicies[0].TrusteeID
+	}
 
-		loop.processAccessPoliciesChanges(ctx, items[i].AccessPolicies)
+	policiesErr := loop.processAccessPoliciesChanges(ctx, item.AccessPolicies)
 
-		// perform user deletion after processing access policies
-		if deleteUserID != "" {
-			if err := loop.extClient.DeleteUser(deleteUserID); err != nil {
-				logger.Warnf("Failed to push user deletion to external system: %v", err)
+	// perform user deletion after processing access policies
+	if deleteUserID != "" {
+		loop.deletions.delete(logger, core.PendingDeletion{Kind: EntityUser, ID: deleteUserID}, func() error {
+			if deleteErr = loop.extClient.DeleteUser(deleteUserID); deleteErr != nil {
+				logger.Warnf("Failed to push user deletion to external system: %v", deleteErr)
+				return deleteErr
 			}
-		}
+			loop.filter.forget(logger, EntityUser, deleteUserID)
+			return nil
+		})
 	}
+	return firstError(userErr, policiesErr, deleteErr)
 }
 
-// processAccessPoliciesChanges pushes access policies change events to external system
-func (loop *SyncLoopImpl) processAccessPoliciesChanges(ctx context.Context, items []accclient.AccessPolicy) {
+// processAccessPoliciesChanges pushes access policies change events to external system, returning the first error
+func (loop *SyncLoopImpl) processAccessPoliciesChanges(ctx context.Context, items []accclient.AccessPolicy) error {
 	logger := logs.GetDefaultLogger(ctx)
+	var failure error
 	for i := range items {
 		if items[i].DeletedAt != nil {
-			if err := loop.extClient.DeleteAccessPolicy(items[i].ID); err != nil {
-				logger.Warnf("Failed to delete access policy: %v", err)
-			}
+			policyID := items[i].ID
+			loop.deletions.delete(logger, core.PendingDeletion{Kind: EntityAccessPolicy, ID: policyID}, func() error {
+				if err := loop.extClient.DeleteAccessPolicy(policyID); err != nil {
+					logger.Warnf("Failed to delete access policy: %v", err)
+					failure = firstError(failure, err)
+					return err
+				}
+				loop.filter.forget(logger, EntityAccessPolicy, policyID)
+				return nil
+			})
+			continue
+		}
+
+		loop.deletions.cancel(logger, EntityAccessPolicy, items[i].ID)
+		if state, changed := loop.filter.changed(logger, EntityAccessPolicy, items[i].ID, items[i].Version, &items[i]); !changed {
+			logger.Debugf("Access policy %v is not changed, skipped", items[i].ID)
 		} else {
 			if apCreated, err := loop.extClient.CreateOrUpdateAccessPolicy(&items[i]); err != nil {
 				logger.Warnf("Failed to upsert access policy %v with ID %v for user %v into external-system: %v",
 					items[i].RoleID, items[i].ID, items[i].TrusteeID, err)
+				failure = firstError(failure, err)
 			} else {
 				logger.Debugf("Access policy %v with ID %v for user %v successfully updated (is new access policy: %v)",
 					items[i].RoleID, items[i].ID, items[i].TrusteeID, apCreated)
+				loop.filter.pushed(logger, EntityAccessPolicy, items[i].ID, state)
 			}
 		}
 	}
-}
-
-func countOfferingItemsInTenants(items []accclient.Tenant) (counter uint) {
-	for i := range items {
-		counter += uint(len(items[i].OfferingItems))
-	}
-	return
-}
-
-func countAccessPoliciesInUsers(items []accclient.User) (counter uint) {
-	for i := range items {
-		counter += uint(len(items[i].AccessPolicies))
-	}
-	return
+	return failure
 }
@@ -0,0 +1,114 @@
+// Copyright (c) 2021 Acronis International GmbH
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package updater
+
+import (
+	"testing"
+	"time"
+
+	"github.com/acronis/acronis-cyber-cloud-go-sample-connector/connector/accclient"
+	"github.com/acronis/acronis-cyber-cloud-go-sample-connector/connector/accclient/acctest"
+)
+
+func TestSyncLoop_UpdateTenantsAndOfferingItems(t *testing.T) {
+	clock := NewFakeClock(time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC))
+	server := acctest.NewServer(acctest.WithClock(clock.Now))
+	defer server.Close()
+
+	ext := newFakeExternalSystem()
+	loop := NewSyncLoop(server.NewClient(), server.RootTenantID, ext,
+		WithUpdateInterval(10), WithSyncClock(clock))
+	go loop.UpdateTenantsAndOfferingItems(clock.Now())
+
+	// first cycle
+	first := server.AddTenant(accclient.Tenant{Name: "first", Kind: "customer", Enabled: true})
+	clock.BlockUntil(1)
+	clock.Advance(10 * time.Second)
+	clock.BlockUntil(1)
+	if _, ok := ext.tenants[first.ID]; !ok {
+		t.Fatalf("expected tenant %v to be synced", first.ID)
+	}
+
+	// second cycle only pulls changes since the first one
+	second := server.AddTenant(accclient.Tenant{Name: "second", Kind: "customer", Enabled: true})
+	if err := server.SetOfferingItems(second.ID, accclient.OfferingItem{ApplicationID: "app", Name: "storage", Status: 1}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	delete(ext.tenants, first.ID)
+	clock.Advance(10 * time.Second)
+	clock.BlockUntil(1)
+	if _, ok := ext.tenants[second.ID]; !ok {
+		t.Errorf("expected tenant %v to be synced", second.ID)
+	}
+	if _, ok := ext.tenants[first.ID]; ok {
+		t.Errorf("expected unchanged tenant %v not to be synced again", first.ID)
+	}
+	if len(ext.offeringItems) != 1 {
+		t.Errorf("expected offering item of tenant %v to be synced, got %v", second.ID, ext.offeringItems)
+	}
+
+	// third cycle syncs deletion
+	if err := server.DeleteTenant(second.ID); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	clock.Advance(10 * time.Second)
+	clock.BlockUntil(1)
+	if _, ok := ext.tenants[second.ID]; ok {
+		t.Errorf("expected deleted tenant %v to be removed", second.ID)
+	}
+}
+
+func TestSyncLoop_DeletionGracePeriod(t *testing.T) {
+	clock := NewFakeClock(time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC))
+	server := acctest.NewServer(acctest.WithClock(clock.Now))
+	defer server.Close()
+
+	customer := server.AddTenant(accclient.Tenant{Name: "customer", Kind: "customer", Enabled: true})
+	ext := newFakeExternalSystem()
+	deletions := NewPendingDeletions(map[string]time.Duration{EntityTenant: time.Minute}, ext, clock)
+	loop := NewSyncLoop(server.NewClient(), server.RootTenantID, ext,
+		WithUpdateInterval(10), WithSyncClock(clock), WithSyncPendingDeletions(deletions))
+	go loop.UpdateTenantsAndOfferingItems(time.Time{})
+
+	clock.BlockUntil(1)
+	if !ext.hasTenant(customer.ID) {
+		t.Fatalf("expected tenant %v to be synced", customer.ID)
+	}
+
+	// deletion is delayed by the grace period, then applied by a later cycle
+	if err := server.DeleteTenant(customer.ID); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for i := 0; i < 6; i++ {
+		clock.Advance(10 * time.Second)
+		clock.BlockUntil(1)
+		if !ext.hasTenant(customer.ID) {
+			t.Fatalf("expected tenant %v to be kept during grace period", customer.ID)
+		}
+	}
+	if len(deletions.Pending()) != 1 {
+		t.Errorf("expected tenant %v pending deletion, got %+v", customer.ID, deletions.Pending())
+	}
+	clock.Advance(10 * time.Second)
+	clock.BlockUntil(1)
+	if ext.hasTenant(customer.ID) || len(deletions.Pending()) != 0 {
+		t.Errorf("expected tenant %v to be deleted after grace period", customer.ID)
+	}
+}
@@ -21,6 +21,8 @@ package updater
 
 import (
 	"context"
+	"fmt"
+	"sync"
 	"time"
 
 	"github.com/acronis/acronis-cyber-cloud-go-sample-connector/connector/accclient"
@@ -35,7 +37,14 @@ type UsageLoop struct {
 	extClient core.ExternalSystemClient
 
 	// optional to be set during initialization
-	updateInterval uint // in seconds
+	updateInterval uint          // in seconds, used when schedule is not set
+	schedule       Schedule      // wall-clock aligned schedule, takes precedence over updateInterval
+	jitter         time.Duration // maximum random delay added to each scheduled run
+	runOnStartup   bool          // push usages immediately on startup
+	clock          Clock
+
+	scheduler *scheduler
+	pushing   sync.Mutex // serializes scheduled usage reports and the ones triggered through PushUsages
 }
 
 // NewUsageLoop initializes UsageLoop as an implementation of core.UsageLoop
@@ -47,12 +56,20 @@ func NewUsageLoop(
 		accClient:      accClient,
 		extClient:      extClient,
 		updateInterval: 21600, // default
+		runOnStartup:   true,  // default
+		clock:          RealClock(),
 	}
 
 	for _, option := range options {
 		option(loop)
 	}
 
+	schedule := loop.schedule
+	if schedule == nil {
+		schedule = EverySchedule(time.Second * time.Duration(loop.updateInterval))
+	}
+	loop.scheduler = newScheduler("usage report", schedule, loop.jitter, loop.clock)
+
 	return loop
 }
 
@@ -63,51 +80,153 @@ func WithUsageUpdateInterval(interval uint) func(*UsageLoop) {
 	}
 }
 
-// UpdateUsages will send usage report from external-system to ACC periodically
+// WithUsageSchedule is an optional init function to set wall-clock aligned schedule of usage reports
+// with maximum random jitter added to each run
+func WithUsageSchedule(schedule Schedule, jitter time.Duration) func(*UsageLoop) {
+	return func(loop *UsageLoop) {
+		loop.schedule = schedule
+		loop.jitter = jitter
+	}
+}
+
+// WithUsageReportOnStartup is an optional init function to set whether usages are pushed immediately on startup
+// or only at the first scheduled run
+func WithUsageReportOnStartup(runOnStartup bool) func(*UsageLoop) {
+	return func(loop *UsageLoop) {
+		loop.runOnStartup = runOnStartup
+	}
+}
+
+// WithUsageClock is an optional init function to set the clock used for scheduling
+func WithUsageClock(clock Clock) func(*UsageLoop) {
+	return func(loop *UsageLoop) {
+		loop.clock = clock
+	}
+}
+
+// NextRun returns the time of the next scheduled usage report,
+// zero time if the report is currently running
+func (loop *UsageLoop) NextRun() time.Time {
+	return loop.scheduler.NextRun()
+}
+
+// UpdateUsages will send usage report from external-system to ACC periodically, following the configured schedule
 // 1. Get usages from external system
 // 2. Push usage report to ACC
+// If external-system client implements core.UsageCursorClient, usages are pulled with cursor pagination,
+// otherwise offset pagination is used.
 func (loop *UsageLoop) UpdateUsages() {
 	ctx := context.Background()
 	ctx = context.WithValue(ctx, logs.ContextID, "usage_loop")
-	logger := logs.GetDefaultLogger(ctx)
 
-	for ; ; time.Sleep(time.Second * time.Duration(loop.updateInterval)) {
-		offset := 0
-		for ; ; offset += externalSystemPageSize {
-			// 1. Get usages from external-system
-			pageUsages, err := loop.extClient.GetUsages(offset, externalSystemPageSize)
-			if err != nil {
-				// Retry whole loop if failed to get usage
-				logger.Warnf("Failed to get external-system usages: %v", err)
-				break
-			}
-
-			// No usages to send
-			if len(pageUsages) == 0 {
-				logger.Infof("No usages to push")
-				break
-			}
-
-			logger.Infof("Pushing %v usages", len(pageUsages))
-			// 2. Push usage report to ACC
-			err = loop.sendACCUsageReport(ctx, pageUsages)
-			if err != nil {
-				// skip this batch if error
-				logger.Warnf("Failed to push usages to ACC: %v", err)
-			}
-
-			if len(pageUsages) < externalSystemPageSize {
-				// last page
-				break
-			}
+	if !loop.runOnStartup {
+		loop.scheduler.wait(ctx)
+	}
+
+	for ; ; loop.scheduler.wait(ctx) {
+		if _, err := loop.PushUsages(ctx); err != nil {
+			// retry in next run
+			logs.GetDefaultLogger(ctx).Warnf("Failed to push usages: %v", err)
 		}
 	}
 }
 
+// PushUsages pulls all usages from external-system and pushes them into ACC at once, outside of the schedule.
+// It returns the counts of usages pushed and pages of usages failed to push.
+func (loop *UsageLoop) PushUsages(ctx context.Context) (PushResult, error) {
+	loop.pushing.Lock()
+	defer loop.pushing.Unlock()
+
+	if cursorClient, ok := loop.extClient.(core.UsageCursorClient); ok {
+		return loop.pushUsagesWithCursor(ctx, cursorClient)
+	}
+	return loop.pushUsagesWithOffset(ctx)
+}
+
 // =====================
 // helper functions
 // =====================
 
+// pushUsagesWithOffset pulls all usages from external-system page by page using offset pagination
+// and pushes them into ACC
+func (loop *UsageLoop) pushUsagesWithOffset(ctx context.Context) (PushResult, error) {
+	logger := logs.GetDefaultLogger(ctx)
+
+	var result PushResult
+	var pushErr error
+	offset := 0
+	for ; ; offset += externalSystemPageSize {
+		// 1. Get usages from external-system
+		pageUsages, err := loop.extClient.GetUsages(offset, externalSystemPageSize)
+		if err != nil {
+			// Retry whole loop if failed to get usage
+			return result, fmt.Errorf("failed to get external-system usages: %w", err)
+		}
+
+		// No usages to send
+		if len(pageUsages) == 0 {
+			logger.Infof("No usages to push")
+			return result, pushErr
+		}
+
+		// 2. Push usage report to ACC
+		pushErr = firstError(pushErr, loop.pushUsagesPage(ctx, pageUsages, &result))
+
+		if len(pageUsages) < externalSystemPageSize {
+			// last page
+			return result, pushErr
+		}
+	}
+}
+
+// pushUsagesWithCursor pulls all usages from external-system page by page using cursor pagination
+// and pushes them into ACC
+func (loop *UsageLoop) pushUsagesWithCursor(ctx context.Context, cursorClient core.UsageCursorClient) (PushResult, error) {
+	logger := logs.GetDefaultLogger(ctx)
+
+	var result PushResult
+	var pushErr error
+	after := ""
+	for {
+		// 1. Get usages from external-system
+		pageUsages, nextAfter, err := cursorClient.GetUsagesAfter(after, externalSystemPageSize)
+		if err != nil {
+			// Retry whole loop if failed to get usage
+			return result, fmt.Errorf("failed to get external-system usages after cursor %q: %w", after, err)
+		}
+
+		// No usages to send
+		if len(pageUsages) == 0 {
+			logger.Infof("No usages to push")
+			return result, pushErr
+		}
+
+		// 2. Push usage report to ACC
+		pushErr = firstError(pushErr, loop.pushUsagesPage(ctx, pageUsages, &result))
+
+		if nextAfter == "" {
+			// last page
+			return result, pushErr
+		}
+		after = nextAfter
+	}
+}
+
+// pushUsagesPage pushes single page of usages into ACC and counts it in result, the page is skipped on error
+func (loop *UsageLoop) pushUsagesPage(ctx context.Context, pageUsages []accclient.Usage, result *PushResult) error {
+	logger := logs.GetDefaultLogger(ctx)
+
+	logger.Infof("Pushing %v usages", len(pageUsages))
+	if err := loop.sendACCUsageReport(ctx, pageUsages); err != nil {
+		// skip this batch if error
+		logger.Warnf("Failed to push usages to ACC: %v", err)
+		result.Failed++
+		return fmt.Errorf("failed to push usages to ACC: %w", err)
+	}
+	result.Usages += len(pageUsages)
+	return nil
+}
+
 func (loop *UsageLoop) sendACCUsageReport(ctx context.Context, extUsages []accclient.Usage) error {
 	logger := logs.GetDefaultLogger(ctx)
 	usageReq := &accclient.UsagesPutRequest{
@@ -22,6 +22,7 @@ package updater
 import (
 	"context"
 	"fmt"
+	"math/rand"
 	"time"
 
 	"github.com/acronis/acronis-cyber-cloud-go-sample-connector/connector/accclient"
@@ -42,10 +43,14 @@ func getTenantsByUUIDs(ctx context.Context, accClient *accclient.Client, tenantU
 
 // createOrUpdateTenant is a helper function to enable recursively creating/updating tenants on external-system
 // It requires ExternalSystem client implementation to interact with external system,
-// accClient to interact with Acronis Cloud, and tenant object to be created/updated.
+// accClient to interact with Acronis Cloud, tenantID of the connector, and tenant object to be created/updated.
+// IDs of the missing parent tenants created first are added to createdParents unless it's nil.
 func createOrUpdateTenant(ctx context.Context,
 	extClient core.ExternalSystemClient,
 	accClient *accclient.Client,
+	filter *pushFilter,
+	createdParents map[string]bool,
+	tenantID string,
 	tenant *accclient.Tenant) error {
 	logger := logs.GetDefaultLogger(ctx)
 
@@ -65,19 +70,84 @@ func createOrUpdateTenant(ctx context.Context,
 			}
 
 			// recursively try to create parent tenant
-			if err := createOrUpdateTenant(ctx, extClient, accClient, &parentTenantResp.Items[0]); err != nil {
+			if err := createParentTenant(ctx, extClient, accClient, filter, createdParents, tenantID, &parentTenantResp.Items[0]); err != nil {
 				return fmt.Errorf("failed to create parent tenant with ID %v: %w", parentTenantResp.Items[0], err)
 			}
 		}
 	}
 
-	tenantCreated, err := extClient.CreateOrUpdateTenant(tenant)
+	var tenantCreated bool
+	var customerID string
+	var err error
+	if customerIDClient, ok := extClient.(core.CustomerIDClient); ok {
+		tenantCreated, customerID, err = customerIDClient.CreateOrUpdateTenantWithCustomerID(tenant)
+	} else {
+		tenantCreated, err = extClient.CreateOrUpdateTenant(tenant)
+	}
 	if err != nil {
 		logger.Warnf("Failed to upsert tenant %v: %v", tenant.ID, err)
 		return fmt.Errorf("failed to upsert tenant with ID %v: %w", tenant.ID, err)
 	}
 	logger.Debugf("Tenant %v successfully updated (is new tenant: %v)", tenant.ID, tenantCreated)
 
+	if err := writeBackCustomerID(ctx, accClient, tenantID, tenant, customerID); err != nil {
+		logger.Warnf("Failed to write back customer ID %v into tenant %v: %v", customerID, tenant.ID, err)
+		return fmt.Errorf("failed to write back customer ID of tenant %v: %w", tenant.ID, err)
+	}
+
+	return nil
+}
+
+// createParentTenant creates the tenant missing in external system as the parent of another tenant or user,
+// records its state in filter and adds it to createdParents unless it's nil, so that it's not pushed again
+// when the tenant itself is processed
+func createParentTenant(ctx context.Context,
+	extClient core.ExternalSystemClient,
+	accClient *accclient.Client,
+	filter *pushFilter,
+	createdParents map[string]bool,
+	tenantID string,
+	tenant *accclient.Tenant) error {
+	if err := createOrUpdateTenant(ctx, extClient, accClient, filter, createdParents, tenantID, tenant); err != nil {
+		return err
+	}
+	logger := logs.GetDefaultLogger(ctx)
+	state, _ := filter.changed(logger, EntityTenant, tenant.ID, tenant.Version, tenantContent(tenant))
+	filter.pushed(logger, EntityTenant, tenant.ID, state)
+	if createdParents != nil {
+		createdParents[tenant.ID] = true
+	}
+	return nil
+}
+
+// writeBackCustomerID sets customer_id of the tenant on Acronis Cloud to the ID of the tenant in external-system.
+// Tenants which already have this customer ID, or are locked for modification by a tenant other than
+// the tenant of the connector (tenantID), are skipped.
+func writeBackCustomerID(ctx context.Context,
+	accClient *accclient.Client,
+	tenantID string,
+	tenant *accclient.Tenant,
+	customerID string) error {
+	logger := logs.GetDefaultLogger(ctx)
+
+	if customerID == "" || (tenant.CustomerID != nil && *tenant.CustomerID == customerID) {
+		return nil
+	}
+
+	if lock := tenant.UpdateLock; lock.Enabled && (lock.OwnerID == nil || *lock.OwnerID != tenantID) {
+		logger.Debugf("Skip writing back customer ID into tenant %v, it is locked for modification", tenant.ID)
+		return nil
+	}
+
+	// the update bumps the version of the tenant, so the change is synced back to external-system once,
+	// when customer_id is already up to date
+	if err := accClient.ModifyTenant(ctx, tenant.ID, func(putReq *accclient.TenantPutRequest) {
+		putReq.CustomerID = &customerID
+	}); err != nil {
+		return err
+	}
+	logger.Debugf("Customer ID %v written back into tenant %v", customerID, tenant.ID)
+
 	return nil
 }
 
@@ -86,6 +156,9 @@ func createOrUpdateTenant(ctx context.Context,
 func createOrUpdateUser(ctx context.Context,
 	extClient core.ExternalSystemClient,
 	accClient *accclient.Client,
+	filter *pushFilter,
+	createdParents map[string]bool,
+	tenantID string,
 	user *accclient.User) error {
 	logger := logs.GetDefaultLogger(ctx)
 
@@ -103,7 +176,7 @@ func createOrUpdateUser(ctx context.Context,
 		}
 
 		// use recursive function to create tenants
-		if err := createOrUpdateTenant(ctx, extClient, accClient, &tenantResp.Items[0]); err != nil {
+		if err := createParentTenant(ctx, extClient, accClient, filter, createdParents, tenantID, &tenantResp.Items[0]); err != nil {
 			return fmt.Errorf("failed to create tenant with ID %v: %w", tenantResp.Items[0], err)
 		}
 	}
@@ -118,9 +191,20 @@ func createOrUpdateUser(ctx context.Context,
 	return nil
 }
 
-// retryHelper is a helper function that retries the passed in function up to max retries on error,
-// backing off exponential amount of time after each try
-func retryHelper(ctx context.Context, userFunction func() error) error {
+// firstError returns the first of the errors which is not nil, nil if all of them are nil
+func firstError(errs ...error) error {
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// retryHelper is a helper function that retries the passed in function calling external system up to max retries
+// on error, backing off exponential amount of time with jitter after each try. It's not used for requests to ACC,
+// which are retried by accclient.RetryTransport already.
+func retryHelper(ctx context.Context, clock Clock, userFunction func() error) error {
 	var err error
 	logger := logs.GetDefaultLogger(ctx)
 	initialBackOff := 1 * time.Second
@@ -131,7 +215,8 @@ func retryHelper(ctx context.Context, userFunction func() error) error {
 				break
 			}
 			logger.Warnf("failed retry %v: %v", i+1, err)
-			time.Sleep(initialBackOff)
+			// up to 20% jitter to avoid retrying concurrent loops at the same time
+			clock.Sleep(initialBackOff + time.Duration(rand.Int63n(int64(initialBackOff/5))))
 			initialBackOff *= 2
 			continue
 		}
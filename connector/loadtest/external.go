@@ -0,0 +1,310 @@
+// Copyright (c) 2021 Acronis International GmbH
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package main
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	"github.com/acronis/acronis-cyber-cloud-go-sample-connector/connector/accclient"
+	"github.com/acronis/acronis-cyber-cloud-go-sample-connector/connector/core"
+)
+
+// counters holds the number of calls pushing changes to external system
+type counters struct {
+	upserts int64
+	deletes int64
+}
+
+func (c *counters) upsert() {
+	atomic.AddInt64(&c.upserts, 1)
+}
+
+func (c *counters) delete() {
+	atomic.AddInt64(&c.deletes, 1)
+}
+
+// pushed returns the total number of pushed changes
+func (c *counters) pushed() int64 {
+	return atomic.LoadInt64(&c.upserts) + atomic.LoadInt64(&c.deletes)
+}
+
+// noopExternalSystem accepts all changes without storing them, to measure the connector and Acronis cloud API only.
+// Reconciliation finds nothing to delete and pushes all the objects on every cycle.
+type noopExternalSystem struct {
+	counters
+}
+
+func (e *noopExternalSystem) CreateOrUpdateTenant(*accclient.Tenant) (bool, error) {
+	e.upsert()
+	return true, nil
+}
+
+func (e *noopExternalSystem) DeleteTenant(string) error {
+	e.delete()
+	return nil
+}
+
+func (e *noopExternalSystem) GetActiveTenantIDs(offset, limit int) ([]string, error) {
+	return nil, nil
+}
+
+func (e *noopExternalSystem) CheckTenantExist(string) (bool, error) {
+	return true, nil
+}
+
+func (e *noopExternalSystem) CreateOrUpdateOfferingItem(*accclient.OfferingItem) (bool, error) {
+	e.upsert()
+	return true, nil
+}
+
+func (e *noopExternalSystem) DeleteOfferingItem(core.OfferingItemID) error {
+	e.delete()
+	return nil
+}
+
+func (e *noopExternalSystem) GetActiveOfferingItemIDs(offset, limit int) ([]core.OfferingItemID, error) {
+	return nil, nil
+}
+
+func (e *noopExternalSystem) CreateOrUpdateUser(*accclient.User) (bool, error) {
+	e.upsert()
+	return true, nil
+}
+
+func (e *noopExternalSystem) DeleteUser(string) error {
+	e.delete()
+	return nil
+}
+
+func (e *noopExternalSystem) GetActiveUserIDs(offset, limit int) ([]string, error) {
+	return nil, nil
+}
+
+func (e *noopExternalSystem) CreateOrUpdateAccessPolicy(*accclient.AccessPolicy) (bool, error) {
+	e.upsert()
+	return true, nil
+}
+
+func (e *noopExternalSystem) DeleteAccessPolicy(string) error {
+	e.delete()
+	return nil
+}
+
+func (e *noopExternalSystem) GetActiveAccessPolicyIDs(offset, limit int) ([]string, error) {
+	return nil, nil
+}
+
+func (e *noopExternalSystem) GetUsages(offset, limit int) ([]accclient.Usage, error) {
+	return nil, nil
+}
+
+// memoryExternalSystem keeps the IDs of the pushed objects in memory, like an external system with its own database
+type memoryExternalSystem struct {
+	counters
+
+	mu             sync.Mutex
+	tenants        idSet
+	offeringItems  map[core.OfferingItemID]struct{}
+	users          idSet
+	accessPolicies idSet
+
+	sortedOfferingItems []core.OfferingItemID // cached for paging, nil when offering items are changed
+}
+
+func newMemoryExternalSystem() *memoryExternalSystem {
+	return &memoryExternalSystem{
+		tenants:        newIDSet(),
+		offeringItems:  make(map[core.OfferingItemID]struct{}),
+		users:          newIDSet(),
+		accessPolicies: newIDSet(),
+	}
+}
+
+func (e *memoryExternalSystem) CreateOrUpdateTenant(tenant *accclient.Tenant) (bool, error) {
+	e.upsert()
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.tenants.add(tenant.ID), nil
+}
+
+func (e *memoryExternalSystem) DeleteTenant(tenantID string) error {
+	e.delete()
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.tenants.remove(tenantID)
+	return nil
+}
+
+func (e *memoryExternalSystem) GetActiveTenantIDs(offset, limit int) ([]string, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.tenants.page(offset, limit), nil
+}
+
+func (e *memoryExternalSystem) CheckTenantExist(tenantID string) (bool, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	_, ok := e.tenants.ids[tenantID]
+	return ok, nil
+}
+
+func (e *memoryExternalSystem) CreateOrUpdateOfferingItem(item *accclient.OfferingItem) (bool, error) {
+	e.upsert()
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	id := core.OfferingItemID{OfferingItemName: item.Name, TenantID: item.TenantID}
+	if _, ok := e.offeringItems[id]; ok {
+		return false, nil
+	}
+	e.offeringItems[id] = struct{}{}
+	e.sortedOfferingItems = nil
+	return true, nil
+}
+
+func (e *memoryExternalSystem) DeleteOfferingItem(itemID core.OfferingItemID) error {
+	e.delete()
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if _, ok := e.offeringItems[itemID]; ok {
+		delete(e.offeringItems, itemID)
+		e.sortedOfferingItems = nil
+	}
+	return nil
+}
+
+func (e *memoryExternalSystem) GetActiveOfferingItemIDs(offset, limit int) ([]core.OfferingItemID, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.sortedOfferingItems == nil {
+		e.sortedOfferingItems = make([]core.OfferingItemID, 0, len(e.offeringItems))
+		for id := range e.offeringItems {
+			e.sortedOfferingItems = append(e.sortedOfferingItems, id)
+		}
+		sort.Slice(e.sortedOfferingItems, func(i, j int) bool {
+			a, b := e.sortedOfferingItems[i], e.sortedOfferingItems[j]
+			if a.TenantID != b.TenantID {
+				return a.TenantID < b.TenantID
+			}
+			return a.OfferingItemName < b.OfferingItemName
+		})
+	}
+	if offset >= len(e.sortedOfferingItems) {
+		return nil, nil
+	}
+	end := offset + limit
+	if end > len(e.sortedOfferingItems) {
+		end = len(e.sortedOfferingItems)
+	}
+	return append([]core.OfferingItemID(nil), e.sortedOfferingItems[offset:end]...), nil
+}
+
+func (e *memoryExternalSystem) CreateOrUpdateUser(user *accclient.User) (bool, error) {
+	e.upsert()
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.users.add(user.ID), nil
+}
+
+func (e *memoryExternalSystem) DeleteUser(userID string) error {
+	e.delete()
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.users.remove(userID)
+	return nil
+}
+
+func (e *memoryExternalSystem) GetActiveUserIDs(offset, limit int) ([]string, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.users.page(offset, limit), nil
+}
+
+func (e *memoryExternalSystem) CreateOrUpdateAccessPolicy(accessPolicy *accclient.AccessPolicy) (bool, error) {
+	e.upsert()
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.accessPolicies.add(accessPolicy.ID), nil
+}
+
+func (e *memoryExternalSystem) DeleteAccessPolicy(accessPolicyID string) error {
+	e.delete()
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.accessPolicies.remove(accessPolicyID)
+	return nil
+}
+
+func (e *memoryExternalSystem) GetActiveAccessPolicyIDs(offset, limit int) ([]string, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.accessPolicies.page(offset, limit), nil
+}
+
+func (e *memoryExternalSystem) GetUsages(offset, limit int) ([]accclient.Usage, error) {
+	return nil, nil
+}
+
+// idSet is a set of IDs paged in sorted order. Sorted IDs are cached between changes,
+// so that paging through all the IDs during reconciliation doesn't sort them for each page.
+type idSet struct {
+	ids    map[string]struct{}
+	sorted []string
+}
+
+func newIDSet() idSet {
+	return idSet{ids: make(map[string]struct{})}
+}
+
+// add returns true if the ID is new
+func (s *idSet) add(id string) bool {
+	if _, ok := s.ids[id]; ok {
+		return false
+	}
+	s.ids[id] = struct{}{}
+	s.sorted = nil
+	return true
+}
+
+func (s *idSet) remove(id string) {
+	if _, ok := s.ids[id]; ok {
+		delete(s.ids, id)
+		s.sorted = nil
+	}
+}
+
+func (s *idSet) page(offset, limit int) []string {
+	if s.sorted == nil {
+		s.sorted = make([]string, 0, len(s.ids))
+		for id := range s.ids {
+			s.sorted = append(s.sorted, id)
+		}
+		sort.Strings(s.sorted)
+	}
+	if offset >= len(s.sorted) {
+		return nil
+	}
+	end := offset + limit
+	if end > len(s.sorted) {
+		end = len(s.sorted)
+	}
+	return append([]string(nil), s.sorted[offset:end]...)
+}
@@ -0,0 +1,312 @@
+// Copyright (c) 2021 Acronis International GmbH
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+// Command loadtest measures the connector with large synthetic tenant hierarchies.
+//
+// It generates a dataset in an in-process fake of Acronis Cyber Cloud Platform API (acctest), runs reconciliation
+// and sync cycles of the updater against a no-op or in-memory external system, and reports throughput,
+// memory peak and cycle times, e.g.:
+//
+//	go run ./connector/loadtest -depth 3 -fanout 46 -users 5 -policies 2
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"runtime"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/acronis/acronis-cyber-cloud-go-sample-connector/connector/accclient"
+	"github.com/acronis/acronis-cyber-cloud-go-sample-connector/connector/accclient/acctest"
+	"github.com/acronis/acronis-cyber-cloud-go-sample-connector/connector/core"
+	"github.com/acronis/acronis-cyber-cloud-go-sample-connector/connector/core/updater"
+	"github.com/acronis/acronis-cyber-cloud-go-sample-connector/connector/logs"
+)
+
+// syncInterval is the interval of sync loops, time is advanced by a fake clock so it doesn't slow down the test
+const syncInterval = 5 * time.Second
+
+// externalSystem is an external system which counts the pushed changes
+type externalSystem interface {
+	core.ExternalSystemClient
+	pushed() int64
+}
+
+// phase is a measured step of the load test
+type phase struct {
+	name     string
+	duration time.Duration
+	objects  int64 // number of changes pushed to external system
+	requests int   // number of requests served by the fake Acronis cloud
+}
+
+// loadTest is a load test run against an in-process fake of Acronis Cyber Cloud Platform API
+type loadTest struct {
+	dataset              acctest.Dataset
+	reconciliationCycles int  // number of reconciliation cycles after the initial one
+	syncCycles           int  // number of sync cycles
+	churn                int  // number of tenants and of users changed before each sync cycle
+	forceFullPush        bool // push all entities, even if not changed since last pushed
+}
+
+// loadTestResult holds the measurements of a load test run
+type loadTestResult struct {
+	generated acctest.GeneratedDataset
+	baseline  uint64 // heap in use after generation
+	phases    []phase
+}
+
+func main() {
+	var test loadTest
+	flag.IntVar(&test.dataset.Depth, "depth", 2, "Number of tenant levels below the root partner")
+	flag.IntVar(&test.dataset.FanOut, "fanout", 10, "Number of child tenants of each partner")
+	flag.IntVar(&test.dataset.OfferingItemsPerTenant, "offering-items", 5, "Number of offering items per tenant")
+	flag.IntVar(&test.dataset.UsersPerTenant, "users", 2, "Number of users per tenant")
+	flag.IntVar(&test.dataset.AccessPoliciesPerUser, "policies", 1, "Number of access policies per user")
+	flag.IntVar(&test.reconciliationCycles, "reconciliation-cycles", 1, "Number of reconciliation cycles after the initial one")
+	flag.IntVar(&test.syncCycles, "sync-cycles", 3, "Number of sync cycles")
+	flag.IntVar(&test.churn, "churn", 100, "Number of tenants and of users changed before each sync cycle")
+	external := flag.String("external", "memory", "External system: memory or noop")
+	flag.BoolVar(&test.forceFullPush, "force-full-push", false, "Push all entities, even if not changed since last pushed")
+	logLevel := flag.String("log-level", "warn", "Log level of the connector")
+	flag.Parse()
+
+	if test.dataset.Depth < 1 || test.dataset.FanOut < 1 {
+		log.Fatalf("depth and fanout must be positive")
+	}
+
+	var extClient externalSystem
+	switch *external {
+	case "memory":
+		extClient = newMemoryExternalSystem()
+	case "noop":
+		extClient = &noopExternalSystem{}
+	default:
+		log.Fatalf("Unknown external system %q, expected memory or noop", *external)
+	}
+
+	logs.SetupLogrusLogger(&logs.LogConfig{LoggingLib: "logrus", LogLevel: *logLevel})
+
+	sampler := newMemorySampler(100 * time.Millisecond)
+	defer sampler.stop()
+
+	result, err := test.run(extClient)
+	if err != nil {
+		log.Fatalf("Load test failed: %v", err)
+	}
+
+	peak := sampler.stop()
+	fmt.Println()
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(writer, "phase\tduration\tpushed\tpushed/s\tACC requests\t")
+	for _, p := range result.phases {
+		fmt.Fprintf(writer, "%v\t%v\t%v\t%.0f\t%v\t\n",
+			p.name, p.duration.Round(time.Millisecond), p.objects, float64(p.objects)/p.duration.Seconds(), p.requests)
+	}
+	_ = writer.Flush()
+
+	fmt.Println()
+	fmt.Printf("Heap in use after generation (fake Acronis cloud and external system): %v MiB\n", mib(result.baseline))
+	fmt.Printf("Peak heap in use: %v MiB\n", mib(peak.heapInUse))
+	fmt.Printf("Peak memory obtained from OS: %v MiB\n", mib(peak.sys))
+}
+
+// run generates the dataset and measures reconciliation and sync cycles of the updater pushing it to extClient
+func (test loadTest) run(extClient externalSystem) (loadTestResult, error) {
+	// updated_since has the resolution of seconds, so the time of the fake Acronis cloud is advanced
+	// before the changes of each sync cycle, for them to be reported after the previous cycle only
+	accClock := updater.NewFakeClock(time.Now())
+	server := acctest.NewServer(acctest.WithClock(accClock.Now))
+	defer server.Close()
+	accClient := server.NewClient()
+
+	var result loadTestResult
+	fmt.Printf("Generating %v tenants...\n", test.dataset.Tenants())
+	start := time.Now()
+	result.generated = server.Generate(test.dataset)
+	generation := time.Since(start)
+	result.baseline = heapInUse()
+	fmt.Printf("Generated %v tenants, %v offering items, %v users and %v access policies in %v\n",
+		len(result.generated.TenantIDs), result.generated.OfferingItems, len(result.generated.UserIDs),
+		result.generated.AccessPolicies, generation.Round(time.Millisecond))
+
+	measure := func(name string, fn func()) {
+		pushed, requests := extClient.pushed(), server.RequestsCount()
+		start := time.Now()
+		fn()
+		result.phases = append(result.phases, phase{
+			name:     name,
+			duration: time.Since(start),
+			objects:  extClient.pushed() - pushed,
+			requests: server.RequestsCount() - requests,
+		})
+		fmt.Printf("%v done in %v\n", name, result.phases[len(result.phases)-1].duration.Round(time.Millisecond))
+	}
+
+	// reconciliation on startup pushes all the objects, the next cycles find them in the in-memory external system
+	accClock.Advance(syncInterval)
+	// shared by reconciliation and sync loops to skip unchanged entities, like in updater
+	stateStore := updater.NewMemoryStateStore()
+	reconciliation := updater.NewReconciliationLoop(accClient, server.RootTenantID, extClient,
+		updater.WithReconciliationStateStore(stateStore, test.forceFullPush))
+	var tenantsUpdatedSince, usersUpdatedSince time.Time
+	for cycle := 0; cycle <= test.reconciliationCycles; cycle++ {
+		measure(fmt.Sprintf("reconciliation %v: tenants and offering items", cycle+1), func() {
+			tenantsUpdatedSince = reconciliation.ReconcileTenantsAndOfferingItems(true)
+		})
+		measure(fmt.Sprintf("reconciliation %v: users and access policies", cycle+1), func() {
+			usersUpdatedSince = reconciliation.ReconcileUsersAndAccessPolicies(true)
+		})
+	}
+
+	// sync loops run forever, each cycle is started by advancing the fake clock
+	// and completed when the loop sleeps again
+	tenantsClock := updater.NewFakeClock(time.Now())
+	usersClock := updater.NewFakeClock(time.Now())
+	tenantsLoop := updater.NewSyncLoop(accClient, server.RootTenantID, extClient,
+		updater.WithUpdateInterval(uint(syncInterval/time.Second)), updater.WithSyncClock(tenantsClock),
+		updater.WithSyncStateStore(stateStore, test.forceFullPush))
+	usersLoop := updater.NewSyncLoop(accClient, server.RootTenantID, extClient,
+		updater.WithUpdateInterval(uint(syncInterval/time.Second)), updater.WithSyncClock(usersClock),
+		updater.WithSyncStateStore(stateStore, test.forceFullPush))
+	go tenantsLoop.UpdateTenantsAndOfferingItems(tenantsUpdatedSince)
+	go usersLoop.UpdateUsersAndAccessPolicies(usersUpdatedSince)
+	tenantsClock.BlockUntil(1)
+	usersClock.BlockUntil(1)
+
+	for cycle := 1; cycle <= test.syncCycles; cycle++ {
+		accClock.Advance(syncInterval)
+		if err := changeTenants(server, result.generated.TenantIDs, cycle, test.churn); err != nil {
+			return result, err
+		}
+		if err := changeUsers(server, result.generated.UserIDs, cycle, test.churn); err != nil {
+			return result, err
+		}
+		measure(fmt.Sprintf("sync %v: tenants and offering items", cycle), func() {
+			tenantsClock.Advance(syncInterval)
+			tenantsClock.BlockUntil(1)
+		})
+		measure(fmt.Sprintf("sync %v: users and access policies", cycle), func() {
+			usersClock.Advance(syncInterval)
+			usersClock.BlockUntil(1)
+		})
+	}
+	return result, nil
+}
+
+// changeTenants renames churn tenants, picked round robin across the cycles
+func changeTenants(server *acctest.Server, tenantIDs []string, cycle, churn int) error {
+	for i := 0; i < churn && i < len(tenantIDs); i++ {
+		tenantID := tenantIDs[((cycle-1)*churn+i)%len(tenantIDs)]
+		if err := server.ModifyTenant(tenantID, func(tenant *accclient.Tenant) {
+			tenant.Name = fmt.Sprintf("%v (changed in cycle %v)", tenant.ID, cycle)
+		}); err != nil {
+			return fmt.Errorf("failed to change tenant %v: %w", tenantID, err)
+		}
+	}
+	return nil
+}
+
+// changeUsers toggles enabled flag of churn users, picked round robin across the cycles
+func changeUsers(server *acctest.Server, userIDs []string, cycle, churn int) error {
+	for i := 0; i < churn && i < len(userIDs); i++ {
+		userID := userIDs[((cycle-1)*churn+i)%len(userIDs)]
+		if err := server.ModifyUser(userID, func(user *accclient.User) {
+			user.Enabled = !user.Enabled
+		}); err != nil {
+			return fmt.Errorf("failed to change user %v: %w", userID, err)
+		}
+	}
+	return nil
+}
+
+// memoryPeak is the peak memory usage observed by memorySampler
+type memoryPeak struct {
+	heapInUse uint64
+	sys       uint64
+}
+
+// memorySampler polls runtime memory statistics in background and keeps the peak values
+type memorySampler struct {
+	mu      sync.Mutex
+	peak    memoryPeak
+	done    chan struct{}
+	stopped sync.Once
+	wg      sync.WaitGroup
+}
+
+func newMemorySampler(interval time.Duration) *memorySampler {
+	s := &memorySampler{done: make(chan struct{})}
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			s.sample()
+			select {
+			case <-ticker.C:
+			case <-s.done:
+				return
+			}
+		}
+	}()
+	return s
+}
+
+func (s *memorySampler) sample() {
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if stats.HeapInuse > s.peak.heapInUse {
+		s.peak.heapInUse = stats.HeapInuse
+	}
+	if stats.Sys > s.peak.sys {
+		s.peak.sys = stats.Sys
+	}
+}
+
+// stop stops sampling and returns the peak values, including a final sample
+func (s *memorySampler) stop() memoryPeak {
+	s.stopped.Do(func() {
+		close(s.done)
+		s.wg.Wait()
+		s.sample()
+	})
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.peak
+}
+
+// heapInUse returns the heap in use after garbage collection
+func heapInUse() uint64 {
+	runtime.GC()
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	return stats.HeapInuse
+}
+
+func mib(bytes uint64) uint64 {
+	return bytes / (1 << 20)
+}
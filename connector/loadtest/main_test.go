@@ -0,0 +1,81 @@
+// Copyright (c) 2021 Acronis International GmbH
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package main
+
+import (
+	"testing"
+
+	"github.com/acronis/acronis-cyber-cloud-go-sample-connector/connector/accclient/acctest"
+)
+
+func TestLoadTest_Run(t *testing.T) {
+	test := loadTest{
+		dataset: acctest.Dataset{
+			Depth: 2, FanOut: 3, OfferingItemsPerTenant: 2, UsersPerTenant: 2, AccessPoliciesPerUser: 2,
+		},
+		reconciliationCycles: 1,
+		syncCycles:           2,
+		churn:                2,
+	}
+	extClient := newMemoryExternalSystem()
+	result, err := test.run(extClient)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// 2 phases of each reconciliation and sync cycle
+	if len(result.phases) != 2*(test.reconciliationCycles+1)+2*test.syncCycles {
+		t.Fatalf("unexpected phases %+v", result.phases)
+	}
+	if pushed := result.phases[0].objects + result.phases[1].objects; pushed != 13+24+24+48 {
+		t.Errorf("expected initial reconciliation to push all the objects and the root tenant, pushed %v", pushed)
+	}
+	for _, p := range result.phases[2:4] {
+		if p.objects != 0 {
+			t.Errorf("expected %v to push no unchanged objects, pushed %v", p.name, p.objects)
+		}
+	}
+	for _, p := range result.phases[4:] {
+		if p.objects == 0 {
+			t.Errorf("expected %v to push the changed objects", p.name)
+		}
+	}
+
+	extClient.mu.Lock()
+	defer extClient.mu.Unlock()
+	// the root tenant is pushed too
+	if len(extClient.tenants.ids) != len(result.generated.TenantIDs)+1 || len(extClient.users.ids) != len(result.generated.UserIDs) ||
+		len(extClient.offeringItems) != result.generated.OfferingItems ||
+		len(extClient.accessPolicies.ids) != result.generated.AccessPolicies {
+		t.Errorf("expected external system to have all the generated objects, got %v tenants, %v offering items, %v users "+
+			"and %v access policies", len(extClient.tenants.ids), len(extClient.offeringItems), len(extClient.users.ids),
+			len(extClient.accessPolicies.ids))
+	}
+	for _, tenantID := range result.generated.TenantIDs {
+		if _, ok := extClient.tenants.ids[tenantID]; !ok {
+			t.Errorf("tenant %v is not pushed", tenantID)
+		}
+	}
+	for _, userID := range result.generated.UserIDs {
+		if _, ok := extClient.users.ids[userID]; !ok {
+			t.Errorf("user %v is not pushed", userID)
+		}
+	}
+}
@@ -0,0 +1,387 @@
+// Copyright (c) 2021 Acronis International GmbH
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/acronis/acronis-cyber-cloud-go-sample-connector/connector/admin"
+	"github.com/acronis/acronis-cyber-cloud-go-sample-connector/connector/core"
+	"github.com/acronis/acronis-cyber-cloud-go-sample-connector/connector/core/updater"
+	"github.com/acronis/acronis-cyber-cloud-go-sample-connector/connector/logs"
+	"github.com/acronis/acronis-cyber-cloud-go-sample-connector/connector/sample-connector/external"
+	extclient "github.com/acronis/acronis-cyber-cloud-go-sample-connector/external-system/client"
+)
+
+// Exit codes of commands
+const (
+	exitOK      = 0
+	exitFailure = 1 // command failed, or diff found differences
+	exitUsage   = 2 // invalid arguments
+)
+
+// Modes of the updater of a command
+const (
+	modeLoops        = iota // runs the loops and records states of pushed entities in stateFile
+	modeOnce                // runs once or pushes usages only, possibly alongside the connector which owns stateFile
+	modeOnceDeleting        // runs once like modeOnce, and may delete entities from external-system
+)
+
+// command is a subcommand of the connector, run returns the exit code of the process
+type command struct {
+	name        string
+	args        string
+	description string
+	run         func(configFile string, args []string) int
+}
+
+var commands = []command{
+	{"run", "", "run all loops until interrupted (default)", runConnector},
+	{"reconcile", "[--once] [--entities tenants,users]",
+		"reconcile the entities now, then following the schedule unless --once is set", runReconcile},
+	{"sync-tenant", "<id>", "push the tenant and its subtree into external-system", runSyncTenant},
+	{"push-usages", "[--once]", "push usages following the schedule, or once and exit if --once is set", runPushUsages},
+	{"validate-config", "", "validate the config file without connecting anywhere", runValidateConfig},
+	{"diff", "--tenant <id>", "show the differences of the tenant subtree between Acronis cloud and external-system", runDiff},
+	{"doctor", "", "check credentials, access to Acronis cloud, external-system endpoints and clock skew", runDoctor},
+}
+
+func findCommand(name string) (command, bool) {
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd, true
+		}
+	}
+	return command{}, false
+}
+
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintf(out, "Usage: %v [-config config.yaml] [command] [arguments]\n\nCommands:\n", os.Args[0])
+	for _, cmd := range commands {
+		fmt.Fprintf(out, "  %v\n      %v\n", strings.TrimSpace(cmd.name+" "+cmd.args), cmd.description)
+	}
+	fmt.Fprintln(out, "\nFlags:")
+	flag.PrintDefaults()
+}
+
+// newFlagSet returns the flags of the command, -config can be set after the command as well
+func newFlagSet(name string, configFile *string) *flag.FlagSet {
+	flags := flag.NewFlagSet(name, flag.ExitOnError)
+	flags.StringVar(configFile, "config", *configFile, "Path to config file")
+	return flags
+}
+
+// loadConfig loads the config and sets up the logger of the command
+func loadConfig(configFile, name string) (*Config, logs.Logger, error) {
+	config := NewDefaultConfig()
+	if err := config.LoadConfigFromFile(configFile); err != nil {
+		return nil, nil, fmt.Errorf("failed to load config with error: %w", err)
+	}
+
+	logs.SetupLogrusLogger(&config.UpdaterSettings.LogSettings)
+	ctx := context.WithValue(context.Background(), logs.ContextID, name)
+	return config, logs.GetDefaultLogger(ctx), nil
+}
+
+// newUpdater loads the config and initializes Updater to pull information from Acronis cloud.
+// Commands run once only read stateFile, as the file is compacted when opened for recording, which would detach it
+// from the running connector. Deletions aren't delayed by them either, as pending deletions are kept in memory
+// of the process until their grace period expires.
+func newUpdater(configFile, name string, mode int) (*updater.Updater, *Config, logs.Logger, error) {
+	config, logger, err := loadConfig(configFile, name)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	var options []updater.Option
+	if mode != modeLoops {
+		if mode == modeOnceDeleting && config.UpdaterSettings.DeletionGracePeriod.Enabled() {
+			return nil, nil, nil, fmt.Errorf("one-shot %v doesn't support deletionGracePeriod, as it exits before grace periods expire; "+
+				"let the running connector delete entities, or set the grace periods to 0 in a separate config", name)
+		}
+		stateStore := updater.StateStore(updater.NewMemoryStateStore())
+		if config.UpdaterSettings.StateFile != "" {
+			if stateStore, err = updater.LoadStateFile(config.UpdaterSettings.StateFile); err != nil {
+				return nil, nil, nil, err
+			}
+		}
+		options = append(options, updater.WithStateStore(stateStore))
+	}
+
+	coreUpdater, err := updater.NewUpdater(config.UpdaterSettings, newExternalSystem(config, http.DefaultClient), options...)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to initialize updater: %w", err)
+	}
+	return coreUpdater, config, logger, nil
+}
+
+// newExternalSystem returns the client of external system
+func newExternalSystem(config *Config, httpClient *http.Client) core.ExternalSystemClient {
+	extClient := extclient.NewClient(httpClient, config.ExternalSystemURL)
+	return external.NewExternalSystem(extClient)
+}
+
+func runConnector(configFile string, args []string) int {
+	flags := newFlagSet("run", &configFile)
+	_ = flags.Parse(args)
+
+	fmt.Println("Sample Connector")
+	coreUpdater, config, logger, err := newUpdater(configFile, "init", modeLoops)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitFailure
+	}
+	logger.Info("Init Complete.")
+
+	// Run updater
+	if err := coreUpdater.Start(); err != nil {
+		logger.Errorf("Failed to start updater with error: %v", err)
+		return exitFailure
+	}
+
+	// Serve admin API
+	if config.AdminSettings.ListenAddress != "" {
+		go func() {
+			logger.Infof("Admin API listening on %v", config.AdminSettings.ListenAddress)
+			handler := admin.NewHandler(coreUpdater, config.AdminSettings.Token)
+			if err := http.ListenAndServe(config.AdminSettings.ListenAddress, handler); err != nil {
+				logger.Errorf("Failed to serve admin API with error: %v", err)
+			}
+		}()
+	}
+
+	// wait for kill signal before attempting to gracefully shutdown
+	// the running service
+	interruptChan := make(chan os.Signal, 1)
+	signal.Notify(interruptChan, os.Interrupt, syscall.SIGINT, syscall.SIGTERM)
+	<-interruptChan
+	if err := coreUpdater.Close(); err != nil {
+		logger.Errorf("Failed to close updater with error: %v", err)
+		return exitFailure
+	}
+	return exitOK
+}
+
+// reconciliationKinds maps the entities of reconcile command to kinds of reconciliation
+var reconciliationKinds = map[string]string{
+	"tenants": updater.ReportTenantsAndOfferingItems,
+	"users":   updater.ReportUsersAndAccessPolicies,
+}
+
+func runReconcile(configFile string, args []string) int {
+	flags := newFlagSet("reconcile", &configFile)
+	once := flags.Bool("once", false, "reconcile once and exit")
+	entities := flags.String("entities", "tenants,users", "comma-separated entities to reconcile: tenants (with offering items), "+
+		"users (with access policies)")
+	_ = flags.Parse(args)
+
+	var kinds []string
+	for _, entity := range strings.Split(*entities, ",") {
+		kind, ok := reconciliationKinds[strings.TrimSpace(entity)]
+		if !ok {
+			fmt.Fprintf(os.Stderr, "Unknown entities %q, expected tenants or users\n", entity)
+			return exitUsage
+		}
+		kinds = append(kinds, kind)
+	}
+
+	mode := modeLoops
+	if *once {
+		mode = modeOnceDeleting
+	}
+	coreUpdater, _, _, err := newUpdater(configFile, "reconcile", mode)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitFailure
+	}
+	if !*once {
+		if err := coreUpdater.RunReconciliation(kinds...); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+		}
+		return exitFailure
+	}
+
+	reports, err := coreUpdater.Reconcile(kinds...)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitFailure
+	}
+	code := exitOK
+	for _, report := range reports {
+		printJSON(report.Header())
+		if report.Error != "" || report.Summary[updater.OutcomeFailed] > 0 {
+			code = exitFailure
+		}
+	}
+	return code
+}
+
+func runSyncTenant(configFile string, args []string) int {
+	flags := newFlagSet("sync-tenant", &configFile)
+	_ = flags.Parse(args)
+	if flags.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "Usage: sync-tenant <id>")
+		return exitUsage
+	}
+	return runJob(configFile, "sync-tenant", updater.JobResyncTenant, flags.Arg(0), modeOnceDeleting)
+}
+
+func runPushUsages(configFile string, args []string) int {
+	flags := newFlagSet("push-usages", &configFile)
+	once := flags.Bool("once", false, "push usages once and exit")
+	_ = flags.Parse(args)
+
+	if *once {
+		return runJob(configFile, "push-usages", updater.JobPushUsages, "", modeOnce)
+	}
+	// usage loop doesn't record states, stateFile is left to the running connector
+	coreUpdater, _, _, err := newUpdater(configFile, "push-usages", modeOnce)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitFailure
+	}
+	coreUpdater.RunUsages()
+	return exitOK
+}
+
+// runJob runs the job of the updater, printing its result
+func runJob(configFile, name, kind, target string, mode int) int {
+	coreUpdater, _, _, err := newUpdater(configFile, name, mode)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitFailure
+	}
+
+	ctx := context.WithValue(context.Background(), logs.ContextID, name)
+	result, err := coreUpdater.RunJob(ctx, kind, target)
+	printJSON(result)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitFailure
+	}
+	return exitOK
+}
+
+func runValidateConfig(configFile string, args []string) int {
+	flags := newFlagSet("validate-config", &configFile)
+	_ = flags.Parse(args)
+
+	config := NewDefaultConfig()
+	if err := config.LoadConfigFromFile(configFile); err != nil {
+		fmt.Fprintf(os.Stderr, "Config %v is invalid: %v\n", configFile, err)
+		return exitFailure
+	}
+	fmt.Printf("Config %v is valid\n", configFile)
+	return exitOK
+}
+
+func runDiff(configFile string, args []string) int {
+	flags := newFlagSet("diff", &configFile)
+	tenantID := flags.String("tenant", "", "ID of the root tenant of the subtree to compare")
+	_ = flags.Parse(args)
+	if *tenantID == "" {
+		fmt.Fprintln(os.Stderr, "Usage: diff --tenant <id>")
+		return exitUsage
+	}
+
+	coreUpdater, _, _, err := newUpdater(configFile, "diff", modeOnce)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitFailure
+	}
+	ctx := context.WithValue(context.Background(), logs.ContextID, "diff")
+	diff, err := coreUpdater.Diff(ctx, *tenantID)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitFailure
+	}
+
+	fmt.Printf("Compared %v tenants, %v offering items, %v users and %v access policies of tenant %v\n",
+		diff.Compared[updater.EntityTenant], diff.Compared[updater.EntityOfferingItem],
+		diff.Compared[updater.EntityUser], diff.Compared[updater.EntityAccessPolicy], diff.TenantID)
+	if !diff.ContentCompared {
+		fmt.Println("External-system doesn't provide fingerprints, only existence of tenants and users is compared")
+	}
+	for _, entry := range diff.Entries {
+		if len(entry.Fields) > 0 {
+			fmt.Printf("%v %v: %v (%v)\n", entry.Kind, entry.ID, entry.Status, strings.Join(entry.Fields, ", "))
+		} else {
+			fmt.Printf("%v %v: %v\n", entry.Kind, entry.ID, entry.Status)
+		}
+	}
+	if len(diff.Entries) > 0 {
+		return exitFailure
+	}
+	fmt.Println("No differences")
+	return exitOK
+}
+
+func runDoctor(configFile string, args []string) int {
+	flags := newFlagSet("doctor", &configFile)
+	_ = flags.Parse(args)
+
+	config, _, err := loadConfig(configFile, "doctor")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitFailure
+	}
+	fmt.Printf("Acronis cloud: %v\nExternal-system: %v\n\n", config.UpdaterSettings.APIServerSettings.BaseURL, config.ExternalSystemURL)
+
+	// unlike the loops, fail fast if external-system doesn't respond
+	externalClient := newExternalSystem(config, &http.Client{Timeout: 30 * time.Second})
+	ctx := context.WithValue(context.Background(), logs.ContextID, "doctor")
+	checks := updater.Diagnose(ctx, config.UpdaterSettings, externalClient, updater.RealClock())
+	failed := 0
+	for _, check := range checks {
+		line := fmt.Sprintf("[%v] %v", strings.ToUpper(check.Status), check.Name)
+		if check.Detail != "" {
+			line += ": " + check.Detail
+		}
+		fmt.Println(line)
+		if check.Status == updater.CheckFailed {
+			fmt.Printf("       hint: %v\n", check.Hint)
+			failed++
+		}
+	}
+
+	if failed > 0 {
+		fmt.Printf("\n%v of %v checks failed\n", failed, len(checks))
+		return exitFailure
+	}
+	fmt.Println("\nAll checks passed")
+	return exitOK
+}
+
+// printJSON prints the value as indented JSON to stdout
+func printJSON(value interface{}) {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	_ = encoder.Encode(value)
+}
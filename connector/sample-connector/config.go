@@ -26,6 +26,7 @@ import (
 
 	"gopkg.in/yaml.v2"
 
+	"github.com/acronis/acronis-cyber-cloud-go-sample-connector/connector/admin"
 	"github.com/acronis/acronis-cyber-cloud-go-sample-connector/connector/core/updater"
 )
 
@@ -33,6 +34,7 @@ import (
 type Config struct {
 	ExternalSystemURL string          `yaml:"externalSystemURL"`
 	UpdaterSettings   *updater.Config `yaml:"updaterSettings,flow"`
+	AdminSettings     admin.Config    `yaml:"adminSettings,flow"`
 }
 
 // NewDefaultConfig returns the default configuration values
@@ -53,6 +55,10 @@ func (c *Config) Validate() error {
 		return err
 	}
 
+	if err := c.AdminSettings.Validate(); err != nil {
+		return err
+	}
+
 	return nil
 }
 
@@ -88,4 +94,10 @@ func (c *Config) LoadEnvVar() {
 	if ok {
 		c.UpdaterSettings.AuthSettings.ClientSecret = envVal
 	}
+
+	// Admin API token
+	envVal, ok = os.LookupEnv("ADMIN_TOKEN")
+	if ok {
+		c.AdminSettings.Token = envVal
+	}
 }
@@ -0,0 +1,121 @@
+// Copyright (c) 2021 Acronis International GmbH
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package external
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/acronis/acronis-cyber-cloud-go-sample-connector/connector/accclient"
+	"github.com/acronis/acronis-cyber-cloud-go-sample-connector/connector/core"
+	"github.com/acronis/acronis-cyber-cloud-go-sample-connector/connector/logs"
+	"github.com/acronis/acronis-cyber-cloud-go-sample-connector/external-system/models"
+)
+
+// GetPendingProvisioningRequests returns customers signed up in external-system which are to be provisioned
+// as tenants on Acronis cloud. It implements the optional core.ProvisioningClient interface.
+func (external *SampleExternalSystem) GetPendingProvisioningRequests(limit int) ([]core.ProvisioningRequest, error) {
+	extRequests, err := external.client.GetPendingProvisioningRequests(limit)
+	if err != nil {
+		return nil, err
+	}
+
+	requests := make([]core.ProvisioningRequest, 0, len(extRequests))
+	for i := range extRequests {
+		request, err := convertProvisioningRequest(&extRequests[i])
+		if err != nil {
+			// completed as failed, so that the request isn't returned again and doesn't block the following ones
+			external.rejectProvisioningRequest(extRequests[i].ID, err)
+			continue
+		}
+		requests = append(requests, *request)
+	}
+
+	return requests, nil
+}
+
+// CompleteProvisioningRequest reports the result of provisioning back to external-system
+func (external *SampleExternalSystem) CompleteProvisioningRequest(result *core.ProvisioningResult) error {
+	id, err := strconv.ParseUint(result.RequestID, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid provisioning request id %v: %w", result.RequestID, err)
+	}
+
+	return external.client.CompleteProvisioningRequest(uint(id), &models.ProvisioningResult{
+		ACCTenantID: result.TenantID,
+		ACCUserID:   result.UserID,
+		Error:       result.Error,
+	})
+}
+
+// rejectProvisioningRequest completes the invalid request as failed, it's returned again if completion fails
+func (external *SampleExternalSystem) rejectProvisioningRequest(id uint, err error) {
+	logger := logs.GetDefaultLogger(context.Background())
+	logger.Warnf("Invalid provisioning request %v: %v", id, err)
+	if err := external.client.CompleteProvisioningRequest(id, &models.ProvisioningResult{
+		Error: fmt.Sprintf("invalid provisioning request: %v", err),
+	}); err != nil {
+		logger.Warnf("Failed to complete invalid provisioning request %v: %v", id, err)
+	}
+}
+
+func convertProvisioningRequest(extRequest *models.ProvisioningRequest) (*core.ProvisioningRequest, error) {
+	request := &core.ProvisioningRequest{
+		ID:             strconv.FormatUint(uint64(extRequest.ID), 10),
+		ParentTenantID: extRequest.ParentTenantID,
+		TenantName:     extRequest.TenantName,
+		CustomerID:     extRequest.CustomerID,
+		Language:       extRequest.Language,
+		AdminLogin:     extRequest.AdminLogin,
+		AdminEmail:     extRequest.AdminEmail,
+		AdminFirstname: extRequest.AdminFirstname,
+		AdminLastname:  extRequest.AdminLastname,
+	}
+
+	if len(extRequest.AdminRoles) > 0 {
+		if err := json.Unmarshal(extRequest.AdminRoles, &request.AdminRoles); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(extRequest.OfferingItems) > 0 {
+		var extOIs []models.ProvisioningOfferingItem
+		if err := json.Unmarshal(extRequest.OfferingItems, &extOIs); err != nil {
+			return nil, err
+		}
+
+		enabled := int8(1)
+		for i := range extOIs {
+			oi := accclient.OfferingItemTenantPut{
+				ApplicationID: extOIs[i].ApplicationID,
+				Name:          extOIs[i].Name,
+				Status:        &enabled,
+			}
+			if extOIs[i].Quota != nil {
+				oi.Quota = &accclient.Quota{Value: extOIs[i].Quota}
+			}
+			request.OfferingItems = append(request.OfferingItems, oi)
+		}
+	}
+
+	return request, nil
+}
@@ -20,8 +20,15 @@
 package external
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+
 	"github.com/acronis/acronis-cyber-cloud-go-sample-connector/connector/accclient"
 	"github.com/acronis/acronis-cyber-cloud-go-sample-connector/connector/core"
+	"github.com/acronis/acronis-cyber-cloud-go-sample-connector/connector/logs"
+	"github.com/acronis/acronis-cyber-cloud-go-sample-connector/external-system/models"
 )
 
 // GetActiveTenantIDs returns tenantIDs from external-system
@@ -30,7 +37,7 @@ import (
 // offset and limit are intended to provide simple mechanism for connector to pull tenants in pages.
 // offset indicates starting index of tenants list
 // limit indicates how many tenants to be requested starting from "offset"
-// The function only returns tenantIDs as a slice of strings.
+// The function only returns tenantIDs as a slice of strings, sorted by external-system in ascending order.
 // when number of tenantIDs returned is less than "limit", it indicates no more pages to be requested.
 func (external *SampleExternalSystem) GetActiveTenantIDs(offset, limit int) ([]string, error) {
 	extTenants, err := external.client.GetTenants(offset, limit)
@@ -57,21 +64,21 @@ func (external *SampleExternalSystem) CheckTenantExist(tenantID string) (bool, e
 // offset and limit are intended to provide simple mechanism for connector to pull offering items in pages.
 // offset indicates starting index of offering items list
 // limit indicates how many offering items to be requested starting from "offset"
-// The function only returns pairs of <offeringItemName, tenantID> as a slice of core.OfferingItemID objects
+// The function only returns pairs of <offeringItemName, tenantID> as a slice of core.OfferingItemID objects,
+// sorted by external-system in ascending order of tenantID, then of offeringItemName
 // when number of objects returned is less than "limit", it indicates no more pages to be requested.
 func (external *SampleExternalSystem) GetActiveOfferingItemIDs(offset, limit int) ([]core.OfferingItemID, error) {
-	extOIs, err := external.client.GetOfferingItems(offset, limit)
+	// disabled offering items are filtered by external-system, so that pages are not shortened
+	extOIs, err := external.client.GetActiveOfferingItems(offset, limit)
 	if err != nil {
 		return nil, err
 	}
 
 	OIs := make([]core.OfferingItemID, len(extOIs))
 	for i := range extOIs {
-		if extOIs[i].Status > 0 {
-			OIs = append(OIs, core.OfferingItemID{
-				OfferingItemName: extOIs[i].Name,
-				TenantID:         extOIs[i].TenantID,
-			})
+		OIs[i] = core.OfferingItemID{
+			OfferingItemName: extOIs[i].Name,
+			TenantID:         extOIs[i].TenantID,
 		}
 	}
 	return OIs, nil
@@ -83,7 +90,7 @@ func (external *SampleExternalSystem) GetActiveOfferingItemIDs(offset, limit int
 // offset and limit are intended to provide simple mechanism for connector to pull users in pages.
 // offset indicates starting index of users list
 // limit indicates how many users to be requested starting from "offset"
-// The function only returns userIDs as a slice of strings
+// The function only returns userIDs as a slice of strings, sorted by external-system in ascending order
 // when number of user IDs returned is less than "limit", it indicates no more pages to be requested.
 func (external *SampleExternalSystem) GetActiveUserIDs(offset, limit int) ([]string, error) {
 	extUsers, err := external.client.GetUsers(offset, limit)
@@ -105,7 +112,7 @@ func (external *SampleExternalSystem) GetActiveUserIDs(offset, limit int) ([]str
 // offset and limit are intended to provide simple mechanism for connector to pull access policies in pages.
 // offset indicates starting index of access policies list
 // limit indicates how many access policies to be requested starting from "offset"
-// The function only returns access policy IDs as a slice of strings
+// The function only returns access policy IDs as a slice of strings, sorted by external-system in ascending order
 // when number of access policy IDs returned is less than "limit", it indicates no more pages to be requested.
 func (external *SampleExternalSystem) GetActiveAccessPolicyIDs(offset, limit int) ([]string, error) {
 	extAPs, err := external.client.GetAccessPolicies(offset, limit)
@@ -121,6 +128,97 @@ func (external *SampleExternalSystem) GetActiveAccessPolicyIDs(offset, limit int
 	return apIDs, nil
 }
 
+// GetTenantFingerprints returns fingerprints of tenants from external-system, paged and ordered as GetActiveTenantIDs.
+// It implements core.FingerprintClient, so that connector detects tenants edited directly in external-system.
+func (external *SampleExternalSystem) GetTenantFingerprints(offset, limit int) ([]core.Fingerprint, error) {
+	extTenants, err := external.client.GetTenants(offset, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	fingerprints := make([]core.Fingerprint, len(extTenants))
+	for i := range extTenants {
+		fingerprints[i] = core.TenantFingerprint(&accclient.Tenant{
+			ID:           extTenants[i].IDNo,
+			Version:      extTenants[i].VersionNumber,
+			ParentID:     extTenants[i].ParentID,
+			Name:         extTenants[i].TenantName,
+			Kind:         extTenants[i].Kind,
+			Enabled:      extTenants[i].Enabled,
+			CustomerType: extTenants[i].CustomerType,
+			Language:     extTenants[i].TenantLanguage,
+			PricingMode:  accclient.PricingModeType(extTenants[i].PricingMode),
+		})
+	}
+
+	return fingerprints, nil
+}
+
+// GetUserFingerprints returns fingerprints of users from external-system, paged and ordered as GetActiveUserIDs.
+// It implements core.FingerprintClient, so that connector detects users edited directly in external-system.
+// External-system doesn't keep versions of users, so that only the content of users is compared.
+func (external *SampleExternalSystem) GetUserFingerprints(offset, limit int) ([]core.Fingerprint, error) {
+	extUsers, err := external.client.GetUsers(offset, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	fingerprints := make([]core.Fingerprint, len(extUsers))
+	for i := range extUsers {
+		user := accclient.User{
+			ID:        extUsers[i].ID,
+			TenantID:  extUsers[i].TenantID,
+			Login:     extUsers[i].Login,
+			Activated: extUsers[i].Activated,
+			Enabled:   extUsers[i].Enabled,
+		}
+		if extUsers[i].Contact != "" {
+			// the user is kept in the page, as a shorter page would end paging, so that the invalid contact
+			// is reported as drifted from Acronis cloud instead of failing reconciliation of all users
+			if err := json.Unmarshal([]byte(extUsers[i].Contact), &user.Contact); err != nil {
+				logs.GetDefaultLogger(context.Background()).Warnf("Invalid contact of user %v is not compared: %v", user.ID, err)
+				user.Contact = accclient.Contact{}
+			}
+		}
+		fingerprints[i] = core.UserFingerprint(&user)
+	}
+
+	return fingerprints, nil
+}
+
+// GetUserParents returns users from external-system with their tenant IDs, paged and ordered as GetActiveUserIDs.
+// It implements core.ParentsClient, so that connector repairs users whose tenant doesn't exist in external-system.
+func (external *SampleExternalSystem) GetUserParents(offset, limit int) ([]core.EntityParent, error) {
+	extUsers, err := external.client.GetUsers(offset, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	parents := make([]core.EntityParent, len(extUsers))
+	for i := range extUsers {
+		parents[i] = core.EntityParent{ID: extUsers[i].ID, ParentID: extUsers[i].TenantID}
+	}
+
+	return parents, nil
+}
+
+// GetAccessPolicyParents returns access policies from external-system with their trustee user IDs,
+// paged and ordered as GetActiveAccessPolicyIDs.
+// It implements core.ParentsClient, so that connector repairs access policies whose user doesn't exist in external-system.
+func (external *SampleExternalSystem) GetAccessPolicyParents(offset, limit int) ([]core.EntityParent, error) {
+	extAPs, err := external.client.GetAccessPolicies(offset, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	parents := make([]core.EntityParent, len(extAPs))
+	for i := range extAPs {
+		parents[i] = core.EntityParent{ID: extAPs[i].ID, ParentID: extAPs[i].TrusteeID}
+	}
+
+	return parents, nil
+}
+
 // GetUsages returns usages from external-system
 // These usages will be sync-ed into Acronis cloud, and the returned objects should follow the structure of accclient.Usage
 // offset and limit are intended to provide simple mechanism for connector to pull usages in pages.
@@ -132,6 +230,36 @@ func (external *SampleExternalSystem) GetUsages(offset, limit int) ([]accclient.
 		return nil, err
 	}
 
+	return toACCUsages(extUsage), nil
+}
+
+// GetUsagesAfter returns usages from external-system using cursor pagination
+// It implements core.UsageCursorClient, so connector prefers it over GetUsages.
+// The cursor is the ID of the last usage returned in the previous page, usages are ordered by ID
+// so usages inserted during a report cycle are neither skipped nor duplicated.
+func (external *SampleExternalSystem) GetUsagesAfter(after string, limit int) ([]accclient.Usage, string, error) {
+	var afterID uint64
+	if after != "" {
+		var err error
+		if afterID, err = strconv.ParseUint(after, 10, 64); err != nil {
+			return nil, "", fmt.Errorf("invalid usage cursor %q: %v", after, err)
+		}
+	}
+
+	extUsage, err := external.client.GetUsagesAfter(uint(afterID), limit)
+	if err != nil {
+		return nil, "", err
+	}
+
+	nextAfter := ""
+	if len(extUsage) == limit {
+		nextAfter = strconv.FormatUint(uint64(extUsage[len(extUsage)-1].ID), 10)
+	}
+
+	return toACCUsages(extUsage), nextAfter, nil
+}
+
+func toACCUsages(extUsage []models.Usage) []accclient.Usage {
 	accUsage := make([]accclient.Usage, len(extUsage))
 	for i := range extUsage {
 		accUsage[i] = accclient.Usage{
@@ -143,6 +271,5 @@ func (external *SampleExternalSystem) GetUsages(offset, limit int) ([]accclient.
 			UsageValue:   extUsage[i].UsageValue,
 		}
 	}
-
-	return accUsage, nil
+	return accUsage
 }
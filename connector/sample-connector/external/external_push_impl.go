@@ -47,18 +47,26 @@ func NewExternalSystem(client *extclient.Client) core.ExternalSystemClient {
 // it returns a boolean value indicating whether a new tenant object is created on external-system, and error value if any.
 // Failed operation or successful "update" operation on this particular tenant will return false
 func (external *SampleExternalSystem) CreateOrUpdateTenant(tenant *accclient.Tenant) (bool, error) {
+	created, _, err := external.CreateOrUpdateTenantWithCustomerID(tenant)
+	return created, err
+}
+
+// CreateOrUpdateTenantWithCustomerID handles tenant changes from connector like CreateOrUpdateTenant,
+// and returns the customer ID assigned to the tenant by external-system to be written back into Acronis cloud.
+// It implements the optional core.CustomerIDClient interface.
+func (external *SampleExternalSystem) CreateOrUpdateTenantWithCustomerID(tenant *accclient.Tenant) (bool, string, error) {
 	contact, contactErr := json.Marshal(tenant.Contact)
 	if contactErr != nil {
-		return false, fmt.Errorf("failed to process tenant's contact: %v", contactErr)
+		return false, "", fmt.Errorf("failed to process tenant's contact: %v", contactErr)
 	}
 	contacts, contactsErr := json.Marshal(tenant.Contacts)
 	if contactsErr != nil {
-		return false, fmt.Errorf("failed to process tenant contacts: %v", contactsErr)
+		return false, "", fmt.Errorf("failed to process tenant contacts: %v", contactsErr)
 	}
 
 	updateLock, err := json.Marshal(tenant.UpdateLock)
 	if err != nil {
-		return false, fmt.Errorf("failed to process tenant's UpdateLock: %v", err)
+		return false, "", fmt.Errorf("failed to process tenant's UpdateLock: %v", err)
 	}
 
 	externalTenant := models.Tenant{
@@ -87,7 +95,12 @@ func (external *SampleExternalSystem) CreateOrUpdateTenant(tenant *accclient.Ten
 		Contacts:        contacts,
 	}
 
-	return external.client.CreateOrUpdateTenant(&externalTenant)
+	created, err := external.client.CreateOrUpdateTenant(&externalTenant)
+	if err != nil {
+		return false, "", err
+	}
+
+	return created, externalTenant.CustomerID, nil
 }
 
 // DeleteTenant handles tenant deletion from connector.
@@ -20,60 +20,27 @@
 package main
 
 import (
-	"context"
 	"flag"
 	"fmt"
-	"log"
-	"net/http"
 	"os"
-	"os/signal"
-	"syscall"
-
-	"github.com/acronis/acronis-cyber-cloud-go-sample-connector/connector/core/updater"
-	"github.com/acronis/acronis-cyber-cloud-go-sample-connector/connector/logs"
-	"github.com/acronis/acronis-cyber-cloud-go-sample-connector/connector/sample-connector/external"
-	extclient "github.com/acronis/acronis-cyber-cloud-go-sample-connector/external-system/client"
 )
 
 func main() {
-	fmt.Println("Sample Connector")
-
 	configFile := flag.String("config", "config.yaml", "Path to config file")
+	flag.Usage = usage
 	flag.Parse()
 
-	// Init config
-	config := NewDefaultConfig()
-	if err := config.LoadConfigFromFile(*configFile); err != nil {
-		log.Fatalf("Failed to load config with error: %v", err)
-	}
-
-	// Init logger
-	logs.SetupLogrusLogger(&config.UpdaterSettings.LogSettings)
-	ctx := context.Background()
-	ctx = context.WithValue(ctx, logs.ContextID, "init")
-	logger := logs.GetDefaultLogger(ctx)
-
-	logger.Info("Init Complete.")
-
-	// Setup client for external system
-	extClient := extclient.NewClient(http.DefaultClient, config.ExternalSystemURL)
-	externalClient := external.NewExternalSystem(extClient)
-
-	// initialize Updater to pull information from Acronis cloud
-	coreUpdater, err := updater.NewUpdater(config.UpdaterSettings, externalClient)
-	if err != nil {
-		log.Fatalf("Failed to initialize updater: %v", err)
+	// run the connector if no command is given, as before commands were introduced
+	name, args := "run", flag.Args()
+	if len(args) > 0 {
+		name, args = args[0], args[1:]
 	}
 
-	// Run updater
-	if err := coreUpdater.Start(); err != nil {
-		logger.Errorf("Failed to start updater with error: %v", err)
-		os.Exit(1)
+	cmd, ok := findCommand(name)
+	if !ok {
+		fmt.Fprintf(os.Stderr, "Unknown command %q\n\n", name)
+		usage()
+		os.Exit(exitUsage)
 	}
-
-	// wait for kill signal before attempting to gracefully shutdown
-	// the running service
-	interruptChan := make(chan os.Signal, 1)
-	signal.Notify(interruptChan, os.Interrupt, syscall.SIGINT, syscall.SIGTERM)
-	<-interruptChan
+	os.Exit(cmd.run(*configFile, args))
 }
@@ -168,6 +168,68 @@ func TestTenantAndOfferingItems(t *testing.T) {
 	}
 }
 
+func TestModifyTenant(t *testing.T) {
+	if clientID == "" || clientSecret == "" || dcURL == "" {
+		t.Fatal("Please provide clientID, clientSecret and dcURL in tools.go")
+	}
+
+	ctx := context.Background()
+	httpDefaultClient := &http.Client{Timeout: 20 * time.Second}
+	httpClient := getTestHTTPClient(
+		ctx,
+		clientID,
+		clientSecret,
+		dcURL,
+		httpDefaultClient,
+	)
+
+	client := accclient.NewClient(httpClient, dcURL)
+
+	tenantID, err := client.GetRegistrationTenantID(ctx, dcURL, clientID)
+	if err != nil {
+		t.Fatalf("Failed to get tenant ID: %v", err)
+	}
+
+	tenantObj, err := client.CreateTenant(ctx, &accclient.TenantPostRequest{
+		ParentID: tenantID,
+		Kind:     "customer",
+		Name:     getTimestampedName("test"),
+	})
+	if err != nil {
+		t.Fatalf("Failed to create tenant: %v", err)
+	}
+	defer cleanUpTenant(ctx, t, tenantObj.ID, client)
+
+	// the tenant is modified concurrently on the first attempt, the version conflict is retried
+	concurrentName := getTimestampedName("concurrent")
+	newName := getTimestampedName("modified")
+	attempts := 0
+	err = client.ModifyTenant(ctx, tenantObj.ID, func(editTenantReq *accclient.TenantPutRequest) {
+		attempts++
+		if attempts == 1 {
+			concurrentReq := &accclient.TenantPutRequest{Version: editTenantReq.Version, Name: &concurrentName}
+			if err := client.UpdateTenant(ctx, tenantObj.ID, concurrentReq); err != nil {
+				t.Fatalf("Failed to update tenant concurrently: %v", err)
+			}
+		}
+		editTenantReq.Name = &newName
+	})
+	if err != nil {
+		t.Fatalf("Failed to modify tenant: %v", err)
+	}
+	if attempts != 2 {
+		t.Errorf("Expected modification to be retried once after conflict, got %v attempts", attempts)
+	}
+
+	modified, err := client.GetTenant(ctx, tenantObj.ID)
+	if err != nil {
+		t.Fatalf("Failed to get tenant: %v", err)
+	}
+	if modified.Name != newName {
+		t.Errorf("Expected tenant name %v, got %v", newName, modified.Name)
+	}
+}
+
 func cleanUpTenant(ctx context.Context, t *testing.T, tenantID string, client *accclient.Client) {
 	tenantObj, err := client.GetTenant(ctx, tenantID)
 	if err == nil {
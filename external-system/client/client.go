@@ -82,3 +82,8 @@ func (c *Client) doDelete(endpoint string) (*http.Response, error) {
 	url := c.APIURL + endpoint
 	return c.do(http.MethodDelete, url, nil)
 }
+
+func (c *Client) doPut(endpoint string, body interface{}) (*http.Response, error) {
+	url := c.APIURL + endpoint
+	return c.do(http.MethodPut, url, body)
+}
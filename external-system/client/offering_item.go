@@ -80,6 +80,27 @@ func (c *Client) GetOfferingItems(offset, limit int) ([]models.OfferingItem, err
 	return items, nil
 }
 
+// GetActiveOfferingItems gets the list of enabled offering items
+func (c *Client) GetActiveOfferingItems(offset, limit int) ([]models.OfferingItem, error) {
+	apiPath := "/offering_items"
+	apiPath = apiPath + "?active=true&offset=" + strconv.Itoa(offset) + "&limit=" + strconv.Itoa(limit)
+	resp, err := c.doGet(apiPath)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return nil, fmt.Errorf("error status code %v returned by server", resp.StatusCode)
+	}
+
+	var items []models.OfferingItem
+	if err := json.NewDecoder(resp.Body).Decode(&items); err != nil {
+		return nil, err
+	}
+
+	return items, nil
+}
+
 // GetOfferingItem get offeringItem by name
 func (c *Client) GetOfferingItem(tenantID, name string) (*models.OfferingItem, error) {
 	apiPath := "/tenants/" + tenantID + "/offering_items/" + name
@@ -364,7 +364,7 @@ func TestMain(m *testing.M) {
 	}()
 
 	// Cleanup
-	if err := config.DBConn.Migrator().DropTable(&models.OfferingItem{}, &models.Tenant{}, &models.AccessPolicy{}); err != nil {
+	if err := config.DBConn.Migrator().DropTable(&models.OfferingItem{}, &models.Tenant{}, &models.AccessPolicy{}, &models.ProvisioningRequest{}); err != nil {
 		fmt.Println("Cleanup failed")
 		os.Exit(1)
 	}
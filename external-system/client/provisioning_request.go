@@ -0,0 +1,83 @@
+// Copyright (c) 2021 Acronis International GmbH
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/acronis/acronis-cyber-cloud-go-sample-connector/external-system/models"
+)
+
+// CreateProvisioningRequest creates a pending provisioning request in external system
+func (c *Client) CreateProvisioningRequest(request *models.ProvisioningRequest) (*models.ProvisioningRequest, error) {
+	const apiPath = "/provisioning_requests"
+	resp, err := c.doPost(apiPath, request)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return nil, fmt.Errorf("error status code %v returned by server", resp.StatusCode)
+	}
+
+	created := &models.ProvisioningRequest{}
+	if err := json.NewDecoder(resp.Body).Decode(created); err != nil {
+		return nil, err
+	}
+
+	return created, nil
+}
+
+// GetPendingProvisioningRequests gets the list of provisioning requests not yet handled by connector
+func (c *Client) GetPendingProvisioningRequests(limit int) ([]models.ProvisioningRequest, error) {
+	apiPath := "/provisioning_requests?limit=" + strconv.Itoa(limit)
+	resp, err := c.doGet(apiPath)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return nil, fmt.Errorf("error status code %v returned by server", resp.StatusCode)
+	}
+
+	var items []models.ProvisioningRequest
+	if err := json.NewDecoder(resp.Body).Decode(&items); err != nil {
+		return nil, err
+	}
+
+	return items, nil
+}
+
+// CompleteProvisioningRequest reports the result of provisioning request
+func (c *Client) CompleteProvisioningRequest(id uint, result *models.ProvisioningResult) error {
+	apiPath := "/provisioning_requests/" + strconv.FormatUint(uint64(id), 10) + "/result"
+	resp, err := c.doPut(apiPath, result)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return fmt.Errorf("error status code %v returned by server", resp.StatusCode)
+	}
+
+	return nil
+}
@@ -0,0 +1,96 @@
+// Copyright (c) 2021 Acronis International GmbH
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package client
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/acronis/acronis-cyber-cloud-go-sample-connector/external-system/config"
+	"github.com/acronis/acronis-cyber-cloud-go-sample-connector/external-system/models"
+)
+
+func cleanupProvisioningRequests() {
+	config.DBConn.Exec("DELETE FROM provisioning_requests")
+}
+
+func TestClient_ProvisioningRequests(t *testing.T) {
+	client := NewClient(http.DefaultClient, testServerAddr)
+	defer cleanupProvisioningRequests()
+
+	first, err := client.CreateProvisioningRequest(&models.ProvisioningRequest{
+		TenantName: "customer 1",
+		AdminLogin: "admin1",
+		AdminEmail: "admin1@example.com",
+		AdminRoles: []byte(`["company_admin"]`),
+	})
+	if err != nil {
+		t.Fatalf("Client.CreateProvisioningRequest() error = %v", err)
+	}
+	if first.Status != models.ProvisioningStatusPending {
+		t.Errorf("Client.CreateProvisioningRequest() status = %v, want %v", first.Status, models.ProvisioningStatusPending)
+	}
+
+	second, err := client.CreateProvisioningRequest(&models.ProvisioningRequest{TenantName: "customer 2"})
+	if err != nil {
+		t.Fatalf("Client.CreateProvisioningRequest() error = %v", err)
+	}
+
+	if _, err := client.CreateProvisioningRequest(&models.ProvisioningRequest{}); err == nil {
+		t.Errorf("Client.CreateProvisioningRequest() expected error for empty tenant name")
+	}
+
+	pending, err := client.GetPendingProvisioningRequests(10)
+	if err != nil {
+		t.Fatalf("Client.GetPendingProvisioningRequests() error = %v", err)
+	}
+	if len(pending) != 2 || pending[0].ID != first.ID {
+		t.Errorf("Client.GetPendingProvisioningRequests() = %v, want requests %v and %v", pending, first.ID, second.ID)
+	}
+
+	if err := client.CompleteProvisioningRequest(first.ID, &models.ProvisioningResult{
+		ACCTenantID: "t1",
+		ACCUserID:   "u1",
+	}); err != nil {
+		t.Errorf("Client.CompleteProvisioningRequest() error = %v", err)
+	}
+	if err := client.CompleteProvisioningRequest(second.ID, &models.ProvisioningResult{Error: "rejected"}); err != nil {
+		t.Errorf("Client.CompleteProvisioningRequest() error = %v", err)
+	}
+	if err := client.CompleteProvisioningRequest(second.ID+100, &models.ProvisioningResult{}); err == nil {
+		t.Errorf("Client.CompleteProvisioningRequest() expected error for unknown request")
+	}
+
+	pending, err = client.GetPendingProvisioningRequests(10)
+	if err != nil {
+		t.Fatalf("Client.GetPendingProvisioningRequests() error = %v", err)
+	}
+	if len(pending) != 0 {
+		t.Errorf("Client.GetPendingProvisioningRequests() = %v, want no pending requests", len(pending))
+	}
+
+	completed, err := models.GetProvisioningRequest(first.ID)
+	if err != nil {
+		t.Fatalf("models.GetProvisioningRequest() error = %v", err)
+	}
+	if completed.Status != models.ProvisioningStatusCompleted || completed.ACCTenantID != "t1" || completed.ACCUserID != "u1" {
+		t.Errorf("models.GetProvisioningRequest() = %+v, want completed request", completed)
+	}
+}
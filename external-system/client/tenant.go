@@ -22,13 +22,16 @@ package client
 import (
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 	"strconv"
 
 	"github.com/acronis/acronis-cyber-cloud-go-sample-connector/external-system/models"
 )
 
-// CreateOrUpdateTenant creates or updates the tenant in external system
+// CreateOrUpdateTenant creates or updates the tenant in external system.
+// The tenant is updated with the values stored by external system, e.g. the assigned customer ID,
+// unless the server responds without body, e.g. with 204 No Content on update.
 func (c *Client) CreateOrUpdateTenant(tenant *models.Tenant) (bool, error) {
 	const apiPath = "/tenants"
 	resp, err := c.doPost(apiPath, tenant)
@@ -40,6 +43,12 @@ func (c *Client) CreateOrUpdateTenant(tenant *models.Tenant) (bool, error) {
 		return false, fmt.Errorf("error status code %v returned by server", resp.StatusCode)
 	}
 
+	if resp.StatusCode != http.StatusNoContent {
+		if err := json.NewDecoder(resp.Body).Decode(tenant); err != nil && err != io.EOF {
+			return false, err
+		}
+	}
+
 	isCreated := resp.StatusCode == http.StatusCreated
 	return isCreated, nil
 }
@@ -21,6 +21,7 @@ package client
 
 import (
 	"net/http"
+	"net/http/httptest"
 	"strconv"
 	"testing"
 	"time"
@@ -69,12 +70,36 @@ func TestClient_CreateOrUpdateTenant(t *testing.T) {
 			if got != tt.isCreate {
 				t.Errorf("Client.CreateOrUpdateTenant() = %v, want %v", got, tt.isCreate)
 			}
+
+			if tt.args.tenant.CustomerID == "" {
+				t.Errorf("Client.CreateOrUpdateTenant() customer ID is not assigned")
+			}
 		})
 	}
 
 	// test cleanup
 	DeleteMockTenant(client, "t1", t)
 }
+
+func TestClient_CreateOrUpdateTenant_WithoutBody(t *testing.T) {
+	for _, status := range []int{http.StatusNoContent, http.StatusOK} {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(status)
+		}))
+		client := NewClient(http.DefaultClient, server.URL)
+
+		tenant := GetMockTenant("t1")
+		created, err := client.CreateOrUpdateTenant(&tenant)
+		server.Close()
+		if err != nil || created {
+			t.Errorf("Client.CreateOrUpdateTenant() with status %v = %v, %v, want updated tenant", status, created, err)
+		}
+		if tenant.IDNo != "t1" {
+			t.Errorf("Client.CreateOrUpdateTenant() with status %v changed tenant to %+v", status, tenant)
+		}
+	}
+}
+
 func TestClient_DeleteTenant(t *testing.T) {
 	client := NewClient(http.DefaultClient, testServerAddr)
 	CreateMockTenant(client, "t1", t)
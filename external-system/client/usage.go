@@ -21,6 +21,7 @@ package client
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"strconv"
 
@@ -46,6 +47,26 @@ func (c *Client) GetUsages(offset, limit int) ([]models.Usage, error) {
 	return usages, nil
 }
 
+// GetUsagesAfter gets the list of usages with ID greater than afterID, ordered by ID
+func (c *Client) GetUsagesAfter(afterID uint, limit int) ([]models.Usage, error) {
+	apiPath := usagesEndpointBase + "?after=" + strconv.FormatUint(uint64(afterID), 10) + "&limit=" + strconv.Itoa(limit)
+	resp, err := c.doGet(apiPath)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return nil, fmt.Errorf("error status code %v returned by server", resp.StatusCode)
+	}
+
+	var usages []models.Usage
+	if err := json.NewDecoder(resp.Body).Decode(&usages); err != nil {
+		return nil, err
+	}
+
+	return usages, nil
+}
+
 // CreateOrUpdateUsage creates or updates the usage in external system
 func (c *Client) CreateOrUpdateUsage(usage *models.Usage) (bool, error) {
 	resp, err := c.doPost(usagesEndpointBase, *usage)
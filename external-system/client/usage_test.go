@@ -206,3 +206,79 @@ func TestClient_CreateOrUpdateUsage(t *testing.T) {
 		})
 	}
 }
+
+func TestClient_GetUsagesAfter(t *testing.T) {
+	client := NewClient(http.DefaultClient, testServerAddr)
+	config.DBConn.Unscoped().Exec("DELETE FROM usages")
+
+	// init items
+	var usages = []models.Usage{
+		testGenerateUsage(1, perTenant),
+		testGenerateUsage(2, perTenantInfra),
+		testGenerateUsage(3, perResource),
+		testGenerateUsage(4, perResource),
+		testGenerateUsage(5, perResource),
+	}
+	config.DBConn.Create(&usages)
+
+	type args struct {
+		afterID uint
+		limit   int
+	}
+	tests := []struct {
+		name    string
+		args    args
+		want    []models.Usage
+		wantErr bool
+	}{
+		{
+			name: "it gets usages from the beginning when cursor is zero",
+			args: args{
+				afterID: 0,
+				limit:   2,
+			},
+			want: usages[0:2],
+		},
+		{
+			name: "it gets usages after the cursor",
+			args: args{
+				afterID: 2,
+				limit:   2,
+			},
+			want: usages[2:4],
+		},
+		{
+			name: "it gets the last page with fewer items than limit",
+			args: args{
+				afterID: 4,
+				limit:   2,
+			},
+			want: usages[4:],
+		},
+		{
+			name: "it gets no usages after the last one",
+			args: args{
+				afterID: 5,
+				limit:   2,
+			},
+			want: []models.Usage{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := client.GetUsagesAfter(tt.args.afterID, tt.args.limit)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Client.GetUsagesAfter() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("Wrong number of items, got = %v, want %v", len(got), len(tt.want))
+			}
+			for i := range got {
+				if got[i].ID != tt.want[i].ID {
+					t.Errorf("Client.GetUsagesAfter() items[%v].ID = %v, want %v", i, got[i].ID, tt.want[i].ID)
+				}
+			}
+		})
+	}
+}
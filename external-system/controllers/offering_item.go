@@ -35,6 +35,11 @@ func GetOfferingItems(offset, limit int) ([]models.OfferingItem, error) {
 	return models.GetOfferingItems(offset, limit)
 }
 
+// GetActiveOfferingItems function fetches enabled offeringItems
+func GetActiveOfferingItems(offset, limit int) ([]models.OfferingItem, error) {
+	return models.GetActiveOfferingItems(offset, limit)
+}
+
 // DeleteOfferingItemByTenantIDAndName function deletes offeringItem for a tenantID with the given item name
 func DeleteOfferingItemByTenantIDAndName(tenantID, name string) error {
 	return models.DeleteOfferingItemByTenantIDAndName(tenantID, name)
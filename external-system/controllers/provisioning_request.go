@@ -0,0 +1,39 @@
+// Copyright (c) 2021 Acronis International GmbH
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package controllers
+
+import (
+	"github.com/acronis/acronis-cyber-cloud-go-sample-connector/external-system/models"
+)
+
+// GetProvisioningRequests fetches provisioning requests with the status
+func GetProvisioningRequests(status string, limit int) ([]models.ProvisioningRequest, error) {
+	return models.GetProvisioningRequests(status, limit)
+}
+
+// CreateProvisioningRequest creates pending provisioning request
+func CreateProvisioningRequest(request *models.ProvisioningRequest) error {
+	return models.CreateProvisioningRequest(request)
+}
+
+// CompleteProvisioningRequest stores the result of provisioning request
+func CompleteProvisioningRequest(id uint, result *models.ProvisioningResult) (*models.ProvisioningRequest, error) {
+	return models.CompleteProvisioningRequest(id, result)
+}
@@ -26,6 +26,11 @@ func GetUsages(offset, limit int) ([]models.Usage, error) {
 	return models.GetUsages(offset, limit)
 }
 
+// GetUsagesAfter gets list of usages with ID greater than afterID
+func GetUsagesAfter(afterID uint, limit int) ([]models.Usage, error) {
+	return models.GetUsagesAfter(afterID, limit)
+}
+
 // CreateOrUpdateUsage Updates existing user or creates the usage if it doesnt exist
 func CreateOrUpdateUsage(usage *models.Usage) (bool, error) {
 	return models.CreateOrUpdateUsage(usage)
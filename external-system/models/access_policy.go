@@ -46,7 +46,7 @@ type AccessPolicy struct {
 func GetAccessPolicies(offset, limit int) ([]AccessPolicy, error) {
 	accessPolicies := []AccessPolicy{}
 
-	if err := config.DBConn.Limit(limit).Offset(offset).Find(&accessPolicies).Error; err != nil {
+	if err := config.DBConn.Order(`id COLLATE "C"`).Limit(limit).Offset(offset).Find(&accessPolicies).Error; err != nil {
 		return nil, err
 	}
 	return accessPolicies, nil
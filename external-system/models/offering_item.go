@@ -118,6 +118,10 @@ func DeleteOfferingItemByTenantIDAndName(tenantID, name string) error {
 		return tx.Error
 	}
 
+	if tx.RowsAffected == 0 {
+		return errors.New(ErrItemNotFound)
+	}
+
 	if tx.RowsAffected != 1 {
 		return errors.New("failed to delete offering item")
 	}
@@ -128,7 +132,17 @@ func DeleteOfferingItemByTenantIDAndName(tenantID, name string) error {
 // GetOfferingItems function fetches the offering items with limit
 func GetOfferingItems(offset, limit int) ([]OfferingItem, error) {
 	var OfferingItems []OfferingItem
-	if err := config.DBConn.Offset(offset).Limit(limit).Find(&OfferingItems).Error; err != nil {
+	if err := config.DBConn.Order(`tenant_id COLLATE "C", name COLLATE "C"`).Offset(offset).Limit(limit).Find(&OfferingItems).Error; err != nil {
+		return nil, err
+	}
+
+	return OfferingItems, nil
+}
+
+// GetActiveOfferingItems function fetches the enabled offering items with limit
+func GetActiveOfferingItems(offset, limit int) ([]OfferingItem, error) {
+	var OfferingItems []OfferingItem
+	if err := config.DBConn.Where("status > 0").Order(`tenant_id COLLATE "C", name COLLATE "C"`).Offset(offset).Limit(limit).Find(&OfferingItems).Error; err != nil {
 		return nil, err
 	}
 
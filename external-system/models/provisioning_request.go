@@ -0,0 +1,125 @@
+// Copyright (c) 2021 Acronis International GmbH
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package models
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/datatypes"
+
+	"github.com/acronis/acronis-cyber-cloud-go-sample-connector/external-system/config"
+)
+
+// Statuses of provisioning request
+const (
+	ProvisioningStatusPending   = "pending"
+	ProvisioningStatusCompleted = "completed"
+	ProvisioningStatusFailed    = "failed"
+)
+
+// ProvisioningRequest orm model, describes a customer signed up in the portal
+// to be provisioned as tenant and admin user in Acronis cloud
+type ProvisioningRequest struct {
+	ID             uint           `json:"id" gorm:"primaryKey"`
+	CreatedAt      time.Time      `json:"createdAt"`
+	UpdatedAt      time.Time      `json:"updatedAt"`
+	Status         string         `json:"status" gorm:"index"`
+	ParentTenantID string         `json:"parentTenantId"`
+	TenantName     string         `json:"tenantName"`
+	CustomerID     string         `json:"customerId"`
+	Language       string         `json:"language"`
+	AdminLogin     string         `json:"adminLogin"`
+	AdminEmail     string         `json:"adminEmail"`
+	AdminFirstname string         `json:"adminFirstname"`
+	AdminLastname  string         `json:"adminLastname"`
+	AdminRoles     datatypes.JSON `json:"adminRoles" description:"List of roles granted to the admin user"`
+	OfferingItems  datatypes.JSON `json:"offeringItems" description:"List of offering items enabled on the tenant"`
+	ACCTenantID    string         `json:"accTenantId"`
+	ACCUserID      string         `json:"accUserId"`
+	Error          string         `json:"error"`
+}
+
+// ProvisioningOfferingItem is an item of ProvisioningRequest.OfferingItems
+type ProvisioningOfferingItem struct {
+	ApplicationID string   `json:"applicationId"`
+	Name          string   `json:"name"`
+	Quota         *float64 `json:"quota,omitempty"`
+}
+
+// ProvisioningResult is the outcome of provisioning request reported by connector
+type ProvisioningResult struct {
+	ACCTenantID string `json:"accTenantId"`
+	ACCUserID   string `json:"accUserId"`
+	Error       string `json:"error"`
+}
+
+// GetProvisioningRequests gets list of provisioning requests with the status from db, ordered by ID
+func GetProvisioningRequests(status string, limit int) ([]ProvisioningRequest, error) {
+	requests := make([]ProvisioningRequest, 0, limit)
+	if err := config.DBConn.Where("status = ?", status).Order("id").Limit(limit).Find(&requests).Error; err != nil {
+		return nil, err
+	}
+	return requests, nil
+}
+
+// GetProvisioningRequest gets single provisioning request by id
+func GetProvisioningRequest(id uint) (*ProvisioningRequest, error) {
+	var request ProvisioningRequest
+	if err := config.DBConn.Find(&request, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	if request.ID != id {
+		return nil, errors.New(ErrItemNotFound)
+	}
+	return &request, nil
+}
+
+// CreateProvisioningRequest creates pending provisioning request in db
+func CreateProvisioningRequest(request *ProvisioningRequest) error {
+	request.ID = 0
+	request.Status = ProvisioningStatusPending
+	request.ACCTenantID = ""
+	request.ACCUserID = ""
+	request.Error = ""
+	return config.DBConn.Create(request).Error
+}
+
+// CompleteProvisioningRequest stores the result of provisioning request in db,
+// the request is failed if the result has an error
+func CompleteProvisioningRequest(id uint, result *ProvisioningResult) (*ProvisioningRequest, error) {
+	request, err := GetProvisioningRequest(id)
+	if err != nil {
+		return nil, err
+	}
+
+	request.Status = ProvisioningStatusCompleted
+	if result.Error != "" {
+		request.Status = ProvisioningStatusFailed
+	}
+	request.ACCTenantID = result.ACCTenantID
+	request.ACCUserID = result.ACCUserID
+	request.Error = result.Error
+
+	if err := config.DBConn.Save(request).Error; err != nil {
+		return nil, err
+	}
+	return request, nil
+}
@@ -22,6 +22,7 @@ package models
 
 import (
 	"errors"
+	"strings"
 	"time"
 
 	"gorm.io/datatypes"
@@ -60,7 +61,7 @@ type Tenant struct {
 func GetTenants(offset, limit int) ([]Tenant, error) {
 	tenants := []Tenant{}
 
-	if err := config.DBConn.Limit(limit).Offset(offset).Find(&tenants).Error; err != nil {
+	if err := config.DBConn.Order(`id_no COLLATE "C"`).Limit(limit).Offset(offset).Find(&tenants).Error; err != nil {
 		return nil, err
 	}
 	return tenants, nil
@@ -82,18 +83,35 @@ func GetTenant(tenantID string) (*Tenant, error) {
 }
 
 // Create or Update tenant based on tenant existence
+// Customer ID is assigned on creation if not provided, and kept on update if not provided.
 func CreateOrUpdate(tenant *Tenant) (bool, error) {
 	isCreated := false
-	_, err := GetTenant(tenant.IDNo)
+	existing, err := GetTenant(tenant.IDNo)
 	if err != nil && err.Error() != ErrItemNotFound {
 		return isCreated, err
 	} else if err != nil && err.Error() == ErrItemNotFound {
 		isCreated = true
 	}
 
+	if tenant.CustomerID == "" {
+		tenant.CustomerID = existing.CustomerID
+	}
+	if tenant.CustomerID == "" {
+		tenant.CustomerID = newCustomerID(tenant.IDNo)
+	}
+
 	return isCreated, config.DBConn.Save(&tenant).Error
 }
 
+// newCustomerID generates billing account number of the sample external system for the tenant
+func newCustomerID(tenantID string) string {
+	id := strings.ToUpper(strings.Replace(tenantID, "-", "", -1))
+	if len(id) > 12 {
+		id = id[:12]
+	}
+	return "ACC-" + id
+}
+
 // Delete tenant object based on tenant Id
 func DeleteTenant(id string) error {
 	tenant := &Tenant{IDNo: id}
@@ -37,7 +37,17 @@ type Usage struct {
 // GetUsages gets list of usages from db
 func GetUsages(offset, limit int) ([]Usage, error) {
 	usages := make([]Usage, 0, limit)
-	if err := config.DBConn.Limit(limit).Offset(offset).Find(&usages).Error; err != nil {
+	if err := config.DBConn.Order("id").Limit(limit).Offset(offset).Find(&usages).Error; err != nil {
+		return nil, err
+	}
+	return usages, nil
+}
+
+// GetUsagesAfter gets list of usages from db with ID greater than afterID, ordered by ID.
+// It allows keyset pagination which is stable when usages are inserted between the calls.
+func GetUsagesAfter(afterID uint, limit int) ([]Usage, error) {
+	usages := make([]Usage, 0, limit)
+	if err := config.DBConn.Where("id > ?", afterID).Order("id").Limit(limit).Find(&usages).Error; err != nil {
 		return nil, err
 	}
 	return usages, nil
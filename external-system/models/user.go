@@ -64,7 +64,7 @@ func CreateOrUpdateUser(user *User) (bool, error) {
 // GetUsers gets list of users from db
 func GetUsers(offset, limit int) ([]User, error) {
 	users := make([]User, 0, limit)
-	if err := config.DBConn.Limit(limit).Offset(offset).Find(&users).Error; err != nil {
+	if err := config.DBConn.Order(`id COLLATE "C"`).Limit(limit).Offset(offset).Find(&users).Error; err != nil {
 		return nil, err
 	}
 	return users, nil
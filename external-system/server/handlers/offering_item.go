@@ -54,7 +54,7 @@ func CreateOrUpdateOfferingItem(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-// GetOfferingItems function handler for get offering items
+// GetOfferingItems function handler for get offering items, only enabled items are returned if "active=true" is set
 func GetOfferingItems(w http.ResponseWriter, r *http.Request) {
 	limit, err := getOptionalIntQueryParam(r, "limit")
 	if err != nil {
@@ -70,7 +70,12 @@ func GetOfferingItems(w http.ResponseWriter, r *http.Request) {
 		respondWithError(w, http.StatusBadRequest, err.Error())
 	}
 
-	offeringItems, err := controllers.GetOfferingItems(offset, limit)
+	getOfferingItems := controllers.GetOfferingItems
+	if r.URL.Query().Get("active") == "true" {
+		getOfferingItems = controllers.GetActiveOfferingItems
+	}
+
+	offeringItems, err := getOfferingItems(offset, limit)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, err.Error())
 		return
@@ -100,7 +105,8 @@ func DeleteOfferingItem(w http.ResponseWriter, r *http.Request) {
 	tenantID := vars["tenant_id"]
 
 	err := controllers.DeleteOfferingItemByTenantIDAndName(tenantID, name)
-	if err != nil {
+	// deletion is idempotent, offering item which doesn't exist is already deleted
+	if err != nil && err.Error() != models.ErrItemNotFound {
 		respondWithError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
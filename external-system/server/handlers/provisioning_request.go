@@ -0,0 +1,105 @@
+// Copyright (c) 2021 Acronis International GmbH
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+
+	"github.com/acronis/acronis-cyber-cloud-go-sample-connector/external-system/controllers"
+	"github.com/acronis/acronis-cyber-cloud-go-sample-connector/external-system/models"
+)
+
+// FetchProvisioningRequests handles GET /provisioning_requests route
+// Requests are filtered by "status" query param, pending requests are returned by default.
+func FetchProvisioningRequests(w http.ResponseWriter, r *http.Request) {
+	limit, err := getOptionalIntQueryParam(r, "limit")
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if limit == 0 {
+		limit = DefaultLimitValue
+	}
+
+	status := r.FormValue("status")
+	if status == "" {
+		status = models.ProvisioningStatusPending
+	}
+
+	requests, err := controllers.GetProvisioningRequests(status, limit)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	respondWithJSON(w, http.StatusOK, requests)
+}
+
+// CreateProvisioningRequest handles POST /provisioning_requests route, e.g. when a customer signs up in the portal
+func CreateProvisioningRequest(w http.ResponseWriter, r *http.Request) {
+	var request models.ProvisioningRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	defer r.Body.Close()
+
+	if request.TenantName == "" {
+		respondWithError(w, http.StatusBadRequest, "tenantName is required")
+		return
+	}
+
+	if err := controllers.CreateProvisioningRequest(&request); err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	respondWithJSON(w, http.StatusCreated, request)
+}
+
+// CompleteProvisioningRequest handles PUT /provisioning_requests/{id}/result route
+func CompleteProvisioningRequest(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var result models.ProvisioningResult
+	if err := json.NewDecoder(r.Body).Decode(&result); err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	defer r.Body.Close()
+
+	request, err := controllers.CompleteProvisioningRequest(uint(id), &result)
+	if err != nil {
+		if err.Error() == models.ErrItemNotFound {
+			respondWithError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	respondWithJSON(w, http.StatusOK, request)
+}
@@ -85,10 +85,11 @@ func CreateOrUpdateTenant(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// respond with the stored tenant, holding the assigned customer ID
 	if isCreated {
-		respondWithJSON(w, http.StatusCreated, nil)
+		respondWithJSON(w, http.StatusCreated, tenant)
 	} else {
-		respondWithJSON(w, http.StatusNoContent, nil)
+		respondWithJSON(w, http.StatusOK, tenant)
 	}
 }
 
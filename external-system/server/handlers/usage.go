@@ -29,6 +29,8 @@ import (
 )
 
 // FetchUsages handles GET /usages route
+// If "after" query param is provided, usages with ID greater than its value are returned (keyset pagination),
+// otherwise "offset" is used.
 func FetchUsages(w http.ResponseWriter, r *http.Request) {
 	offset, _ := strconv.Atoi(r.FormValue("offset"))
 	limit, _ := strconv.Atoi(r.FormValue("limit"))
@@ -37,7 +39,18 @@ func FetchUsages(w http.ResponseWriter, r *http.Request) {
 		limit = DefaultLimitValue
 	}
 
-	usages, err := controllers.GetUsages(offset, limit)
+	var usages []models.Usage
+	var err error
+	if after := r.FormValue("after"); after != "" {
+		afterID, parseErr := strconv.ParseUint(after, 10, 64)
+		if parseErr != nil {
+			respondWithError(w, http.StatusBadRequest, parseErr.Error())
+			return
+		}
+		usages, err = controllers.GetUsagesAfter(uint(afterID), limit)
+	} else {
+		usages, err = controllers.GetUsages(offset, limit)
+	}
 
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, err.Error())
@@ -54,6 +54,7 @@ func (app *App) initializeRoutes(appConfig *config.Config) error {
 	app.initializeOfferingItemsRoutes()
 	app.initializeUsageRoutes()
 	app.initializeAccessPolicyRoutes()
+	app.initializeProvisioningRoutes()
 
 	if appConfig.AuthSettings.Enabled {
 		// Auth routes
@@ -111,3 +112,9 @@ func (app *App) initializeUsageRoutes() {
 	app.Router.HandleFunc("/usages", handlers.FetchUsages).Methods(http.MethodGet)
 	app.Router.HandleFunc("/usages", handlers.CreateOrUpdateUsage).Methods(http.MethodPost)
 }
+
+func (app *App) initializeProvisioningRoutes() {
+	app.Router.HandleFunc("/provisioning_requests", handlers.FetchProvisioningRequests).Methods(http.MethodGet)
+	app.Router.HandleFunc("/provisioning_requests", handlers.CreateProvisioningRequest).Methods(http.MethodPost)
+	app.Router.HandleFunc("/provisioning_requests/{id}/result", handlers.CompleteProvisioningRequest).Methods(http.MethodPut)
+}
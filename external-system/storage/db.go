@@ -51,7 +51,8 @@ func SetupDB(dbConfig *config.Config) {
 		&models.Tenant{},
 		&models.OfferingItem{},
 		&models.AccessPolicy{},
-		&models.Usage{}); migrateErr != nil {
+		&models.Usage{},
+		&models.ProvisioningRequest{}); migrateErr != nil {
 		log.Fatal(migrateErr)
 	}
 